@@ -2,52 +2,78 @@ package cardatatransfer
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"sync"
+	"time"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-graphsync/storeutil"
 	logging "github.com/ipfs/go-log/v2"
+	"github.com/ipfs/go-unixfsnode"
 	"github.com/ipld/go-ipld-prime"
 	"github.com/ipld/go-ipld-prime/codec/dagcbor"
-	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
 	peer "github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multicodec"
 	"github.com/multiformats/go-multihash"
 
 	"github.com/filecoin-project/index-provider/cardatatransfer/stores"
+	"github.com/filecoin-project/index-provider/commp"
 	"github.com/filecoin-project/index-provider/metadata"
+	"github.com/filecoin-project/index-provider/metrics"
 	"github.com/filecoin-project/index-provider/supplier"
 )
 
 var log = logging.Logger("car-data-transfer")
 
-var allSelectorBytes []byte
-
-func init() {
-	buf := new(bytes.Buffer)
-	_ = dagcbor.Encode(selectorparse.CommonSelector_ExploreAllRecursively, buf)
-	allSelectorBytes = buf.Bytes()
-}
-
 type BlockStoreSupplier interface {
 	ReadOnlyBlockstore(contextID []byte) (supplier.ClosableBlockstore, error)
 }
 
+// PieceResolver resolves the CID of a piece commitment to the context ID of the content it holds.
+// A BlockStoreSupplier that also implements PieceResolver accepts retrieval proposals that
+// reference the real piece CID of the content, as advertised via TransportFromPieceCID.
+type PieceResolver interface {
+	ContextIDForPiece(pieceCid cid.Cid) ([]byte, error)
+}
+
 type carDataTransfer struct {
 	dt       datatransfer.Manager
 	supplier BlockStoreSupplier
 	stores   *stores.ReadOnlyBlockstores
+	opts     *options
+
+	// lock guards the transfers that are in progress, tracked in order to limit their concurrency.
+	lock    sync.Mutex
+	active  map[string]activeTransfer
+	perPeer map[peer.ID]int
+}
+
+// activeTransfer is an accepted transfer that has not yet terminated.
+type activeTransfer struct {
+	receiver peer.ID
+	start    time.Time
 }
 
-func StartCarDataTransfer(dt datatransfer.Manager, supplier BlockStoreSupplier) error {
+// StartCarDataTransfer registers the handling of retrieval requests with DealProposal vouchers
+// with the given data transfer manager, serving the content of the blockstores provided by the
+// given supplier.
+func StartCarDataTransfer(dt datatransfer.Manager, supplier BlockStoreSupplier, o ...Option) error {
+	opts, err := newOptions(o...)
+	if err != nil {
+		return err
+	}
 	cdt := &carDataTransfer{
 		dt:       dt,
 		supplier: supplier,
 		stores:   stores.NewReadOnlyBlockstores(),
+		opts:     opts,
+		active:   make(map[string]activeTransfer),
+		perPeer:  make(map[peer.ID]int),
 	}
-	err := dt.RegisterVoucherType(&DealProposal{}, cdt)
+	err = dt.RegisterVoucherType(&DealProposal{}, cdt)
 	if err != nil {
 		return err
 	}
@@ -80,6 +106,22 @@ func TransportFromContextID(contextID []byte) (metadata.Protocol, error) {
 	}, nil
 }
 
+// TransportFromPieceCID instantiates the metadata that advertises retrieval via graphsync of the
+// piece with the given CID, i.e. the CID of the piece commitment computed by commp.
+//
+// The piece CID must be resolvable to its context ID by the supplier passed to
+// StartCarDataTransfer, which therefore must implement PieceResolver.
+func TransportFromPieceCID(pieceCid cid.Cid) (metadata.Protocol, error) {
+	if !commp.IsPieceCID(pieceCid) {
+		return nil, fmt.Errorf("not a piece commitment CID: %s", pieceCid)
+	}
+	return &metadata.GraphsyncFilecoinV1{
+		PieceCID:      pieceCid,
+		VerifiedDeal:  true,
+		FastRetrieval: true,
+	}, nil
+}
+
 // ValidatePush validates a push request received from the peer that will send data
 func (cdt *carDataTransfer) ValidatePush(isRestart bool, _ datatransfer.ChannelID, sender peer.ID, voucher datatransfer.Voucher, baseCid cid.Cid, selector ipld.Node) (datatransfer.VoucherResult, error) {
 	return nil, errors.New("no pushes accepted")
@@ -97,28 +139,49 @@ func (cdt *carDataTransfer) ValidatePull(isRestart bool, _ datatransfer.ChannelI
 		return nil, errors.New("incorrect CID for this proposal")
 	}
 
-	// Check the proposal selector matches
+	// Check the selector matches the proposal, if the proposal specifies one. Otherwise, any
+	// selector is accepted as long as it is bounded by the configured limits.
 	buf := new(bytes.Buffer)
 	err := dagcbor.Encode(selector, buf)
 	if err != nil {
 		return nil, err
 	}
-	bytesCompare := allSelectorBytes
-	if proposal.SelectorSpecified() {
-		bytesCompare = proposal.Selector.Raw
-	}
-	if !bytes.Equal(buf.Bytes(), bytesCompare) {
+	if proposal.SelectorSpecified() && !bytes.Equal(buf.Bytes(), proposal.Selector.Raw) {
 		return nil, errors.New("incorrect selector for this proposal")
 	}
 
+	// Check the selector is bounded by the configured limits
+	if err := cdt.opts.validateSelector(selector, buf.Len()); err != nil {
+		metrics.Retrieval.Transfers.Add(context.Background(), 1, metrics.Attributes.StatusRejected)
+		return &DealResponse{
+			ID:      proposal.ID,
+			Status:  DealStatusRejected,
+			Message: err.Error(),
+		}, err
+	}
+
+	providerDealID := ProviderDealID{DealID: proposal.ID, Receiver: receiver}
+
 	// If the validation is for a restart request, return nil, which means
-	// the data-transfer should not be explicitly paused or resumed
+	// the data-transfer should not be explicitly paused or resumed. Restarted transfers that are
+	// no longer tracked, e.g. after the provider restarted, are accepted as new ones are, so that
+	// they count towards the concurrency limits.
 	if isRestart {
+		if cdt.isActive(providerDealID) {
+			return nil, nil
+		}
+		status, err := cdt.attemptAcceptDeal(providerDealID, proposal)
+		if err != nil {
+			return &DealResponse{
+				ID:      proposal.ID,
+				Status:  status,
+				Message: err.Error(),
+			}, err
+		}
 		return nil, nil
 	}
 
 	// attempt to setup the deal
-	providerDealID := ProviderDealID{DealID: proposal.ID, Receiver: receiver}
 
 	status, err := cdt.attemptAcceptDeal(providerDealID, proposal)
 
@@ -135,33 +198,112 @@ func (cdt *carDataTransfer) ValidatePull(isRestart bool, _ datatransfer.ChannelI
 }
 
 func (cdt *carDataTransfer) attemptAcceptDeal(providerDealID ProviderDealID, proposal *DealProposal) (DealStatus, error) {
+	ctx := context.Background()
 	if proposal.PieceCID == nil {
+		metrics.Retrieval.Transfers.Add(ctx, 1, metrics.Attributes.StatusFailure)
 		return DealStatusErrored, errors.New("must specific piece CID")
 	}
 
-	// get contextID
-	prefix := proposal.PieceCID.Prefix()
-	if prefix.Codec != uint64(multicodec.TransportGraphsyncFilecoinv1) {
-		return DealStatusErrored, errors.New("incorrect Piece CID codec")
-	}
-	if prefix.MhType != multihash.IDENTITY {
-		return DealStatusErrored, errors.New("piece CID must be an identity CI")
-	}
-	dmh, err := multihash.Decode(proposal.PieceCID.Hash())
+	contextID, err := cdt.contextIDFromPieceCID(*proposal.PieceCID)
 	if err != nil {
-		return DealStatusErrored, errors.New("unable to decode piece CID")
+		metrics.Retrieval.Transfers.Add(ctx, 1, metrics.Attributes.StatusFailure)
+		return DealStatusErrored, err
+	}
+
+	// reserve a transfer slot before opening the blockstore, so that rejected deals are cheap
+	if err := cdt.reserve(providerDealID); err != nil {
+		metrics.Retrieval.Transfers.Add(ctx, 1, metrics.Attributes.StatusRejected)
+		return DealStatusRejected, err
 	}
-	contextID := dmh.Digest
 
 	// read blockstore from supplier
 	bs, err := cdt.supplier.ReadOnlyBlockstore(contextID)
 	if err != nil {
+		cdt.release(providerDealID.String())
+		metrics.Retrieval.Transfers.Add(ctx, 1, metrics.Attributes.StatusFailure)
 		return DealStatusErrored, fmt.Errorf("error reading blockstore: %w", err)
 	}
 	cdt.stores.Track(providerDealID.String(), bs)
+	metrics.Retrieval.ActiveTransfers.Add(ctx, 1)
 	return DealStatusAccepted, nil
 }
 
+// reserve tracks the given deal as an active transfer, unless the maximum number of concurrent
+// transfers is reached in total or for the receiving peer.
+func (cdt *carDataTransfer) reserve(providerDealID ProviderDealID) error {
+	cdt.lock.Lock()
+	defer cdt.lock.Unlock()
+
+	key := providerDealID.String()
+	if _, ok := cdt.active[key]; ok {
+		return fmt.Errorf("transfer already in progress for deal %d", providerDealID.DealID)
+	}
+	if max := cdt.opts.maxConcurrentTransfers; max > 0 && len(cdt.active) >= max {
+		return fmt.Errorf("too many concurrent transfers: maximum of %d reached", max)
+	}
+	if max := cdt.opts.maxConcurrentTransfersPerPeer; max > 0 && cdt.perPeer[providerDealID.Receiver] >= max {
+		return fmt.Errorf("too many concurrent transfers to peer: maximum of %d reached", max)
+	}
+	cdt.active[key] = activeTransfer{receiver: providerDealID.Receiver, start: time.Now()}
+	cdt.perPeer[providerDealID.Receiver]++
+	return nil
+}
+
+// isActive checks whether the given deal is tracked as an active transfer.
+func (cdt *carDataTransfer) isActive(providerDealID ProviderDealID) bool {
+	cdt.lock.Lock()
+	defer cdt.lock.Unlock()
+	_, ok := cdt.active[providerDealID.String()]
+	return ok
+}
+
+// release stops tracking the active transfer with the given key, and returns it if it was tracked.
+func (cdt *carDataTransfer) release(key string) (activeTransfer, bool) {
+	cdt.lock.Lock()
+	defer cdt.lock.Unlock()
+
+	transfer, ok := cdt.active[key]
+	if !ok {
+		return activeTransfer{}, false
+	}
+	delete(cdt.active, key)
+	if cdt.perPeer[transfer.receiver] <= 1 {
+		delete(cdt.perPeer, transfer.receiver)
+	} else {
+		cdt.perPeer[transfer.receiver]--
+	}
+	return transfer, true
+}
+
+// contextIDFromPieceCID returns the context ID referenced by the given piece CID, which is either
+// the CID of a piece commitment, or an identity CID that holds the context ID itself.
+func (cdt *carDataTransfer) contextIDFromPieceCID(pieceCid cid.Cid) ([]byte, error) {
+	if commp.IsPieceCID(pieceCid) {
+		resolver, ok := cdt.supplier.(PieceResolver)
+		if !ok {
+			return nil, errors.New("piece CIDs of piece commitments are not supported")
+		}
+		contextID, err := resolver.ContextIDForPiece(pieceCid)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving piece CID: %w", err)
+		}
+		return contextID, nil
+	}
+
+	prefix := pieceCid.Prefix()
+	if prefix.Codec != uint64(multicodec.TransportGraphsyncFilecoinv1) {
+		return nil, errors.New("incorrect Piece CID codec")
+	}
+	if prefix.MhType != multihash.IDENTITY {
+		return nil, errors.New("piece CID must be an identity CI")
+	}
+	dmh, err := multihash.Decode(pieceCid.Hash())
+	if err != nil {
+		return nil, errors.New("unable to decode piece CID")
+	}
+	return dmh.Digest, nil
+}
+
 func checkTermination(event datatransfer.Event, channelState datatransfer.ChannelState) bool {
 	return channelState.Status() == datatransfer.Completed ||
 		event.Code == datatransfer.Disconnected ||
@@ -179,11 +321,28 @@ func (cdt *carDataTransfer) eventListener(event datatransfer.Event, channelState
 	providerDealID := ProviderDealID{DealID: dealProposal.ID, Receiver: channelState.Recipient()}
 
 	if checkTermination(event, channelState) {
-		err := cdt.stores.Untrack(providerDealID.String())
+		key := providerDealID.String()
+		err := cdt.stores.Untrack(key)
 		if err != nil {
 			log.Errorf("termination error: %s", err)
 		}
+		// Termination may be signalled by more than one event; record metrics only once.
+		if transfer, ok := cdt.release(key); ok {
+			recordTermination(transfer, channelState)
+		}
+	}
+}
+
+func recordTermination(transfer activeTransfer, channelState datatransfer.ChannelState) {
+	ctx := context.Background()
+	attr := metrics.Attributes.StatusSuccess
+	if channelState.Status() != datatransfer.Completed {
+		attr = metrics.Attributes.StatusFailure
 	}
+	metrics.Retrieval.ActiveTransfers.Add(ctx, -1)
+	metrics.Retrieval.Transfers.Add(ctx, 1, attr)
+	metrics.Retrieval.BytesSent.Add(ctx, int64(channelState.Sent()))
+	metrics.Retrieval.TransferDuration.Record(ctx, time.Since(transfer.start).Milliseconds(), attr)
 }
 
 // StoreConfigurableTransport defines the methods needed to
@@ -210,7 +369,10 @@ func (ctd *carDataTransfer) transportConfigurer(channelID datatransfer.ChannelID
 	if store == nil {
 		return
 	}
-	err = gsTransport.UseStore(channelID, storeutil.LinkSystemForBlockstore(store))
+	// Support selectors that traverse UnixFS paths or interpret nodes as UnixFS.
+	lsys := storeutil.LinkSystemForBlockstore(store)
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	err = gsTransport.UseStore(channelID, lsys)
 	if err != nil {
 		log.Errorf("attempting to configure data store: %s", err)
 	}
@@ -7,14 +7,20 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
+	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
 	"github.com/ipfs/go-graphsync/storeutil"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipfs/go-unixfsnode"
+	unixfsbuilder "github.com/ipfs/go-unixfsnode/data/builder"
 	dagpb "github.com/ipld/go-codec-dagpb"
 	"github.com/ipld/go-ipld-prime"
 	"github.com/ipld/go-ipld-prime/codec/dagcbor"
@@ -26,12 +32,14 @@ import (
 	"github.com/ipld/go-ipld-prime/traversal/selector"
 	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
 	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+	"github.com/libp2p/go-libp2p/core/host"
 	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
 	"github.com/stretchr/testify/require"
 	cbg "github.com/whyrusleeping/cbor-gen"
 
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/index-provider/cardatatransfer"
+	"github.com/filecoin-project/index-provider/commp"
 	"github.com/filecoin-project/index-provider/metadata"
 	"github.com/filecoin-project/index-provider/supplier"
 	"github.com/filecoin-project/index-provider/testutil"
@@ -56,9 +64,23 @@ func TestCarDataTransfer(t *testing.T) {
 	missingCid := testutil.RandomCids(t, rng, 1)[0]
 	missingContextID := []byte("notFound")
 
-	supplier := &fakeSupplier{blockstores: make(map[string]supplier.ClosableBlockstore)}
+	// Blockstores are closed once transferred; open another one to retrieve by piece commitment.
+	contextID3 := []byte("fish")
+	rdOnlyBS3 := testutil.OpenSampleCar(t, "sample-v1-2.car")
+
+	realPieceCID3, _, err := commp.FromReader(bytes.NewReader([]byte("fish")))
+	require.NoError(t, err)
+	unknownRealPieceCID, _, err := commp.FromReader(bytes.NewReader([]byte("lobster")))
+	require.NoError(t, err)
+
+	supplier := &fakeSupplier{
+		blockstores: make(map[string]supplier.ClosableBlockstore),
+		pieces:      make(map[cid.Cid][]byte),
+	}
 	supplier.blockstores[string(contextID1)] = rdOnlyBS1
 	supplier.blockstores[string(contextID2)] = rdOnlyBS2
+	supplier.blockstores[string(contextID3)] = rdOnlyBS3
+	supplier.pieces[realPieceCID3] = contextID3
 
 	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
 
@@ -118,6 +140,32 @@ func TestCarDataTransfer(t *testing.T) {
 			expectSuccess:            true,
 			expectedBlockstoreResult: partialBs,
 		},
+		"select all by piece commitment": {
+			voucher: &cardatatransfer.DealProposal{
+				PayloadCID: roots1[0],
+				ID:         6,
+				Params: cardatatransfer.Params{
+					PieceCID: &realPieceCID3,
+				},
+			},
+			root:                     roots1[0],
+			selector:                 selectorparse.CommonSelector_ExploreAllRecursively,
+			expectSuccess:            true,
+			expectedBlockstoreResult: rdOnlyBS3,
+		},
+		"unknown piece commitment": {
+			voucher: &cardatatransfer.DealProposal{
+				PayloadCID: roots1[0],
+				ID:         7,
+				Params: cardatatransfer.Params{
+					PieceCID: &unknownRealPieceCID,
+				},
+			},
+			root:          roots1[0],
+			selector:      selectorparse.CommonSelector_ExploreAllRecursively,
+			expectSuccess: false,
+			expectMessage: "error resolving piece CID: Not found!",
+		},
 		"no blockstore for context ID": {
 			voucher: &cardatatransfer.DealProposal{
 				PayloadCID: missingCid,
@@ -220,8 +268,199 @@ func TestCarDataTransfer(t *testing.T) {
 	}
 }
 
+func TestCarDataTransferBoundedSelectors(t *testing.T) {
+	root, contentBs := buildUnixFSDirectory(t)
+	contextID := []byte("fish")
+	pieceCID := pieceCIDFromContextID(t, contextID)
+	supplier := &fakeSupplier{
+		blockstores: map[string]supplier.ClosableBlockstore{string(contextID): nopCloser{contentBs}},
+	}
+
+	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	depthSelector := func(depth int64) ipld.Node {
+		return ssb.ExploreRecursive(selector.RecursionLimitDepth(depth), ssb.ExploreAll(ssb.ExploreRecursiveEdge())).Node()
+	}
+	pathSelector := unixfsnode.UnixFSPathSelector("sub/b.txt")
+
+	// The depth limits of nested recursions multiply, since the inner recursion applies at each
+	// level of the outer one.
+	nestedSelector := ssb.ExploreRecursive(selector.RecursionLimitDepth(2), ssb.ExploreUnion(
+		ssb.ExploreRecursive(selector.RecursionLimitDepth(3), ssb.ExploreAll(ssb.ExploreRecursiveEdge())),
+		ssb.ExploreAll(ssb.ExploreRecursiveEdge()),
+	)).Node()
+
+	testCases := map[string]struct {
+		options       []cardatatransfer.Option
+		selector      ipld.Node
+		unspecified   bool
+		expectSuccess bool
+		expectMessage string
+		expectBlocks  int
+	}{
+		"single block": {
+			options:       []cardatatransfer.Option{cardatatransfer.WithMaxSelectorDepth(4)},
+			selector:      ssb.Matcher().Node(),
+			expectSuccess: true,
+			expectBlocks:  1,
+		},
+		"unixfs path": {
+			options:       []cardatatransfer.Option{cardatatransfer.WithMaxSelectorDepth(4)},
+			selector:      pathSelector,
+			expectSuccess: true,
+			expectBlocks:  3,
+		},
+		// The children of a dag-pb node are at a depth of 4, i.e. below the node, its Links, each
+		// entry in Links and its Hash.
+		"unixfs path not specified in proposal": {
+			options:       []cardatatransfer.Option{cardatatransfer.WithMaxSelectorDepth(4)},
+			selector:      pathSelector,
+			unspecified:   true,
+			expectSuccess: true,
+			expectBlocks:  3,
+		},
+		"limited depth": {
+			options:       []cardatatransfer.Option{cardatatransfer.WithMaxSelectorDepth(4)},
+			selector:      depthSelector(4),
+			expectSuccess: true,
+			expectBlocks:  3,
+		},
+		"depth beyond maximum": {
+			options:       []cardatatransfer.Option{cardatatransfer.WithMaxSelectorDepth(4)},
+			selector:      depthSelector(5),
+			expectMessage: "selector recursion depth of 5 exceeds the maximum of 4",
+		},
+		"nested depths beyond maximum": {
+			options:       []cardatatransfer.Option{cardatatransfer.WithMaxSelectorDepth(4)},
+			selector:      nestedSelector,
+			expectMessage: "selector recursion depth of 6 exceeds the maximum of 4",
+		},
+		"unlimited depth": {
+			options:       []cardatatransfer.Option{cardatatransfer.WithMaxSelectorDepth(4)},
+			selector:      selectorparse.CommonSelector_ExploreAllRecursively,
+			expectMessage: "selector recursion must be limited to a depth of at most 4",
+		},
+		"unlimited depth without maximum": {
+			selector:      selectorparse.CommonSelector_ExploreAllRecursively,
+			expectSuccess: true,
+			expectBlocks:  testutil.GetBstoreLen(context.Background(), t, contentBs),
+		},
+		"selector beyond maximum size": {
+			options:       []cardatatransfer.Option{cardatatransfer.WithMaxSelectorSize(8)},
+			selector:      pathSelector,
+			expectMessage: fmt.Sprintf("selector of %d bytes exceeds the maximum of 8 bytes", len(encodeSelector(t, pathSelector))),
+		},
+	}
+
+	for testCase, data := range testCases {
+		t.Run(testCase, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			mn := mocknet.New()
+			srcHost := startCarDataTransfer(t, mn, supplier, data.options...)
+
+			dst, dstBlockstore := newDestination(t, mn)
+			proposal := dealProposal(t, 1, root, pieceCID, data.selector)
+			if data.unspecified {
+				proposal.Selector = nil
+			}
+			result := dst.pull(ctx, t, srcHost, proposal, root, data.selector)
+			require.Equal(t, data.expectSuccess, result.success, result.message)
+			if data.expectSuccess {
+				require.Equal(t, data.expectBlocks, testutil.GetBstoreLen(ctx, t, dstBlockstore))
+			} else {
+				require.Equal(t, data.expectMessage, result.message)
+			}
+		})
+	}
+}
+
+func TestCarDataTransferLimitsConcurrentTransfers(t *testing.T) {
+	root, contentBs := buildUnixFSDirectory(t)
+	blockingPieceCID := pieceCIDFromContextID(t, []byte("blocking"))
+	pieceCID := pieceCIDFromContextID(t, []byte("fish"))
+	sel := selectorparse.CommonSelector_ExploreAllRecursively
+
+	for _, tt := range []struct {
+		name          string
+		option        cardatatransfer.Option
+		samePeer      bool
+		expectMessage string
+	}{
+		{
+			name:          "total",
+			option:        cardatatransfer.WithMaxConcurrentTransfers(1),
+			expectMessage: "too many concurrent transfers: maximum of 1 reached",
+		},
+		{
+			name:          "per peer",
+			option:        cardatatransfer.WithMaxConcurrentTransfersPerPeer(1),
+			samePeer:      true,
+			expectMessage: "too many concurrent transfers to peer: maximum of 1 reached",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			blocking := &blockingBlockstore{
+				Blockstore: contentBs,
+				reading:    make(chan struct{}),
+				unblock:    make(chan struct{}),
+			}
+			supplier := &fakeSupplier{
+				blockstores: map[string]supplier.ClosableBlockstore{
+					"blocking": nopCloser{blocking},
+					"fish":     nopCloser{contentBs},
+				},
+			}
+			mn := mocknet.New()
+			srcHost := startCarDataTransfer(t, mn, supplier, tt.option)
+			dst1, _ := newDestination(t, mn)
+			dst2 := dst1
+			if !tt.samePeer {
+				dst2, _ = newDestination(t, mn)
+			}
+
+			// Start a transfer that stays in progress until unblocked.
+			firstResult := make(chan pullResult, 1)
+			go func() {
+				firstResult <- dst1.pull(ctx, t, srcHost, dealProposal(t, 1, root, blockingPieceCID, sel), root, sel)
+			}()
+			select {
+			case <-blocking.reading:
+			case <-ctx.Done():
+				require.FailNow(t, "first transfer did not start")
+			}
+
+			result := dst2.pull(ctx, t, srcHost, dealProposal(t, 2, root, pieceCID, sel), root, sel)
+			require.False(t, result.success)
+			require.Equal(t, tt.expectMessage, result.message)
+
+			// Once the first transfer completes, transfers are accepted again.
+			close(blocking.unblock)
+			require.True(t, (<-firstResult).success)
+			result = dst2.pull(ctx, t, srcHost, dealProposal(t, 3, root, pieceCID, sel), root, sel)
+			require.True(t, result.success, result.message)
+		})
+	}
+}
+
+var (
+	_ cardatatransfer.BlockStoreSupplier = (*supplier.CarSupplier)(nil)
+	_ cardatatransfer.BlockStoreSupplier = (*supplier.UnixFSSupplier)(nil)
+	_ cardatatransfer.PieceResolver      = (*supplier.CarSupplier)(nil)
+)
+
 type fakeSupplier struct {
 	blockstores map[string]supplier.ClosableBlockstore
+	pieces      map[cid.Cid][]byte
+}
+
+func (fs *fakeSupplier) ContextIDForPiece(pieceCid cid.Cid) ([]byte, error) {
+	contextID, ok := fs.pieces[pieceCid]
+	if !ok {
+		return nil, errors.New("Not found!")
+	}
+	return contextID, nil
 }
 
 func (fs *fakeSupplier) ReadOnlyBlockstore(contextID []byte) (supplier.ClosableBlockstore, error) {
@@ -275,3 +514,138 @@ func copySelectorOutputToBlockstore(t *testing.T, sourceBs bstore.Blockstore, ro
 
 	return bsOutput, count
 }
+
+// buildUnixFSDirectory builds the UnixFS DAG of a directory with files a.txt and sub/b.txt, and
+// returns its root along with the blockstore that holds its blocks.
+func buildUnixFSDirectory(t *testing.T) (cid.Cid, bstore.Blockstore) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "a.txt"), []byte("fish"), 0666))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "b.txt"), []byte("lobster"), 0666))
+
+	bs := bstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore()))
+	lsys := storeutil.LinkSystemForBlockstore(bs)
+	root, _, err := unixfsbuilder.BuildUnixFSRecursive(dir, &lsys)
+	require.NoError(t, err)
+	return root.(cidlink.Link).Cid, bs
+}
+
+func encodeSelector(t *testing.T, sel ipld.Node) []byte {
+	buf := new(bytes.Buffer)
+	require.NoError(t, dagcbor.Encode(sel, buf))
+	return buf.Bytes()
+}
+
+func dealProposal(t *testing.T, id cardatatransfer.DealID, root, pieceCID cid.Cid, sel ipld.Node) *cardatatransfer.DealProposal {
+	return &cardatatransfer.DealProposal{
+		PayloadCID: root,
+		ID:         id,
+		Params: cardatatransfer.Params{
+			PieceCID: &pieceCID,
+			Selector: &cbg.Deferred{Raw: encodeSelector(t, sel)},
+		},
+	}
+}
+
+func startCarDataTransfer(t *testing.T, mn mocknet.Mocknet, supplier cardatatransfer.BlockStoreSupplier, o ...cardatatransfer.Option) host.Host {
+	srcHost, err := mn.GenPeer()
+	require.NoError(t, err)
+	srcStore := dssync.MutexWrap(datastore.NewMapDatastore())
+	srcDt := testutil.SetupDataTransferOnHost(t, srcHost, srcStore, cidlink.DefaultLinkSystem())
+	require.NoError(t, cardatatransfer.StartCarDataTransfer(srcDt, supplier, o...))
+	return srcHost
+}
+
+// destination is a host that retrieves content via data transfer.
+type destination struct {
+	dt datatransfer.Manager
+
+	lock    sync.Mutex
+	results map[datatransfer.ChannelID]pullResult
+}
+
+type pullResult struct {
+	success bool
+	message string
+}
+
+func newDestination(t *testing.T, mn mocknet.Mocknet) (*destination, bstore.Blockstore) {
+	dstHost, err := mn.GenPeer()
+	require.NoError(t, err)
+	require.NoError(t, mn.LinkAll())
+	dstStore := dssync.MutexWrap(datastore.NewMapDatastore())
+	dstBlockstore := bstore.NewBlockstore(dstStore)
+	dstDt := testutil.SetupDataTransferOnHost(t, dstHost, dstStore, storeutil.LinkSystemForBlockstore(dstBlockstore))
+	require.NoError(t, dstDt.RegisterVoucherResultType(&cardatatransfer.DealResponse{}))
+	require.NoError(t, dstDt.RegisterVoucherType(&cardatatransfer.DealProposal{}, nil))
+
+	d := &destination{
+		dt:      dstDt,
+		results: make(map[datatransfer.ChannelID]pullResult),
+	}
+	messages := make(map[datatransfer.ChannelID]string)
+	dstDt.SubscribeToEvents(func(event datatransfer.Event, channelState datatransfer.ChannelState) {
+		d.lock.Lock()
+		defer d.lock.Unlock()
+		chid := channelState.ChannelID()
+		if event.Code == datatransfer.NewVoucherResult {
+			if vr, ok := channelState.LastVoucherResult().(*cardatatransfer.DealResponse); ok {
+				messages[chid] = vr.Message
+			}
+		}
+		if _, ok := d.results[chid]; ok {
+			return
+		}
+		switch channelState.Status() {
+		case datatransfer.Cancelled, datatransfer.Failed:
+			d.results[chid] = pullResult{message: messages[chid]}
+		case datatransfer.Completed:
+			d.results[chid] = pullResult{success: true, message: messages[chid]}
+		}
+	})
+	return d, dstBlockstore
+}
+
+// pull retrieves the given selection from the source host, and returns whether the transfer
+// succeeded along with the message of the deal response.
+func (d *destination) pull(ctx context.Context, t *testing.T, srcHost host.Host, voucher datatransfer.Voucher, root cid.Cid, sel ipld.Node) pullResult {
+	chid, err := d.dt.OpenPullDataChannel(ctx, srcHost.ID(), voucher, root, sel)
+	require.NoError(t, err)
+	for {
+		d.lock.Lock()
+		result, ok := d.results[chid]
+		d.lock.Unlock()
+		if ok {
+			return result
+		}
+		select {
+		case <-ctx.Done():
+			require.FailNow(t, "context closed")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+type nopCloser struct {
+	bstore.Blockstore
+}
+
+func (nopCloser) Close() error { return nil }
+
+// blockingBlockstore signals the first read, and blocks all reads until unblocked.
+type blockingBlockstore struct {
+	bstore.Blockstore
+	once    sync.Once
+	reading chan struct{}
+	unblock chan struct{}
+}
+
+func (b *blockingBlockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	b.once.Do(func() { close(b.reading) })
+	select {
+	case <-b.unblock:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return b.Blockstore.Get(ctx, c)
+}
@@ -0,0 +1,84 @@
+package cardatatransfer
+
+import "fmt"
+
+// defaultMaxSelectorSize is the default maximum size of the dag-cbor encoded selectors of accepted
+// retrievals.
+const defaultMaxSelectorSize = 16 << 10
+
+type (
+	// Option captures a configurable parameter of the retrievals served by StartCarDataTransfer.
+	Option func(*options) error
+
+	options struct {
+		maxConcurrentTransfers        int
+		maxConcurrentTransfersPerPeer int
+		maxSelectorDepth              int64
+		maxSelectorSize               int
+	}
+)
+
+func newOptions(o ...Option) (*options, error) {
+	opts := &options{
+		maxSelectorSize: defaultMaxSelectorSize,
+	}
+	for _, apply := range o {
+		if err := apply(opts); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// WithMaxConcurrentTransfers sets the maximum number of retrievals served at a time across all
+// peers. Retrieval proposals beyond the limit are rejected. Zero means no limit.
+// If unset, the number of concurrent transfers is not limited.
+func WithMaxConcurrentTransfers(max int) Option {
+	return func(o *options) error {
+		if max < 0 {
+			return fmt.Errorf("max concurrent transfers must not be negative, got %d", max)
+		}
+		o.maxConcurrentTransfers = max
+		return nil
+	}
+}
+
+// WithMaxConcurrentTransfersPerPeer sets the maximum number of retrievals served at a time to each
+// peer. Retrieval proposals beyond the limit are rejected. Zero means no limit.
+// If unset, the number of concurrent transfers per peer is not limited.
+func WithMaxConcurrentTransfersPerPeer(max int) Option {
+	return func(o *options) error {
+		if max < 0 {
+			return fmt.Errorf("max concurrent transfers per peer must not be negative, got %d", max)
+		}
+		o.maxConcurrentTransfersPerPeer = max
+		return nil
+	}
+}
+
+// WithMaxSelectorDepth sets the maximum recursion depth of the selectors of accepted retrievals.
+// When set, selectors that recurse without a depth limit, e.g. the explore-all selector, or with
+// a depth limit beyond the maximum are rejected. Zero means no limit.
+// If unset, the recursion depth of selectors is not limited.
+func WithMaxSelectorDepth(depth int64) Option {
+	return func(o *options) error {
+		if depth < 0 {
+			return fmt.Errorf("max selector depth must not be negative, got %d", depth)
+		}
+		o.maxSelectorDepth = depth
+		return nil
+	}
+}
+
+// WithMaxSelectorSize sets the maximum size in bytes of the dag-cbor encoded selectors of accepted
+// retrievals.
+// If unset, the default of 16 KiB is used.
+func WithMaxSelectorSize(size int) Option {
+	return func(o *options) error {
+		if size < 1 {
+			return fmt.Errorf("max selector size must be at least 1, got %d", size)
+		}
+		o.maxSelectorSize = size
+		return nil
+	}
+}
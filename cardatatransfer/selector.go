@@ -0,0 +1,107 @@
+package cardatatransfer
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+)
+
+// validateSelector checks that the given selector is valid and bounded by the configured limits,
+// i.e. its encoded size and the depth of its recursive explorations.
+func (o *options) validateSelector(sel datamodel.Node, encodedSize int) error {
+	if encodedSize > o.maxSelectorSize {
+		return fmt.Errorf("selector of %d bytes exceeds the maximum of %d bytes", encodedSize, o.maxSelectorSize)
+	}
+	if _, err := selector.CompileSelector(sel); err != nil {
+		return fmt.Errorf("invalid selector: %w", err)
+	}
+	if o.maxSelectorDepth == 0 {
+		return nil
+	}
+	depth, unbounded, err := recursionDepth(sel)
+	if err != nil {
+		return fmt.Errorf("invalid selector: %w", err)
+	}
+	if unbounded {
+		return fmt.Errorf("selector recursion must be limited to a depth of at most %d", o.maxSelectorDepth)
+	}
+	if depth > o.maxSelectorDepth {
+		return fmt.Errorf("selector recursion depth of %d exceeds the maximum of %d", depth, o.maxSelectorDepth)
+	}
+	return nil
+}
+
+// recursionDepth returns the depth up to which the given selector recurses, i.e. the product of
+// the depth limits of nested recursive explorations, or the maximum across the alternatives of
+// a union. Whether any recursive exploration has no depth limit is returned too.
+func recursionDepth(n datamodel.Node) (int64, bool, error) {
+	var maxDepth int64
+	var unbounded bool
+	merge := func(depth int64, childUnbounded bool) {
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		unbounded = unbounded || childUnbounded
+	}
+
+	switch n.Kind() {
+	case datamodel.Kind_Map:
+		it := n.MapIterator()
+		for !it.Done() {
+			k, v, err := it.Next()
+			if err != nil {
+				return 0, false, err
+			}
+			depth, childUnbounded, err := recursionDepth(v)
+			if err != nil {
+				return 0, false, err
+			}
+			if key, err := k.AsString(); err == nil && key == selector.SelectorKey_ExploreRecursive {
+				// The selectors nested in the sequence of a recursive exploration apply at each
+				// level of the recursion.
+				limit, err := v.LookupByString(selector.SelectorKey_Limit)
+				if err != nil {
+					return 0, false, err
+				}
+				if _, err := limit.LookupByString(selector.SelectorKey_LimitNone); err == nil {
+					childUnbounded = true
+				} else if depthNode, err := limit.LookupByString(selector.SelectorKey_LimitDepth); err == nil {
+					limitDepth, err := depthNode.AsInt()
+					if err != nil {
+						return 0, false, err
+					}
+					depth = multiplyDepths(limitDepth, depth)
+				}
+			}
+			merge(depth, childUnbounded)
+		}
+	case datamodel.Kind_List:
+		it := n.ListIterator()
+		for !it.Done() {
+			_, v, err := it.Next()
+			if err != nil {
+				return 0, false, err
+			}
+			depth, childUnbounded, err := recursionDepth(v)
+			if err != nil {
+				return 0, false, err
+			}
+			merge(depth, childUnbounded)
+		}
+	}
+	return maxDepth, unbounded, nil
+}
+
+// multiplyDepths returns the depth of a recursion limited to the given depth, the sequence of
+// which recurses up to the given nested depth, saturating at math.MaxInt64.
+func multiplyDepths(depth, nested int64) int64 {
+	if nested < 1 {
+		return depth
+	}
+	if depth > math.MaxInt64/nested {
+		return math.MaxInt64
+	}
+	return depth * nested
+}
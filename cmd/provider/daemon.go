@@ -14,11 +14,14 @@ import (
 	"github.com/filecoin-project/index-provider/cmd/provider/internal/config"
 	"github.com/filecoin-project/index-provider/engine"
 	"github.com/filecoin-project/index-provider/engine/policy"
+	"github.com/filecoin-project/index-provider/metadata"
+	"github.com/filecoin-project/index-provider/metrics"
 
 	adminserver "github.com/filecoin-project/index-provider/server/admin/http"
+	bitswapserver "github.com/filecoin-project/index-provider/server/bitswap"
 	reframeserver "github.com/filecoin-project/index-provider/server/reframe/http"
+	retrievalserver "github.com/filecoin-project/index-provider/server/retrieval/http"
 	"github.com/filecoin-project/index-provider/supplier"
-	leveldb "github.com/ipfs/go-ds-leveldb"
 	gsimpl "github.com/ipfs/go-graphsync/impl"
 	gsnet "github.com/ipfs/go-graphsync/network"
 	logging "github.com/ipfs/go-log/v2"
@@ -27,6 +30,7 @@ import (
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/libp2p/go-libp2p"
 	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multicodec"
 	"github.com/urfave/cli/v2"
 )
 
@@ -56,12 +60,9 @@ func daemonCommand(cctx *cli.Context) error {
 		return err
 	}
 
-	cfg, err := config.Load("")
+	cfg, err := loadConfig()
 	if err != nil {
-		if err == config.ErrNotInitialized {
-			return errors.New("reference provider is not initialized\nTo initialize, run using the \"init\" command")
-		}
-		return fmt.Errorf("cannot load config file: %w", err)
+		return err
 	}
 
 	// Initialize libp2p host
@@ -94,31 +95,37 @@ func daemonCommand(cctx *cli.Context) error {
 	log.Infow("libp2p host initialized", "host_id", h.ID(), "multiaddr", p2pmaddr)
 
 	// Initialize datastore
-	if cfg.Datastore.Type != "levelds" {
-		return fmt.Errorf("only levelds datastore type supported, %q not supported", cfg.Datastore.Type)
+	ds, err := openDatastore(cfg.Datastore)
+	if err != nil {
+		return err
 	}
-	dataStorePath, err := config.Path("", cfg.Datastore.Dir)
+
+	gsnet := gsnet.NewFromLibp2pHost(h)
+	dtNet := dtnetwork.NewFromLibp2pHost(h)
+	gs := gsimpl.New(context.Background(), gsnet, cidlink.DefaultLinkSystem())
+	tp := gstransport.NewTransport(h.ID(), gs)
+	dt, err := datatransfer.NewDataTransfer(ds, dtNet, tp)
 	if err != nil {
 		return err
 	}
-	err = checkWritable(dataStorePath)
+	err = dt.Start(context.Background())
 	if err != nil {
 		return err
 	}
-	ds, err := leveldb.NewDatastore(dataStorePath, nil)
+
+	entriesOpt, err := entriesFormatOption(cfg.Ingest)
 	if err != nil {
 		return err
 	}
 
-	gsnet := gsnet.NewFromLibp2pHost(h)
-	dtNet := dtnetwork.NewFromLibp2pHost(h)
-	gs := gsimpl.New(context.Background(), gsnet, cidlink.DefaultLinkSystem())
-	tp := gstransport.NewTransport(h.ID(), gs)
-	dt, err := datatransfer.NewDataTransfer(ds, dtNet, tp)
+	mdContext, err := metadataContext(cfg.Metadata)
 	if err != nil {
 		return err
 	}
-	err = dt.Start(context.Background())
+
+	// Advertise the content of all suppliers as retrievable from the retrieval HTTP server, if
+	// enabled, via HTTP metadata that points at it.
+	httpMd, err := httpRetrievalMetadata(cfg)
 	if err != nil {
 		return err
 	}
@@ -127,10 +134,13 @@ func daemonCommand(cctx *cli.Context) error {
 	eng, err := engine.New(
 		engine.WithDatastore(ds),
 		engine.WithDataTransfer(dt),
+		engine.WithDataTransferDatastore(ds),
 		engine.WithDirectAnnounce(cfg.DirectAnnounce.URLs...),
 		engine.WithHost(h),
 		engine.WithEntriesCacheCapacity(cfg.Ingest.LinkCacheSize),
-		engine.WithChainedEntries(cfg.Ingest.LinkedChunkSize),
+		entriesOpt,
+		engine.WithLocalIndex(localIndexEnabled(cfg)),
+		engine.WithMetadataContext(mdContext),
 		engine.WithTopicName(cfg.Ingest.PubSubTopic),
 		engine.WithPublisherKind(engine.PublisherKind(cfg.Ingest.PublisherKind)),
 		engine.WithSyncPolicy(syncPolicy))
@@ -143,14 +153,85 @@ func daemonCommand(cctx *cli.Context) error {
 		return err
 	}
 
-	// Instantiate CAR supplier and register it as the multihash lister onto the engine.
-	cs := supplier.NewCarSupplier(eng, ds, car.ZeroLengthSectionAsEOF(carZeroLengthAsEOFFlagValue))
+	// Instantiate the suppliers, and register them onto the engine via the registry that lists
+	// multihashes across all of them.
+	suppliers := supplier.NewRegistry(eng)
+	cs := supplier.NewCarSupplier(suppliers.Engine(), ds, car.ZeroLengthSectionAsEOF(carZeroLengthAsEOFFlagValue))
+	if err := suppliers.Register(supplier.CarSupplierName, cs); err != nil {
+		return err
+	}
+	us, err := supplier.NewUnixFSSupplier(suppliers.Engine(), ds)
+	if err != nil {
+		return err
+	}
+	if err := suppliers.Register(supplier.UnixFSSupplierName, us); err != nil {
+		return err
+	}
+
+	// Expose the metrics of the provider, if configured.
+	var metricsSrv *metrics.Server
+	if cfg.Metrics.ListenMultiaddr != "" {
+		metricsAddr, err := cfg.Metrics.ListenNetAddr()
+		if err != nil {
+			return err
+		}
+		if metricsSrv, err = metrics.NewServer(metricsAddr); err != nil {
+			return err
+		}
+		if err = metricsSrv.Start(); err != nil {
+			return err
+		}
+	}
+
+	// Start serving the content of all suppliers for retrieval requests
+	err = cardatatransfer.StartCarDataTransfer(dt, suppliers, graphsyncRetrievalOptions(cfg.GraphsyncRetrieval)...)
+	if err != nil {
+		return err
+	}
+
+	// Serve the blocks of all suppliers over Bitswap, so that Bitswap metadata points at content.
+	var bitswapSrv *bitswapserver.Server
+	if !cfg.Bitswap.Disabled {
+		// A negative rate in config disables rate limiting, which the server signals with zero.
+		maxBlocksPerSecond := cfg.Bitswap.MaxBlocksPerSecondPerPeer
+		if maxBlocksPerSecond < 0 {
+			maxBlocksPerSecond = 0
+		}
+		bitswapSrv, err = bitswapserver.New(ctx, h, suppliers.Blockstore(),
+			bitswapserver.WithMaxBlocksPerSecondPerPeer(maxBlocksPerSecond),
+			bitswapserver.WithBurstPerPeer(cfg.Bitswap.BurstPerPeer),
+			bitswapserver.WithTaskWorkerCount(cfg.Bitswap.TaskWorkerCount))
+		if err != nil {
+			return err
+		}
+	}
 
-	// Start serving CAR files for retrieval requests
-	err = cardatatransfer.StartCarDataTransfer(dt, cs)
+	// Periodically check that the imported CAR files are neither moved nor modified.
+	carChecker, err := supplier.NewCarChecker(cs,
+		supplier.WithCheckInterval(time.Duration(cfg.CarChecker.Interval)),
+		supplier.WithRemoveBroken(cfg.CarChecker.RemoveBroken))
+	if err != nil {
+		return err
+	}
+	carChecker.Start()
+
+	// Automatically advertise the CAR files in the configured directories, if any. Otherwise,
+	// only remove the advertisements of the CAR files in previously configured directories.
+	dirSupplier, err := supplier.NewDirSupplier(cs, ds, cfg.DirSupplier.Dirs,
+		supplier.WithMetadataFunc(carDataTransferMetadata(mdContext, httpMd)),
+		supplier.WithPollInterval(time.Duration(cfg.DirSupplier.PollInterval)),
+		supplier.WithSettleDelay(time.Duration(cfg.DirSupplier.SettleDelay)))
 	if err != nil {
 		return err
 	}
+	if len(cfg.DirSupplier.Dirs) != 0 {
+		if err := dirSupplier.Start(ctx); err != nil {
+			return err
+		}
+		log.Infow("Watching directories for CAR files", "dirs", cfg.DirSupplier.Dirs)
+	} else if _, err := dirSupplier.Reconcile(ctx); err != nil {
+		return err
+	}
 
 	// TODO: unclear why the admin config takes multiaddr if it is always converted to net addr; simplify.
 	addr, err := cfg.AdminServer.ListenNetAddr()
@@ -162,10 +243,12 @@ func daemonCommand(cctx *cli.Context) error {
 		h,
 		privKey,
 		eng,
-		cs,
+		suppliers,
 		adminserver.WithListenAddr(addr),
 		adminserver.WithReadTimeout(time.Duration(cfg.AdminServer.ReadTimeout)),
 		adminserver.WithWriteTimeout(time.Duration(cfg.AdminServer.WriteTimeout)),
+		adminserver.WithMetadataContext(mdContext),
+		adminserver.WithHTTPRetrievalMetadata(httpMd),
 	)
 
 	if err != nil {
@@ -198,6 +281,30 @@ func daemonCommand(cctx *cli.Context) error {
 		defer bootstrapper.Close()
 	}
 
+	// Serve the content of all suppliers over HTTP as a trustless gateway, if enabled.
+	httpRetrievalErrChan := make(chan error, 1)
+	var httpRetrievalSrv *retrievalserver.Server
+	if httpRetrievalEnabled(cfg) {
+		httpRetrievalAddr, err := cfg.HttpRetrieval.ListenNetAddr()
+		if err != nil {
+			return err
+		}
+		httpRetrievalSrv, err = retrievalserver.New(suppliers.Blockstore(),
+			retrievalserver.WithListenAddr(httpRetrievalAddr),
+			retrievalserver.WithReadTimeout(time.Duration(cfg.HttpRetrieval.ReadTimeout)),
+			retrievalserver.WithWriteTimeout(time.Duration(cfg.HttpRetrieval.WriteTimeout)),
+		)
+		if err != nil {
+			return err
+		}
+		log.Infow("retrieval http server initialized", "address", cfg.HttpRetrieval.ListenMultiaddr)
+
+		fmt.Fprintf(cctx.App.ErrWriter, "Starting retrieval http server on %s ...", cfg.HttpRetrieval.ListenMultiaddr)
+		go func() {
+			httpRetrievalErrChan <- httpRetrievalSrv.Start()
+		}()
+	}
+
 	// setting up reframe server
 	var reframeSrv *reframeserver.Server
 	if len(cfg.Reframe.ListenMultiaddr) != 0 {
@@ -240,6 +347,9 @@ func daemonCommand(cctx *cli.Context) error {
 	case err = <-reframeErrChan:
 		log.Errorw("Failed to start reframe server", "err", err)
 		finalErr = ErrDaemonStart
+	case err = <-httpRetrievalErrChan:
+		log.Errorw("Failed to start retrieval http server", "err", err)
+		finalErr = ErrDaemonStart
 	}
 
 	log.Infow("Shutting down daemon")
@@ -255,6 +365,25 @@ func daemonCommand(cctx *cli.Context) error {
 		}
 	}()
 
+	if err = carChecker.Close(); err != nil {
+		log.Errorw("Error closing CAR checker", "err", err)
+		finalErr = ErrDaemonStop
+	}
+
+	if bitswapSrv != nil {
+		if err = bitswapSrv.Close(); err != nil {
+			log.Errorw("Error closing Bitswap server", "err", err)
+			finalErr = ErrDaemonStop
+		}
+	}
+
+	if dirSupplier != nil {
+		if err = dirSupplier.Close(); err != nil {
+			log.Errorw("Error closing directory supplier", "err", err)
+			finalErr = ErrDaemonStop
+		}
+	}
+
 	if err = eng.Shutdown(); err != nil {
 		log.Errorf("Error closing provider core: %s", err)
 		finalErr = ErrDaemonStop
@@ -278,6 +407,128 @@ func daemonCommand(cctx *cli.Context) error {
 			finalErr = ErrDaemonStop
 		}
 	}
+	if httpRetrievalSrv != nil {
+		if err = httpRetrievalSrv.Shutdown(shutdownCtx); err != nil {
+			log.Errorw("Error shutting down retrieval http server.", "err", err)
+			finalErr = ErrDaemonStop
+		}
+	}
+	if metricsSrv != nil {
+		if err = metricsSrv.Shutdown(shutdownCtx); err != nil {
+			log.Errorw("Error shutting down metrics server.", "err", err)
+			finalErr = ErrDaemonStop
+		}
+	}
 	log.Infow("node stopped")
 	return finalErr
 }
+
+// graphsyncRetrievalOptions returns the options of retrievals over graphsync as configured in the
+// given config, where negative limits in config disable the limit, which is signalled with zero.
+func graphsyncRetrievalOptions(c config.GraphsyncRetrieval) []cardatatransfer.Option {
+	maxTransfers := c.MaxConcurrentTransfers
+	if maxTransfers < 0 {
+		maxTransfers = 0
+	}
+	maxTransfersPerPeer := c.MaxConcurrentTransfersPerPeer
+	if maxTransfersPerPeer < 0 {
+		maxTransfersPerPeer = 0
+	}
+	maxDepth := c.MaxSelectorDepth
+	if maxDepth < 0 {
+		maxDepth = 0
+	}
+	return []cardatatransfer.Option{
+		cardatatransfer.WithMaxConcurrentTransfers(maxTransfers),
+		cardatatransfer.WithMaxConcurrentTransfersPerPeer(maxTransfersPerPeer),
+		cardatatransfer.WithMaxSelectorDepth(maxDepth),
+	}
+}
+
+// entriesFormatOption returns the engine option that sets the format of advertisement entries as
+// configured in the given ingest config.
+func entriesFormatOption(c config.Ingest) (engine.Option, error) {
+	switch c.EntriesFormat.Kind {
+	case config.ChainEntriesFormatKind:
+		if c.LinkedChunkMaxBytes != 0 {
+			return engine.WithBoundedChainedEntries(c.LinkedChunkMaxBytes), nil
+		}
+		return engine.WithChainedEntries(c.LinkedChunkSize), nil
+	case config.HamtEntriesFormatKind:
+		var hashAlg multicodec.Code
+		if err := hashAlg.Set(c.EntriesFormat.HamtHashAlg); err != nil {
+			return nil, fmt.Errorf("bad HAMT hash algorithm in config %s: %w", c.EntriesFormat.HamtHashAlg, err)
+		}
+		return engine.WithHamtEntries(hashAlg, c.EntriesFormat.HamtBitWidth, c.EntriesFormat.HamtBucketSize), nil
+	default:
+		return nil, fmt.Errorf("unknown entries format kind in config: %q", c.EntriesFormat.Kind)
+	}
+}
+
+// carDataTransferMetadata returns the function that generates the metadata of CAR files
+// retrievable over graphsync via cardatatransfer, as does the provider CLI when importing CAR files.
+// The given HTTP retrieval protocol is also included in the metadata, unless nil.
+func carDataTransferMetadata(mc metadata.MetadataContext, httpMd *metadata.HTTPRetrievalV1) supplier.MetadataFunc {
+	return func(_ context.Context, contextID []byte, _ string) (metadata.Metadata, error) {
+		tp, err := cardatatransfer.TransportFromContextID(contextID)
+		if err != nil {
+			return metadata.Metadata{}, err
+		}
+		if httpMd != nil {
+			return mc.New(tp, httpMd), nil
+		}
+		return mc.New(tp), nil
+	}
+}
+
+// httpRetrievalMetadata returns the HTTP retrieval protocol that signals retrieval of trustless
+// CARs from the retrieval HTTP server, or nil if the server is disabled.
+func httpRetrievalMetadata(cfg *config.Config) (*metadata.HTTPRetrievalV1, error) {
+	if !httpRetrievalEnabled(cfg) {
+		return nil, nil
+	}
+	urlTemplate, err := cfg.HttpRetrieval.URLTemplate()
+	if err != nil {
+		return nil, fmt.Errorf("bad retrieval http address in config: %w", err)
+	}
+	return &metadata.HTTPRetrievalV1{URLTemplate: urlTemplate, TrustlessCAR: true}, nil
+}
+
+// httpRetrievalEnabled checks whether the retrieval HTTP server is enabled in the given config.
+func httpRetrievalEnabled(cfg *config.Config) bool {
+	return cfg.HttpRetrieval.ListenMultiaddr != ""
+}
+
+// localIndexEnabled returns true if the local index is enabled in config, or blocks are served by
+// multihash over Bitswap or HTTP, which are located via the local index.
+func localIndexEnabled(cfg *config.Config) bool {
+	return cfg.Ingest.LocalIndex || !cfg.Bitswap.Disabled || httpRetrievalEnabled(cfg)
+}
+
+// metadataContext returns the metadata context that includes the custom protocols declared in the
+// given metadata config, in addition to the built-in ones.
+func metadataContext(c config.Metadata) (metadata.MetadataContext, error) {
+	mc := metadata.Default
+	seen := make(map[multicodec.Code]struct{})
+	for _, p := range c.Protocols {
+		var code multicodec.Code
+		if err := code.Set(p.Code); err != nil {
+			return nil, fmt.Errorf("bad metadata protocol code in config %s: %w", p.Code, err)
+		}
+		switch code {
+		case multicodec.TransportBitswap, multicodec.TransportGraphsyncFilecoinv1, multicodec.Http:
+			return nil, fmt.Errorf("metadata protocol in config cannot redefine built-in protocol %s", code)
+		}
+		if _, ok := seen[code]; ok {
+			return nil, fmt.Errorf("metadata protocol %s is declared more than once in config", p.Code)
+		}
+		seen[code] = struct{}{}
+		factory, err := metadata.NewSchemaProtocolFactory(code, p.Schema, p.Type)
+		if err != nil {
+			return nil, fmt.Errorf("bad metadata protocol in config: %w", err)
+		}
+		mc = mc.WithProtocol(code, factory)
+		log.Infow("Registered custom metadata protocol", "code", p.Code, "type", p.Type)
+	}
+	return mc, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/filecoin-project/index-provider/cmd/provider/internal/config"
+	"github.com/filecoin-project/index-provider/metadata"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-varint"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_metadataContext(t *testing.T) {
+	const schema = `type FishTransport struct {
+	Pond String
+}`
+	mc, err := metadataContext(config.Metadata{
+		Protocols: []config.MetadataProtocol{{Code: "0x300001", Schema: schema, Type: "FishTransport"}},
+	})
+	require.NoError(t, err)
+
+	md := mc.New()
+	require.NoError(t, json.Unmarshal([]byte(`[{"protocol":"0x300001","value":{"Pond":"lobster"}},{"protocol":"transport-bitswap"}]`), &md))
+	require.Equal(t, []multicodec.Code{multicodec.TransportBitswap, multicodec.Code(0x300001)}, md.Protocols())
+
+	mdBytes, err := md.MarshalBinary()
+	require.NoError(t, err)
+	fromBytes := mc.New()
+	require.NoError(t, fromBytes.UnmarshalBinary(mdBytes))
+	require.True(t, md.Equal(fromBytes))
+
+	// Payload that does not match the schema is rejected.
+	malformed := append(varint.ToUvarint(0x300001), 0xa1, 0x64, 'P', 'o', 'n', 'd', 0x01)
+	fromMalformed := mc.New()
+	err = fromMalformed.UnmarshalBinary(malformed)
+	require.ErrorAs(t, err, &metadata.ErrInvalidMetadata{})
+}
+
+func Test_metadataContextInvalidConfigIsError(t *testing.T) {
+	tests := []struct {
+		name    string
+		given   []config.MetadataProtocol
+		wantErr string
+	}{
+		{
+			name:    "Unknown code",
+			given:   []config.MetadataProtocol{{Code: "fish", Schema: "type Fish string", Type: "Fish"}},
+			wantErr: "bad metadata protocol code in config fish",
+		},
+		{
+			name:    "Built-in code",
+			given:   []config.MetadataProtocol{{Code: "transport-bitswap", Schema: "type Fish string", Type: "Fish"}},
+			wantErr: "metadata protocol in config cannot redefine built-in protocol transport-bitswap",
+		},
+		{
+			name: "Duplicate code",
+			given: []config.MetadataProtocol{
+				{Code: "0x300001", Schema: "type Fish string", Type: "Fish"},
+				{Code: "0x300001", Schema: "type Fish string", Type: "Fish"},
+			},
+			wantErr: "metadata protocol 0x300001 is declared more than once in config",
+		},
+		{
+			name:    "Unknown type",
+			given:   []config.MetadataProtocol{{Code: "0x300001", Schema: "type Fish string", Type: "Lobster"}},
+			wantErr: `bad metadata protocol in config: type "Lobster" not found in schema for 0x300001`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := metadataContext(config.Metadata{Protocols: test.given})
+			require.ErrorContains(t, err, test.wantErr)
+		})
+	}
+}
+
+func Test_carDataTransferMetadataIncludesHttpRetrieval(t *testing.T) {
+	cfg := &config.Config{}
+	httpMd, err := httpRetrievalMetadata(cfg)
+	require.NoError(t, err)
+	require.Nil(t, httpMd)
+	md, err := carDataTransferMetadata(metadata.Default, httpMd)(context.Background(), []byte("fish"), "")
+	require.NoError(t, err)
+	require.Equal(t, []multicodec.Code{multicodec.TransportGraphsyncFilecoinv1}, md.Protocols())
+
+	// Metadata of CAR files in directories points at the retrieval HTTP server when it is enabled.
+	cfg.HttpRetrieval.ListenMultiaddr = "/ip4/127.0.0.1/tcp/3104"
+	httpMd, err = httpRetrievalMetadata(cfg)
+	require.NoError(t, err)
+	require.Equal(t, &metadata.HTTPRetrievalV1{URLTemplate: "http://127.0.0.1:3104/ipfs/{cid}", TrustlessCAR: true}, httpMd)
+	md, err = carDataTransferMetadata(metadata.Default, httpMd)(context.Background(), []byte("fish"), "")
+	require.NoError(t, err)
+	require.Equal(t, []multicodec.Code{multicodec.Http, multicodec.TransportGraphsyncFilecoinv1}, md.Protocols())
+	require.Equal(t, httpMd, md.Get(multicodec.Http))
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/filecoin-project/index-provider/cmd/provider/internal/config"
+	"github.com/filecoin-project/index-provider/engine"
+	adminserver "github.com/filecoin-project/index-provider/server/admin/http"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/urfave/cli/v2"
+)
+
+var DatastoreCmd = &cli.Command{
+	Name:        "datastore",
+	Usage:       "Manages the provider datastore.",
+	Subcommands: []*cli.Command{datastoreConvertSubCmd, datastoreGCSubCmd, datastoreMigrateSubCmd},
+}
+
+var datastoreConvertSubCmd = &cli.Command{
+	Name:  "convert",
+	Usage: "Copies the provider datastore into a datastore of another type. The daemon must not be running.",
+	Description: `Copies all the data in the datastore configured for the provider into a new datastore
+of the given type and directory. The configured datastore is left unchanged. Unless
+--update-config is set, the Datastore section of the config must be updated to use the new
+datastore once converted.`,
+	Flags:  datastoreConvertFlags,
+	Action: doDatastoreConvert,
+}
+
+var datastoreGCSubCmd = &cli.Command{
+	Name:  "gc",
+	Usage: "Deletes the data no longer referenced by advertised context IDs from the datastore of a running provider.",
+	Description: `Deletes the cached entries, caching metadata and mappings that are no longer
+referenced by any advertised context ID, along with the state of finished data transfers, and
+compacts the datastore. Publication of new advertisements is paused while garbage is collected.`,
+	Flags:  datastoreGCFlags,
+	Action: doDatastoreGC,
+}
+
+var datastoreMigrateSubCmd = &cli.Command{
+	Name:  "migrate",
+	Usage: "Applies the pending migrations to the layout of the provider datastore. The daemon must not be running.",
+	Description: `Migrates the provider datastore to the latest layout version. Migrations are also
+applied automatically when the daemon starts; this command allows migrating ahead of time
+and, with --dry-run, listing the pending migrations without applying them.`,
+	Flags:  datastoreMigrateFlags,
+	Action: doDatastoreMigrate,
+}
+
+func doDatastoreConvert(cctx *cli.Context) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	dstCfg := config.Datastore{
+		Type:      cctx.String("type"),
+		Dir:       cctx.String("dir"),
+		ChunksDir: cctx.String("chunks-dir"),
+	}
+	switch dstCfg.Type {
+	case config.MemoryDatastoreType:
+		return errors.New("cannot convert to an in-memory datastore")
+	case config.FlatfsLevelDatastoreType:
+		if dstCfg.ChunksDir == "" {
+			return fmt.Errorf("chunks-dir must be set for %s datastore type", dstCfg.Type)
+		}
+	}
+	srcDirs, err := datastoreDirs(cfg.Datastore)
+	if err != nil {
+		return err
+	}
+	dstDirs, err := datastoreDirs(dstCfg)
+	if err != nil {
+		return err
+	}
+	dstDir := dstDirs[0]
+	for _, dst := range dstDirs {
+		for _, src := range srcDirs {
+			if dst == src {
+				return fmt.Errorf("destination directory %s must differ from the configured datastore directories", dst)
+			}
+		}
+	}
+
+	src, err := openDatastore(cfg.Datastore)
+	if err != nil {
+		return fmt.Errorf("cannot open configured datastore: %w", err)
+	}
+	defer src.Close()
+	dst, err := openDatastore(dstCfg)
+	if err != nil {
+		return fmt.Errorf("cannot open destination datastore: %w", err)
+	}
+	count, err := copyDatastore(cctx.Context, src, dst)
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to copy datastore: %w", err)
+	}
+
+	var b bytes.Buffer
+	b.WriteString(fmt.Sprintf("Copied %d keys into %s datastore at %s.\n", count, dstCfg.Type, dstDir))
+	if cctx.Bool("update-config") {
+		dstCfg.PopulateDefaults()
+		cfg.Datastore = dstCfg
+		if err := cfg.Save(""); err != nil {
+			return err
+		}
+		b.WriteString("Updated config to use the converted datastore.\n")
+	} else {
+		b.WriteString("Update the Datastore section of the config to use the converted datastore.\n")
+	}
+	_, err = cctx.App.Writer.Write(b.Bytes())
+	return err
+}
+
+// datastoreDirs returns the paths of the directories in which the datastore of the given config
+// keeps its data, starting with its Dir.
+func datastoreDirs(cfg config.Datastore) ([]string, error) {
+	dir, err := config.Path("", cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	dirs := []string{dir}
+	if cfg.Type == config.FlatfsLevelDatastoreType {
+		chunksDir, err := config.Path("", cfg.ChunksDir)
+		if err != nil {
+			return nil, err
+		}
+		dirs = append(dirs, chunksDir)
+	}
+	return dirs, nil
+}
+
+// copyDatastore copies all the entries in src into dst and returns the number of entries copied.
+func copyDatastore(ctx context.Context, src, dst datastore.Batching) (int, error) {
+	const batchSize = 1024
+
+	results, err := src.Query(ctx, query.Query{})
+	if err != nil {
+		return 0, err
+	}
+	defer results.Close()
+
+	batch, err := dst.Batch(ctx)
+	if err != nil {
+		return 0, err
+	}
+	var count int
+	for r := range results.Next() {
+		if ctx.Err() != nil {
+			return count, ctx.Err()
+		}
+		if r.Error != nil {
+			return count, r.Error
+		}
+		if err := batch.Put(ctx, datastore.RawKey(r.Key), r.Value); err != nil {
+			return count, err
+		}
+		count++
+		if count%batchSize == 0 {
+			if err := batch.Commit(ctx); err != nil {
+				return count, err
+			}
+			if batch, err = dst.Batch(ctx); err != nil {
+				return count, err
+			}
+		}
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return count, err
+	}
+	return count, dst.Sync(ctx, datastore.NewKey("/"))
+}
+
+func doDatastoreGC(cctx *cli.Context) error {
+	req, err := http.NewRequestWithContext(cctx.Context, http.MethodPost, adminAPIFlagValue+"/admin/datastore/gc", nil)
+	if err != nil {
+		return err
+	}
+
+	cl := &http.Client{}
+	resp, err := cl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errFromHttpResp(resp)
+	}
+
+	var res adminserver.GCDatastoreRes
+	if _, err := res.ReadFrom(resp.Body); err != nil {
+		return fmt.Errorf("received ok response from server but cannot decode response body. %v", err)
+	}
+	_, err = fmt.Fprintf(cctx.App.Writer, "Successfully collected garbage.\n\t Deleted keys: %d\n\t Deleted bytes: %d\n\t Reclaimed bytes: %d\n",
+		res.DeletedKeys, res.DeletedBytes, res.ReclaimedBytes)
+	return err
+}
+
+func doDatastoreMigrate(cctx *cli.Context) error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	ds, err := openDatastore(cfg.Datastore)
+	if err != nil {
+		return err
+	}
+	defer ds.Close()
+
+	v, err := engine.DatastoreVersion(cctx.Context, ds)
+	if err != nil {
+		return err
+	}
+	var b bytes.Buffer
+	b.WriteString(fmt.Sprintf("Datastore version: %d (latest: %d)\n", v, engine.LatestDatastoreVersion()))
+
+	var migrations []engine.Migration
+	if cctx.Bool("dry-run") {
+		migrations, err = engine.PendingMigrations(cctx.Context, ds)
+		if err != nil {
+			return err
+		}
+		if len(migrations) != 0 {
+			b.WriteString("Pending migrations:\n")
+		}
+	} else {
+		migrations, err = engine.Migrate(cctx.Context, ds)
+		if len(migrations) != 0 {
+			b.WriteString("Applied migrations:\n")
+		}
+	}
+	for _, m := range migrations {
+		b.WriteString(fmt.Sprintf("\t%d: %s\n", m.Version, m.Description))
+	}
+	if len(migrations) == 0 && err == nil {
+		b.WriteString("Datastore is up to date.\n")
+	}
+	if _, werr := cctx.App.Writer.Write(b.Bytes()); werr != nil {
+		return werr
+	}
+	return err
+}
+
+// loadConfig loads the provider config, returning a user-friendly error if the provider is not
+// initialized.
+func loadConfig() (*config.Config, error) {
+	cfg, err := config.Load("")
+	if err != nil {
+		if err == config.ErrNotInitialized {
+			return nil, errors.New("reference provider is not initialized\nTo initialize, run using the \"init\" command")
+		}
+		return nil, fmt.Errorf("cannot load config file: %w", err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"encoding/base32"
+	"fmt"
+
+	"github.com/filecoin-project/index-provider/cmd/provider/internal/config"
+	"github.com/filecoin-project/index-provider/engine"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/mount"
+	dsq "github.com/ipfs/go-datastore/query"
+	dssync "github.com/ipfs/go-datastore/sync"
+	badger "github.com/ipfs/go-ds-badger2"
+	flatfs "github.com/ipfs/go-ds-flatfs"
+	leveldb "github.com/ipfs/go-ds-leveldb"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+// openDatastore opens the provider datastore as configured.
+func openDatastore(cfg config.Datastore) (datastore.Batching, error) {
+	switch cfg.Type {
+	case config.LevelDatastoreType:
+		return openLevelDatastore(cfg.Dir)
+	case config.MemoryDatastoreType:
+		return dssync.MutexWrap(datastore.NewMapDatastore()), nil
+	case config.BadgerDatastoreType:
+		dir, err := writableDatastorePath(cfg.Dir)
+		if err != nil {
+			return nil, err
+		}
+		return badger.NewDatastore(dir, nil)
+	case config.FlatfsLevelDatastoreType:
+		chunksDir, err := writableDatastorePath(cfg.ChunksDir)
+		if err != nil {
+			return nil, err
+		}
+		chunks, err := flatfs.CreateOrOpen(chunksDir, flatfs.NextToLast(2), true)
+		if err != nil {
+			return nil, err
+		}
+		ds, err := openLevelDatastore(cfg.Dir)
+		if err != nil {
+			chunks.Close()
+			return nil, err
+		}
+		return mount.New([]mount.Mount{
+			{Prefix: datastore.NewKey(engine.EntriesCacheKeyPrefix), Datastore: &flatfsDatastore{chunks}},
+			{Prefix: datastore.NewKey("/"), Datastore: ds},
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown datastore type: %q", cfg.Type)
+	}
+}
+
+func writableDatastorePath(dir string) (string, error) {
+	path, err := config.Path("", dir)
+	if err != nil {
+		return "", err
+	}
+	if err = checkWritable(path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func openLevelDatastore(dir string) (*levelDatastore, error) {
+	path, err := writableDatastorePath(dir)
+	if err != nil {
+		return nil, err
+	}
+	ds, err := leveldb.NewDatastore(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &levelDatastore{ds}, nil
+}
+
+// levelDatastore is a leveldb datastore that compacts the database when garbage is collected.
+type levelDatastore struct {
+	*leveldb.Datastore
+}
+
+var _ datastore.GCDatastore = (*levelDatastore)(nil)
+
+func (d *levelDatastore) CollectGarbage(context.Context) error {
+	return d.DB.CompactRange(util.Range{})
+}
+
+// flatfsDatastore adapts a flatfs datastore to store arbitrary keys.
+//
+// Flatfs only supports single component keys made up of a restricted set of characters. Keys are
+// therefore encoded as unpadded base32 in a single component, and queries are performed over all
+// keys with the query logic applied naively.
+type flatfsDatastore struct {
+	*flatfs.Datastore
+}
+
+var (
+	_ datastore.Batching            = (*flatfsDatastore)(nil)
+	_ datastore.PersistentDatastore = (*flatfsDatastore)(nil)
+
+	flatfsKeyEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+)
+
+func (d *flatfsDatastore) Put(ctx context.Context, key datastore.Key, value []byte) error {
+	return d.Datastore.Put(ctx, encodeFlatfsKey(key), value)
+}
+
+func (d *flatfsDatastore) Get(ctx context.Context, key datastore.Key) ([]byte, error) {
+	return d.Datastore.Get(ctx, encodeFlatfsKey(key))
+}
+
+func (d *flatfsDatastore) Has(ctx context.Context, key datastore.Key) (bool, error) {
+	return d.Datastore.Has(ctx, encodeFlatfsKey(key))
+}
+
+func (d *flatfsDatastore) GetSize(ctx context.Context, key datastore.Key) (int, error) {
+	return d.Datastore.GetSize(ctx, encodeFlatfsKey(key))
+}
+
+func (d *flatfsDatastore) Delete(ctx context.Context, key datastore.Key) error {
+	return d.Datastore.Delete(ctx, encodeFlatfsKey(key))
+}
+
+func (d *flatfsDatastore) Sync(ctx context.Context, _ datastore.Key) error {
+	return d.Datastore.Sync(ctx, datastore.NewKey("/"))
+}
+
+func (d *flatfsDatastore) Query(ctx context.Context, q dsq.Query) (dsq.Results, error) {
+	results, err := d.Datastore.Query(ctx, dsq.Query{KeysOnly: q.KeysOnly, ReturnsSizes: q.ReturnsSizes})
+	if err != nil {
+		return nil, err
+	}
+	decoded := dsq.ResultsFromIterator(q, dsq.Iterator{
+		Next: func() (dsq.Result, bool) {
+			r, ok := results.NextSync()
+			if !ok || r.Error != nil {
+				return r, ok
+			}
+			key, err := decodeFlatfsKey(r.Key)
+			if err != nil {
+				return dsq.Result{Error: err}, true
+			}
+			r.Key = key.String()
+			return r, true
+		},
+		Close: results.Close,
+	})
+	return dsq.NaiveQueryApply(q, decoded), nil
+}
+
+func (d *flatfsDatastore) Batch(ctx context.Context) (datastore.Batch, error) {
+	b, err := d.Datastore.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &flatfsBatch{b}, nil
+}
+
+type flatfsBatch struct {
+	datastore.Batch
+}
+
+func (b *flatfsBatch) Put(ctx context.Context, key datastore.Key, value []byte) error {
+	return b.Batch.Put(ctx, encodeFlatfsKey(key), value)
+}
+
+func (b *flatfsBatch) Delete(ctx context.Context, key datastore.Key) error {
+	return b.Batch.Delete(ctx, encodeFlatfsKey(key))
+}
+
+func encodeFlatfsKey(key datastore.Key) datastore.Key {
+	return datastore.RawKey("/" + flatfsKeyEncoding.EncodeToString(key.Bytes()))
+}
+
+func decodeFlatfsKey(key string) (datastore.Key, error) {
+	b, err := flatfsKeyEncoding.DecodeString(datastore.RawKey(key).BaseNamespace())
+	if err != nil {
+		return datastore.Key{}, fmt.Errorf("malformed flatfs key %s: %w", key, err)
+	}
+	return datastore.RawKey(string(b)), nil
+}
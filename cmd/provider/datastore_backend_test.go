@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	provider "github.com/filecoin-project/index-provider"
+	"github.com/filecoin-project/index-provider/cmd/provider/internal/config"
+	"github.com/filecoin-project/index-provider/engine"
+	"github.com/filecoin-project/index-provider/metadata"
+	"github.com/filecoin-project/index-provider/testutil"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_openDatastore_PersistsEngineState(t *testing.T) {
+	tests := []config.Datastore{
+		{Type: config.LevelDatastoreType, Dir: "levelds"},
+		{Type: config.BadgerDatastoreType, Dir: "badgerds"},
+		{Type: config.FlatfsLevelDatastoreType, Dir: "levelds", ChunksDir: filepath.Join(t.TempDir(), "chunks")},
+	}
+	for _, cfg := range tests {
+		cfg := cfg
+		t.Run(cfg.Type, func(t *testing.T) {
+			t.Setenv(config.EnvDir, t.TempDir())
+			ctx := testutil.ContextWithTimeout(t)
+			rng := rand.New(rand.NewSource(1413))
+			mhs := testutil.RandomMultihashes(t, rng, 42)
+			h, err := libp2p.New()
+			require.NoError(t, err)
+			defer h.Close()
+
+			ds, err := openDatastore(cfg)
+			require.NoError(t, err)
+			subject := startTestEngine(t, ctx, h.ID(), ds, mhs)
+			adCid, err := subject.NotifyPut(ctx, nil, []byte("fish"), metadata.Default.New(metadata.Bitswap{}))
+			require.NoError(t, err)
+			require.NoError(t, subject.Shutdown())
+			require.NoError(t, ds.Close())
+
+			// Reopen the datastore and assert that the advertisement and its cached entries are
+			// restored.
+			ds, err = openDatastore(cfg)
+			require.NoError(t, err)
+			defer ds.Close()
+			subject = startTestEngine(t, ctx, h.ID(), ds, mhs)
+			defer subject.Shutdown()
+			ad, err := subject.GetAdv(ctx, adCid)
+			require.NoError(t, err)
+			chunk, err := ds.Get(ctx, datastore.NewKey(engine.EntriesCacheKeyPrefix).ChildString(ad.Entries.String()))
+			require.NoError(t, err)
+			require.NotEmpty(t, chunk)
+			if cfg.Type == config.FlatfsLevelDatastoreType {
+				chunkFiles, err := filepath.Glob(filepath.Join(cfg.ChunksDir, "*", "*.data"))
+				require.NoError(t, err)
+				require.NotEmpty(t, chunkFiles)
+			}
+			_, err = subject.NotifyPut(ctx, nil, []byte("fish"), metadata.Default.New(metadata.Bitswap{}))
+			require.Equal(t, provider.ErrAlreadyAdvertised, err)
+
+			// Assert that the datastore can be copied.
+			dst, err := openDatastore(config.Datastore{Type: config.LevelDatastoreType, Dir: "copy"})
+			require.NoError(t, err)
+			defer dst.Close()
+			count, err := copyDatastore(ctx, ds, dst)
+			require.NoError(t, err)
+			require.Equal(t, countKeys(t, ctx, ds), count)
+			require.Equal(t, count, countKeys(t, ctx, dst))
+		})
+	}
+}
+
+func startTestEngine(t *testing.T, ctx context.Context, pid peer.ID, ds datastore.Batching, mhs []multihash.Multihash) *engine.Engine {
+	subject, err := engine.New(engine.WithDatastore(ds), engine.WithProvider(peer.AddrInfo{ID: pid}))
+	require.NoError(t, err)
+	require.NoError(t, subject.Start(ctx))
+	subject.RegisterMultihashLister(func(context.Context, peer.ID, []byte) (provider.MultihashIterator, error) {
+		if mhs == nil {
+			return nil, errors.New("not found")
+		}
+		return provider.SliceMultihashIterator(mhs), nil
+	})
+	return subject
+}
+
+func countKeys(t *testing.T, ctx context.Context, ds datastore.Datastore) int {
+	results, err := ds.Query(ctx, query.Query{KeysOnly: true})
+	require.NoError(t, err)
+	entries, err := results.Rest()
+	require.NoError(t, err)
+	return len(entries)
+}
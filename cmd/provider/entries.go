@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+
+	adminserver "github.com/filecoin-project/index-provider/server/admin/http"
+	"github.com/urfave/cli/v2"
+)
+
+var EntriesCmd = &cli.Command{
+	Name:        "entries",
+	Usage:       "Manages the advertisement entries published by the provider.",
+	Subcommands: []*cli.Command{entriesReencodeSubCmd},
+}
+
+var entriesReencodeSubCmd = &cli.Command{
+	Name:  "reencode",
+	Usage: "Republishes advertised context IDs with entries in the currently configured format.",
+	Description: `Regenerates the entries of every context ID currently advertised by the provider
+using the entries format the daemon is running with, and publishes a new advertisement for
+each context ID whose entries have changed as a result. The previously cached entry chunks
+are removed from the entries cache.
+
+To change the entries format, update the Ingest.EntriesFormat section of the config, restart
+the daemon and then run this command.`,
+	Flags:  entriesReencodeFlags,
+	Action: doEntriesReencode,
+}
+
+func doEntriesReencode(cctx *cli.Context) error {
+	req, err := http.NewRequestWithContext(cctx.Context, http.MethodPost, adminAPIFlagValue+"/admin/entries/reencode", nil)
+	if err != nil {
+		return err
+	}
+
+	cl := &http.Client{}
+	resp, err := cl.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errFromHttpResp(resp)
+	}
+
+	var res adminserver.ReencodeEntriesRes
+	if _, err := res.ReadFrom(resp.Body); err != nil {
+		return fmt.Errorf("received ok response from server but cannot decode response body. %v", err)
+	}
+	var b bytes.Buffer
+	b.WriteString(fmt.Sprintf("Successfully re-encoded entries of %d context IDs.\n", len(res.AdvIds)))
+	for _, adCid := range res.AdvIds {
+		b.WriteString("\t Advertisement ID: ")
+		b.WriteString(adCid.String())
+		b.WriteString("\n")
+	}
+	_, err = cctx.App.Writer.Write(b.Bytes())
+	return err
+}
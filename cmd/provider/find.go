@@ -2,8 +2,11 @@ package main
 
 import (
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"net/http"
 
+	adminserver "github.com/filecoin-project/index-provider/server/admin/http"
 	httpfinderclient "github.com/filecoin-project/storetheindex/api/v0/finder/client/http"
 	"github.com/ipfs/go-cid"
 	"github.com/multiformats/go-multihash"
@@ -11,18 +14,18 @@ import (
 )
 
 var FindCmd = &cli.Command{
-	Name:   "find",
-	Usage:  "Query an indexer for indexed content",
+	Name:  "find",
+	Usage: "Query an indexer for indexed content",
+	Description: `Queries the given indexer for the providers of the given multihashes or CIDs.
+
+When --local is set, the local index of the provider is queried via its admin API instead.
+The local index is enabled by setting Ingest.LocalIndex to true in the config, or by serving
+content over Bitswap or HTTP.`,
 	Flags:  findFlags,
 	Action: findCommand,
 }
 
 func findCommand(cctx *cli.Context) error {
-	cli, err := httpfinderclient.New(cctx.String("indexer"))
-	if err != nil {
-		return err
-	}
-
 	mhArgs := cctx.StringSlice("mh")
 	cidArgs := cctx.StringSlice("cid")
 	mhs := make([]multihash.Multihash, 0, len(mhArgs)+len(cidArgs))
@@ -41,6 +44,19 @@ func findCommand(cctx *cli.Context) error {
 		mhs = append(mhs, c.Hash())
 	}
 
+	if cctx.Bool("local") {
+		return findLocal(cctx, mhs)
+	}
+
+	indexer := cctx.String("indexer")
+	if indexer == "" {
+		return errors.New("indexer must be specified unless --local is set")
+	}
+	cli, err := httpfinderclient.New(indexer)
+	if err != nil {
+		return err
+	}
+
 	resp, err := cli.FindBatch(cctx.Context, mhs)
 	if err != nil {
 		return err
@@ -63,3 +79,49 @@ func findCommand(cctx *cli.Context) error {
 
 	return nil
 }
+
+func findLocal(cctx *cli.Context, mhs []multihash.Multihash) error {
+	cl := &http.Client{}
+	var found []*adminserver.FindLocalRes
+	for _, mh := range mhs {
+		req, err := http.NewRequestWithContext(cctx.Context, http.MethodGet, adminAPIFlagValue+"/admin/find/"+mh.B58String(), nil)
+		if err != nil {
+			return err
+		}
+		resp, err := cl.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err = errFromHttpResp(resp)
+			resp.Body.Close()
+			return err
+		}
+		var res adminserver.FindLocalRes
+		_, err = res.ReadFrom(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("received ok response from server but cannot decode response body. %v", err)
+		}
+		if len(res.Results) != 0 {
+			found = append(found, &res)
+		}
+	}
+
+	w := cctx.App.Writer
+	if len(found) == 0 {
+		fmt.Fprintln(w, "index not found")
+		return nil
+	}
+
+	fmt.Fprintln(w, "Content providers:")
+	for _, res := range found {
+		fmt.Fprintln(w, "   Multihash:", res.Multihash.B58String())
+		for _, r := range res.Results {
+			fmt.Fprintln(w, "       Provider:", r.Provider)
+			fmt.Fprintln(w, "       ContextID:", base64.StdEncoding.EncodeToString(r.ContextID))
+			fmt.Fprintln(w, "       Metadata:", base64.StdEncoding.EncodeToString(r.Metadata))
+		}
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/urfave/cli/v2"
 )
 
@@ -13,6 +15,42 @@ var announceHttpFlags = []cli.Flag{
 	indexerFlag,
 }
 
+var entriesReencodeFlags = []cli.Flag{
+	adminAPIFlag,
+}
+
+var datastoreGCFlags = []cli.Flag{
+	adminAPIFlag,
+}
+
+var datastoreConvertFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "type",
+		Usage:    "The type of the destination datastore, one of: levelds, badgerds or flatfs-levelds",
+		Required: true,
+	},
+	&cli.StringFlag{
+		Name:     "dir",
+		Usage:    "The directory of the destination datastore, relative to the config root unless absolute",
+		Required: true,
+	},
+	&cli.StringFlag{
+		Name:  "chunks-dir",
+		Usage: "The directory of the destination entry chunks when type is flatfs-levelds, relative to the config root unless absolute",
+	},
+	&cli.BoolFlag{
+		Name:  "update-config",
+		Usage: "Update the config to use the destination datastore once converted",
+	},
+}
+
+var datastoreMigrateFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "List the pending migrations without applying them",
+	},
+}
+
 var daemonFlags = []cli.Flag{
 	carZeroLengthAsEOFFlag,
 	&cli.StringFlag{
@@ -51,7 +89,16 @@ var addrFlag = &cli.StringSliceFlag{
 }
 
 var findFlags = []cli.Flag{
-	indexerFlag,
+	&cli.StringFlag{
+		Name:    "indexer",
+		Usage:   "Host or host:port of indexer to use. Required unless --local is set",
+		Aliases: []string{"i"},
+	},
+	&cli.BoolFlag{
+		Name:  "local",
+		Usage: "Look up the content in the local index of the provider instead of an indexer",
+	},
+	adminAPIFlag,
 	&cli.StringSliceFlag{
 		Name:     "mh",
 		Usage:    "Specify multihash to use as indexer key, multiple OK",
@@ -64,6 +111,36 @@ var findFlags = []cli.Flag{
 	},
 }
 
+var retrieveFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:     "cid",
+		Usage:    "The root CID of the DAG to retrieve",
+		Required: true,
+	},
+	&cli.StringFlag{
+		Name: "provider",
+		Usage: "The provider's address in form of libp2p multiaddr info, from which to retrieve directly. " +
+			"Example HTTP endpoint: /ip4/1.2.3.4/tcp/3104/http/p2p/12D3KooWE8yt84RVwW3sFcd6WMjbUdWrZer2YtT4dmtj3dHdahSZ",
+		Aliases: []string{"p"},
+	},
+	&cli.StringFlag{
+		Name:    "via-indexer",
+		Usage:   "The URL of the indexer on which to look up the provider records of the CID",
+		Aliases: []string{"i"},
+	},
+	&cli.PathFlag{
+		Name:        "output",
+		Usage:       "The path of the CAR file to which to write the retrieved DAG",
+		Aliases:     []string{"o"},
+		DefaultText: "<cid>.car",
+	},
+	&cli.DurationFlag{
+		Name:  "timeout",
+		Usage: "The maximum time to retrieve the DAG over each protocol",
+		Value: 5 * time.Minute,
+	},
+}
+
 var indexFlags = []cli.Flag{
 	indexerFlag,
 	addrFlag,
@@ -145,8 +222,29 @@ var registerFlags = []cli.Flag{
 var importCarFlags = []cli.Flag{
 	adminAPIFlag,
 	carPathFlag,
+	carShardFlag,
 	metadataFlag,
 	keyFlag,
+	keyDerivationFlag,
+	computePieceCIDFlag,
+	httpMetadataFlag,
+	httpURLTemplateFlag,
+	httpTrustlessCARFlag,
+	httpAuthHintFlag,
+}
+
+var importContentFlags = []cli.Flag{
+	adminAPIFlag,
+	supplierFlag,
+	contentPathFlag,
+	metadataFlag,
+	keyFlag,
+}
+
+var removeContentFlags = []cli.Flag{
+	adminAPIFlag,
+	supplierFlag,
+	requiredKeyFlag,
 }
 
 var removeCarFlags = []cli.Flag{
@@ -166,6 +264,25 @@ var (
 	}
 )
 
+var (
+	httpMetadataFlag = &cli.BoolFlag{
+		Name:  "http",
+		Usage: "Whether to advertise that the content is retrievable over HTTP, in addition to the given or default metadata. Implied by any of the other http flags.",
+	}
+	httpURLTemplateFlag = &cli.StringFlag{
+		Name:  "http-url-template",
+		Usage: "The base URL or path template at which the content is retrievable over HTTP, e.g. https://example.com/ipfs/{cid}",
+	}
+	httpTrustlessCARFlag = &cli.BoolFlag{
+		Name:  "http-trustless-car",
+		Usage: "Whether HTTP responses are trustless CAR streams as opposed to raw blocks.",
+	}
+	httpAuthHintFlag = &cli.StringSliceFlag{
+		Name:  "http-auth-hint",
+		Usage: "The authentication scheme accepted by the HTTP server, e.g. bearer. Multiple OK.",
+	}
+)
+
 var (
 	keyFlagValue string
 	keyFlag      = &cli.StringFlag{
@@ -182,10 +299,43 @@ var (
 	carPathFlag      = &cli.StringFlag{
 		Name:        "input",
 		Aliases:     []string{"i"},
-		Usage:       "Path to the CAR file to import",
+		Usage:       "Path to the CAR file to import, or its http(s):// URL if it is served remotely",
 		Destination: &carPathFlagValue,
 		Required:    true,
 	}
+	keyDerivationFlag = &cli.StringFlag{
+		Name:  "derive-key",
+		Usage: "Derive the key from the CAR content instead of its path; one of \"roots\" or \"content\". Importing identical content again returns the existing advertisement.",
+	}
+	computePieceCIDFlag = &cli.BoolFlag{
+		Name:  "compute-piece-cid",
+		Usage: "Compute the piece commitment (CommP) of the CAR padded to a power-of-two piece size, and advertise it as the piece CID for graphsync retrieval. Not supported with --shard.",
+	}
+	carShardFlag = &cli.StringSliceFlag{
+		Name:  "shard",
+		Usage: "Path to an additional CAR file whose content is advertised along with the input CAR under the same context ID. Can be specified multiple times.",
+	}
+)
+
+var (
+	supplierFlag = &cli.StringFlag{
+		Name:  "supplier",
+		Usage: "The name of the supplier via which content is imported or removed, e.g. unixfs.",
+		Value: "unixfs",
+	}
+	contentPathFlag = &cli.StringFlag{
+		Name:     "input",
+		Aliases:  []string{"i"},
+		Usage:    "Path to the content to import, as interpreted by the supplier.",
+		Required: true,
+	}
+	requiredKeyFlag = &cli.StringFlag{
+		Name:        "key",
+		Usage:       "Base64 encoded lookup key with which the content was imported.",
+		Aliases:     []string{"k"},
+		Required:    true,
+		Destination: &keyFlagValue,
+	}
 )
 
 var (
@@ -7,11 +7,15 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"strconv"
 
 	"github.com/filecoin-project/index-provider/cardatatransfer"
 	"github.com/filecoin-project/index-provider/metadata"
 	adminserver "github.com/filecoin-project/index-provider/server/admin/http"
+	"github.com/filecoin-project/index-provider/supplier"
+	"github.com/multiformats/go-multicodec"
 	"github.com/urfave/cli/v2"
 )
 
@@ -19,7 +23,7 @@ var ImportCmd = &cli.Command{
 	Name:        "import",
 	Aliases:     []string{"i"},
 	Usage:       "Imports sources of multihashes to the index provider.",
-	Subcommands: []*cli.Command{importCarSubCmd},
+	Subcommands: []*cli.Command{importCarSubCmd, importContentSubCmd},
 }
 
 var (
@@ -36,14 +40,20 @@ var (
 )
 
 func beforeImportCar(cctx *cli.Context) error {
-	if cctx.IsSet(keyFlag.Name) {
+	if cctx.IsSet(keyDerivationFlag.Name) {
+		if cctx.IsSet(keyFlag.Name) {
+			return errors.New("only one of key or derive-key must be specified")
+		}
+		// The key is derived by the provider.
+		importCarKey = nil
+	} else if cctx.IsSet(keyFlag.Name) {
 		decoded, err := base64.StdEncoding.DecodeString(keyFlagValue)
 		if err != nil {
 			return errors.New("key is not a valid base64 encoded string")
 		}
 		importCarKey = decoded
 	} else {
-		absCarPath, err := filepath.Abs(carPathFlagValue)
+		absCarPath, err := absCarLocation(carPathFlagValue)
 		if err != nil {
 			return err
 		}
@@ -60,9 +70,10 @@ func beforeImportCar(cctx *cli.Context) error {
 		if err != nil {
 			return err
 		}
-	} else {
+	} else if importCarKey != nil {
 		// If no metadata is set, generate metadata that is compatible for FileCoin retrieval base
-		// on the context ID
+		// on the context ID. Derived context IDs are only known to the provider, which generates
+		// such metadata instead.
 		var err error
 		tp, err := cardatatransfer.TransportFromContextID(importCarKey)
 		if err != nil {
@@ -70,9 +81,37 @@ func beforeImportCar(cctx *cli.Context) error {
 		}
 		md = metadata.Default.New(tp)
 	}
+	if httpMetadataRequested(cctx) {
+		var protocols []metadata.Protocol
+		for _, id := range md.Protocols() {
+			if id != multicodec.Http {
+				protocols = append(protocols, md.Get(id))
+			}
+		}
+		protocols = append(protocols, &metadata.HTTPRetrievalV1{
+			URLTemplate:  cctx.String(httpURLTemplateFlag.Name),
+			TrustlessCAR: cctx.Bool(httpTrustlessCARFlag.Name),
+			AuthHints:    cctx.StringSlice(httpAuthHintFlag.Name),
+		})
+		md = metadata.Default.New(protocols...)
+	}
 	return nil
 }
 
+// httpMetadataRequested checks whether any of the flags that specify HTTP retrieval metadata are
+// set.
+func httpMetadataRequested(cctx *cli.Context) bool {
+	if cctx.IsSet(httpMetadataFlag.Name) {
+		return cctx.Bool(httpMetadataFlag.Name)
+	}
+	for _, f := range []string{httpURLTemplateFlag.Name, httpTrustlessCARFlag.Name, httpAuthHintFlag.Name} {
+		if cctx.IsSet(f) {
+			return true
+		}
+	}
+	return false
+}
+
 func doImportCar(cctx *cli.Context) error {
 
 	mdBytes, err := md.MarshalBinary()
@@ -80,15 +119,27 @@ func doImportCar(cctx *cli.Context) error {
 		return err
 	}
 
-	absCarPath, err := filepath.Abs(carPathFlagValue)
+	absCarPath, err := absCarLocation(carPathFlagValue)
 	if err != nil {
 		return err
 	}
 
+	var absShardPaths []string
+	for _, shardPath := range cctx.StringSlice(carShardFlag.Name) {
+		absShardPath, err := absCarLocation(shardPath)
+		if err != nil {
+			return err
+		}
+		absShardPaths = append(absShardPaths, absShardPath)
+	}
+
 	req := adminserver.ImportCarReq{
-		Path:     absCarPath,
-		Key:      importCarKey,
-		Metadata: mdBytes,
+		Path:            absCarPath,
+		Shards:          absShardPaths,
+		Key:             importCarKey,
+		KeyDerivation:   cctx.String(keyDerivationFlag.Name),
+		Metadata:        mdBytes,
+		ComputePieceCID: cctx.Bool(computePieceCIDFlag.Name),
 	}
 	resp, err := doHttpPostReq(cctx.Context, adminAPIFlagValue+"/admin/import/car", req)
 	if err != nil {
@@ -104,12 +155,95 @@ func doImportCar(cctx *cli.Context) error {
 		return fmt.Errorf("received ok response from server but cannot decode response body. %v", err)
 	}
 	var b bytes.Buffer
-	b.WriteString("Successfully imported CAR.\n")
+	if res.Duplicate {
+		b.WriteString("Identical CAR content is already imported.\n")
+	} else {
+		b.WriteString("Successfully imported CAR.\n")
+	}
 	b.WriteString("\t Advertisement ID: ")
 	b.WriteString(res.AdvId.String())
 	b.WriteString("\n\t Context ID: ")
-	b.WriteString(base64.StdEncoding.EncodeToString(importCarKey))
+	b.WriteString(base64.StdEncoding.EncodeToString(res.Key))
 	b.WriteString("\n")
+	if res.PieceCID.Defined() {
+		b.WriteString("\t Piece CID: ")
+		b.WriteString(res.PieceCID.String())
+		b.WriteString("\n\t Piece size: ")
+		b.WriteString(strconv.FormatUint(res.PieceSize, 10))
+		b.WriteString("\n")
+	}
 	_, err = cctx.App.Writer.Write(b.Bytes())
 	return err
 }
+
+var importContentSubCmd = &cli.Command{
+	Name:  "content",
+	Usage: "Imports content from a path via any supplier of the provider, e.g. unixfs",
+	Description: `Imports the content at the given path via the named supplier, and advertises it.
+The path is interpreted by the supplier: the unixfs supplier imports a plain file or directory
+as a UnixFS DAG.
+
+If no key is specified, it is calculated as the SHA_256 hash of the absolute path. If no metadata
+is specified, Bitswap metadata is advertised.`,
+	Flags:  importContentFlags,
+	Action: doImportContent,
+}
+
+func doImportContent(cctx *cli.Context) error {
+	path, err := filepath.Abs(cctx.String(contentPathFlag.Name))
+	if err != nil {
+		return err
+	}
+	key := sha256.Sum256([]byte(path))
+	req := adminserver.ImportReq{
+		Path: path,
+		Key:  key[:],
+	}
+	if cctx.IsSet(keyFlag.Name) {
+		if req.Key, err = base64.StdEncoding.DecodeString(keyFlagValue); err != nil {
+			return errors.New("key is not a valid base64 encoded string")
+		}
+	}
+	if cctx.IsSet(metadataFlag.Name) {
+		if req.Metadata, err = base64.StdEncoding.DecodeString(metadataFlagValue); err != nil {
+			return errors.New("metadata is not a valid base64 encoded string")
+		}
+	} else {
+		md := metadata.Default.New(&metadata.Bitswap{})
+		if req.Metadata, err = md.MarshalBinary(); err != nil {
+			return err
+		}
+	}
+
+	name := cctx.String(supplierFlag.Name)
+	resp, err := doHttpPostReq(cctx.Context, adminAPIFlagValue+"/admin/import/"+url.PathEscape(name), req)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errFromHttpResp(resp)
+	}
+
+	var res adminserver.ImportRes
+	if _, err := res.ReadFrom(resp.Body); err != nil {
+		return fmt.Errorf("received ok response from server but cannot decode response body. %v", err)
+	}
+	var b bytes.Buffer
+	b.WriteString("Successfully imported content.\n")
+	b.WriteString("\t Advertisement ID: ")
+	b.WriteString(res.AdvId.String())
+	b.WriteString("\n\t Context ID: ")
+	b.WriteString(base64.StdEncoding.EncodeToString(res.Key))
+	b.WriteString("\n")
+	_, err = cctx.App.Writer.Write(b.Bytes())
+	return err
+}
+
+// absCarLocation returns the absolute path of the given CAR location, unless it is an HTTP(S) URL
+// in which case it is returned as is.
+func absCarLocation(path string) (string, error) {
+	if supplier.IsRemoteCar(path) {
+		return path, nil
+	}
+	return filepath.Abs(path)
+}
@@ -9,7 +9,6 @@ import (
 	"github.com/filecoin-project/index-provider/metadata"
 	httpc "github.com/filecoin-project/storetheindex/api/v0/ingest/client/http"
 	"github.com/ipfs/go-cid"
-	"github.com/multiformats/go-multicodec"
 	"github.com/multiformats/go-multihash"
 	"github.com/urfave/cli/v2"
 )
@@ -66,7 +65,7 @@ func indexCommand(cctx *cli.Context) error {
 	if err != nil {
 		return errors.New("metadata is not a valid base64 encoded string")
 	}
-	md = metadata.Default.WithProtocol(multicodec.Http, metadata.HTTPV1).New()
+	md = metadata.Default.New()
 	err = md.UnmarshalBinary(decoded)
 	if err != nil {
 		return err
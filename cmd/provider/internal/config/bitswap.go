@@ -0,0 +1,45 @@
+package config
+
+const (
+	defaultBitswapMaxBlocksPerSecondPerPeer = 1000
+	defaultBitswapBurstPerPeer              = 2000
+	defaultBitswapTaskWorkerCount           = 8
+)
+
+// Bitswap configures the Bitswap server, which serves the blocks of all supplied content to the
+// peers that retrieve it over Bitswap, e.g. as advertised with Bitswap metadata.
+type Bitswap struct {
+	// Disabled sets whether to not serve content over Bitswap.
+	Disabled bool
+	// MaxBlocksPerSecondPerPeer is the maximum rate at which the wants of each peer are accepted.
+	// Wants beyond the rate are answered as if the blocks were not present. A negative value
+	// disables rate limiting.
+	MaxBlocksPerSecondPerPeer float64
+	// BurstPerPeer is the maximum number of wants of each peer that are accepted at once, beyond
+	// MaxBlocksPerSecondPerPeer.
+	BurstPerPeer int
+	// TaskWorkerCount is the number of workers that send blocks to peers.
+	TaskWorkerCount int
+}
+
+// NewBitswap instantiates a new Bitswap config with default values.
+func NewBitswap() Bitswap {
+	return Bitswap{
+		MaxBlocksPerSecondPerPeer: defaultBitswapMaxBlocksPerSecondPerPeer,
+		BurstPerPeer:              defaultBitswapBurstPerPeer,
+		TaskWorkerCount:           defaultBitswapTaskWorkerCount,
+	}
+}
+
+// PopulateDefaults replaces zero-values in the config with default values.
+func (c *Bitswap) PopulateDefaults() {
+	if c.MaxBlocksPerSecondPerPeer == 0 {
+		c.MaxBlocksPerSecondPerPeer = defaultBitswapMaxBlocksPerSecondPerPeer
+	}
+	if c.BurstPerPeer == 0 {
+		c.BurstPerPeer = defaultBitswapBurstPerPeer
+	}
+	if c.TaskWorkerCount == 0 {
+		c.TaskWorkerCount = defaultBitswapTaskWorkerCount
+	}
+}
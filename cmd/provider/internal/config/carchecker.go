@@ -0,0 +1,30 @@
+package config
+
+import "time"
+
+const defaultCarCheckerInterval = Duration(10 * time.Minute)
+
+// CarChecker configures the periodic integrity checks of the imported CAR files, which detect CAR
+// files that are moved, deleted or modified after they are imported.
+type CarChecker struct {
+	// Interval is the interval at which the imported CAR files are checked.
+	Interval Duration
+	// RemoveBroken sets whether to remove the CAR files found to be missing or modified, which
+	// publishes the removal of their advertisements. Otherwise, broken CAR files are only reported
+	// as such when listing CAR files.
+	RemoveBroken bool
+}
+
+// NewCarChecker instantiates a new CarChecker config with default values.
+func NewCarChecker() CarChecker {
+	return CarChecker{
+		Interval: defaultCarCheckerInterval,
+	}
+}
+
+// PopulateDefaults replaces zero-values in the config with default values.
+func (c *CarChecker) PopulateDefaults() {
+	if c.Interval == 0 {
+		c.Interval = defaultCarCheckerInterval
+	}
+}
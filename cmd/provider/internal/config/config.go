@@ -11,14 +11,21 @@ import (
 
 // Config is used to load config files.
 type Config struct {
-	Identity       Identity
-	Datastore      Datastore
-	Ingest         Ingest
-	ProviderServer ProviderServer
-	AdminServer    AdminServer
-	Bootstrap      Bootstrap
-	DirectAnnounce DirectAnnounce
-	Reframe        Reframe
+	Identity           Identity
+	Datastore          Datastore
+	Ingest             Ingest
+	ProviderServer     ProviderServer
+	AdminServer        AdminServer
+	Bootstrap          Bootstrap
+	DirectAnnounce     DirectAnnounce
+	Reframe            Reframe
+	Metadata           Metadata
+	DirSupplier        DirSupplier
+	CarChecker         CarChecker
+	Bitswap            Bitswap
+	HttpRetrieval      HttpRetrieval
+	GraphsyncRetrieval GraphsyncRetrieval
+	Metrics            Metrics
 }
 
 const (
@@ -96,13 +103,18 @@ func Load(filePath string) (*Config, error) {
 
 	// Populate with initial values in case they are not present in config.
 	cfg := Config{
-		Bootstrap:      NewBootstrap(),
-		Datastore:      NewDatastore(),
-		Ingest:         NewIngest(),
-		AdminServer:    NewAdminServer(),
-		ProviderServer: NewProviderServer(),
-		DirectAnnounce: NewDirectAnnounce(),
-		Reframe:        NewReframe(),
+		Bootstrap:          NewBootstrap(),
+		Datastore:          NewDatastore(),
+		Ingest:             NewIngest(),
+		AdminServer:        NewAdminServer(),
+		ProviderServer:     NewProviderServer(),
+		DirectAnnounce:     NewDirectAnnounce(),
+		Reframe:            NewReframe(),
+		DirSupplier:        NewDirSupplier(),
+		CarChecker:         NewCarChecker(),
+		Bitswap:            NewBitswap(),
+		HttpRetrieval:      NewHttpRetrieval(),
+		GraphsyncRetrieval: NewGraphsyncRetrieval(),
 	}
 
 	if err = json.NewDecoder(f).Decode(&cfg); err != nil {
@@ -159,4 +171,9 @@ func (c *Config) PopulateDefaults() {
 	c.Ingest.PopulateDefaults()
 	c.ProviderServer.PopulateDefaults()
 	c.Reframe.PopulateDefaults()
+	c.DirSupplier.PopulateDefaults()
+	c.CarChecker.PopulateDefaults()
+	c.Bitswap.PopulateDefaults()
+	c.HttpRetrieval.PopulateDefaults()
+	c.GraphsyncRetrieval.PopulateDefaults()
 }
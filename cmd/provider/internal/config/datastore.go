@@ -1,23 +1,43 @@
 package config
 
 const (
-	defaultDatastoreType = "levelds"
-	defaultDatastoreDir  = "datastore"
+	defaultDatastoreType      = LevelDatastoreType
+	defaultDatastoreDir       = "datastore"
+	defaultDatastoreChunksDir = "datastore-chunks"
+)
+
+const (
+	// LevelDatastoreType stores all data in a leveldb database.
+	LevelDatastoreType = "levelds"
+	// MemoryDatastoreType stores all data in memory. The data is lost when the provider stops,
+	// which makes it only suitable for ephemeral providers, e.g. in tests.
+	MemoryDatastoreType = "memory"
+	// BadgerDatastoreType stores all data in a badger database, an LSM tree database.
+	BadgerDatastoreType = "badgerds"
+	// FlatfsLevelDatastoreType stores the cached advertisement entry chunks as files in a flatfs
+	// datastore at ChunksDir, and all other data in a leveldb database at Dir. This allows the
+	// potentially large entry chunks to be kept on a different disk from the mappings.
+	FlatfsLevelDatastoreType = "flatfs-levelds"
 )
 
 // Datastore tracks the configuration of the datastore.
 type Datastore struct {
-	// Type is the type of datastore
+	// Type is the type of datastore, one of "levelds", "memory", "badgerds" or "flatfs-levelds".
 	Type string
-	// Dir is the directory within the config root where the datastore is kept
+	// Dir is the directory within the config root where the datastore is kept.
+	// Absolute paths are used as is.
 	Dir string
+	// ChunksDir is the directory within the config root where cached advertisement entry chunks
+	// are kept when Type is "flatfs-levelds". Absolute paths are used as is.
+	ChunksDir string
 }
 
 // NewDatastore instantiates a new Datastore config with default values.
 func NewDatastore() Datastore {
 	return Datastore{
-		Type: defaultDatastoreType,
-		Dir:  defaultDatastoreDir,
+		Type:      defaultDatastoreType,
+		Dir:       defaultDatastoreDir,
+		ChunksDir: defaultDatastoreChunksDir,
 	}
 }
 
@@ -29,4 +49,7 @@ func (c *Datastore) PopulateDefaults() {
 	if c.Dir == "" {
 		c.Dir = defaultDatastoreDir
 	}
+	if c.ChunksDir == "" {
+		c.ChunksDir = defaultDatastoreChunksDir
+	}
 }
@@ -0,0 +1,42 @@
+package config
+
+import "time"
+
+const (
+	defaultDirSupplierPollInterval = Duration(time.Minute)
+	defaultDirSupplierSettleDelay  = Duration(time.Second)
+)
+
+// DirSupplier configures the automatic advertisement of the CAR files in a set of directories.
+// The CAR files are advertised as they appear in the directories and their advertisements are
+// removed as they disappear.
+type DirSupplier struct {
+	// Dirs are the directories whose CAR files are advertised. Only the files with ".car"
+	// extension at the top level of each directory are advertised. Relative paths are resolved
+	// against the working directory of the daemon. Automatic advertisement is disabled if empty.
+	Dirs []string
+	// PollInterval is the interval at which the directories are scanned for changes when they
+	// cannot be watched for file system events, e.g. on platforms other than Linux.
+	PollInterval Duration
+	// SettleDelay is the duration for which a CAR file must remain unmodified before it is
+	// advertised, so that files that are being written are not advertised prematurely.
+	SettleDelay Duration
+}
+
+// NewDirSupplier instantiates a new DirSupplier config with default values.
+func NewDirSupplier() DirSupplier {
+	return DirSupplier{
+		PollInterval: defaultDirSupplierPollInterval,
+		SettleDelay:  defaultDirSupplierSettleDelay,
+	}
+}
+
+// PopulateDefaults replaces zero-values in the config with default values.
+func (c *DirSupplier) PopulateDefaults() {
+	if c.PollInterval == 0 {
+		c.PollInterval = defaultDirSupplierPollInterval
+	}
+	if c.SettleDelay == 0 {
+		c.SettleDelay = defaultDirSupplierSettleDelay
+	}
+}
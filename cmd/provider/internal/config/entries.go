@@ -0,0 +1,63 @@
+package config
+
+const (
+	defaultHamtHashAlg    = "murmur3-x64-64"
+	defaultHamtBitWidth   = 5
+	defaultHamtBucketSize = 3
+)
+
+type EntriesFormatKind string
+
+const (
+	ChainEntriesFormatKind EntriesFormatKind = "chain"
+	HamtEntriesFormatKind  EntriesFormatKind = "hamt"
+)
+
+// EntriesFormat configures the format of the advertisement entries DAG.
+//
+// The chain format uses Ingest.LinkedChunkSize, or Ingest.LinkedChunkMaxBytes
+// when set, to bound the size of each chunk in the chain. The HAMT format
+// uses the Hamt prefixed settings.
+//
+// Note that changing the format of an existing provider does not change the
+// entries of previously published advertisements. To republish them in the
+// new format, use the "provider entries reencode" command.
+type EntriesFormat struct {
+	// Kind is the kind of DAG that entries are formatted as; either "chain" or
+	// "hamt". Defaults to "chain" if unset.
+	Kind EntriesFormatKind
+	// HamtHashAlg is the name of multicodec hash algorithm used to hash HAMT
+	// keys. Only "identity", "sha2-256" and "murmur3-x64-64" are supported.
+	HamtHashAlg string
+	// HamtBitWidth is the bit-width of HAMT nodes; must be at least 3.
+	HamtBitWidth int
+	// HamtBucketSize is the maximum number of entries in each HAMT bucket;
+	// must be at least 1.
+	HamtBucketSize int
+}
+
+// NewEntriesFormat instantiates a new EntriesFormat config with default values.
+func NewEntriesFormat() EntriesFormat {
+	return EntriesFormat{
+		Kind:           ChainEntriesFormatKind,
+		HamtHashAlg:    defaultHamtHashAlg,
+		HamtBitWidth:   defaultHamtBitWidth,
+		HamtBucketSize: defaultHamtBucketSize,
+	}
+}
+
+// PopulateDefaults replaces zero-values in the config with default values.
+func (c *EntriesFormat) PopulateDefaults() {
+	if c.Kind == "" {
+		c.Kind = ChainEntriesFormatKind
+	}
+	if c.HamtHashAlg == "" {
+		c.HamtHashAlg = defaultHamtHashAlg
+	}
+	if c.HamtBitWidth == 0 {
+		c.HamtBitWidth = defaultHamtBitWidth
+	}
+	if c.HamtBucketSize == 0 {
+		c.HamtBucketSize = defaultHamtBucketSize
+	}
+}
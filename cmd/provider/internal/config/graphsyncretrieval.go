@@ -0,0 +1,47 @@
+package config
+
+const (
+	defaultGraphsyncRetrievalMaxConcurrentTransfers        = 100
+	defaultGraphsyncRetrievalMaxConcurrentTransfersPerPeer = 10
+	// defaultGraphsyncRetrievalMaxSelectorDepth disables the limit, so that selectors recursing
+	// without a depth limit, such as the explore-all selector, are accepted.
+	defaultGraphsyncRetrievalMaxSelectorDepth = -1
+)
+
+// GraphsyncRetrieval configures the retrievals of supplied content over graphsync, as advertised
+// with graphsync metadata.
+type GraphsyncRetrieval struct {
+	// MaxConcurrentTransfers is the maximum number of transfers served at a time across all peers.
+	// Retrievals beyond the limit are rejected. A negative value disables the limit.
+	MaxConcurrentTransfers int
+	// MaxConcurrentTransfersPerPeer is the maximum number of transfers served at a time to each
+	// peer. Retrievals beyond the limit are rejected. A negative value disables the limit.
+	MaxConcurrentTransfersPerPeer int
+	// MaxSelectorDepth is the maximum recursion depth of the selectors of accepted retrievals,
+	// where the depth limits of nested recursions multiply. When limited, selectors that recurse
+	// without a depth limit, such as the explore-all selector, are rejected. A negative value
+	// disables the limit, which is the default.
+	MaxSelectorDepth int64
+}
+
+// NewGraphsyncRetrieval instantiates a new GraphsyncRetrieval config with default values.
+func NewGraphsyncRetrieval() GraphsyncRetrieval {
+	return GraphsyncRetrieval{
+		MaxConcurrentTransfers:        defaultGraphsyncRetrievalMaxConcurrentTransfers,
+		MaxConcurrentTransfersPerPeer: defaultGraphsyncRetrievalMaxConcurrentTransfersPerPeer,
+		MaxSelectorDepth:              defaultGraphsyncRetrievalMaxSelectorDepth,
+	}
+}
+
+// PopulateDefaults replaces zero-values in the config with default values.
+func (c *GraphsyncRetrieval) PopulateDefaults() {
+	if c.MaxConcurrentTransfers == 0 {
+		c.MaxConcurrentTransfers = defaultGraphsyncRetrievalMaxConcurrentTransfers
+	}
+	if c.MaxConcurrentTransfersPerPeer == 0 {
+		c.MaxConcurrentTransfersPerPeer = defaultGraphsyncRetrievalMaxConcurrentTransfersPerPeer
+	}
+	if c.MaxSelectorDepth == 0 {
+		c.MaxSelectorDepth = defaultGraphsyncRetrievalMaxSelectorDepth
+	}
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/filecoin-project/storetheindex/dagsync/httpsync/maconv"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+const (
+	defaultHttpRetrievalReadTimeout  = Duration(30 * time.Second)
+	defaultHttpRetrievalWriteTimeout = Duration(10 * time.Minute)
+)
+
+// HttpRetrieval configures the retrieval HTTP server, which serves the supplied content as a
+// trustless gateway at `GET /ipfs/{cid}`. The server is off by default.
+type HttpRetrieval struct {
+	// ListenMultiaddr is the multiaddr string of the address on which the server listens, e.g.
+	// "/ip4/0.0.0.0/tcp/3104". The server is disabled when empty.
+	ListenMultiaddr string
+	// AnnounceMultiaddr is the multiaddr string of the address at which the server is reachable
+	// by retrieval clients, e.g. "/dns4/example.com/tcp/3104", from which the URL template of the
+	// HTTP retrieval metadata is derived. Defaults to ListenMultiaddr, and must be set if the
+	// latter has an unspecified IP address.
+	AnnounceMultiaddr string
+	ReadTimeout       Duration
+	WriteTimeout      Duration
+}
+
+// NewHttpRetrieval instantiates a new HttpRetrieval config with default values.
+func NewHttpRetrieval() HttpRetrieval {
+	return HttpRetrieval{
+		ReadTimeout:  defaultHttpRetrievalReadTimeout,
+		WriteTimeout: defaultHttpRetrievalWriteTimeout,
+	}
+}
+
+// PopulateDefaults replaces zero-values in the config with default values.
+func (c *HttpRetrieval) PopulateDefaults() {
+	if c.ReadTimeout == 0 {
+		c.ReadTimeout = defaultHttpRetrievalReadTimeout
+	}
+	if c.WriteTimeout == 0 {
+		c.WriteTimeout = defaultHttpRetrievalWriteTimeout
+	}
+}
+
+// ListenNetAddr returns the net address on which the server listens.
+func (c *HttpRetrieval) ListenNetAddr() (string, error) {
+	maddr, err := multiaddr.NewMultiaddr(c.ListenMultiaddr)
+	if err != nil {
+		return "", err
+	}
+
+	netAddr, err := manet.ToNetAddr(maddr)
+	if err != nil {
+		return "", err
+	}
+	return netAddr.String(), nil
+}
+
+// URLTemplate returns the URL template at which the server serves content to retrieval clients,
+// i.e. the gateway path of the announce address, e.g. "http://example.com:3104/ipfs/{cid}".
+func (c *HttpRetrieval) URLTemplate() (string, error) {
+	addr := c.AnnounceMultiaddr
+	if addr == "" {
+		addr = c.ListenMultiaddr
+	}
+	maddr, err := multiaddr.NewMultiaddr(addr)
+	if err != nil {
+		return "", err
+	}
+	if manet.IsIPUnspecified(maddr) {
+		return "", fmt.Errorf("address %s is not reachable by retrieval clients; AnnounceMultiaddr must be set", maddr)
+	}
+	httpComponent, err := multiaddr.NewComponent("http", "")
+	if err != nil {
+		return "", err
+	}
+	u, err := maconv.ToURL(maddr.Encapsulate(httpComponent))
+	if err != nil {
+		return "", err
+	}
+	return u.String() + "/ipfs/{cid}", nil
+}
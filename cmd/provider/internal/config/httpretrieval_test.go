@@ -0,0 +1,41 @@
+package config
+
+import (
+	"testing"
+)
+
+func TestHttpRetrievalURLTemplate(t *testing.T) {
+	c := HttpRetrieval{
+		ListenMultiaddr:   "/ip4/0.0.0.0/tcp/3104",
+		AnnounceMultiaddr: "/dns4/example.com/tcp/3104",
+	}
+	got, err := c.URLTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "http://example.com:3104/ipfs/{cid}" {
+		t.Fatalf("unexpected URL template: %s", got)
+	}
+
+	c.AnnounceMultiaddr = ""
+	if _, err = c.URLTemplate(); err == nil {
+		t.Fatal("expected error for unspecified listen address with no announce address")
+	}
+
+	c.ListenMultiaddr = "/ip4/127.0.0.1/tcp/3104"
+	got, err = c.URLTemplate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "http://127.0.0.1:3104/ipfs/{cid}" {
+		t.Fatalf("unexpected URL template: %s", got)
+	}
+
+	netAddr, err := c.ListenNetAddr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if netAddr != "127.0.0.1:3104" {
+		t.Fatalf("unexpected listen net addr: %s", netAddr)
+	}
+}
@@ -3,7 +3,7 @@ package config
 const (
 	// Keep 1024 chunks in cache; keeps 256MiB if chunks are 0.25MiB.
 	defaultLinkCacheSize = 1024
-	// Multihashes are 128 bytes so 16384 results in 0.25MiB chunk when full.
+	// Multihashes are 128 bits so 16384 results in 0.25MiB chunk when full.
 	defaultLinkedChunkSize = 16384
 	defaultPubSubTopic     = "/indexer/ingest/mainnet"
 )
@@ -22,14 +22,29 @@ type Ingest struct {
 	// hold, the cache is resized to be able to hold all links.
 	LinkCacheSize int
 	// LinkedChunkSize is the number of multihashes in each chunk of in the
-	// advertised entries linked list.  If multihashes are 128 bytes, then
-	// setting LinkedChunkSize = 16384 will result in blocks of about 2Mb when
-	// full.
+	// advertised entries linked list.  If multihashes are 128 bits, then
+	// setting LinkedChunkSize = 16384 will result in blocks of about 0.25MiB
+	// when full, excluding encoding overhead. Note that the actual block size
+	// varies with the length of multihashes; see LinkedChunkMaxBytes.
 	LinkedChunkSize int
+	// LinkedChunkMaxBytes is the maximum encoded size in bytes of each chunk
+	// in the advertised entries linked list. When set to a non-zero value,
+	// chunks are bounded by their size instead of LinkedChunkSize, so that
+	// blocks stay under the limit regardless of the multihash type. Zero
+	// disables size-bounded chunking.
+	LinkedChunkMaxBytes int
+	// EntriesFormat configures the format of advertisement entries DAG.
+	EntriesFormat EntriesFormat
 	// PubSubTopic used to advertise ingestion announcements.
 	PubSubTopic string
 	// PurgeLinkCache tells whether to purge the link cache on daemon startup.
 	PurgeLinkCache bool
+	// LocalIndex tells whether to maintain a local index of advertised
+	// multihashes to the context IDs under which they are advertised. The
+	// index can be queried using the "provider find --local" command. The
+	// index is always maintained when blocks are served over Bitswap or
+	// HTTP, since it is used to locate them.
+	LocalIndex bool
 
 	// HttpPublisher configures the dagsync httpsync publisher.
 	HttpPublisher HttpPublisher
@@ -47,6 +62,7 @@ func NewIngest() Ingest {
 	return Ingest{
 		LinkCacheSize:   defaultLinkCacheSize,
 		LinkedChunkSize: defaultLinkedChunkSize,
+		EntriesFormat:   NewEntriesFormat(),
 		PubSubTopic:     defaultPubSubTopic,
 		HttpPublisher:   NewHttpPublisher(),
 		PublisherKind:   DTSyncPublisherKind,
@@ -65,4 +81,5 @@ func (c *Ingest) PopulateDefaults() {
 	if c.PubSubTopic == "" {
 		c.PubSubTopic = defaultPubSubTopic
 	}
+	c.EntriesFormat.PopulateDefaults()
 }
@@ -20,13 +20,18 @@ func Init(out io.Writer) (*Config, error) {
 
 func InitWithIdentity(identity Identity) (*Config, error) {
 	return &Config{
-		Identity:       identity,
-		Bootstrap:      NewBootstrap(),
-		Datastore:      NewDatastore(),
-		Ingest:         NewIngest(),
-		ProviderServer: NewProviderServer(),
-		AdminServer:    NewAdminServer(),
-		Reframe:        NewReframe(),
+		Identity:           identity,
+		Bootstrap:          NewBootstrap(),
+		Datastore:          NewDatastore(),
+		Ingest:             NewIngest(),
+		ProviderServer:     NewProviderServer(),
+		AdminServer:        NewAdminServer(),
+		Reframe:            NewReframe(),
+		DirSupplier:        NewDirSupplier(),
+		CarChecker:         NewCarChecker(),
+		Bitswap:            NewBitswap(),
+		HttpRetrieval:      NewHttpRetrieval(),
+		GraphsyncRetrieval: NewGraphsyncRetrieval(),
 	}, nil
 }
 
@@ -0,0 +1,21 @@
+package config
+
+// Metadata configures the advertisement metadata accepted by the provider.
+type Metadata struct {
+	// Protocols declares custom transport protocols, in addition to the built-in ones, that may
+	// be present in advertisement metadata. The payload of each protocol is validated against its
+	// schema whenever metadata is decoded.
+	Protocols []MetadataProtocol
+}
+
+// MetadataProtocol declares a custom transport protocol whose metadata payload is defined by an
+// IPLD schema and encoded as DAG-CBOR.
+type MetadataProtocol struct {
+	// Code is the multicodec code of the transport, either as a name or as a number, e.g.
+	// "0x300001". Codes in the private use range 0x300000-0x3FFFFF are recommended.
+	Code string
+	// Schema is the IPLD schema, in DSL form, that defines the type of the protocol payload.
+	Schema string
+	// Type is the name of the type in Schema that represents the protocol payload.
+	Type string
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+)
+
+// Metrics configures the exposure of the metrics of the provider, e.g. of its retrievals, to
+// Prometheus. Metrics are not exposed by default.
+type Metrics struct {
+	// ListenMultiaddr is the multiaddr string of the address on which the metrics are exposed at
+	// "/metrics", e.g. "/ip4/127.0.0.1/tcp/3105". Metrics are not exposed when empty.
+	ListenMultiaddr string
+}
+
+// ListenNetAddr returns the net address on which the metrics are exposed.
+func (c *Metrics) ListenNetAddr() (string, error) {
+	maddr, err := multiaddr.NewMultiaddr(c.ListenMultiaddr)
+	if err != nil {
+		return "", err
+	}
+
+	netAddr, err := manet.ToNetAddr(maddr)
+	if err != nil {
+		return "", err
+	}
+	return netAddr.String(), nil
+}
@@ -0,0 +1,467 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	dtimpl "github.com/filecoin-project/go-data-transfer/impl"
+	dtnetwork "github.com/filecoin-project/go-data-transfer/network"
+	gstransport "github.com/filecoin-project/go-data-transfer/transport/graphsync"
+	"github.com/filecoin-project/index-provider/cardatatransfer"
+	"github.com/filecoin-project/index-provider/metadata"
+	"github.com/filecoin-project/storetheindex/dagsync/httpsync/maconv"
+	bsclient "github.com/ipfs/go-bitswap/client"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	gsimpl "github.com/ipfs/go-graphsync/impl"
+	gsnet "github.com/ipfs/go-graphsync/network"
+	"github.com/ipfs/go-graphsync/storeutil"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/ipld/go-car/v2"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/linking"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+	selectorparse "github.com/ipld/go-ipld-prime/traversal/selector/parse"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multicodec"
+)
+
+// graphsyncSelector selects all blocks of a DAG of up to 256 levels of dag-pb nodes, so that
+// providers that limit the depth of selectors to 1024 accept it.
+var graphsyncSelector = func() ipld.Node {
+	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	return ssb.ExploreRecursive(selector.RecursionLimitDepth(1024), ssb.ExploreAll(ssb.ExploreRecursiveEdge())).Node()
+}()
+
+// Retriever retrieves DAGs from providers over the retrieval protocols advertised in their
+// metadata, i.e. graphsync with cardatatransfer.DealProposal vouchers, Bitswap or HTTP.
+type Retriever struct {
+	h          host.Host
+	dt         datatransfer.Manager
+	httpClient *http.Client
+
+	// lock guards the link systems into which the blocks of graphsync retrievals are stored,
+	// by the ID of their deal proposal.
+	lock       sync.Mutex
+	nextDealID cardatatransfer.DealID
+	lsysByDeal map[cardatatransfer.DealID]ipld.LinkSystem
+}
+
+// NewRetriever instantiates a new Retriever on a new libp2p host.
+func NewRetriever(ctx context.Context) (*Retriever, error) {
+	h, err := libp2p.New()
+	if err != nil {
+		return nil, err
+	}
+	r := &Retriever{
+		h:          h,
+		httpClient: http.DefaultClient,
+		lsysByDeal: make(map[cardatatransfer.DealID]ipld.LinkSystem),
+	}
+	if r.dt, err = r.startDataTransfer(ctx); err != nil {
+		_ = h.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Retriever) startDataTransfer(ctx context.Context) (datatransfer.Manager, error) {
+	gs := gsimpl.New(ctx, gsnet.NewFromLibp2pHost(r.h), cidlink.DefaultLinkSystem())
+	tp := gstransport.NewTransport(r.h.ID(), gs)
+	dt, err := dtimpl.NewDataTransfer(dssync.MutexWrap(datastore.NewMapDatastore()), dtnetwork.NewFromLibp2pHost(r.h), tp)
+	if err != nil {
+		return nil, err
+	}
+	if err := dt.RegisterVoucherType(&cardatatransfer.DealProposal{}, nil); err != nil {
+		return nil, err
+	}
+	if err := dt.RegisterVoucherResultType(&cardatatransfer.DealResponse{}); err != nil {
+		return nil, err
+	}
+	if err := dt.RegisterTransportConfigurer(&cardatatransfer.DealProposal{}, r.transportConfigurer); err != nil {
+		return nil, err
+	}
+
+	ready := make(chan error, 1)
+	dt.OnReady(func(err error) {
+		ready <- err
+	})
+	if err := dt.Start(ctx); err != nil {
+		return nil, err
+	}
+	select {
+	case err := <-ready:
+		if err != nil {
+			return nil, err
+		}
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	return dt, nil
+}
+
+// transportConfigurer stores the blocks of each graphsync retrieval into the link system of its
+// deal, so that blocks retrieved by one attempt do not satisfy another.
+func (r *Retriever) transportConfigurer(chid datatransfer.ChannelID, voucher datatransfer.Voucher, transport datatransfer.Transport) {
+	proposal, ok := voucher.(*cardatatransfer.DealProposal)
+	if !ok {
+		return
+	}
+	gsTransport, ok := transport.(cardatatransfer.StoreConfigurableTransport)
+	if !ok {
+		return
+	}
+	r.lock.Lock()
+	lsys, ok := r.lsysByDeal[proposal.ID]
+	r.lock.Unlock()
+	if !ok {
+		return
+	}
+	if err := gsTransport.UseStore(chid, lsys); err != nil {
+		log.Errorw("Failed to configure graphsync retrieval store", "err", err)
+	}
+}
+
+// Retrieve retrieves the DAG with the given root from the given provider over the given protocol,
+// and writes it to w as a CARv1 stream once all of its blocks are retrieved and verified.
+func (r *Retriever) Retrieve(ctx context.Context, provider peer.AddrInfo, protocol metadata.Protocol, root cid.Cid, w io.Writer) error {
+	// Wrap the store so that identity CIDs, which are not transferred, are resolved locally.
+	bs := bstore.NewIdStore(bstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore())))
+	lsys := storeutil.LinkSystemForBlockstore(bs)
+
+	var err error
+	switch protocol.ID() {
+	case multicodec.TransportGraphsyncFilecoinv1:
+		gsMetadata, ok := protocol.(*metadata.GraphsyncFilecoinV1)
+		if !ok {
+			return fmt.Errorf("unexpected graphsync metadata type: %T", protocol)
+		}
+		err = r.retrieveGraphsync(ctx, provider, gsMetadata, root, lsys)
+	case multicodec.TransportBitswap:
+		err = r.retrieveBitswap(ctx, provider, root, bs)
+	case multicodec.Http:
+		httpMetadata, ok := protocol.(*metadata.HTTPRetrievalV1)
+		if !ok {
+			return fmt.Errorf("unexpected HTTP metadata type: %T", protocol)
+		}
+		err = r.retrieveHttp(ctx, provider, httpMetadata, root, bs)
+	default:
+		return fmt.Errorf("unsupported retrieval protocol: %s", protocol.ID())
+	}
+	if err != nil {
+		return err
+	}
+
+	// Check that the retrieved DAG is complete before writing any of it.
+	if err := traverseDag(ctx, lsys, root, io.Discard); err != nil {
+		return fmt.Errorf("retrieved DAG is incomplete: %w", err)
+	}
+	return traverseDag(ctx, lsys, root, w)
+}
+
+func (r *Retriever) retrieveGraphsync(ctx context.Context, provider peer.AddrInfo, md *metadata.GraphsyncFilecoinV1, root cid.Cid, lsys ipld.LinkSystem) error {
+	if err := r.h.Connect(ctx, provider); err != nil {
+		return fmt.Errorf("failed to connect to provider: %w", err)
+	}
+
+	r.lock.Lock()
+	r.nextDealID++
+	dealID := r.nextDealID
+	r.lsysByDeal[dealID] = lsys
+	r.lock.Unlock()
+	defer func() {
+		r.lock.Lock()
+		delete(r.lsysByDeal, dealID)
+		r.lock.Unlock()
+	}()
+
+	pieceCid := md.PieceCID
+	proposal := &cardatatransfer.DealProposal{
+		PayloadCID: root,
+		ID:         dealID,
+		Params: cardatatransfer.Params{
+			PieceCID: &pieceCid,
+		},
+	}
+
+	done := make(chan error, 1)
+	var message string
+	unsubscribe := r.dt.SubscribeToEvents(func(event datatransfer.Event, channelState datatransfer.ChannelState) {
+		if p, ok := channelState.Voucher().(*cardatatransfer.DealProposal); !ok || p.ID != dealID {
+			return
+		}
+		if event.Code == datatransfer.NewVoucherResult {
+			if resp, ok := channelState.LastVoucherResult().(*cardatatransfer.DealResponse); ok && resp.Message != "" {
+				message = resp.Message
+			}
+		}
+		var err error
+		switch channelState.Status() {
+		case datatransfer.Completed:
+		case datatransfer.Failed, datatransfer.Cancelled:
+			err = errors.New(channelState.Message())
+			if message != "" {
+				err = errors.New(message)
+			}
+		default:
+			return
+		}
+		select {
+		case done <- err:
+		default:
+		}
+	})
+	defer unsubscribe()
+
+	if _, err := r.dt.OpenPullDataChannel(ctx, provider.ID, proposal, root, graphsyncSelector); err != nil {
+		return err
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("graphsync transfer failed: %w", err)
+		}
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Retriever) retrieveBitswap(ctx context.Context, provider peer.AddrInfo, root cid.Cid, bs bstore.Blockstore) error {
+	// Wants are only sent to the connected provider, since no content routing is used.
+	net := bsnet.NewFromIpfsHost(r.h, noContentRouting{})
+	client := bsclient.New(ctx, net, bs)
+	net.Start(client)
+	defer func() {
+		net.Stop()
+		_ = client.Close()
+	}()
+
+	if err := r.h.Connect(ctx, provider); err != nil {
+		return fmt.Errorf("failed to connect to provider: %w", err)
+	}
+	// The network only notifies the client of new connections, whereas the host may already be
+	// connected to the provider, e.g. by an earlier retrieval.
+	client.PeerConnected(provider.ID)
+
+	session := client.NewSession(ctx)
+	return traverseDag(ctx, fetchingLinkSystem(bs, session.GetBlock), root, io.Discard)
+}
+
+func (r *Retriever) retrieveHttp(ctx context.Context, provider peer.AddrInfo, md *metadata.HTTPRetrievalV1, root cid.Cid, bs bstore.Blockstore) error {
+	var baseURL *url.URL
+	for _, addr := range provider.Addrs {
+		if !IsHttpAddr(addr) {
+			continue
+		}
+		u, err := maconv.ToURL(addr)
+		if err != nil {
+			return fmt.Errorf("invalid HTTP address %s: %w", addr, err)
+		}
+		baseURL = u
+		break
+	}
+	if baseURL == nil && !strings.Contains(md.URLTemplate, "://") {
+		return errors.New("provider has no HTTP address")
+	}
+
+	if md.TrustlessCAR {
+		u, err := contentURL(baseURL, md.URLTemplate, root)
+		if err != nil {
+			return err
+		}
+		return r.fetchCar(ctx, u, bs)
+	}
+
+	getBlock := func(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+		u, err := contentURL(baseURL, md.URLTemplate, c)
+		if err != nil {
+			return nil, err
+		}
+		return r.fetchRawBlock(ctx, u, c)
+	}
+	return traverseDag(ctx, fetchingLinkSystem(bs, getBlock), root, io.Discard)
+}
+
+// fetchCar fetches the CAR stream of all blocks of a DAG, and stores each of its blocks once
+// verified against its CID.
+func (r *Retriever) fetchCar(ctx context.Context, u *url.URL, bs bstore.Blockstore) error {
+	query := u.Query()
+	query.Set("format", "car")
+	query.Set("dag-scope", "all")
+	u.RawQuery = query.Encode()
+	resp, err := r.get(ctx, u, "application/vnd.ipld.car; version=1")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	br, err := car.NewBlockReader(resp.Body)
+	if err != nil {
+		return fmt.Errorf("invalid CAR response: %w", err)
+	}
+	for {
+		blk, err := br.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("invalid CAR response: %w", err)
+		}
+		if err := verifyBlock(blk.Cid(), blk.RawData()); err != nil {
+			return err
+		}
+		if err := bs.Put(ctx, blk); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Retriever) fetchRawBlock(ctx context.Context, u *url.URL, c cid.Cid) (blocks.Block, error) {
+	query := u.Query()
+	query.Set("format", "raw")
+	u.RawQuery = query.Encode()
+	resp, err := r.get(ctx, u, "application/vnd.ipld.raw")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifyBlock(c, data); err != nil {
+		return nil, err
+	}
+	return blocks.NewBlockWithCid(data, c)
+}
+
+func (r *Retriever) get(ctx context.Context, u *url.URL, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", accept)
+	resp, err := r.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s responded with %d %s: %s", u, resp.StatusCode, http.StatusText(resp.StatusCode), bytes.TrimSpace(body))
+	}
+	return resp, nil
+}
+
+// Close shuts down the data transfer manager and the libp2p host of the retriever.
+func (r *Retriever) Close() error {
+	dtErr := r.dt.Stop(context.Background())
+	hErr := r.h.Close()
+	if dtErr != nil {
+		return dtErr
+	}
+	return hErr
+}
+
+// contentURL returns the URL of the given CID, as templated by the given URL template relative to
+// the given base URL, or at the conventional gateway path if the template is empty.
+func contentURL(base *url.URL, template string, c cid.Cid) (*url.URL, error) {
+	if template == "" {
+		template = "/ipfs/{cid}"
+	}
+	ref, err := url.Parse(strings.ReplaceAll(template, "{cid}", c.String()))
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL template %q: %w", template, err)
+	}
+	if base == nil {
+		return ref, nil
+	}
+	return base.ResolveReference(ref), nil
+}
+
+// IsHttpAddr checks whether the given multiaddr is an HTTP address, i.e. has an "/http" or
+// "/https" component as used by HTTP publishers and retrieval servers.
+func IsHttpAddr(addr multiaddr.Multiaddr) bool {
+	for _, p := range addr.Protocols() {
+		if p.Code == multiaddr.P_HTTP || p.Code == multiaddr.P_HTTPS {
+			return true
+		}
+	}
+	return false
+}
+
+// verifyBlock checks that the given data hashes to the given CID.
+func verifyBlock(c cid.Cid, data []byte) error {
+	got, err := c.Prefix().Sum(data)
+	if err != nil {
+		return err
+	}
+	if !got.Equals(c) {
+		return fmt.Errorf("block does not match its CID %s", c)
+	}
+	return nil
+}
+
+// fetchingLinkSystem returns a link system that loads blocks from the given blockstore, and
+// otherwise fetches them via the given function and stores them in the blockstore.
+func fetchingLinkSystem(bs bstore.Blockstore, fetch func(context.Context, cid.Cid) (blocks.Block, error)) ipld.LinkSystem {
+	lsys := storeutil.LinkSystemForBlockstore(bs)
+	lsys.StorageReadOpener = func(lctx linking.LinkContext, lnk ipld.Link) (io.Reader, error) {
+		c := lnk.(cidlink.Link).Cid
+		blk, err := bs.Get(lctx.Ctx, c)
+		if err == nil {
+			return bytes.NewReader(blk.RawData()), nil
+		}
+		if blk, err = fetch(lctx.Ctx, c); err != nil {
+			return nil, fmt.Errorf("failed to fetch block %s: %w", c, err)
+		}
+		if err := bs.Put(lctx.Ctx, blk); err != nil {
+			return nil, err
+		}
+		return bytes.NewReader(blk.RawData()), nil
+	}
+	return lsys
+}
+
+// traverseDag traverses all blocks of the DAG with the given root, writing them to w as a CARv1.
+func traverseDag(ctx context.Context, lsys ipld.LinkSystem, root cid.Cid, w io.Writer) error {
+	_, err := car.TraverseV1(ctx, &lsys, root, selectorparse.CommonSelector_ExploreAllRecursively, w,
+		car.WithTraversalPrototypeChooser(dagpb.AddSupportToChooser(func(ipld.Link, linking.LinkContext) (ipld.NodePrototype, error) {
+			return basicnode.Prototype.Any, nil
+		})))
+	return err
+}
+
+var _ routing.ContentRouting = noContentRouting{}
+
+// noContentRouting is a content routing that finds no providers, so that the Bitswap client only
+// fetches from the connected provider.
+type noContentRouting struct{}
+
+func (noContentRouting) Provide(context.Context, cid.Cid, bool) error { return nil }
+
+func (noContentRouting) FindProvidersAsync(context.Context, cid.Cid, int) <-chan peer.AddrInfo {
+	ch := make(chan peer.AddrInfo)
+	close(ch)
+	return ch
+}
@@ -0,0 +1,128 @@
+package internal
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/index-provider/cardatatransfer"
+	"github.com/filecoin-project/index-provider/metadata"
+	mock_provider "github.com/filecoin-project/index-provider/mock"
+	bitswapserver "github.com/filecoin-project/index-provider/server/bitswap"
+	retrievalserver "github.com/filecoin-project/index-provider/server/retrieval/http"
+	"github.com/filecoin-project/index-provider/supplier"
+	"github.com/filecoin-project/index-provider/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipld/go-car/v2"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetrieverRetrievesOverAdvertisedProtocols(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any()).AnyTimes()
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), gomock.Any(), gomock.Any()).AnyTimes()
+	reg := supplier.NewRegistry(mockEng)
+	cs := supplier.NewCarSupplier(mockEng, dssync.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, reg.Register(supplier.CarSupplierName, cs))
+	contextID := []byte("fish")
+	gsMetadata, err := cardatatransfer.TransportFromContextID(contextID)
+	require.NoError(t, err)
+	_, err = cs.Put(ctx, contextID, "../../../testdata/sample-v1-2.car", metadata.Default.New(gsMetadata))
+	require.NoError(t, err)
+
+	// Serve the supplied content over graphsync, Bitswap and HTTP.
+	providerHost, err := libp2p.New(libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+	require.NoError(t, err)
+	t.Cleanup(func() { providerHost.Close() })
+	dt := testutil.SetupDataTransferOnHost(t, providerHost, dssync.MutexWrap(datastore.NewMapDatastore()), cidlink.DefaultLinkSystem())
+	require.NoError(t, cardatatransfer.StartCarDataTransfer(dt, cs))
+	bitswapSrv, err := bitswapserver.New(ctx, providerHost, reg.Blockstore(), bitswapserver.WithMaxBlocksPerSecondPerPeer(0))
+	require.NoError(t, err)
+	t.Cleanup(func() { bitswapSrv.Close() })
+	httpSrv, err := retrievalserver.New(reg.Blockstore(), retrievalserver.WithListenAddr("127.0.0.1:0"))
+	require.NoError(t, err)
+	go func() { _ = httpSrv.Start() }()
+	t.Cleanup(func() { httpSrv.Shutdown(context.Background()) })
+	httpAddr, err := manet.FromNetAddr(httpSrv.Addr())
+	require.NoError(t, err)
+	httpAddr = httpAddr.Encapsulate(multiaddr.StringCast("/http"))
+
+	provider := peer.AddrInfo{ID: providerHost.ID(), Addrs: append(providerHost.Addrs(), httpAddr)}
+	carBs := testutil.OpenSampleCar(t, "sample-v1-2.car")
+	roots, err := carBs.Roots()
+	require.NoError(t, err)
+	root := roots[0]
+	wantCids := allCids(t, ctx, carBs.AllKeysChan)
+
+	subject, err := NewRetriever(ctx)
+	require.NoError(t, err)
+	t.Cleanup(func() { subject.Close() })
+
+	for _, tt := range []struct {
+		name     string
+		protocol metadata.Protocol
+	}{
+		{name: "graphsync", protocol: gsMetadata},
+		{name: "bitswap", protocol: &metadata.Bitswap{}},
+		{name: "http trustless car", protocol: &metadata.HTTPRetrievalV1{TrustlessCAR: true}},
+		{name: "http raw blocks", protocol: &metadata.HTTPRetrievalV1{}},
+		{name: "http url template", protocol: &metadata.HTTPRetrievalV1{URLTemplate: "/ipfs/{cid}", TrustlessCAR: true}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			require.NoError(t, subject.Retrieve(ctx, provider, tt.protocol, root, &out))
+
+			br, err := car.NewBlockReader(&out)
+			require.NoError(t, err)
+			require.Equal(t, []cid.Cid{root}, br.Roots)
+			var gotCids []cid.Cid
+			for {
+				blk, err := br.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				want, err := carBs.Get(ctx, blk.Cid())
+				require.NoError(t, err)
+				require.Equal(t, want.RawData(), blk.RawData())
+				gotCids = append(gotCids, blk.Cid())
+			}
+			require.ElementsMatch(t, wantCids, gotCids)
+		})
+	}
+
+	t.Run("absent content", func(t *testing.T) {
+		absent := testutil.RandomCids(t, rand.New(rand.NewSource(1413)), 1)[0]
+		for _, protocol := range []metadata.Protocol{gsMetadata, &metadata.HTTPRetrievalV1{TrustlessCAR: true}} {
+			ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			var out bytes.Buffer
+			err := subject.Retrieve(ctx, provider, protocol, absent, &out)
+			cancel()
+			require.Error(t, err)
+			require.Zero(t, out.Len(), "nothing must be written when retrieval fails")
+		}
+	})
+}
+
+func allCids(t *testing.T, ctx context.Context, allKeysChan func(context.Context) (<-chan cid.Cid, error)) []cid.Cid {
+	keys, err := allKeysChan(ctx)
+	require.NoError(t, err)
+	var cids []cid.Cid
+	for c := range keys {
+		cids = append(cids, c)
+	}
+	return cids
+}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net/http"
 	"os"
+	"strings"
 
 	"github.com/filecoin-project/index-provider/cmd/provider/internal"
+	"github.com/filecoin-project/index-provider/metadata"
 	adminserver "github.com/filecoin-project/index-provider/server/admin/http"
+	"github.com/filecoin-project/index-provider/supplier"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	"github.com/ipld/go-ipld-prime/traversal/selector"
@@ -133,6 +138,7 @@ func doGetAdvertisements(cctx *cli.Context) error {
 	fmt.Printf("ProviderID:  %s\n", ad.ProviderID)
 	fmt.Printf("Addresses:   %v\n", ad.Addresses)
 	fmt.Printf("Is Remove:   %v\n", ad.IsRemove)
+	fmt.Printf("Metadata:    %s\n", formatMetadata(ad.Metadata))
 
 	if ad.IsRemove {
 		if ad.HasEntries() {
@@ -182,10 +188,29 @@ func doListCars(cctx *cli.Context) error {
 		return fmt.Errorf("received ok response from server but cannot decode response body. %v", err)
 	}
 	var b bytes.Buffer
-	for _, path := range res.Paths {
-		b.WriteString(path)
+	for _, car := range res.Cars {
+		b.WriteString(base64.StdEncoding.EncodeToString(car.Key))
+		b.WriteString("\t")
+		b.WriteString(strings.Join(car.Paths, ", "))
+		if supplier.CarStatus(car.Status).IsBroken() {
+			b.WriteString(fmt.Sprintf(" (%s: %s)", car.Status, car.Detail))
+		}
 		b.WriteString(fmt.Sprintln())
 	}
 	_, err = cctx.App.Writer.Write(b.Bytes())
 	return err
 }
+
+// formatMetadata returns the JSON representation of the given binary metadata, or its base64
+// encoding if it cannot be decoded.
+func formatMetadata(mdBytes []byte) string {
+	md := metadata.Default.New()
+	if err := md.UnmarshalBinary(mdBytes); err != nil {
+		return base64.StdEncoding.EncodeToString(mdBytes)
+	}
+	out, err := json.Marshal(md)
+	if err != nil {
+		return base64.StdEncoding.EncodeToString(mdBytes)
+	}
+	return string(out)
+}
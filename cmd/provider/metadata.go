@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/filecoin-project/index-provider/cmd/provider/internal/config"
+	"github.com/filecoin-project/index-provider/metadata"
+	"github.com/urfave/cli/v2"
+)
+
+var MetadataCmd = &cli.Command{
+	Name:        "metadata",
+	Usage:       "Converts advertisement metadata between its binary and human-readable forms.",
+	Description: "Custom metadata protocols declared in the provider config, if initialized, are supported in addition to the built-in ones.",
+	Subcommands: []*cli.Command{metadataDecodeSubCmd, metadataEncodeSubCmd},
+}
+
+var metadataDecodeSubCmd = &cli.Command{
+	Name:        "decode",
+	Usage:       "Decodes base64 encoded binary metadata into JSON",
+	ArgsUsage:   "[base64-metadata]",
+	Description: "The metadata is read from the first argument if present, or from standard input otherwise.",
+	Action:      doMetadataDecode,
+}
+
+var metadataEncodeSubCmd = &cli.Command{
+	Name:        "encode",
+	Usage:       "Encodes JSON metadata into base64 encoded binary metadata",
+	ArgsUsage:   "[json-metadata]",
+	Description: "The metadata is read from the first argument if present, or from standard input otherwise.",
+	Action:      doMetadataEncode,
+}
+
+func doMetadataDecode(cctx *cli.Context) error {
+	in, err := metadataInput(cctx)
+	if err != nil {
+		return err
+	}
+	decoded, err := base64.StdEncoding.DecodeString(in)
+	if err != nil {
+		return errors.New("metadata is not a valid base64 encoded string")
+	}
+	mc, err := configuredMetadataContext()
+	if err != nil {
+		return err
+	}
+	md := mc.New()
+	if err := md.UnmarshalBinary(decoded); err != nil {
+		return fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	out, err := json.MarshalIndent(md, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(cctx.App.Writer, string(out))
+	return err
+}
+
+func doMetadataEncode(cctx *cli.Context) error {
+	in, err := metadataInput(cctx)
+	if err != nil {
+		return err
+	}
+	mc, err := configuredMetadataContext()
+	if err != nil {
+		return err
+	}
+	md := mc.New()
+	if err := json.Unmarshal([]byte(in), &md); err != nil {
+		return fmt.Errorf("failed to decode metadata JSON: %w", err)
+	}
+	if err := md.Validate(); err != nil {
+		return err
+	}
+	mdBytes, err := md.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(cctx.App.Writer, base64.StdEncoding.EncodeToString(mdBytes))
+	return err
+}
+
+// configuredMetadataContext returns the metadata context that includes the custom protocols
+// declared in the provider config, or metadata.Default if the provider is not initialized.
+func configuredMetadataContext() (metadata.MetadataContext, error) {
+	cfg, err := config.Load("")
+	if err != nil {
+		if err == config.ErrNotInitialized {
+			return metadata.Default, nil
+		}
+		return nil, fmt.Errorf("cannot load config file: %w", err)
+	}
+	return metadataContext(cfg.Metadata)
+}
+
+// metadataInput returns the metadata given as the first argument, or read from standard input if
+// no argument is given.
+func metadataInput(cctx *cli.Context) (string, error) {
+	if cctx.NArg() > 1 {
+		return "", cli.Exit("At most one argument must be specified.", 1)
+	}
+	if cctx.Args().Present() {
+		return strings.TrimSpace(cctx.Args().First()), nil
+	}
+	in, err := io.ReadAll(cctx.App.Reader)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(in)), nil
+}
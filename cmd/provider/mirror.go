@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/filecoin-project/index-provider/engine"
 	"github.com/filecoin-project/index-provider/metrics"
 	"github.com/filecoin-project/index-provider/mirror"
 	leveldb "github.com/ipfs/go-ds-leveldb"
@@ -36,6 +37,8 @@ var Mirror struct {
 		skipRemapOnEntriesTypeMatch *cli.BoolFlag
 		alwaysReSignAds             *cli.BoolFlag
 		metricsListenAddr           *cli.StringFlag
+		publisherKinds              *cli.StringSliceFlag
+		httpPublisherListenAddr     *cli.StringFlag
 	}
 
 	source  *peer.AddrInfo
@@ -45,7 +48,7 @@ var Mirror struct {
 func init() {
 	Mirror.flags.source = &cli.StringFlag{
 		Name:     "source",
-		Usage:    "The addrinfo of the provider to mirror.",
+		Usage:    "The addrinfo of the provider to mirror. Advertisements are synced over HTTP if the address has an \"/http\" component.",
 		Required: true,
 	}
 	Mirror.flags.syncInterval = &cli.DurationFlag{
@@ -119,6 +122,16 @@ func init() {
 		Usage: "The listen address on which metrics are exposed",
 		Value: "0.0.0.0:8989",
 	}
+	Mirror.flags.publisherKinds = &cli.StringSliceFlag{
+		Name:        "publisherKinds",
+		Usage:       "The kinds of publisher over which mirrored advertisements are published. Only `dtsync` and `http` are accepted.",
+		DefaultText: "dtsync",
+	}
+	Mirror.flags.httpPublisherListenAddr = &cli.StringFlag{
+		Name:        "httpPublisherListenAddr",
+		Usage:       "The listen address of the HTTP publisher, used when the publisher kinds include http.",
+		DefaultText: "0.0.0.0:3104",
+	}
 	Mirror.Command = &cli.Command{
 		Name:  "mirror",
 		Usage: "Mirrors the advertisement chain from an existing index provider.",
@@ -138,6 +151,8 @@ func init() {
 			Mirror.flags.skipRemapOnEntriesTypeMatch,
 			Mirror.flags.alwaysReSignAds,
 			Mirror.flags.metricsListenAddr,
+			Mirror.flags.publisherKinds,
+			Mirror.flags.httpPublisherListenAddr,
 		},
 		Before: beforeMirror,
 		Action: doMirror,
@@ -229,6 +244,17 @@ func beforeMirror(cctx *cli.Context) error {
 		r := Mirror.flags.alwaysReSignAds.Get(cctx)
 		Mirror.options = append(Mirror.options, mirror.WithAlwaysReSignAds(r))
 	}
+	if cctx.IsSet(Mirror.flags.publisherKinds.Name) {
+		var kinds []engine.PublisherKind
+		for _, k := range Mirror.flags.publisherKinds.Get(cctx) {
+			kinds = append(kinds, engine.PublisherKind(k))
+		}
+		Mirror.options = append(Mirror.options, mirror.WithPublisherKinds(kinds...))
+	}
+	if cctx.IsSet(Mirror.flags.httpPublisherListenAddr.Name) {
+		addr := Mirror.flags.httpPublisherListenAddr.Get(cctx)
+		Mirror.options = append(Mirror.options, mirror.WithHttpPublisherListenAddr(addr))
+	}
 	return nil
 }
 
@@ -45,13 +45,17 @@ func run() int {
 			AnnounceHttpCmd,
 			ConnectCmd,
 			DaemonCmd,
+			DatastoreCmd,
+			EntriesCmd,
 			FindCmd,
 			ImportCmd,
 			IndexCmd,
 			InitCmd,
 			ListCmd,
+			MetadataCmd,
 			RegisterCmd,
 			RemoveCmd,
+			RetrieveCmd,
 			VerifyIngestCmd,
 			Mirror.Command,
 			RandomAdCmd,
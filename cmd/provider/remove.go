@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 
 	adminserver "github.com/filecoin-project/index-provider/server/admin/http"
 	"github.com/urfave/cli/v2"
@@ -16,7 +17,7 @@ var RemoveCmd = &cli.Command{
 	Name:        "remove",
 	Aliases:     []string{"rm"},
 	Usage:       "Removes previously advertised multihashes by the provider.",
-	Subcommands: []*cli.Command{removeCarSubCmd},
+	Subcommands: []*cli.Command{removeCarSubCmd, removeContentSubCmd},
 }
 
 var (
@@ -92,3 +93,42 @@ func doRemoveCar(cctx *cli.Context) error {
 	_, err = cctx.App.Writer.Write(b.Bytes())
 	return err
 }
+
+var removeContentSubCmd = &cli.Command{
+	Name:  "content",
+	Usage: "Removes the multihashes previously advertised via any supplier of the provider, e.g. unixfs.",
+	Description: `Publishes an advertisement signalling that the provider no longer provides the
+content previously imported via the named supplier under the given key.
+See import content command.`,
+	Flags:  removeContentFlags,
+	Action: doRemoveContent,
+}
+
+func doRemoveContent(cctx *cli.Context) error {
+	key, err := base64.StdEncoding.DecodeString(keyFlagValue)
+	if err != nil {
+		return errors.New("key is not a valid base64 encoded string")
+	}
+	name := cctx.String(supplierFlag.Name)
+	resp, err := doHttpPostReq(cctx.Context, adminAPIFlagValue+"/admin/remove/"+url.PathEscape(name), adminserver.RemoveReq{Key: key})
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return errFromHttpResp(resp)
+	}
+
+	var res adminserver.RemoveRes
+	if _, err := res.ReadFrom(resp.Body); err != nil {
+		return fmt.Errorf("received ok response from server but cannot decode response body. %v", err)
+	}
+	var b bytes.Buffer
+	b.WriteString("Successfully removed content.\n")
+	b.WriteString("\t Advertisement ID: ")
+	b.WriteString(res.AdvId.String())
+	b.WriteString("\n\t Context ID: ")
+	b.WriteString(base64.StdEncoding.EncodeToString(key))
+	b.WriteString("\n")
+	_, err = cctx.App.Writer.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/filecoin-project/index-provider/cmd/provider/internal"
+	"github.com/filecoin-project/index-provider/metadata"
+	httpfinderclient "github.com/filecoin-project/storetheindex/api/v0/finder/client/http"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
+	"github.com/urfave/cli/v2"
+)
+
+var RetrieveCmd = &cli.Command{
+	Name:  "retrieve",
+	Usage: "Retrieves content from providers to check that it is retrievable as advertised",
+	Description: `Retrieves the DAG with the given root CID into a local CAR file, in order to check that the
+content is retrievable as advertised.
+
+When --via-indexer is set, the providers of the CID are looked up on the given indexer, and the
+DAG is retrieved over the protocols in the metadata of their records, i.e. graphsync with
+DealProposal vouchers, Bitswap or HTTP. When --provider is also set, only the records of the given
+provider are used, at the given address.
+
+When only --provider is set, no metadata is known. The DAG is therefore retrieved over HTTP as a
+trustless CAR if the address has an "/http" component, and otherwise over Bitswap. Retrieval over
+graphsync needs the piece CID in the metadata of provider records, and so requires --via-indexer.
+
+Protocols are attempted in turn until one succeeds. The provider and protocol that succeeded are
+printed, and the DAG is written as a CARv1 to the path given by --output.
+
+Example usage:
+
+	provider retrieve \
+		--cid bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi \
+		--via-indexer https://cid.contact
+
+	provider retrieve \
+		--cid bafybeigdyrzt5sfp7udm7hu76uh7y26nf3efuylqabf3oclgtqy55fbzdi \
+		--provider /ip4/1.2.3.4/tcp/3104/http/p2p/12D3KooWE8yt84RVwW3sFcd6WMjbUdWrZer2YtT4dmtj3dHdahSZ`,
+	Flags:  retrieveFlags,
+	Action: retrieveCommand,
+}
+
+// retrieveCandidate is a provider along with a protocol over which to attempt retrieval from it.
+type retrieveCandidate struct {
+	provider peer.AddrInfo
+	protocol metadata.Protocol
+}
+
+func retrieveCommand(cctx *cli.Context) error {
+	root, err := cid.Decode(cctx.String("cid"))
+	if err != nil {
+		return fmt.Errorf("invalid CID: %w", err)
+	}
+
+	var provider *peer.AddrInfo
+	if addr := cctx.String("provider"); addr != "" {
+		maddr, err := multiaddr.NewMultiaddr(addr)
+		if err != nil {
+			return fmt.Errorf("invalid provider address: %w", err)
+		}
+		if provider, err = peer.AddrInfoFromP2pAddr(maddr); err != nil {
+			return fmt.Errorf("invalid provider address: %w", err)
+		}
+	}
+
+	var candidates []retrieveCandidate
+	switch indexer := cctx.String("via-indexer"); {
+	case indexer != "":
+		if candidates, err = indexedCandidates(cctx.Context, indexer, root, provider); err != nil {
+			return err
+		}
+	case provider != nil:
+		candidates = providerCandidates(*provider)
+	default:
+		return errors.New("either --provider or --via-indexer must be specified")
+	}
+	if len(candidates) == 0 {
+		return errors.New("no provider records found")
+	}
+
+	retriever, err := internal.NewRetriever(cctx.Context)
+	if err != nil {
+		return err
+	}
+	defer retriever.Close()
+
+	output := cctx.String("output")
+	if output == "" {
+		output = root.String() + ".car"
+	}
+	w := cctx.App.Writer
+	for _, c := range candidates {
+		protocol := c.protocol.ID()
+		fmt.Fprintf(w, "Retrieving from %s over %s...\n", c.provider.ID, protocol)
+		err := retrieveToFile(cctx.Context, retriever, c, root, output, cctx.Duration("timeout"))
+		if err != nil {
+			fmt.Fprintf(w, "  ❌ Failed: %s\n", err)
+			continue
+		}
+		fmt.Fprintf(w, "🎉 Retrieved %s from %s over %s\n", root, c.provider.ID, protocol)
+		fmt.Fprintf(w, "CAR written to %s\n", output)
+		return nil
+	}
+	return errors.New("failed to retrieve content from any provider")
+}
+
+// indexedCandidates looks up the provider records of the given CID on the given indexer, and
+// returns the protocols in the metadata of each record. When a provider is given, only its records
+// are used, at its given addresses.
+func indexedCandidates(ctx context.Context, indexer string, root cid.Cid, provider *peer.AddrInfo) ([]retrieveCandidate, error) {
+	client, err := httpfinderclient.New(indexer)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Find(ctx, root.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []retrieveCandidate
+	for _, mhr := range resp.MultihashResults {
+		for _, pr := range mhr.ProviderResults {
+			addrInfo := pr.Provider
+			if provider != nil {
+				if addrInfo.ID != provider.ID {
+					continue
+				}
+				addrInfo = *provider
+			}
+			md := metadata.Default.New()
+			if err := md.UnmarshalBinary(pr.Metadata); err != nil {
+				log.Warnw("Ignoring provider record with invalid metadata", "provider", pr.Provider.ID, "err", err)
+				continue
+			}
+			for _, id := range md.Protocols() {
+				candidates = append(candidates, retrieveCandidate{provider: addrInfo, protocol: md.Get(id)})
+			}
+		}
+	}
+	return candidates, nil
+}
+
+// providerCandidates returns the protocols over which the given provider may serve content
+// without metadata, i.e. HTTP at its HTTP addresses and Bitswap at its libp2p addresses.
+func providerCandidates(provider peer.AddrInfo) []retrieveCandidate {
+	var httpAddrs, p2pAddrs []multiaddr.Multiaddr
+	for _, addr := range provider.Addrs {
+		if internal.IsHttpAddr(addr) {
+			httpAddrs = append(httpAddrs, addr)
+		} else {
+			p2pAddrs = append(p2pAddrs, addr)
+		}
+	}
+	var candidates []retrieveCandidate
+	if len(httpAddrs) != 0 {
+		candidates = append(candidates, retrieveCandidate{
+			provider: peer.AddrInfo{ID: provider.ID, Addrs: httpAddrs},
+			protocol: &metadata.HTTPRetrievalV1{TrustlessCAR: true},
+		})
+	}
+	if len(p2pAddrs) != 0 {
+		candidates = append(candidates, retrieveCandidate{
+			provider: peer.AddrInfo{ID: provider.ID, Addrs: p2pAddrs},
+			protocol: &metadata.Bitswap{},
+		})
+	}
+	return candidates
+}
+
+// retrieveToFile retrieves the DAG with the given root from the given candidate into the file at
+// the given path, which is only created once the DAG is retrieved.
+func retrieveToFile(ctx context.Context, retriever *internal.Retriever, c retrieveCandidate, root cid.Cid, path string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	w := &lazyFile{path: path}
+	err := retriever.Retrieve(ctx, c.provider, c.protocol, root, w)
+	if cErr := w.Close(); err == nil {
+		err = cErr
+	}
+	return err
+}
+
+// lazyFile is a writer that creates the file at its path upon first write.
+type lazyFile struct {
+	path string
+	f    *os.File
+}
+
+func (l *lazyFile) Write(p []byte) (int, error) {
+	if l.f == nil {
+		f, err := os.Create(l.path)
+		if err != nil {
+			return 0, err
+		}
+		l.f = f
+	}
+	return l.f.Write(p)
+}
+
+func (l *lazyFile) Close() error {
+	if l.f == nil {
+		return nil
+	}
+	return l.f.Close()
+}
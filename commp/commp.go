@@ -0,0 +1,229 @@
+// Package commp computes Filecoin piece commitments, i.e. CommP, of arbitrary data.
+//
+// The data is padded to a piece the way Filecoin deals do it: every 127 bytes of data are
+// expanded to 128 bytes by inserting two zero bits after every 254 bits (fr32 padding), and the
+// result is padded with zeros to a power-of-two piece size of at least 128 bytes. The piece
+// commitment is the root of the binary merkle tree over the 32-byte nodes of the padded piece,
+// where each node is hashed with SHA-256 truncated to 254 bits.
+package commp
+
+import (
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/bits"
+
+	"github.com/ipfs/go-cid"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	// nodeSize is the size of the nodes of the piece merkle tree.
+	nodeSize = 32
+	// unpaddedChunkSize is the size of the chunks of data expanded by fr32 padding.
+	unpaddedChunkSize = 127
+	// paddedChunkSize is the size of the chunks of data once fr32 padded.
+	paddedChunkSize = 128
+	// maxLevels is the maximum number of merkle tree levels supported, i.e. pieces up to 2^64 bytes.
+	maxLevels = 64 - 5
+)
+
+// ErrEmpty signals that no data was written, and therefore there is no piece to commit to.
+var ErrEmpty = errors.New("cannot compute the piece commitment of empty data")
+
+// zeroCommitments holds the roots of merkle trees over zeros at each level, starting from a
+// single zero node.
+var zeroCommitments [maxLevels][nodeSize]byte
+
+func init() {
+	for l := 1; l < maxLevels; l++ {
+		zeroCommitments[l] = hashNodes(&zeroCommitments[l-1], &zeroCommitments[l-1])
+	}
+}
+
+// Calc computes the piece commitment of the data written to it. Writes never fail.
+//
+// The zero value is ready to use.
+type Calc struct {
+	// buf holds the data written since the last complete chunk.
+	buf [unpaddedChunkSize]byte
+	n   int
+	// size is the total number of bytes written.
+	size uint64
+	// stack holds the roots of complete subtrees, from the highest level to the lowest.
+	stack []subtree
+}
+
+type subtree struct {
+	level int
+	root  [nodeSize]byte
+}
+
+var _ io.Writer = (*Calc)(nil)
+
+func (c *Calc) Write(p []byte) (int, error) {
+	written := len(p)
+	for len(p) != 0 {
+		copied := copy(c.buf[c.n:], p)
+		c.n += copied
+		p = p[copied:]
+		if c.n == unpaddedChunkSize {
+			c.digestChunk()
+		}
+	}
+	c.size += uint64(written)
+	return written, nil
+}
+
+// Sum returns the piece commitment of the data written so far along with the padded size of
+// the piece. ErrEmpty is returned if no data was written.
+func (c *Calc) Sum() ([]byte, uint64, error) {
+	if c.size == 0 {
+		return nil, 0, ErrEmpty
+	}
+	// Work on a copy, so that more data can still be written.
+	clone := *c
+	clone.stack = append([]subtree(nil), c.stack...)
+	if clone.n != 0 {
+		for i := clone.n; i < unpaddedChunkSize; i++ {
+			clone.buf[i] = 0
+		}
+		clone.digestChunk()
+	}
+
+	// Complete the tree with the zero subtrees that pad the piece to its power-of-two size.
+	pieceSize := PaddedPieceSize(c.size)
+	rootLevel := bits.TrailingZeros64(pieceSize / nodeSize)
+	for len(clone.stack) > 1 || clone.stack[0].level < rootLevel {
+		top := clone.stack[len(clone.stack)-1]
+		clone.push(top.level, zeroCommitments[top.level])
+	}
+	root := clone.stack[0].root
+	return root[:], pieceSize, nil
+}
+
+// PaddedPieceSize returns the size of the piece that holds the given number of bytes of data once
+// fr32 padded, i.e. the smallest power of two that is at least 128 bytes and can hold the padded
+// data.
+func PaddedPieceSize(size uint64) uint64 {
+	chunks := (size + unpaddedChunkSize - 1) / unpaddedChunkSize
+	padded := chunks * paddedChunkSize
+	if padded <= paddedChunkSize {
+		return paddedChunkSize
+	}
+	return 1 << (64 - bits.LeadingZeros64(padded-1))
+}
+
+// digestChunk fr32 pads the buffered chunk of data, and adds its nodes to the tree.
+func (c *Calc) digestChunk() {
+	var padded [paddedChunkSize]byte
+	fr32Pad(&c.buf, &padded)
+	for i := 0; i < paddedChunkSize; i += nodeSize {
+		var node [nodeSize]byte
+		copy(node[:], padded[i:i+nodeSize])
+		c.push(0, node)
+	}
+	c.n = 0
+}
+
+// push adds the root of a complete subtree at the given level, merging it with its sibling
+// subtrees for as long as there are any.
+func (c *Calc) push(level int, root [nodeSize]byte) {
+	for len(c.stack) != 0 {
+		top := c.stack[len(c.stack)-1]
+		if top.level != level {
+			break
+		}
+		c.stack = c.stack[:len(c.stack)-1]
+		root = hashNodes(&top.root, &root)
+		level++
+	}
+	c.stack = append(c.stack, subtree{level: level, root: root})
+}
+
+func hashNodes(left, right *[nodeSize]byte) [nodeSize]byte {
+	h := sha256.New()
+	_, _ = h.Write(left[:])
+	_, _ = h.Write(right[:])
+	var node [nodeSize]byte
+	h.Sum(node[:0])
+	// Truncate to 254 bits, so that the node is a valid field element.
+	node[nodeSize-1] &= 0x3f
+	return node
+}
+
+// fr32Pad expands 127 bytes of data to 128 bytes, inserting two zero bits after every 254 bits so
+// that each 32-byte node is a valid field element.
+func fr32Pad(in *[unpaddedChunkSize]byte, out *[paddedChunkSize]byte) {
+	// The first node holds input bits 0 to 253.
+	copy(out[:31], in[:31])
+	out[31] = in[31] & 0x3f
+
+	// The second node holds input bits 254 to 507, i.e. shifted by 2 bits.
+	t := in[31] >> 6
+	for i := 32; i < 64; i++ {
+		out[i] = in[i]<<2 | t
+		t = in[i] >> 6
+	}
+	out[63] &= 0x3f
+
+	// The third node holds input bits 508 to 761, i.e. shifted by 4 bits.
+	t = in[63] >> 4
+	for i := 64; i < 96; i++ {
+		out[i] = in[i]<<4 | t
+		t = in[i] >> 4
+	}
+	out[95] &= 0x3f
+
+	// The fourth node holds input bits 762 to 1015, i.e. shifted by 6 bits.
+	t = in[95] >> 2
+	for i := 96; i < 127; i++ {
+		out[i] = in[i]<<6 | t
+		t = in[i] >> 2
+	}
+	out[127] = t & 0x3f
+}
+
+// PieceCID returns the CID of the given piece commitment, i.e. a CIDv1 with the
+// fil-commitment-unsealed codec and a sha2-256-trunc254-padded multihash.
+func PieceCID(commP []byte) (cid.Cid, error) {
+	if len(commP) != nodeSize {
+		return cid.Undef, errors.New("piece commitment must be 32 bytes long")
+	}
+	mh, err := multihash.Encode(commP, uint64(multicodec.Sha2_256Trunc254Padded))
+	if err != nil {
+		return cid.Undef, err
+	}
+	return cid.NewCidV1(uint64(multicodec.FilCommitmentUnsealed), mh), nil
+}
+
+// IsPieceCID returns true if the given CID is the CID of a piece commitment.
+//
+// See: PieceCID.
+func IsPieceCID(c cid.Cid) bool {
+	if !c.Defined() {
+		return false
+	}
+	prefix := c.Prefix()
+	return prefix.Codec == uint64(multicodec.FilCommitmentUnsealed) &&
+		prefix.MhType == uint64(multicodec.Sha2_256Trunc254Padded)
+}
+
+// FromReader computes the piece CID of all the data read from the given reader, along with the
+// padded size of the piece.
+func FromReader(r io.Reader) (cid.Cid, uint64, error) {
+	var calc Calc
+	if _, err := io.Copy(&calc, r); err != nil {
+		return cid.Undef, 0, err
+	}
+	commP, size, err := calc.Sum()
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	pieceCid, err := PieceCID(commP)
+	if err != nil {
+		return cid.Undef, 0, err
+	}
+	return pieceCid, size, nil
+}
@@ -0,0 +1,135 @@
+package commp_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/filecoin-project/index-provider/commp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPaddedPieceSize(t *testing.T) {
+	tests := []struct {
+		size uint64
+		want uint64
+	}{
+		{size: 1, want: 128},
+		{size: 127, want: 128},
+		{size: 128, want: 256},
+		{size: 254, want: 256},
+		{size: 255, want: 512},
+		{size: 127 << 20, want: 128 << 20},
+		{size: 127<<20 + 1, want: 256 << 20},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.want, commp.PaddedPieceSize(tt.size), "size %d", tt.size)
+	}
+}
+
+func TestZeroPieceCommitment(t *testing.T) {
+	tests := []struct {
+		size uint64
+		want string
+	}{
+		{size: 127, want: "3731bb99ac689f66eef5973e4a94da188f4ddcae580724fc6f3fd60dfd488333"},
+		{size: 254, want: "642a607ef886b004bf2c1978463ae1d4693ac0f410eb2d1b7a47fe205e5e750f"},
+	}
+	for _, tt := range tests {
+		var calc commp.Calc
+		_, err := calc.Write(make([]byte, tt.size))
+		require.NoError(t, err)
+		got, size, err := calc.Sum()
+		require.NoError(t, err)
+		require.Equal(t, tt.want, hex.EncodeToString(got))
+		require.Equal(t, commp.PaddedPieceSize(tt.size), size)
+	}
+
+	pieceCid, size, err := commp.FromReader(bytes.NewReader(make([]byte, 127)))
+	require.NoError(t, err)
+	require.Equal(t, "baga6ea4seaqdomn3tgwgrh3g532zopskstnbrd2n3sxfqbze7rxt7vqn7veigmy", pieceCid.String())
+	require.Equal(t, uint64(128), size)
+	require.True(t, commp.IsPieceCID(pieceCid))
+}
+
+func TestPieceCommitmentIsPaddedWithZeros(t *testing.T) {
+	rng := rand.New(rand.NewSource(1413))
+	data := make([]byte, 1000)
+	rng.Read(data)
+
+	// Assert that data is implicitly padded with zeros up to its piece size, and that the result
+	// does not depend on how data is written.
+	var calc commp.Calc
+	for _, chunk := range [][]byte{data[:1], data[1:300], data[300:]} {
+		_, err := calc.Write(chunk)
+		require.NoError(t, err)
+	}
+	got, size, err := calc.Sum()
+	require.NoError(t, err)
+	require.Equal(t, uint64(1024), size)
+
+	var padded commp.Calc
+	_, err = padded.Write(append(data, make([]byte, 1016-len(data))...))
+	require.NoError(t, err)
+	want, wantSize, err := padded.Sum()
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+	require.Equal(t, wantSize, size)
+
+	// Assert that more data can be written after summing.
+	_, err = calc.Write([]byte("fish"))
+	require.NoError(t, err)
+	more, _, err := calc.Sum()
+	require.NoError(t, err)
+	require.NotEqual(t, got, more)
+}
+
+func TestEmptyDataHasNoPieceCommitment(t *testing.T) {
+	_, _, err := commp.FromReader(bytes.NewReader(nil))
+	require.ErrorIs(t, err, commp.ErrEmpty)
+}
+
+func TestCarPieceCID(t *testing.T) {
+	f, err := os.Open("../testdata/sample-v1.car")
+	require.NoError(t, err)
+	defer f.Close()
+	info, err := f.Stat()
+	require.NoError(t, err)
+
+	pieceCid, size, err := commp.FromReader(f)
+	require.NoError(t, err)
+	require.True(t, commp.IsPieceCID(pieceCid))
+	require.Equal(t, commp.PaddedPieceSize(uint64(info.Size())), size)
+}
+
+func TestPieceCommitmentMatchesReference(t *testing.T) {
+	rng := rand.New(rand.NewSource(1413))
+	data := make([]byte, 127)
+	rng.Read(data)
+
+	// Pad bit by bit: input bit i lands at output bit i + 2*(i/254).
+	var padded [128]byte
+	for i := 0; i < len(data)*8; i++ {
+		if data[i/8]&(1<<(i%8)) == 0 {
+			continue
+		}
+		o := i + 2*(i/254)
+		padded[o/8] |= 1 << (o % 8)
+	}
+	hash := func(left, right []byte) []byte {
+		digest := sha256.Sum256(append(append([]byte{}, left...), right...))
+		digest[31] &= 0x3f
+		return digest[:]
+	}
+	want := hash(hash(padded[0:32], padded[32:64]), hash(padded[64:96], padded[96:128]))
+
+	var calc commp.Calc
+	_, err := calc.Write(data)
+	require.NoError(t, err)
+	got, _, err := calc.Sum()
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
@@ -0,0 +1,96 @@
+package engine_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	provider "github.com/filecoin-project/index-provider"
+	"github.com/filecoin-project/index-provider/engine"
+	"github.com/filecoin-project/index-provider/metadata"
+	"github.com/filecoin-project/index-provider/testutil"
+	"github.com/filecoin-project/storetheindex/api/v0/ingest/schema"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+// BenchmarkEngine_Sync measures the throughput of traversing the advertisement chain along with
+// the entries of each advertisement via the engine linksystem, similar to an indexer syncing
+// with the engine.
+func BenchmarkEngine_Sync(b *testing.B) {
+	b.Run("Ads_10/Multihashes_1000", benchmarkEngineSync(10, 1000))
+	b.Run("Ads_100/Multihashes_100", benchmarkEngineSync(100, 100))
+	b.Run("Ads_1000/Multihashes_10", benchmarkEngineSync(1000, 10))
+}
+
+func benchmarkEngineSync(adCount, mhCount int) func(b *testing.B) {
+	return func(b *testing.B) {
+		rng := rand.New(rand.NewSource(1413))
+		ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+		defer cancel()
+
+		// Use a cache large enough to hold all the entries so that only reads are measured.
+		subject, err := engine.New(engine.WithChainedEntries(10), engine.WithEntriesCacheCapacity(adCount))
+		require.NoError(b, err)
+		require.NoError(b, subject.Start(ctx))
+		defer subject.Shutdown()
+
+		mhsByContextID := make(map[string][]multihash.Multihash, adCount)
+		subject.RegisterMultihashLister(func(ctx context.Context, p peer.ID, contextID []byte) (provider.MultihashIterator, error) {
+			mhs, ok := mhsByContextID[string(contextID)]
+			if !ok {
+				return nil, errors.New("not found")
+			}
+			return provider.SliceMultihashIterator(mhs), nil
+		})
+		md := metadata.Default.New(metadata.Bitswap{})
+		var latest cid.Cid
+		for i := 0; i < adCount; i++ {
+			contextID := []byte(fmt.Sprintf("ctx-%d", i))
+			mhsByContextID[string(contextID)] = testutil.RandomMultihashes(b, rng, mhCount)
+			latest, err = subject.NotifyPut(ctx, nil, contextID, md)
+			require.NoError(b, err)
+		}
+
+		lsys := subject.LinkSystem()
+		lctx := ipld.LinkContext{Ctx: ctx}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			var gotMhCount int
+			next := latest
+			for next != cid.Undef {
+				n, err := lsys.Load(lctx, cidlink.Link{Cid: next}, schema.AdvertisementPrototype)
+				require.NoError(b, err)
+				ad, err := schema.UnwrapAdvertisement(n)
+				require.NoError(b, err)
+
+				entries := ad.Entries
+				for entries != nil {
+					n, err := lsys.Load(lctx, entries, schema.EntryChunkPrototype)
+					require.NoError(b, err)
+					chunk, err := schema.UnwrapEntryChunk(n)
+					require.NoError(b, err)
+					gotMhCount += len(chunk.Entries)
+					entries = nil
+					if chunk.Next != nil {
+						entries = chunk.Next
+					}
+				}
+
+				next = cid.Undef
+				if ad.PreviousID != nil {
+					next = ad.PreviousID.(cidlink.Link).Cid
+				}
+			}
+			require.Equal(b, adCount*mhCount, gotMhCount)
+		}
+	}
+}
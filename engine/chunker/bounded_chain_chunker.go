@@ -0,0 +1,171 @@
+package chunker
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	provider "github.com/filecoin-project/index-provider"
+	"github.com/filecoin-project/storetheindex/api/v0/ingest/schema"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/multiformats/go-multihash"
+)
+
+var _ EntriesChunker = (*BoundedChainChunker)(nil)
+
+// BoundedChainChunker chunks advertisement entries as a chained series of schema.EntryChunk nodes,
+// where the size of each encoded chunk is bounded by a maximum number of bytes.
+// See: NewBoundedChainChunker
+type BoundedChainChunker struct {
+	ls            *ipld.LinkSystem
+	maxChunkBytes int
+	// entrySizes caches the number of bytes a multihash of a given length adds to an encoded chunk.
+	entrySizes map[int]int
+}
+
+// NewBoundedChainChunker instantiates a new chain chunker that given a provider.MultihashIterator
+// it drains all its mulithashes and stores them in the given link system represented as a chain of
+// schema.EntryChunk nodes where the encoded size of each chunk, including the link to the next
+// chunk, is no larger than maxChunkBytes.
+//
+// Unlike ChainChunker, the number of multihashes per chunk varies depending on the length of
+// multihashes. This makes the size of generated blocks predictable regardless of the hash
+// functions used to generate the multihashes.
+//
+// See: schema.EntryChunk, NewChainChunker.
+func NewBoundedChainChunker(ls *ipld.LinkSystem, maxChunkBytes int) (*BoundedChainChunker, error) {
+	if maxChunkBytes < 1 {
+		return nil, fmt.Errorf("max chunk bytes must be at least 1; got: %d", maxChunkBytes)
+	}
+	return &BoundedChainChunker{
+		ls:            ls,
+		maxChunkBytes: maxChunkBytes,
+		entrySizes:    make(map[int]int),
+	}, nil
+}
+
+func NewBoundedChainChunkerFunc(maxChunkBytes int) NewChunkerFunc {
+	return func(ls *ipld.LinkSystem) (EntriesChunker, error) {
+		return NewBoundedChainChunker(ls, maxChunkBytes)
+	}
+}
+
+// Chunk chunks all the mulithashes returned by the given iterator into a chain of schema.EntryChunk
+// nodes where each encoded chunk is no larger than maxChunkBytes and returns the link the root
+// chunk node.
+//
+// An error is returned if a single multihash cannot fit in a chunk of maxChunkBytes.
+//
+// See: schema.EntryChunk.
+func (b *BoundedChainChunker) Chunk(ctx context.Context, mhi provider.MultihashIterator) (ipld.Link, error) {
+	var mhs []multihash.Multihash
+	var next ipld.Link
+	var mhCount, chunkCount int
+
+	size, err := b.encodedSize(nil, next)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		mh, err := mhi.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		entrySize, err := b.entrySize(len(mh))
+		if err != nil {
+			return nil, err
+		}
+		if size+entrySize > b.maxChunkBytes {
+			if len(mhs) == 0 {
+				return nil, fmt.Errorf("multihash of length %d does not fit in chunk of max %d bytes", len(mh), b.maxChunkBytes)
+			}
+			cNode, err := newEntriesChunkNode(mhs, next)
+			if err != nil {
+				return nil, err
+			}
+			next, err = b.ls.Store(ipld.LinkContext{Ctx: ctx}, schema.Linkproto, cNode)
+			if err != nil {
+				return nil, err
+			}
+			chunkCount++
+			// The chunk is fully encoded on store, so it is safe to reuse mhs.
+			mhs = mhs[:0]
+			size, err = b.encodedSize(nil, next)
+			if err != nil {
+				return nil, err
+			}
+			if size+entrySize > b.maxChunkBytes {
+				return nil, fmt.Errorf("multihash of length %d does not fit in chunk of max %d bytes", len(mh), b.maxChunkBytes)
+			}
+		}
+		mhs = append(mhs, mh)
+		size += entrySize
+		mhCount++
+	}
+	if len(mhs) != 0 {
+		cNode, err := newEntriesChunkNode(mhs, next)
+		if err != nil {
+			return nil, err
+		}
+		next, err = b.ls.Store(ipld.LinkContext{Ctx: ctx}, schema.Linkproto, cNode)
+		if err != nil {
+			return nil, err
+		}
+		chunkCount++
+	}
+
+	log.Infow("Generated size-bounded linked chunks of multihashes", "totalMhCount", mhCount, "chunkCount", chunkCount, "maxChunkBytes", b.maxChunkBytes)
+	return next, nil
+}
+
+// entrySize returns the number of bytes that a multihash of the given length adds to an encoded
+// chunk. The size is measured by encoding a chunk with a single entry and is cached per length,
+// since the encoded size of an entry only depends on its length.
+//
+// The returned size includes one extra byte to account for any separator the codec may insert
+// between list elements.
+func (b *BoundedChainChunker) entrySize(mhLen int) (int, error) {
+	if s, ok := b.entrySizes[mhLen]; ok {
+		return s, nil
+	}
+	empty, err := b.encodedSize(nil, nil)
+	if err != nil {
+		return 0, err
+	}
+	single, err := b.encodedSize([]multihash.Multihash{make([]byte, mhLen)}, nil)
+	if err != nil {
+		return 0, err
+	}
+	s := single - empty + 1
+	b.entrySizes[mhLen] = s
+	return s, nil
+}
+
+// encodedSize returns the number of bytes of a schema.EntryChunk with the given entries and next
+// link when encoded using the codec of schema.Linkproto.
+func (b *BoundedChainChunker) encodedSize(mhs []multihash.Multihash, next ipld.Link) (int, error) {
+	n, err := newEntriesChunkNode(mhs, next)
+	if err != nil {
+		return 0, err
+	}
+	encoder, err := b.ls.EncoderChooser(schema.Linkproto)
+	if err != nil {
+		return 0, err
+	}
+	var cw countingWriter
+	if err := encoder(n, &cw); err != nil {
+		return 0, err
+	}
+	return int(cw), nil
+}
+
+// countingWriter counts the number of bytes written to it and discards them.
+type countingWriter int
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	*c += countingWriter(len(p))
+	return len(p), nil
+}
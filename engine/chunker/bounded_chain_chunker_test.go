@@ -0,0 +1,89 @@
+package chunker_test
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+
+	provider "github.com/filecoin-project/index-provider"
+	"github.com/filecoin-project/index-provider/engine/chunker"
+	"github.com/filecoin-project/index-provider/testutil"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/storage/memstore"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoundedChainChunker_Chunk(t *testing.T) {
+	ctx := context.TODO()
+	const maxChunkBytes = 1024
+	rng := rand.New(rand.NewSource(1413))
+
+	sha256Mhs := testutil.RandomMultihashes(t, rng, 100)
+	var mixedMhs []multihash.Multihash
+	for i := 0; i < 100; i++ {
+		code := uint64(multihash.SHA2_256)
+		if i%2 == 0 {
+			code = multihash.SHA2_512
+		}
+		buf := make([]byte, 64)
+		rng.Read(buf)
+		mh, err := multihash.Sum(buf, code, -1)
+		require.NoError(t, err)
+		mixedMhs = append(mixedMhs, mh)
+	}
+
+	tests := []struct {
+		name string
+		mhs  []multihash.Multihash
+	}{
+		{name: "sha2-256", mhs: sha256Mhs},
+		{name: "mixed sha2-256 and sha2-512", mhs: mixedMhs},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memstore.Store{}
+			ls := cidlink.DefaultLinkSystem()
+			ls.SetReadStorage(store)
+			ls.SetWriteStorage(store)
+
+			subject, err := chunker.NewBoundedChainChunkerFunc(maxChunkBytes)(&ls)
+			require.NoError(t, err)
+			l, err := subject.Chunk(ctx, provider.SliceMultihashIterator(tt.mhs))
+			require.NoError(t, err)
+
+			var chunkCount int
+			next := l
+			for next != nil {
+				raw, err := store.Get(ctx, next.(cidlink.Link).Cid.KeyString())
+				require.NoError(t, err)
+				require.LessOrEqual(t, len(raw), maxChunkBytes)
+				chunk := requireDecodeAsEntryChunk(t, next, raw)
+				require.NotEmpty(t, chunk.Entries)
+				next = chunk.Next
+				chunkCount++
+			}
+			require.Greater(t, chunkCount, 1)
+
+			gotMhs := requireDecodeAllMultihashes(t, l, ls)
+			requireChunkEntriesMatch(t, gotMhs, tt.mhs)
+		})
+	}
+}
+
+func TestBoundedChainChunker_ErrorsWhenMultihashDoesNotFit(t *testing.T) {
+	ctx := context.TODO()
+	store := &memstore.Store{}
+	ls := cidlink.DefaultLinkSystem()
+	ls.SetReadStorage(store)
+	ls.SetWriteStorage(store)
+
+	_, err := chunker.NewBoundedChainChunker(&ls, 0)
+	require.Error(t, err)
+
+	subject, err := chunker.NewBoundedChainChunker(&ls, 32)
+	require.NoError(t, err)
+	mhs := testutil.RandomMultihashes(t, rand.New(rand.NewSource(1413)), 1)
+	_, err = subject.Chunk(ctx, provider.SliceMultihashIterator(mhs))
+	require.Error(t, err)
+}
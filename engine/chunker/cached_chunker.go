@@ -269,6 +269,16 @@ func (ls *CachedEntriesChunker) Chunk(ctx context.Context, mhi provider.Multihas
 		return nil, err
 	}
 
+	// Chunking a DAG that is already cached writes every one of its chunks again, which counts
+	// each of them as overlapping; revert the counts so that the DAG is only counted once.
+	if _, cached := ls.cache.Get(root); cached {
+		for _, link := range links {
+			if err := ls.decrementOverlap(ctx, link); err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	// Store internal mappings for caching purposes.
 	err = ls.performOnCache(ctx, func(cache *lru.Cache) { cache.Add(root, links) })
 	if err != nil {
@@ -297,6 +307,144 @@ func (ls *CachedEntriesChunker) GetRawCachedChunk(ctx context.Context, l ipld.Li
 	return raw, nil
 }
 
+// Remove evicts the DAG with the given root link from the cache, deleting any of its chunks that
+// are not shared with other cached DAGs. Removing a root that is not cached is a no-op.
+func (ls *CachedEntriesChunker) Remove(ctx context.Context, root ipld.Link) error {
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+
+	err := ls.performOnCache(ctx, func(cache *lru.Cache) { cache.Remove(root) })
+	if err != nil {
+		return err
+	}
+	return ls.sync(ctx)
+}
+
+// GC evicts the cached DAGs whose root is not live according to the given isLive function, and
+// sweeps any chunks and caching metadata in the datastore that are not referenced by the remaining
+// cached DAGs. The overlap counts of the remaining chunks are recomputed from the remaining DAGs.
+//
+// The number of datastore keys deleted and the total size of their keys and values are returned.
+// Note that the space is not necessarily reclaimed by the backing datastore until it is compacted.
+func (ls *CachedEntriesChunker) GC(ctx context.Context, isLive func(root ipld.Link) bool) (int, uint64, error) {
+	ls.lock.Lock()
+	defer ls.lock.Unlock()
+
+	// Mark: count the occurrences of chunks across the live DAGs, and evict the DAGs that are no
+	// longer live from the in-memory cache. Their chunks are deleted from the datastore during
+	// sweep, since they are not counted.
+	occurrences := make(map[string]uint64)
+	liveRoots := make(map[string]struct{})
+	rootResults, err := ls.ds.Query(ctx, dsq.Query{Prefix: rootKeyPrefix.String()})
+	if err != nil {
+		return 0, 0, err
+	}
+	onEvicted := ls.cache.OnEvicted
+	ls.cache.OnEvicted = nil
+	defer func() { ls.cache.OnEvicted = onEvicted }()
+	for r := range rootResults.Next() {
+		if ctx.Err() != nil {
+			rootResults.Close()
+			return 0, 0, ctx.Err()
+		}
+		if r.Error != nil {
+			rootResults.Close()
+			return 0, 0, fmt.Errorf("cannot read cache key: %w", r.Error)
+		}
+		root, err := ls.linkFromDsCachePrefixedKey(datastore.RawKey(r.Key))
+		if err != nil {
+			rootResults.Close()
+			return 0, 0, err
+		}
+		if !isLive(root) {
+			ls.cache.Remove(root)
+			continue
+		}
+		liveRoots[dsKey(root).String()] = struct{}{}
+		vr := bytes.NewReader(r.Value)
+		for {
+			_, c, err := cid.CidFromReader(vr)
+			if err != nil {
+				if err == io.EOF {
+					break
+				}
+				rootResults.Close()
+				return 0, 0, err
+			}
+			occurrences[dsKey(cidlink.Link{Cid: c}).String()]++
+		}
+	}
+	rootResults.Close()
+
+	// Sweep: delete anything that is not referenced by a live DAG, and correct overlap counts.
+	results, err := ls.ds.Query(ctx, dsq.Query{})
+	if err != nil {
+		return 0, 0, err
+	}
+	defer results.Close()
+	batch, err := ls.ds.Batch(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	var deletedKeys int
+	var deletedBytes uint64
+	seenOverlaps := make(map[string]struct{})
+	for r := range results.Next() {
+		if ctx.Err() != nil {
+			return 0, 0, ctx.Err()
+		}
+		if r.Error != nil {
+			return 0, 0, fmt.Errorf("cannot read cache key: %w", r.Error)
+		}
+		key := datastore.RawKey(r.Key)
+
+		var keep bool
+		switch {
+		case rootKeyPrefix.IsAncestorOf(key):
+			_, keep = liveRoots["/"+key.BaseNamespace()]
+		case loverlapKeyPrefix.IsAncestorOf(key):
+			seenOverlaps["/"+key.BaseNamespace()] = struct{}{}
+			count := occurrences["/"+key.BaseNamespace()]
+			if count > 1 {
+				keep = true
+				if len(r.Value) != 8 || binary.LittleEndian.Uint64(r.Value) != count-1 {
+					oVal := make([]byte, 8)
+					binary.LittleEndian.PutUint64(oVal, count-1)
+					if err := batch.Put(ctx, key, oVal); err != nil {
+						return 0, 0, err
+					}
+				}
+			}
+		default:
+			keep = occurrences[key.String()] != 0
+		}
+		if keep {
+			continue
+		}
+		if err := batch.Delete(ctx, key); err != nil {
+			return 0, 0, err
+		}
+		deletedKeys++
+		deletedBytes += uint64(len(r.Key) + len(r.Value))
+	}
+	// Restore any missing overlap counts.
+	for k, count := range occurrences {
+		if _, ok := seenOverlaps[k]; ok || count < 2 {
+			continue
+		}
+		oVal := make([]byte, 8)
+		binary.LittleEndian.PutUint64(oVal, count-1)
+		if err := batch.Put(ctx, loverlapKeyPrefix.Child(datastore.NewKey(k)), oVal); err != nil {
+			return 0, 0, err
+		}
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return 0, 0, err
+	}
+	log.Infow("Garbage collected cached entries", "deletedKeys", deletedKeys, "deletedBytes", deletedBytes, "remainingDAGs", ls.cache.Len())
+	return deletedKeys, deletedBytes, ls.sync(ctx)
+}
+
 // Clear purges all stored items from the CachedEntriesChunker.
 func (ls *CachedEntriesChunker) Clear(ctx context.Context) error {
 	ls.lock.Lock()
@@ -14,6 +14,7 @@ import (
 	"github.com/filecoin-project/index-provider/testutil"
 	"github.com/filecoin-project/storetheindex/api/v0/ingest/schema"
 	"github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
 	dssync "github.com/ipfs/go-datastore/sync"
 	hamt "github.com/ipld/go-ipld-adl-hamt"
 	"github.com/ipld/go-ipld-prime"
@@ -70,6 +71,87 @@ func TestCachedEntriesChunker_Chain_OverlappingLinkCounter(t *testing.T) {
 	}
 }
 
+func TestCachedEntriesChunker_GC(t *testing.T) {
+	rng := rand.New(rand.NewSource(1413))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	store := datastore.NewMapDatastore()
+	subject, err := chunker.NewCachedEntriesChunker(ctx, store, 10, chunker.NewChainChunkerFunc(10), false)
+	require.NoError(t, err)
+	defer subject.Close()
+
+	// Cache two overlapping chains and one that does not overlap.
+	c1Mhs := testutil.RandomMultihashes(t, rng, 20)
+	c1Lnk, err := subject.Chunk(ctx, provider.SliceMultihashIterator(c1Mhs))
+	require.NoError(t, err)
+	c1Chain := listEntriesChain(t, subject, c1Lnk)
+	c2Lnk, err := subject.Chunk(ctx, provider.SliceMultihashIterator(append(c1Mhs, testutil.RandomMultihashes(t, rng, 10)...)))
+	require.NoError(t, err)
+	c2Chain := listEntriesChain(t, subject, c2Lnk)
+	c3Lnk, err := subject.Chunk(ctx, provider.SliceMultihashIterator(testutil.RandomMultihashes(t, rng, 20)))
+	require.NoError(t, err)
+	c3Chain := listEntriesChain(t, subject, c3Lnk)
+	requireOverlapCount(t, subject, 1, c1Chain...)
+	require.Equal(t, 3, subject.Len())
+
+	// Collect all but the second chain; the chunks it shares with the first chain must remain.
+	deletedKeys, deletedBytes, err := subject.GC(ctx, func(root ipld.Link) bool { return root == c2Lnk })
+	require.NoError(t, err)
+	require.Equal(t, 1, subject.Len())
+	// Two root keys, the two chunks of the third chain, and the overlap counts of the first chain.
+	require.Equal(t, 2+len(c3Chain)+len(c1Chain), deletedKeys)
+	require.NotZero(t, deletedBytes)
+	requireChunkIsCached(t, subject, c2Chain...)
+	requireChunkIsNotCached(t, subject, c3Chain...)
+	requireOverlapCount(t, subject, 0, c1Chain...)
+
+	// Collecting again must be a no-op.
+	deletedKeys, _, err = subject.GC(ctx, func(root ipld.Link) bool { return root == c2Lnk })
+	require.NoError(t, err)
+	require.Zero(t, deletedKeys)
+
+	// Evicting the remaining chain must delete its chunks without error.
+	require.NoError(t, subject.Remove(ctx, c2Lnk))
+	requireChunkIsNotCached(t, subject, c2Chain...)
+
+	// Collecting when nothing is live must leave the datastore empty.
+	_, err = subject.Chunk(ctx, provider.SliceMultihashIterator(c1Mhs))
+	require.NoError(t, err)
+	_, _, err = subject.GC(ctx, func(ipld.Link) bool { return false })
+	require.NoError(t, err)
+	require.Zero(t, subject.Len())
+	results, err := store.Query(ctx, dsq.Query{KeysOnly: true})
+	require.NoError(t, err)
+	remaining, err := results.Rest()
+	require.NoError(t, err)
+	require.Empty(t, remaining)
+}
+
+func TestCachedEntriesChunker_RechunkingCachedDagCountsOnce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1413))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	subject, err := chunker.NewCachedEntriesChunker(ctx, datastore.NewMapDatastore(), 10, chunker.NewChainChunkerFunc(10), false)
+	require.NoError(t, err)
+	defer subject.Close()
+
+	mhs := testutil.RandomMultihashes(t, rng, 20)
+	lnk, err := subject.Chunk(ctx, provider.SliceMultihashIterator(mhs))
+	require.NoError(t, err)
+	chain := listEntriesChain(t, subject, lnk)
+
+	// Chunking the same multihashes again must not count the cached chunks as overlapping.
+	again, err := subject.Chunk(ctx, provider.SliceMultihashIterator(mhs))
+	require.NoError(t, err)
+	require.Equal(t, lnk, again)
+	require.Equal(t, 1, subject.Len())
+	requireOverlapCount(t, subject, 0, chain...)
+
+	// Evicting the DAG must then delete its chunks.
+	require.NoError(t, subject.Remove(ctx, lnk))
+	requireChunkIsNotCached(t, subject, chain...)
+}
+
 func TestCachedEntriesChunker(t *testing.T) {
 	tests := []struct {
 		capacity int
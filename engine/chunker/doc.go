@@ -1,9 +1,10 @@
 // Package chunker provides functionality for chunking ad entries generated from
 // provider.MultihashIterator into an IPLD DAG. The interface given a multihash iterator an
 // EntriesChunker drains it, restructures the multihashes in an IPLD DAG and returns the root link
-// to that DAG. Two DAG datastructures are currently implemented: ChainChunker, and HamtChunker.
-// Additionally, CachedEntriesChunker can use either of the chunkers and provide an LRU caching
-// functionality for the generated DAGs.
+// to that DAG. Two DAG datastructures are currently implemented: chained EntryChunk, and HAMT.
+// The chain can either be bounded by the number of multihashes per chunk via ChainChunker, or by
+// the encoded size of each chunk via BoundedChainChunker. Additionally, CachedEntriesChunker can
+// use any of the chunkers and provide an LRU caching functionality for the generated DAGs.
 //
-// See: CachedEntriesChunker, ChainChunker, HamtChunker
+// See: CachedEntriesChunker, ChainChunker, BoundedChainChunker, HamtChunker
 package chunker
@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/url"
 	"sync"
@@ -32,14 +33,24 @@ const (
 	cidToKeyMapPrefix            = "map/cidKey/"
 	cidToProviderAndKeyMapPrefix = "map/cidProvAndKey/"
 	keyToMetadataMapPrefix       = "map/keyMD/"
+	adsPrefix                    = "ads/"
 	latestAdvKey                 = "sync/adv/"
 	linksCachePath               = "/cache/links"
 )
 
+// EntriesCacheKeyPrefix is the prefix of the datastore keys at which the engine caches the
+// entries of advertisements. It may be used to mount a separate storage for entries in the
+// datastore given to the engine.
+const EntriesCacheKeyPrefix = linksCachePath
+
 var (
 	log = logging.Logger("provider/engine")
 
 	dsLatestAdvKey = datastore.NewKey(latestAdvKey)
+
+	// ErrNotStarted signals that the engine must be started before the operation is performed.
+	// See: Engine.Start.
+	ErrNotStarted = errors.New("engine is not started")
 )
 
 // Engine is an implementation of the core reference provider interface.
@@ -53,6 +64,10 @@ type Engine struct {
 
 	mhLister provider.MultihashLister
 	cblk     sync.Mutex
+
+	// gcLock prevents advertisements from being published while garbage is collected, so that
+	// newly generated entries are not collected before they are mapped to their context ID.
+	gcLock sync.RWMutex
 }
 
 var _ provider.Interface = (*Engine)(nil)
@@ -96,12 +111,18 @@ func New(o ...Option) (*Engine, error) {
 }
 
 // Start starts the engine by instantiating the internal storage and joining
-// the configured gossipsub topic used for publishing advertisements.
+// the configured gossipsub topic used for publishing advertisements. Any
+// pending datastore migrations are applied before the engine starts; see
+// Migrate.
 //
 // The context is used to instantiate the internal LRU cache storage. See:
 // Engine.Shutdown, chunker.NewCachedEntriesChunker,
 // dtsync.NewPublisherFromExisting
 func (e *Engine) Start(ctx context.Context) error {
+	if _, err := Migrate(ctx, e.ds); err != nil {
+		return fmt.Errorf("could not migrate datastore: %w", err)
+	}
+
 	var err error
 	// Create datastore entriesChunker.
 	entriesCacheDs := dsn.Wrap(e.ds, datastore.NewKey(linksCachePath))
@@ -147,7 +168,7 @@ func (e *Engine) newPublisher() (dagsync.Publisher, error) {
 		if e.pubDT != nil {
 			return dtsync.NewPublisherFromExisting(e.pubDT, e.h, e.pubTopicName, e.lsys, dtOpts...)
 		}
-		ds := dsn.Wrap(e.ds, datastore.NewKey("/dagsync/dtsync/pub"))
+		ds := dsn.Wrap(e.ds, datastore.NewKey(dtsyncPublisherDatastorePrefix))
 		return dtsync.NewPublisher(e.h, ds, e.lsys, e.pubTopicName, dtOpts...)
 	case HttpPublisher:
 		return httpsync.NewPublisher(e.pubHttpListenAddr, e.lsys, e.h.ID(), e.key)
@@ -432,6 +453,9 @@ func (e *Engine) GetLatestAdv(ctx context.Context) (cid.Cid, *schema.Advertiseme
 }
 
 func (e *Engine) publishAdvForIndex(ctx context.Context, p peer.ID, addrs []multiaddr.Multiaddr, contextID []byte, md metadata.Metadata, isRm bool) (cid.Cid, error) {
+	e.gcLock.RLock()
+	defer e.gcLock.RUnlock()
+
 	var err error
 	var cidsLnk cidlink.Link
 
@@ -448,6 +472,11 @@ func (e *Engine) publishAdvForIndex(ctx context.Context, p peer.ID, addrs []mult
 	// CIDs from the contextID using the multihash lister, and store the
 	// relationship.
 	if !isRm {
+		// Reject metadata that indexers would reject, before any state is changed.
+		if err := md.Validate(); err != nil {
+			return cid.Undef, err
+		}
+
 		log.Info("Creating advertisement")
 
 		// If no previously-published ad for this context ID.
@@ -463,6 +492,15 @@ func (e *Engine) publishAdvForIndex(ctx context.Context, p peer.ID, addrs []mult
 			if err != nil {
 				return cid.Undef, err
 			}
+			// Index the multihashes locally as they are chunked, if enabled.
+			var idxIter *indexingIterator
+			if e.localIndex {
+				idxIter, err = e.newIndexingIterator(ctx, p, contextID, mhIter)
+				if err != nil {
+					return cid.Undef, err
+				}
+				mhIter = idxIter
+			}
 			// Generate the linked list ipld.Link that is added to the
 			// advertisement and used for ingestion.
 			lnk, err := e.entriesChunker.Chunk(ctx, mhIter)
@@ -470,6 +508,11 @@ func (e *Engine) publishAdvForIndex(ctx context.Context, p peer.ID, addrs []mult
 				return cid.Undef, fmt.Errorf("could not generate entries list: %s", err)
 			}
 			cidsLnk = lnk.(cidlink.Link)
+			if idxIter != nil {
+				if err = idxIter.commit(); err != nil {
+					return cid.Undef, fmt.Errorf("failed to write multihashes to local index: %s", err)
+				}
+			}
 
 			// Store the relationship between providerID, contextID and CID of the
 			// advertised list of Cids.
@@ -508,6 +551,15 @@ func (e *Engine) publishAdvForIndex(ctx context.Context, p peer.ID, addrs []mult
 			return cid.Undef, provider.ErrContextIDNotFound
 		}
 
+		// Remove the multihashes from local index before the mappings are
+		// deleted. Failing to do so is not fatal, since the stale records
+		// are skipped on lookup.
+		if e.localIndex {
+			if err = e.removeFromLocalIndex(ctx, p, contextID); err != nil {
+				log.Warnw("Failed to remove multihashes from local index", "err", err)
+			}
+		}
+
 		// If removing by context ID, it means the list of CIDs is not needed
 		// anymore, so we can remove the entry from the datastore.
 		err = e.deleteKeyCidMap(ctx, p, contextID)
@@ -529,7 +581,7 @@ func (e *Engine) publishAdvForIndex(ctx context.Context, p peer.ID, addrs []mult
 
 		// The advertisement still requires a valid metadata even though
 		// metadata is not used for removal. Create a valid empty metadata.
-		md = metadata.Default.New()
+		md = e.mdContext.New()
 	}
 
 	mdBytes, err := md.MarshalBinary()
@@ -550,7 +602,12 @@ func (e *Engine) publishAdvForIndex(ctx context.Context, p peer.ID, addrs []mult
 		Metadata:  mdBytes,
 		IsRm:      isRm,
 	}
+	return e.signAndPublish(ctx, adv)
+}
 
+// signAndPublish links the given advertisement to the latest advertisement, signs it and publishes
+// it via Engine.Publish.
+func (e *Engine) signAndPublish(ctx context.Context, adv schema.Advertisement) (cid.Cid, error) {
 	// Get the previous advertisement that was generated.
 	prevAdvID, err := e.getLatestAdCid(ctx)
 	if err != nil {
@@ -679,7 +736,7 @@ func (e *Engine) putKeyMetadataMap(ctx context.Context, provider peer.ID, contex
 }
 
 func (e *Engine) getKeyMetadataMap(ctx context.Context, provider peer.ID, contextID []byte) (metadata.Metadata, error) {
-	md := metadata.Default.New()
+	md := e.mdContext.New()
 	data, err := e.ds.Get(ctx, e.keyToMetadataKey(provider, contextID))
 	if err != nil {
 		return md, err
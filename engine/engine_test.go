@@ -9,9 +9,11 @@ import (
 	"net/http/httptest"
 	"path/filepath"
 	"sort"
+	"sync"
 	"testing"
 	"time"
 
+	datatransfer "github.com/filecoin-project/go-data-transfer"
 	provider "github.com/filecoin-project/index-provider"
 	"github.com/filecoin-project/index-provider/engine"
 	"github.com/filecoin-project/index-provider/metadata"
@@ -24,7 +26,11 @@ import (
 	"github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
 	leveldb "github.com/ipfs/go-ds-leveldb"
+	hamt "github.com/ipld/go-ipld-adl-hamt"
 	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/ipld/go-ipld-prime/node/basicnode"
 	"github.com/ipld/go-ipld-prime/storage/memstore"
@@ -34,6 +40,7 @@ import (
 	pubsub "github.com/libp2p/go-libp2p-pubsub"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multiaddr"
+	"github.com/multiformats/go-multicodec"
 	"github.com/multiformats/go-multihash"
 	"github.com/stretchr/testify/require"
 	"golang.org/x/time/rate"
@@ -323,6 +330,23 @@ func TestEngine_NotifyPutWithoutListerIsError(t *testing.T) {
 	require.Equal(t, cid.Undef, gotCid)
 }
 
+func TestEngine_NotifyPutWithInvalidMetadataIsError(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	subject, err := engine.New()
+	require.NoError(t, err)
+	err = subject.Start(ctx)
+	require.NoError(t, err)
+	defer subject.Shutdown()
+	subject.RegisterMultihashLister(func(ctx context.Context, p peer.ID, contextID []byte) (provider.MultihashIterator, error) {
+		t.Fatal("multihashes must not be listed for invalid metadata")
+		return nil, nil
+	})
+
+	gotCid, err := subject.NotifyPut(ctx, nil, []byte("fish"), metadata.Default.New(&metadata.GraphsyncFilecoinV1{}))
+	require.ErrorAs(t, err, &metadata.ErrInvalidMetadata{})
+	require.Equal(t, cid.Undef, gotCid)
+}
+
 func TestEngine_NotifyPutThenNotifyRemove(t *testing.T) {
 	ctx := testutil.ContextWithTimeout(t)
 	rng := rand.New(rand.NewSource(1413))
@@ -619,6 +643,15 @@ func TestEngine_DatastoreBackwardsCompatibilityTest(t *testing.T) {
 
 	// walking back the ad chain
 	existingRoot, _ := cid.Parse("baguqeeraix5q35zho3z2x5hqsa2iga3372qj4txsr4ooc2zvbyownka57gzq")
+
+	// assert that the existing ads are moved to their own namespace on start
+	legacyRootExists, err := ds.Has(ctx, datastore.NewKey(existingRoot.String()))
+	require.NoError(t, err)
+	require.False(t, legacyRootExists)
+	rootExists, err := ds.Has(ctx, datastore.NewKey("ads/"+existingRoot.String()))
+	require.NoError(t, err)
+	require.True(t, rootExists)
+
 	ad, err := subject.GetAdv(ctx, existingRoot)
 	require.NoError(t, err)
 
@@ -696,3 +729,495 @@ func requireEqualDagsyncMessage(t *testing.T, got, want gossiptopic.Message) {
 	sort.Strings(gotAddrsStr)
 	require.Equal(t, wantAddrsStr, gotAddrsStr)
 }
+
+func TestEngine_ReencodeEntries(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	rng := rand.New(rand.NewSource(1413))
+
+	h, err := libp2p.New()
+	require.NoError(t, err)
+	defer h.Close()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	mhsByContextID := map[string][]multihash.Multihash{
+		"fish":    testutil.RandomMultihashes(t, rng, 42),
+		"lobster": testutil.RandomMultihashes(t, rng, 42),
+	}
+	lister := func(ctx context.Context, p peer.ID, contextID []byte) (provider.MultihashIterator, error) {
+		mhs, ok := mhsByContextID[string(contextID)]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return provider.SliceMultihashIterator(mhs), nil
+	}
+	wantMd := metadata.Default.New(metadata.Bitswap{})
+
+	original, err := engine.New(engine.WithHost(h), engine.WithDatastore(ds), engine.WithChainedEntries(10))
+	require.NoError(t, err)
+	require.NoError(t, original.Start(ctx))
+	original.RegisterMultihashLister(lister)
+	fishAdCid, err := original.NotifyPut(ctx, nil, []byte("fish"), wantMd)
+	require.NoError(t, err)
+	_, err = original.NotifyPut(ctx, nil, []byte("lobster"), wantMd)
+	require.NoError(t, err)
+	_, err = original.NotifyRemove(ctx, "", []byte("lobster"))
+	require.NoError(t, err)
+	fishAd, err := original.GetAdv(ctx, fishAdCid)
+	require.NoError(t, err)
+	require.NoError(t, original.Shutdown())
+
+	subject, err := engine.New(engine.WithHost(h), engine.WithDatastore(ds), engine.WithHamtEntries(multicodec.Murmur3X64_64, 3, 1))
+	require.NoError(t, err)
+	require.NoError(t, subject.Start(ctx))
+	defer subject.Shutdown()
+	subject.RegisterMultihashLister(lister)
+
+	// Only the context ID that is not removed should be re-encoded.
+	gotAdCids, err := subject.ReencodeEntries(ctx)
+	require.NoError(t, err)
+	require.Len(t, gotAdCids, 1)
+
+	latestAdCid, latestAd, err := subject.GetLatestAdv(ctx)
+	require.NoError(t, err)
+	require.Equal(t, gotAdCids[0], latestAdCid)
+	require.Equal(t, []byte("fish"), latestAd.ContextID)
+	require.Equal(t, fishAd.Addresses, latestAd.Addresses)
+	require.Equal(t, fishAd.Metadata, latestAd.Metadata)
+	require.False(t, latestAd.IsRm)
+	require.NotEqual(t, fishAd.Entries, latestAd.Entries)
+
+	// The previous entries must no longer be cached, and the new entries must be a HAMT.
+	oldChunk, err := subject.Chunker().GetRawCachedChunk(ctx, fishAd.Entries)
+	require.NoError(t, err)
+	require.Nil(t, oldChunk)
+	_, err = subject.LinkSystem().Load(ipld.LinkContext{Ctx: ctx}, latestAd.Entries, hamt.HashMapRootPrototype)
+	require.NoError(t, err)
+
+	// Re-encoding again should be a no-op since entries are already in the configured format.
+	gotAdCids, err = subject.ReencodeEntries(ctx)
+	require.NoError(t, err)
+	require.Empty(t, gotAdCids)
+}
+
+func TestEngine_ReencodeEntriesKeepsPreviousEntriesOnFailure(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	rng := rand.New(rand.NewSource(1413))
+
+	h, err := libp2p.New()
+	require.NoError(t, err)
+	defer h.Close()
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	mhsByContextID := map[string][]multihash.Multihash{
+		"fish":    testutil.RandomMultihashes(t, rng, 42),
+		"lobster": testutil.RandomMultihashes(t, rng, 42),
+	}
+	var failLobster bool
+	lister := func(ctx context.Context, p peer.ID, contextID []byte) (provider.MultihashIterator, error) {
+		mhs, ok := mhsByContextID[string(contextID)]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		if failLobster && string(contextID) == "lobster" {
+			return &failingMhIterator{mhs: mhs[:21]}, nil
+		}
+		return provider.SliceMultihashIterator(mhs), nil
+	}
+	wantMd := metadata.Default.New(metadata.Bitswap{})
+
+	original, err := engine.New(engine.WithHost(h), engine.WithDatastore(ds), engine.WithChainedEntries(10))
+	require.NoError(t, err)
+	require.NoError(t, original.Start(ctx))
+	original.RegisterMultihashLister(lister)
+	_, err = original.NotifyPut(ctx, nil, []byte("fish"), wantMd)
+	require.NoError(t, err)
+	lobsterAdCid, err := original.NotifyPut(ctx, nil, []byte("lobster"), wantMd)
+	require.NoError(t, err)
+	lobsterAd, err := original.GetAdv(ctx, lobsterAdCid)
+	require.NoError(t, err)
+	require.NoError(t, original.Shutdown())
+
+	subject, err := engine.New(engine.WithHost(h), engine.WithDatastore(ds), engine.WithHamtEntries(multicodec.Murmur3X64_64, 3, 1))
+	require.NoError(t, err)
+	require.NoError(t, subject.Start(ctx))
+	defer subject.Shutdown()
+	subject.RegisterMultihashLister(lister)
+
+	// Fail listing the multihashes of the second context ID midway through re-encoding.
+	failLobster = true
+	gotAdCids, err := subject.ReencodeEntries(ctx)
+	require.ErrorContains(t, err, "could not generate entries list")
+	require.Len(t, gotAdCids, 1)
+
+	// The entries of the advertisement that failed to re-encode must still be cached and served,
+	// even though the lister cannot regenerate them.
+	oldChunk, err := subject.Chunker().GetRawCachedChunk(ctx, lobsterAd.Entries)
+	require.NoError(t, err)
+	require.NotNil(t, oldChunk)
+	_, err = subject.LinkSystem().Load(ipld.LinkContext{Ctx: ctx}, lobsterAd.Entries, schema.EntryChunkPrototype)
+	require.NoError(t, err)
+
+	// Once listing succeeds, only the remaining context ID is re-encoded.
+	failLobster = false
+	gotAdCids, err = subject.ReencodeEntries(ctx)
+	require.NoError(t, err)
+	require.Len(t, gotAdCids, 1)
+	_, latestAd, err := subject.GetLatestAdv(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []byte("lobster"), latestAd.ContextID)
+	oldChunk, err = subject.Chunker().GetRawCachedChunk(ctx, lobsterAd.Entries)
+	require.NoError(t, err)
+	require.Nil(t, oldChunk)
+}
+
+// failingMhIterator returns the given multihashes followed by an error.
+type failingMhIterator struct {
+	mhs []multihash.Multihash
+}
+
+func (i *failingMhIterator) Next() (multihash.Multihash, error) {
+	if len(i.mhs) == 0 {
+		return nil, errors.New("failed to list multihashes")
+	}
+	mh := i.mhs[0]
+	i.mhs = i.mhs[1:]
+	return mh, nil
+}
+
+func TestEngine_FindLocal(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	rng := rand.New(rand.NewSource(1413))
+
+	mhsByContextID := map[string][]multihash.Multihash{
+		"fish":    testutil.RandomMultihashes(t, rng, 42),
+		"lobster": testutil.RandomMultihashes(t, rng, 42),
+	}
+	// Share a multihash across both context IDs.
+	shared := mhsByContextID["fish"][0]
+	mhsByContextID["lobster"] = append(mhsByContextID["lobster"], shared)
+
+	subject, err := engine.New(engine.WithLocalIndex(true))
+	require.NoError(t, err)
+	require.NoError(t, subject.Start(ctx))
+	defer subject.Shutdown()
+	subject.RegisterMultihashLister(func(ctx context.Context, p peer.ID, contextID []byte) (provider.MultihashIterator, error) {
+		mhs, ok := mhsByContextID[string(contextID)]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return provider.SliceMultihashIterator(mhs), nil
+	})
+
+	wantMd := metadata.Default.New(metadata.Bitswap{})
+	_, err = subject.NotifyPut(ctx, nil, []byte("fish"), wantMd)
+	require.NoError(t, err)
+	_, err = subject.NotifyPut(ctx, nil, []byte("lobster"), wantMd)
+	require.NoError(t, err)
+
+	got, err := subject.FindLocal(ctx, mhsByContextID["fish"][1])
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, subject.ProviderID(), got[0].Provider)
+	require.Equal(t, []byte("fish"), got[0].ContextID)
+	require.True(t, wantMd.Equal(got[0].Metadata))
+
+	got, err = subject.FindLocal(ctx, shared)
+	require.NoError(t, err)
+	require.Len(t, got, 2)
+
+	_, err = subject.NotifyRemove(ctx, "", []byte("fish"))
+	require.NoError(t, err)
+
+	got, err = subject.FindLocal(ctx, mhsByContextID["fish"][1])
+	require.NoError(t, err)
+	require.Empty(t, got)
+	got, err = subject.FindLocal(ctx, shared)
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, []byte("lobster"), got[0].ContextID)
+
+	got, err = subject.FindLocal(ctx, testutil.RandomMultihashes(t, rng, 1)[0])
+	require.NoError(t, err)
+	require.Empty(t, got)
+}
+
+func TestEngine_FindLocalIgnoresPreviousContent(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	rng := rand.New(rand.NewSource(1413))
+	oldMhs := testutil.RandomMultihashes(t, rng, 42)
+	newMhs := testutil.RandomMultihashes(t, rng, 42)
+
+	subject, err := engine.New(engine.WithLocalIndex(true))
+	require.NoError(t, err)
+	require.NoError(t, subject.Start(ctx))
+	defer subject.Shutdown()
+	mhs := oldMhs
+	subject.RegisterMultihashLister(func(ctx context.Context, p peer.ID, contextID []byte) (provider.MultihashIterator, error) {
+		if mhs == nil {
+			return nil, errors.New("not available")
+		}
+		return provider.SliceMultihashIterator(mhs), nil
+	})
+
+	md := metadata.Default.New(metadata.Bitswap{})
+	_, err = subject.NotifyPut(ctx, nil, []byte("fish"), md)
+	require.NoError(t, err)
+
+	// Remove while the multihashes cannot be listed, then re-put with different content.
+	mhs = nil
+	_, err = subject.NotifyRemove(ctx, "", []byte("fish"))
+	require.NoError(t, err)
+	got, err := subject.FindLocal(ctx, oldMhs[0])
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	mhs = newMhs
+	_, err = subject.NotifyPut(ctx, nil, []byte("fish"), md)
+	require.NoError(t, err)
+	got, err = subject.FindLocal(ctx, oldMhs[0])
+	require.NoError(t, err)
+	require.Empty(t, got)
+	got, err = subject.FindLocal(ctx, newMhs[0])
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.Equal(t, []byte("fish"), got[0].ContextID)
+}
+
+func TestEngine_FindLocalIndexesInBoundedBatches(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	rng := rand.New(rand.NewSource(1413))
+	mhs := testutil.RandomMultihashes(t, rng, 2500)
+
+	ds := &batchSizeRecordingDatastore{Batching: dssync.MutexWrap(datastore.NewMapDatastore())}
+	subject, err := engine.New(engine.WithLocalIndex(true), engine.WithDatastore(ds))
+	require.NoError(t, err)
+	require.NoError(t, subject.Start(ctx))
+	defer subject.Shutdown()
+	fail := true
+	subject.RegisterMultihashLister(func(ctx context.Context, p peer.ID, contextID []byte) (provider.MultihashIterator, error) {
+		if fail {
+			return &failingMhIterator{mhs: mhs}, nil
+		}
+		return provider.SliceMultihashIterator(mhs), nil
+	})
+
+	// Assert that the multihashes written before listing failed are not found, even though some
+	// of their batches were committed.
+	md := metadata.Default.New(metadata.Bitswap{})
+	_, err = subject.NotifyPut(ctx, nil, []byte("fish"), md)
+	require.Error(t, err)
+	got, err := subject.FindLocal(ctx, mhs[0])
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	fail = false
+	_, err = subject.NotifyPut(ctx, nil, []byte("fish"), md)
+	require.NoError(t, err)
+	for _, mh := range []multihash.Multihash{mhs[0], mhs[len(mhs)-1]} {
+		got, err = subject.FindLocal(ctx, mh)
+		require.NoError(t, err)
+		require.Len(t, got, 1)
+	}
+
+	_, err = subject.NotifyRemove(ctx, "", []byte("fish"))
+	require.NoError(t, err)
+	got, err = subject.FindLocal(ctx, mhs[len(mhs)-1])
+	require.NoError(t, err)
+	require.Empty(t, got)
+
+	// Each multihash is written to and deleted from two keys of the local index.
+	require.LessOrEqual(t, ds.maxBatchSize(), 2*1024)
+}
+
+// batchSizeRecordingDatastore records the largest number of operations committed in a batch.
+type batchSizeRecordingDatastore struct {
+	datastore.Batching
+	mu  sync.Mutex
+	max int
+}
+
+func (d *batchSizeRecordingDatastore) Batch(ctx context.Context) (datastore.Batch, error) {
+	b, err := d.Batching.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &sizeRecordingBatch{Batch: b, d: d}, nil
+}
+
+func (d *batchSizeRecordingDatastore) maxBatchSize() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.max
+}
+
+type sizeRecordingBatch struct {
+	datastore.Batch
+	d    *batchSizeRecordingDatastore
+	size int
+}
+
+func (b *sizeRecordingBatch) Put(ctx context.Context, key datastore.Key, value []byte) error {
+	b.size++
+	return b.Batch.Put(ctx, key, value)
+}
+
+func (b *sizeRecordingBatch) Delete(ctx context.Context, key datastore.Key) error {
+	b.size++
+	return b.Batch.Delete(ctx, key)
+}
+
+func (b *sizeRecordingBatch) Commit(ctx context.Context) error {
+	b.d.mu.Lock()
+	if b.size > b.d.max {
+		b.d.max = b.size
+	}
+	b.d.mu.Unlock()
+	return b.Batch.Commit(ctx)
+}
+
+func TestEngine_FindLocalWithCustomMetadataProtocol(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	rng := rand.New(rand.NewSource(1413))
+	mhs := testutil.RandomMultihashes(t, rng, 42)
+
+	const customCode = multicodec.Code(0x300001)
+	factory, err := metadata.NewSchemaProtocolFactory(customCode, "type Fish string", "Fish")
+	require.NoError(t, err)
+	mc := metadata.Default.WithProtocol(customCode, factory)
+
+	subject, err := engine.New(engine.WithLocalIndex(true), engine.WithMetadataContext(mc))
+	require.NoError(t, err)
+	require.NoError(t, subject.Start(ctx))
+	defer subject.Shutdown()
+	subject.RegisterMultihashLister(func(ctx context.Context, p peer.ID, contextID []byte) (provider.MultihashIterator, error) {
+		return provider.SliceMultihashIterator(mhs), nil
+	})
+
+	custom := factory().(*metadata.SchemaProtocol)
+	require.NoError(t, custom.SetNode(basicnode.NewString("lobster")))
+	wantMd := mc.New(custom)
+	_, err = subject.NotifyPut(ctx, nil, []byte("fish"), wantMd)
+	require.NoError(t, err)
+
+	got, err := subject.FindLocal(ctx, mhs[0])
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	require.True(t, wantMd.Equal(got[0].Metadata))
+}
+
+func TestEngine_FindLocalWhenDisabledIsError(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	rng := rand.New(rand.NewSource(1413))
+
+	subject, err := engine.New()
+	require.NoError(t, err)
+	require.NoError(t, subject.Start(ctx))
+	defer subject.Shutdown()
+
+	_, err = subject.FindLocal(ctx, testutil.RandomMultihashes(t, rng, 1)[0])
+	require.Equal(t, engine.ErrLocalIndexDisabled, err)
+}
+
+func TestEngine_GC(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	rng := rand.New(rand.NewSource(1413))
+
+	mhsByContextID := map[string][]multihash.Multihash{
+		"fish":    testutil.RandomMultihashes(t, rng, 42),
+		"lobster": testutil.RandomMultihashes(t, rng, 42),
+	}
+	subject, err := engine.New(engine.WithChainedEntries(10), engine.WithLocalIndex(true))
+	require.NoError(t, err)
+	require.NoError(t, subject.Start(ctx))
+	defer subject.Shutdown()
+	subject.RegisterMultihashLister(func(ctx context.Context, p peer.ID, contextID []byte) (provider.MultihashIterator, error) {
+		mhs, ok := mhsByContextID[string(contextID)]
+		if !ok {
+			return nil, errors.New("not found")
+		}
+		return provider.SliceMultihashIterator(mhs), nil
+	})
+
+	md := metadata.Default.New(metadata.Bitswap{})
+	fishAdCid, err := subject.NotifyPut(ctx, nil, []byte("fish"), md)
+	require.NoError(t, err)
+	lobsterAdCid, err := subject.NotifyPut(ctx, nil, []byte("lobster"), md)
+	require.NoError(t, err)
+	fishAd, err := subject.GetAdv(ctx, fishAdCid)
+	require.NoError(t, err)
+	lobsterAd, err := subject.GetAdv(ctx, lobsterAdCid)
+	require.NoError(t, err)
+	_, err = subject.NotifyRemove(ctx, "", []byte("lobster"))
+	require.NoError(t, err)
+
+	// The entries of removed context ID remain cached until garbage is collected.
+	lobsterChain := listEntriesChainFromCache(t, subject.Chunker(), lobsterAd.Entries)
+	fishChain := listEntriesChainFromCache(t, subject.Chunker(), fishAd.Entries)
+	requireChunkIsCached(t, subject.Chunker(), lobsterChain...)
+
+	stats, err := subject.GC(ctx)
+	require.NoError(t, err)
+	require.NotZero(t, stats.DeletedKeys)
+	require.NotZero(t, stats.DeletedBytes)
+	require.Equal(t, stats.DeletedBytes, stats.ReclaimedBytes())
+	requireChunkIsNotCached(t, subject.Chunker(), lobsterChain...)
+	requireChunkIsCached(t, subject.Chunker(), fishChain...)
+
+	// The advertisements and the entries of live context IDs must remain retrievable.
+	_, err = subject.LinkSystem().Load(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: lobsterAdCid}, schema.AdvertisementPrototype)
+	require.NoError(t, err)
+	requireLoadEntryChunkFromEngine(t, subject, fishChain...)
+	got, err := subject.FindLocal(ctx, mhsByContextID["fish"][0])
+	require.NoError(t, err)
+	require.Len(t, got, 1)
+	_, err = subject.NotifyPut(ctx, nil, []byte("fish"), md)
+	require.Equal(t, provider.ErrAlreadyAdvertised, err)
+
+	// Collecting again must be a no-op.
+	stats, err = subject.GC(ctx)
+	require.NoError(t, err)
+	require.Zero(t, stats.DeletedKeys)
+}
+
+func TestEngine_GCSweepsFinishedDataTransferState(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	dtds := dssync.MutexWrap(datastore.NewMapDatastore())
+	putChannelState := func(key string, status datatransfer.Status) datastore.Key {
+		n, err := qp.BuildMap(basicnode.Prototype.Any, 1, func(ma datamodel.MapAssembler) {
+			qp.MapEntry(ma, "Status", qp.Int(int64(status)))
+		})
+		require.NoError(t, err)
+		var buf bytes.Buffer
+		require.NoError(t, dagcbor.Encode(n, &buf))
+		k := datastore.NewKey("/2/" + key)
+		require.NoError(t, dtds.Put(ctx, k, buf.Bytes()))
+		return k
+	}
+	completed := putChannelState("completed", datatransfer.Completed)
+	failed := putChannelState("failed", datatransfer.Failed)
+	ongoing := putChannelState("ongoing", datatransfer.Ongoing)
+	unknown := datastore.NewKey("/2/unknown")
+	require.NoError(t, dtds.Put(ctx, unknown, []byte("fish")))
+
+	subject, err := engine.New(engine.WithDataTransferDatastore(dtds))
+	require.NoError(t, err)
+	_, err = subject.GC(ctx)
+	require.Equal(t, engine.ErrNotStarted, err)
+
+	require.NoError(t, subject.Start(ctx))
+	defer subject.Shutdown()
+	stats, err := subject.GC(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.DeletedKeys)
+
+	for _, k := range []datastore.Key{completed, failed} {
+		has, err := dtds.Has(ctx, k)
+		require.NoError(t, err)
+		require.False(t, has, "state of finished transfer %s must be collected", k)
+	}
+	for _, k := range []datastore.Key{ongoing, unknown} {
+		has, err := dtds.Has(ctx, k)
+		require.NoError(t, err)
+		require.True(t, has, "%s must not be collected", k)
+	}
+}
@@ -0,0 +1,296 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	datatransfer "github.com/filecoin-project/go-data-transfer"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dsn "github.com/ipfs/go-datastore/namespace"
+	dsq "github.com/ipfs/go-datastore/query"
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+)
+
+const (
+	// dtsyncPublisherDatastorePrefix is the prefix of the datastore keys at which the data
+	// transfer manager created by the engine for its publisher persists its state.
+	dtsyncPublisherDatastorePrefix = "/dagsync/dtsync/pub"
+	// dtChannelStatePrefix is the prefix of the datastore keys at which a data transfer manager
+	// persists the state of its channels, relative to its datastore. The prefix is the version of
+	// the channel state schema of go-data-transfer.
+	dtChannelStatePrefix = "/2/"
+)
+
+// GCStats summarises the outcome of a garbage collection run. See: Engine.GC.
+type GCStats struct {
+	// DeletedKeys is the number of datastore keys deleted.
+	DeletedKeys int
+	// DeletedBytes is the total size of the deleted datastore keys and values.
+	DeletedBytes uint64
+	// DiskUsageBefore is the disk usage of the datastore before garbage collection, or zero if the
+	// datastore does not report its disk usage.
+	DiskUsageBefore uint64
+	// DiskUsageAfter is the disk usage of the datastore after garbage collection, or zero if the
+	// datastore does not report its disk usage.
+	DiskUsageAfter uint64
+}
+
+// ReclaimedBytes returns the reduction in disk usage of the datastore if reported by the
+// datastore, or the total size of the deleted keys and values otherwise.
+func (s *GCStats) ReclaimedBytes() uint64 {
+	if s.DiskUsageBefore == 0 {
+		return s.DeletedBytes
+	}
+	if s.DiskUsageAfter > s.DiskUsageBefore {
+		return 0
+	}
+	return s.DiskUsageBefore - s.DiskUsageAfter
+}
+
+// GC deletes the data in the engine datastore that is no longer referenced by any context ID
+// that is currently advertised. Specifically:
+//   - the cached entries that are not the entries of a live context ID, along with their caching
+//     metadata, and
+//   - the mappings of entries and metadata that are left behind for removed context IDs, and
+//   - the records of the local multihash index that are not of the current generation of a
+//     live context ID.
+//
+// Once deleted, the datastore is compacted if it implements datastore.GCDatastore.
+//
+// GC can be called while the engine is running. Publication of advertisements via
+// Engine.NotifyPut and Engine.NotifyRemove blocks until GC is complete; the advertisements and
+// their entries remain retrievable in the meantime.
+//
+// The state of finished data transfers is also swept, i.e. the transfers that are completed,
+// failed or cancelled. This includes the state of the data transfer manager created by the engine
+// for its publisher, and of the manager set via WithDataTransfer if its datastore is set via
+// WithDataTransferDatastore.
+//
+// ErrNotStarted is returned if the engine is not started.
+func (e *Engine) GC(ctx context.Context) (*GCStats, error) {
+	e.gcLock.Lock()
+	defer e.gcLock.Unlock()
+	if e.entriesChunker == nil {
+		return nil, ErrNotStarted
+	}
+
+	var stats GCStats
+	var err error
+	if stats.DiskUsageBefore, err = datastore.DiskUsage(ctx, e.ds); err != nil {
+		return nil, err
+	}
+
+	// Mark the entries of context IDs that are currently advertised.
+	liveKeys := make(map[string]struct{})
+	liveEntries := make(map[cid.Cid]struct{})
+	if err := e.queryPrefix(ctx, "/"+keyToCidMapPrefix, true, func(r dsq.Result) error {
+		_, c, err := cid.CidFromBytes(r.Value)
+		if err != nil {
+			return err
+		}
+		liveKeys[r.Key] = struct{}{}
+		liveEntries[c] = struct{}{}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	log.Infow("Collecting garbage", "liveContextIDs", len(liveKeys), "liveEntries", len(liveEntries))
+
+	stats.DeletedKeys, stats.DeletedBytes, err = e.entriesChunker.GC(ctx, func(root ipld.Link) bool {
+		_, ok := liveEntries[root.(cidlink.Link).Cid]
+		return ok
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to collect cached entries: %w", err)
+	}
+
+	// Sweep the mappings that do not correspond to a live context ID.
+	batch, err := e.ds.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sweep := func(r dsq.Result) {
+		stats.DeletedKeys++
+		stats.DeletedBytes += uint64(len(r.Key) + len(r.Value))
+	}
+	for _, prefix := range []string{cidToProviderAndKeyMapPrefix, cidToKeyMapPrefix} {
+		if err := e.queryPrefix(ctx, "/"+prefix, true, func(r dsq.Result) error {
+			c, err := cid.Decode(datastore.RawKey(r.Key).BaseNamespace())
+			if err != nil {
+				return err
+			}
+			if _, ok := liveEntries[c]; ok {
+				return nil
+			}
+			sweep(r)
+			return batch.Delete(ctx, datastore.RawKey(r.Key))
+		}); err != nil {
+			return nil, err
+		}
+	}
+	if err := e.queryPrefix(ctx, "/"+keyToMetadataMapPrefix, true, func(r dsq.Result) error {
+		keyCidKey := "/" + keyToCidMapPrefix + strings.TrimPrefix(r.Key, "/"+keyToMetadataMapPrefix)
+		if _, ok := liveKeys[keyCidKey]; ok {
+			return nil
+		}
+		sweep(r)
+		return batch.Delete(ctx, datastore.RawKey(r.Key))
+	}); err != nil {
+		return nil, err
+	}
+	// Sweep the local index records that are not of the current generation of a live context ID.
+	liveGens := make(map[string][]byte)
+	if err := e.queryPrefix(ctx, "/"+localIndexGenerationPrefix, true, func(r dsq.Result) error {
+		k := datastore.RawKey(r.Key)
+		p, contextID, err := decodeProviderAndKey(k, k.BaseNamespace())
+		if err != nil {
+			return err
+		}
+		if _, ok := liveKeys[e.keyToCidKey(p, contextID).String()]; ok {
+			liveGens[k.BaseNamespace()] = r.Value
+			return nil
+		}
+		sweep(r)
+		return batch.Delete(ctx, k)
+	}); err != nil {
+		return nil, err
+	}
+	isLiveRecord := func(encodedProviderAndKey string, gen []byte) bool {
+		liveGen, ok := liveGens[encodedProviderAndKey]
+		return ok && bytes.Equal(liveGen, gen)
+	}
+	if err := e.queryPrefix(ctx, "/"+mhToProviderAndKeyPrefix, true, func(r dsq.Result) error {
+		k := datastore.RawKey(r.Key)
+		if isLiveRecord(k.BaseNamespace(), r.Value) {
+			return nil
+		}
+		sweep(r)
+		return batch.Delete(ctx, k)
+	}); err != nil {
+		return nil, err
+	}
+	if err := e.queryPrefix(ctx, "/"+providerAndKeyToMhPrefix, true, func(r dsq.Result) error {
+		k := datastore.RawKey(r.Key)
+		if isLiveRecord(k.Parent().BaseNamespace(), r.Value) {
+			return nil
+		}
+		sweep(r)
+		return batch.Delete(ctx, k)
+	}); err != nil {
+		return nil, err
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	// Sweep the state of finished data transfers.
+	dtDatastores := []datastore.Batching{dsn.Wrap(e.ds, datastore.NewKey(dtsyncPublisherDatastorePrefix))}
+	if e.pubDTds != nil {
+		dtDatastores = append(dtDatastores, e.pubDTds)
+	}
+	for _, ds := range dtDatastores {
+		keys, size, err := gcDataTransferState(ctx, ds)
+		if err != nil {
+			return nil, fmt.Errorf("failed to collect data transfer state: %w", err)
+		}
+		stats.DeletedKeys += keys
+		stats.DeletedBytes += size
+	}
+	if err := e.ds.Sync(ctx, datastore.NewKey("")); err != nil {
+		return nil, err
+	}
+
+	if gcds, ok := e.ds.(datastore.GCDatastore); ok {
+		if err := gcds.CollectGarbage(ctx); err != nil {
+			return nil, fmt.Errorf("failed to compact datastore: %w", err)
+		}
+	}
+	if stats.DiskUsageAfter, err = datastore.DiskUsage(ctx, e.ds); err != nil {
+		return nil, err
+	}
+	log.Infow("Collected garbage", "deletedKeys", stats.DeletedKeys, "deletedBytes", stats.DeletedBytes, "reclaimedBytes", stats.ReclaimedBytes())
+	return &stats, nil
+}
+
+// gcDataTransferState deletes the state of the finished data transfers persisted in the given
+// datastore of a data transfer manager, and returns the number and total size of deleted keys.
+// The entries that cannot be decoded as transfer state are left untouched.
+func gcDataTransferState(ctx context.Context, ds datastore.Batching) (int, uint64, error) {
+	batch, err := ds.Batch(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	var keys int
+	var size uint64
+	if err := queryPrefix(ctx, ds, dtChannelStatePrefix, true, func(r dsq.Result) error {
+		status, ok := dataTransferStatus(r.Value)
+		if !ok {
+			return nil
+		}
+		switch status {
+		case datatransfer.Completed, datatransfer.Failed, datatransfer.Cancelled:
+			keys++
+			size += uint64(len(r.Key) + len(r.Value))
+			return batch.Delete(ctx, datastore.RawKey(r.Key))
+		default:
+			return nil
+		}
+	}); err != nil {
+		return 0, 0, err
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return 0, 0, err
+	}
+	return keys, size, nil
+}
+
+// dataTransferStatus decodes the status of the given data transfer channel state, which is
+// encoded as a DAG-CBOR map.
+func dataTransferStatus(state []byte) (datatransfer.Status, bool) {
+	nb := basicnode.Prototype.Any.NewBuilder()
+	if err := dagcbor.Decode(nb, bytes.NewReader(state)); err != nil {
+		return 0, false
+	}
+	n, err := nb.Build().LookupByString("Status")
+	if err != nil {
+		return 0, false
+	}
+	status, err := n.AsInt()
+	if err != nil {
+		return 0, false
+	}
+	return datatransfer.Status(status), true
+}
+
+// queryPrefix calls the given function for each entry in the engine datastore with the given
+// prefix.
+func (e *Engine) queryPrefix(ctx context.Context, prefix string, withValues bool, f func(dsq.Result) error) error {
+	return queryPrefix(ctx, e.ds, prefix, withValues, f)
+}
+
+// queryPrefix calls the given function for each entry in the given datastore with the given prefix.
+func queryPrefix(ctx context.Context, ds datastore.Datastore, prefix string, withValues bool, f func(dsq.Result) error) error {
+	results, err := ds.Query(ctx, dsq.Query{Prefix: prefix, KeysOnly: !withValues})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+	for r := range results.Next() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if r.Error != nil {
+			return fmt.Errorf("cannot read datastore key: %w", r.Error)
+		}
+		if err := f(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
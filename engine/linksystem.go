@@ -7,11 +7,10 @@ import (
 
 	provider "github.com/filecoin-project/index-provider"
 	"github.com/filecoin-project/storetheindex/api/v0/ingest/schema"
+	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	"github.com/ipld/go-ipld-prime"
-	"github.com/ipld/go-ipld-prime/codec/dagjson"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
-	"github.com/ipld/go-ipld-prime/node/basicnode"
 	"github.com/libp2p/go-libp2p/core/peer"
 )
 
@@ -30,28 +29,16 @@ func (e *Engine) mkLinkSystem() ipld.LinkSystem {
 		c := lnk.(cidlink.Link).Cid
 		log.Debugf("Triggered ReadOpener from engine's linksystem with cid (%s)", c)
 
-		// Get the node from main datastore. If it is in the
-		// main datastore it means it is an advertisement.
-		val, err := e.ds.Get(ctx, datastore.NewKey(c.String()))
+		// Get the node from the advertisements namespace. If it is found there it
+		// means it is an advertisement.
+		val, err := e.ds.Get(ctx, adKey(c))
 		if err != nil && err != datastore.ErrNotFound {
 			log.Errorf("Error getting object from datastore in linksystem: %s", err)
 			return nil, err
 		}
-
-		// If data was retrieved from the datastore, this may be an advertisement.
 		if len(val) != 0 {
-			// Decode the node to check its type to see if it is an Advertisement.
-			n, err := decodeIPLDNode(bytes.NewBuffer(val))
-			if err != nil {
-				log.Errorf("Could not decode IPLD node for potential advertisement: %s", err)
-				return nil, err
-			}
-			// If this was an advertisement, then return it.
-			if isAdvertisement(n) {
-				log.Debugw("Retrieved advertisement from datastore", "cid", c, "size", len(val))
-				return bytes.NewBuffer(val), nil
-			}
-			log.Debugw("Retrieved non-advertisement object from datastore", "cid", c, "size", len(val))
+			log.Debugw("Retrieved advertisement from datastore", "cid", c, "size", len(val))
+			return bytes.NewBuffer(val), nil
 		}
 
 		// Not an advertisement, so this means we are receiving ingestion data.
@@ -138,13 +125,13 @@ func (e *Engine) mkLinkSystem() ipld.LinkSystem {
 		buf := bytes.NewBuffer(nil)
 		return buf, func(lnk ipld.Link) error {
 			c := lnk.(cidlink.Link).Cid
-			return e.ds.Put(lctx.Ctx, datastore.NewKey(c.String()), buf.Bytes())
+			return e.ds.Put(lctx.Ctx, adKey(c), buf.Bytes())
 		}, nil
 	}
 	return lsys
 }
 
-// vanillaLinkSystem plainly loads and stores from engine datastore.
+// vanillaLinkSystem plainly loads and stores from the advertisements namespace of engine datastore.
 //
 // This is used to plainly load and store links without the complex
 // logic of the main linksystem. This is mainly used to retrieve
@@ -153,7 +140,7 @@ func (e *Engine) vanillaLinkSystem() ipld.LinkSystem {
 	lsys := cidlink.DefaultLinkSystem()
 	lsys.StorageReadOpener = func(lctx ipld.LinkContext, lnk ipld.Link) (io.Reader, error) {
 		c := lnk.(cidlink.Link).Cid
-		val, err := e.ds.Get(lctx.Ctx, datastore.NewKey(c.String()))
+		val, err := e.ds.Get(lctx.Ctx, adKey(c))
 		if err != nil {
 			return nil, err
 		}
@@ -163,25 +150,13 @@ func (e *Engine) vanillaLinkSystem() ipld.LinkSystem {
 		buf := bytes.NewBuffer(nil)
 		return buf, func(lnk ipld.Link) error {
 			c := lnk.(cidlink.Link).Cid
-			return e.ds.Put(lctx.Ctx, datastore.NewKey(c.String()), buf.Bytes())
+			return e.ds.Put(lctx.Ctx, adKey(c), buf.Bytes())
 		}, nil
 	}
 	return lsys
 }
 
-// decodeIPLDNode reads the content of the given reader fully as an IPLD node.
-func decodeIPLDNode(r io.Reader) (ipld.Node, error) {
-	nb := basicnode.Prototype.Any.NewBuilder()
-	err := dagjson.Decode(nb, r)
-	if err != nil {
-		return nil, err
-	}
-	return nb.Build(), nil
-}
-
-// isAdvertisement loosely checks if an IPLD node is an advertisement or an index.
-// This is done simply by checking if `Signature` filed is present.
-func isAdvertisement(n ipld.Node) bool {
-	indexID, _ := n.LookupByString("Signature")
-	return indexID != nil
+// adKey returns the datastore key at which the advertisement with the given CID is stored.
+func adKey(c cid.Cid) datastore.Key {
+	return datastore.NewKey(adsPrefix + c.String())
 }
@@ -0,0 +1,280 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	provider "github.com/filecoin-project/index-provider"
+	"github.com/filecoin-project/index-provider/metadata"
+	"github.com/ipfs/go-datastore"
+	dsq "github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+	"github.com/multiformats/go-varint"
+)
+
+const (
+	mhToProviderAndKeyPrefix   = "map/mhProvAndKey/"
+	providerAndKeyToMhPrefix   = "map/provAndKeyMh/"
+	localIndexGenerationPrefix = "map/provAndKeyGen/"
+	// localIndexGenerationSize is the size of the random generation assigned to the records of a
+	// context ID every time its multihashes are indexed.
+	localIndexGenerationSize = 8
+	// localIndexBatchSize is the maximum number of multihashes written to or deleted from the local
+	// index per datastore batch.
+	localIndexBatchSize = 1024
+)
+
+// ErrLocalIndexDisabled signals that the local multihash index is not enabled on the engine.
+// See: WithLocalIndex.
+var ErrLocalIndexDisabled = errors.New("local multihash index is disabled")
+
+// LocalIndexRecord represents a context ID under which a multihash is advertised by this engine.
+type LocalIndexRecord struct {
+	// Provider is the ID of the provider that advertises the multihash.
+	Provider peer.ID
+	// ContextID is the context ID under which the multihash is advertised.
+	ContextID []byte
+	// Metadata is the metadata currently advertised for the provider and context ID.
+	Metadata metadata.Metadata
+}
+
+// FindLocal looks up the provider and context IDs under which the given multihash is currently
+// advertised by this engine. An empty result is returned if the multihash is not advertised.
+//
+// The lookup is performed against a persistent reverse index of multihashes to provider and
+// context ID that is maintained as the entries of advertisements are generated and removed. The
+// index must be enabled via WithLocalIndex; otherwise ErrLocalIndexDisabled is returned.
+//
+// Note that only the multihashes of context IDs advertised while the index is enabled are
+// indexed.
+func (e *Engine) FindLocal(ctx context.Context, mh multihash.Multihash) ([]LocalIndexRecord, error) {
+	if !e.localIndex {
+		return nil, ErrLocalIndexDisabled
+	}
+
+	var records []LocalIndexRecord
+	err := e.queryPrefix(ctx, e.mhToProviderAndKeyPrefix(mh), true, func(r dsq.Result) error {
+		p, contextID, err := e.providerAndKeyFromMhIndexKey(datastore.RawKey(r.Key))
+		if err != nil {
+			return err
+		}
+
+		// Skip the records that were indexed by a generation other than the current one of
+		// the context ID, e.g. left behind by an interrupted removal or by entries that have
+		// since been regenerated with different content.
+		gen, err := e.ds.Get(ctx, e.localIndexGenerationKey(p, contextID))
+		if err != nil {
+			if err == datastore.ErrNotFound {
+				return nil
+			}
+			return err
+		}
+		if !bytes.Equal(gen, r.Value) {
+			return nil
+		}
+		md, err := e.getKeyMetadataMap(ctx, p, contextID)
+		if err != nil && err != datastore.ErrNotFound {
+			return err
+		}
+		records = append(records, LocalIndexRecord{
+			Provider:  p,
+			ContextID: contextID,
+			Metadata:  md,
+		})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return records, nil
+}
+
+// indexingIterator is a provider.MultihashIterator that adds the multihashes it iterates over to
+// the local index under a new generation of the context ID. The multihashes are written in bounded
+// batches as they are iterated over, and are only considered by FindLocal once the generation is
+// made current by commit.
+type indexingIterator struct {
+	ctx        context.Context
+	e          *Engine
+	batch      datastore.Batch
+	pending    int
+	provider   peer.ID
+	contextID  []byte
+	generation []byte
+	delegate   provider.MultihashIterator
+}
+
+func (e *Engine) newIndexingIterator(ctx context.Context, p peer.ID, contextID []byte, mhi provider.MultihashIterator) (*indexingIterator, error) {
+	batch, err := e.ds.Batch(ctx)
+	if err != nil {
+		return nil, err
+	}
+	gen := make([]byte, localIndexGenerationSize)
+	if _, err := rand.Read(gen); err != nil {
+		return nil, err
+	}
+	return &indexingIterator{
+		ctx:        ctx,
+		e:          e,
+		batch:      batch,
+		provider:   p,
+		contextID:  contextID,
+		generation: gen,
+		delegate:   mhi,
+	}, nil
+}
+
+func (i *indexingIterator) Next() (multihash.Multihash, error) {
+	mh, err := i.delegate.Next()
+	if err != nil {
+		return mh, err
+	}
+	if err := i.batch.Put(i.ctx, i.e.mhToProviderAndKeyKey(mh, i.provider, i.contextID), i.generation); err != nil {
+		return nil, err
+	}
+	if err := i.batch.Put(i.ctx, i.e.providerAndKeyToMhKey(i.provider, i.contextID, mh), i.generation); err != nil {
+		return nil, err
+	}
+	i.pending++
+	if i.pending >= localIndexBatchSize {
+		if err := i.batch.Commit(i.ctx); err != nil {
+			return nil, err
+		}
+		batch, err := i.e.ds.Batch(i.ctx)
+		if err != nil {
+			return nil, err
+		}
+		i.batch = batch
+		i.pending = 0
+	}
+	return mh, nil
+}
+
+// commit persists the multihashes iterated over so far in the local index, makes their
+// generation the current one of the context ID, and removes the records of previous generations.
+// The generation is written last so that a partially written index is never treated as current.
+func (i *indexingIterator) commit() error {
+	if err := i.batch.Commit(i.ctx); err != nil {
+		return err
+	}
+	if err := i.e.ds.Put(i.ctx, i.e.localIndexGenerationKey(i.provider, i.contextID), i.generation); err != nil {
+		return err
+	}
+	return i.e.purgeLocalIndex(i.ctx, i.provider, i.contextID, i.generation)
+}
+
+// removeFromLocalIndex removes the multihashes associated to the given provider and context ID
+// from the local index.
+func (e *Engine) removeFromLocalIndex(ctx context.Context, p peer.ID, contextID []byte) error {
+	if err := e.ds.Delete(ctx, e.localIndexGenerationKey(p, contextID)); err != nil {
+		return err
+	}
+	return e.purgeLocalIndex(ctx, p, contextID, nil)
+}
+
+// purgeLocalIndex deletes the records of the given provider and context ID from the local index,
+// except for the ones of the given generation. The records are found via the forward index of
+// context IDs to multihashes, so that the multihashes need not be listed, and are deleted in
+// bounded batches.
+func (e *Engine) purgeLocalIndex(ctx context.Context, p peer.ID, contextID []byte, keep []byte) error {
+	batch, err := e.ds.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	var pending int
+	prefix := e.providerAndKeyToMhPrefix(p, contextID)
+	if err := e.queryPrefix(ctx, prefix, true, func(r dsq.Result) error {
+		if keep != nil && bytes.Equal(keep, r.Value) {
+			return nil
+		}
+		mh, err := multihash.FromB58String(datastore.RawKey(r.Key).BaseNamespace())
+		if err != nil {
+			return fmt.Errorf("malformed local index key %s: %w", r.Key, err)
+		}
+		if err := batch.Delete(ctx, datastore.RawKey(r.Key)); err != nil {
+			return err
+		}
+		if err := batch.Delete(ctx, e.mhToProviderAndKeyKey(mh, p, contextID)); err != nil {
+			return err
+		}
+		pending++
+		if pending >= localIndexBatchSize {
+			if err := batch.Commit(ctx); err != nil {
+				return err
+			}
+			if batch, err = e.ds.Batch(ctx); err != nil {
+				return err
+			}
+			pending = 0
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	return batch.Commit(ctx)
+}
+
+func (e *Engine) localIndexGenerationKey(p peer.ID, contextID []byte) datastore.Key {
+	return datastore.NewKey(localIndexGenerationPrefix + encodeProviderAndKey(p, contextID))
+}
+
+func (e *Engine) providerAndKeyToMhPrefix(p peer.ID, contextID []byte) string {
+	return "/" + providerAndKeyToMhPrefix + encodeProviderAndKey(p, contextID) + "/"
+}
+
+func (e *Engine) providerAndKeyToMhKey(p peer.ID, contextID []byte, mh multihash.Multihash) datastore.Key {
+	return datastore.NewKey(e.providerAndKeyToMhPrefix(p, contextID) + mh.B58String())
+}
+
+func (e *Engine) mhToProviderAndKeyPrefix(mh multihash.Multihash) string {
+	return "/" + mhToProviderAndKeyPrefix + mh.B58String() + "/"
+}
+
+// mhToProviderAndKeyKey returns the local index key for the given multihash, provider and context
+// ID. The key is made up of the multihash followed by the encoded provider and context ID.
+//
+// See: encodeProviderAndKey.
+func (e *Engine) mhToProviderAndKeyKey(mh multihash.Multihash, p peer.ID, contextID []byte) datastore.Key {
+	return datastore.NewKey(e.mhToProviderAndKeyPrefix(mh) + encodeProviderAndKey(p, contextID))
+}
+
+// encodeProviderAndKey encodes the given provider and context ID as the base64 URL encoding of
+// provider ID prefixed by its varint length and the context ID.
+func encodeProviderAndKey(p peer.ID, contextID []byte) string {
+	pBytes := []byte(p)
+	buf := make([]byte, 0, varint.UvarintSize(uint64(len(pBytes)))+len(pBytes)+len(contextID))
+	buf = append(buf, varint.ToUvarint(uint64(len(pBytes)))...)
+	buf = append(buf, pBytes...)
+	buf = append(buf, contextID...)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func (e *Engine) providerAndKeyFromMhIndexKey(k datastore.Key) (peer.ID, []byte, error) {
+	return decodeProviderAndKey(k, k.BaseNamespace())
+}
+
+// decodeProviderAndKey decodes the provider and context ID encoded by encodeProviderAndKey in the
+// given key.
+func decodeProviderAndKey(k datastore.Key, encoded string) (peer.ID, []byte, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed local index key %s: %w", k, err)
+	}
+	pLen, n, err := varint.FromUvarint(buf)
+	if err != nil {
+		return "", nil, fmt.Errorf("malformed local index key %s: %w", k, err)
+	}
+	if uint64(len(buf)-n) < pLen {
+		return "", nil, fmt.Errorf("malformed local index key %s: provider ID too short", k)
+	}
+	p, err := peer.IDFromBytes(buf[n : n+int(pLen)])
+	if err != nil {
+		return "", nil, err
+	}
+	return p, buf[n+int(pLen):], nil
+}
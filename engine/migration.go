@@ -0,0 +1,205 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/filecoin-project/storetheindex/api/v0/ingest/schema"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/multiformats/go-varint"
+)
+
+const (
+	datastoreVersionKey = "migration/version"
+	// adsMigrationBatchSize is the maximum number of advertisements moved per datastore batch.
+	adsMigrationBatchSize = 1024
+)
+
+var dsDatastoreVersionKey = datastore.NewKey(datastoreVersionKey)
+
+// Migration describes a change to the layout of the engine datastore.
+type Migration struct {
+	// Version is the version of the datastore once the migration is applied.
+	Version uint64
+	// Description is a human-readable summary of the change made by the migration.
+	Description string
+
+	migrate func(context.Context, datastore.Batching) error
+}
+
+// migrations is the registry of datastore migrations in the order they must be applied.
+//
+// Migrations must be idempotent, since a migration that is interrupted is run again from the
+// beginning on next start. New migrations must be appended with the next version.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "Move advertisements into their own datastore namespace",
+		migrate:     migrateAdsNamespace,
+	},
+}
+
+// LatestDatastoreVersion returns the version of the datastore layout used by the engine.
+func LatestDatastoreVersion() uint64 {
+	return migrations[len(migrations)-1].Version
+}
+
+// DatastoreVersion returns the version of the layout of the given engine datastore. A datastore
+// that has never been migrated is at version zero.
+func DatastoreVersion(ctx context.Context, ds datastore.Datastore) (uint64, error) {
+	b, err := ds.Get(ctx, dsDatastoreVersionKey)
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+	v, _, err := varint.FromUvarint(b)
+	if err != nil {
+		return 0, fmt.Errorf("malformed datastore version: %w", err)
+	}
+	return v, nil
+}
+
+// PendingMigrations returns the migrations that are yet to be applied to the given engine
+// datastore, in the order they would be applied.
+func PendingMigrations(ctx context.Context, ds datastore.Datastore) ([]Migration, error) {
+	v, err := DatastoreVersion(ctx, ds)
+	if err != nil {
+		return nil, err
+	}
+	if v > LatestDatastoreVersion() {
+		return nil, fmt.Errorf("datastore version %d is newer than the latest known version %d", v, LatestDatastoreVersion())
+	}
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > v {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies the pending migrations to the given engine datastore in order, and returns the
+// migrations that were applied. The datastore version is recorded after each migration so that
+// an interrupted run resumes from the migration it was interrupted at.
+//
+// Migrate is called by Engine.Start. It may also be called explicitly when the engine is not
+// running, e.g. to migrate a datastore offline.
+func Migrate(ctx context.Context, ds datastore.Batching) ([]Migration, error) {
+	pending, err := PendingMigrations(ctx, ds)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, m := range pending {
+		log.Infow("Applying datastore migration", "version", m.Version, "description", m.Description)
+		if err := m.migrate(ctx, ds); err != nil {
+			return applied, fmt.Errorf("failed to apply datastore migration to version %d: %w", m.Version, err)
+		}
+		if err := ds.Put(ctx, dsDatastoreVersionKey, varint.ToUvarint(m.Version)); err != nil {
+			return applied, err
+		}
+		if err := ds.Sync(ctx, datastore.NewKey("")); err != nil {
+			return applied, err
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// migrateAdsNamespace moves the advertisements stored at the root of the datastore into the
+// advertisements namespace. Advertisements are discovered by walking the chain backwards starting
+// from the latest advertisement; the advertisements that are already moved are skipped.
+func migrateAdsNamespace(ctx context.Context, ds datastore.Batching) error {
+	adCid := cid.Undef
+	b, err := ds.Get(ctx, dsLatestAdvKey)
+	switch err {
+	case nil:
+		if _, adCid, err = cid.CidFromBytes(b); err != nil {
+			return err
+		}
+	case datastore.ErrNotFound:
+	default:
+		return err
+	}
+
+	batch, err := ds.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	var moved, pending int
+	for adCid != cid.Undef {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		legacyKey := datastore.NewKey(adCid.String())
+		val, err := ds.Get(ctx, legacyKey)
+		switch err {
+		case nil:
+			if err := batch.Put(ctx, adKey(adCid), val); err != nil {
+				return err
+			}
+			if err := batch.Delete(ctx, legacyKey); err != nil {
+				return err
+			}
+			moved++
+			pending++
+		case datastore.ErrNotFound:
+			// Already moved by a previous run that got interrupted.
+			val, err = ds.Get(ctx, adKey(adCid))
+			if err != nil {
+				return fmt.Errorf("cannot find advertisement %s: %w", adCid, err)
+			}
+		default:
+			return err
+		}
+
+		if pending >= adsMigrationBatchSize {
+			if err := batch.Commit(ctx); err != nil {
+				return err
+			}
+			if batch, err = ds.Batch(ctx); err != nil {
+				return err
+			}
+			pending = 0
+		}
+
+		adCid, err = previousAdCid(ctx, adCid, val)
+		if err != nil {
+			return err
+		}
+	}
+	if err := batch.Commit(ctx); err != nil {
+		return err
+	}
+	log.Infow("Moved advertisements into their own datastore namespace", "count", moved)
+	return nil
+}
+
+// previousAdCid decodes the given raw advertisement and returns the CID of its previous
+// advertisement, or cid.Undef if there is none.
+func previousAdCid(ctx context.Context, adCid cid.Cid, raw []byte) (cid.Cid, error) {
+	lsys := cidlink.DefaultLinkSystem()
+	lsys.StorageReadOpener = func(ipld.LinkContext, ipld.Link) (io.Reader, error) {
+		return bytes.NewReader(raw), nil
+	}
+	n, err := lsys.Load(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: adCid}, schema.AdvertisementPrototype)
+	if err != nil {
+		return cid.Undef, fmt.Errorf("cannot decode advertisement %s: %w", adCid, err)
+	}
+	ad, err := schema.UnwrapAdvertisement(n)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if ad.PreviousID == nil {
+		return cid.Undef, nil
+	}
+	return ad.PreviousID.(cidlink.Link).Cid, nil
+}
@@ -0,0 +1,85 @@
+package engine_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/index-provider/engine"
+	"github.com/filecoin-project/index-provider/testutil"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	leveldb "github.com/ipfs/go-ds-leveldb"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrate_NewDatastoreIsAtLatestVersionAfterStart(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	v, err := engine.DatastoreVersion(ctx, ds)
+	require.NoError(t, err)
+	require.Zero(t, v)
+
+	subject, err := engine.New(engine.WithDatastore(ds))
+	require.NoError(t, err)
+	require.NoError(t, subject.Start(ctx))
+	require.NoError(t, subject.Shutdown())
+
+	v, err = engine.DatastoreVersion(ctx, ds)
+	require.NoError(t, err)
+	require.Equal(t, engine.LatestDatastoreVersion(), v)
+	pending, err := engine.PendingMigrations(ctx, ds)
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
+
+func TestMigrate_LegacyDatastoreIsMigratedAndResumable(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	tempDir := t.TempDir()
+	testutil.CopyDir(t, filepath.Join(testutil.ThisDir(t), "../testdata/datastore.ds"), tempDir)
+	ds, err := leveldb.NewDatastore(tempDir, nil)
+	require.NoError(t, err)
+	defer ds.Close()
+
+	pending, err := engine.PendingMigrations(ctx, ds)
+	require.NoError(t, err)
+	require.Len(t, pending, int(engine.LatestDatastoreVersion()))
+	require.Equal(t, uint64(1), pending[0].Version)
+
+	applied, err := engine.Migrate(ctx, ds)
+	require.NoError(t, err)
+	requireSameMigrations(t, pending, applied)
+	v, err := engine.DatastoreVersion(ctx, ds)
+	require.NoError(t, err)
+	require.Equal(t, engine.LatestDatastoreVersion(), v)
+
+	latestAdCid, err := cid.Parse("baguqeeraix5q35zho3z2x5hqsa2iga3372qj4txsr4ooc2zvbyownka57gzq")
+	require.NoError(t, err)
+	has, err := ds.Has(ctx, datastore.NewKey(latestAdCid.String()))
+	require.NoError(t, err)
+	require.False(t, has)
+	has, err = ds.Has(ctx, datastore.NewKey("ads/"+latestAdCid.String()))
+	require.NoError(t, err)
+	require.True(t, has)
+
+	// Applying again is a no-op.
+	applied, err = engine.Migrate(ctx, ds)
+	require.NoError(t, err)
+	require.Empty(t, applied)
+
+	// Simulate an interruption right before the version is recorded; migrations must resume
+	// gracefully over the partially migrated datastore.
+	require.NoError(t, ds.Delete(ctx, datastore.NewKey("migration/version")))
+	applied, err = engine.Migrate(ctx, ds)
+	require.NoError(t, err)
+	requireSameMigrations(t, pending, applied)
+}
+
+func requireSameMigrations(t *testing.T, want, got []engine.Migration) {
+	require.Len(t, got, len(want))
+	for i := range want {
+		require.Equal(t, want[i].Version, got[i].Version)
+		require.Equal(t, want[i].Description, got[i].Description)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	datatransfer "github.com/filecoin-project/go-data-transfer"
 	"github.com/filecoin-project/index-provider/engine/chunker"
 	"github.com/filecoin-project/index-provider/engine/policy"
+	"github.com/filecoin-project/index-provider/metadata"
 	"github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
 	"github.com/libp2p/go-libp2p"
@@ -62,6 +63,7 @@ type (
 
 		pubKind            PublisherKind
 		pubDT              datatransfer.Manager
+		pubDTds            datastore.Batching
 		pubHttpListenAddr  string
 		pubTopicName       string
 		pubTopic           *pubsub.Topic
@@ -70,6 +72,9 @@ type (
 		entCacheCap int
 		purgeCache  bool
 		chunker     chunker.NewChunkerFunc
+		localIndex  bool
+
+		mdContext metadata.MetadataContext
 
 		syncPolicy *policy.Policy
 	}
@@ -87,6 +92,7 @@ func newOptions(o ...Option) (*options, error) {
 		// 16384 multihashes per chunk.
 		chunker:    chunker.NewChainChunkerFunc(16384),
 		purgeCache: false,
+		mdContext:  metadata.Default,
 	}
 
 	for _, apply := range o {
@@ -160,6 +166,7 @@ func WithPurgeCacheOnStart(p bool) Option {
 // If unset, advertisement entries are formatted as chained Entry Chunk with default maximum of
 // 16384 multihashes per chunk.
 //
+// To bound the chunks by their encoded size instead, see: WithBoundedChainedEntries.
 // To use HAMT as the advertisement entries format, see: WithHamtEntries.
 // For caching configuration: WithEntriesCacheCapacity, chunker.CachedEntriesChunker
 func WithChainedEntries(chunkSize int) Option {
@@ -169,6 +176,23 @@ func WithChainedEntries(chunkSize int) Option {
 	}
 }
 
+// WithBoundedChainedEntries sets format of advertisement entries to chained Entry Chunk where
+// the encoded size of each chunk is at most maxChunkBytes. The number of multihashes per chunk
+// therefore depends on the length of multihashes, which varies by hash function.
+//
+// If unset, advertisement entries are formatted as chained Entry Chunk with default maximum of
+// 16384 multihashes per chunk.
+//
+// To bound the chunks by the number of multihashes instead, see: WithChainedEntries.
+// To use HAMT as the advertisement entries format, see: WithHamtEntries.
+// For caching configuration: WithEntriesCacheCapacity, chunker.CachedEntriesChunker
+func WithBoundedChainedEntries(maxChunkBytes int) Option {
+	return func(o *options) error {
+		o.chunker = chunker.NewBoundedChainChunkerFunc(maxChunkBytes)
+		return nil
+	}
+}
+
 // WithHamtEntries sets format of advertisement entries to HAMT with the given hash algorithm,
 // bit-width and bucket size.
 //
@@ -209,6 +233,30 @@ func WithEntriesCacheCapacity(s int) Option {
 	}
 }
 
+// WithLocalIndex sets whether to maintain a persistent local index of multihashes to the provider
+// and context IDs under which they are advertised. When enabled, the multihashes are indexed as
+// advertisement entries are generated by Engine.NotifyPut, and are removed from the index by
+// Engine.NotifyRemove. The index can be queried via Engine.FindLocal.
+//
+// Note that the index consumes storage proportional to the total number of advertised
+// multihashes. If unset, the local index is disabled.
+func WithLocalIndex(enabled bool) Option {
+	return func(o *options) error {
+		o.localIndex = enabled
+		return nil
+	}
+}
+
+// WithMetadataContext sets the context used to decode the metadata stored by the engine, which
+// must include any custom protocols that may be present in the metadata given to
+// Engine.NotifyPut. If unset, metadata.Default is used.
+func WithMetadataContext(mc metadata.MetadataContext) Option {
+	return func(o *options) error {
+		o.mdContext = mc
+		return nil
+	}
+}
+
 // WithPublisherKind sets the kind of publisher used to announce new advertisements.
 // If unset, advertisements are only stored locally and no announcements are made.
 // See: PublisherKind.
@@ -268,6 +316,19 @@ func WithDataTransfer(dt datatransfer.Manager) Option {
 	}
 }
 
+// WithDataTransferDatastore sets the datastore in which the datatransfer.Manager set via
+// WithDataTransfer persists its state, so that the state of finished transfers is swept by
+// Engine.GC. If unspecified, only the state of the datatransfer.Manager created automatically is
+// swept.
+//
+// See: WithDataTransfer, Engine.GC.
+func WithDataTransferDatastore(ds datastore.Batching) Option {
+	return func(o *options) error {
+		o.pubDTds = ds
+		return nil
+	}
+}
+
 // WithHost specifies the host to which the provider engine belongs.
 // If unspecified, a host is created automatically.
 // See: libp2p.New.
@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	provider "github.com/filecoin-project/index-provider"
+	"github.com/filecoin-project/storetheindex/api/v0/ingest/schema"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+)
+
+// reencodeCandidate represents a context ID with live entries that may need re-encoding.
+type reencodeCandidate struct {
+	provider   peer.ID
+	addrs      []string
+	contextID  []byte
+	entriesCid cid.Cid
+}
+
+// ReencodeEntries republishes the entries of every context ID that is currently advertised in the
+// format of advertisement entries configured on this engine. This is useful when the entries
+// format of an existing provider is changed, e.g. from chained Entry Chunk to HAMT, or when the
+// chunk size is changed.
+//
+// For each context ID that is not removed, the entries are regenerated from the registered
+// provider.MultihashLister. If the regenerated entries link differs from the previously advertised
+// one, a new advertisement is published with the new entries, the same metadata and the same
+// provider addresses as the latest advertisement for that context ID. The previously cached entry
+// chunks are evicted from the entries cache once the new advertisement is published; if
+// regenerating the entries or publishing fails, the previously advertised entries remain served.
+//
+// Note that previously published advertisements remain unchanged and will refer to entries that
+// can no longer be generated by the engine.
+//
+// The CIDs of the published advertisements are returned in order of publication. The context IDs
+// whose entries are already in the configured format are skipped.
+//
+// See: WithChainedEntries, WithBoundedChainedEntries, WithHamtEntries.
+func (e *Engine) ReencodeEntries(ctx context.Context) ([]cid.Cid, error) {
+	if e.mhLister == nil {
+		return nil, provider.ErrNoMultihashLister
+	}
+	e.gcLock.RLock()
+	defer e.gcLock.RUnlock()
+
+	candidates, err := e.listReencodeCandidates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	log.Infow("Re-encoding advertisement entries", "candidates", len(candidates))
+
+	var adCids []cid.Cid
+	for _, rc := range candidates {
+		log := log.With("providerID", rc.provider, "contextID", base64.StdEncoding.EncodeToString(rc.contextID))
+
+		mhIter, err := e.mhLister(ctx, rc.provider, rc.contextID)
+		if err != nil {
+			return adCids, err
+		}
+		lnk, err := e.entriesChunker.Chunk(ctx, mhIter)
+		if err != nil {
+			return adCids, fmt.Errorf("could not generate entries list: %s", err)
+		}
+		newCid := lnk.(cidlink.Link).Cid
+		if newCid == rc.entriesCid {
+			log.Debug("Entries already in configured format; skipped re-encoding")
+			continue
+		}
+
+		md, err := e.getKeyMetadataMap(ctx, rc.provider, rc.contextID)
+		if err != nil {
+			return adCids, fmt.Errorf("could not get metadata for provider + context id: %s", err)
+		}
+		mdBytes, err := md.MarshalBinary()
+		if err != nil {
+			return adCids, err
+		}
+
+		if err := e.putKeyCidMap(ctx, rc.provider, rc.contextID, newCid); err != nil {
+			return adCids, fmt.Errorf("failed to write provider + context id to entries cid mapping: %s", err)
+		}
+		adCid, err := e.signAndPublish(ctx, schema.Advertisement{
+			Provider:  rc.provider.String(),
+			Addresses: rc.addrs,
+			Entries:   lnk,
+			ContextID: rc.contextID,
+			Metadata:  mdBytes,
+		})
+		if err != nil {
+			// Keep serving the previously advertised entries, since nothing refers to the new ones.
+			if rerr := e.putKeyCidMap(ctx, rc.provider, rc.contextID, rc.entriesCid); rerr != nil {
+				log.Errorw("Failed to restore provider + context id to entries cid mapping", "err", rerr)
+			}
+			if rerr := e.deleteCidKeyMap(ctx, newCid); rerr != nil {
+				log.Errorw("Failed to delete entries cid to provider + context id mapping", "err", rerr)
+			}
+			if rerr := e.entriesChunker.Remove(ctx, lnk); rerr != nil {
+				log.Errorw("Failed to remove re-encoded entries from cache", "err", rerr)
+			}
+			return adCids, err
+		}
+
+		// Only evict the previous entries once the re-encoded ones are advertised.
+		if err := e.deleteCidKeyMap(ctx, rc.entriesCid); err != nil {
+			return append(adCids, adCid), fmt.Errorf("failed to delete entries cid to provider + context id mapping: %s", err)
+		}
+		if err := e.entriesChunker.Remove(ctx, cidlink.Link{Cid: rc.entriesCid}); err != nil {
+			return append(adCids, adCid), fmt.Errorf("failed to remove previously cached entries: %w", err)
+		}
+		adCids = append(adCids, adCid)
+		log.Infow("Re-encoded advertisement entries", "adCid", adCid, "oldEntries", rc.entriesCid, "newEntries", newCid)
+	}
+	return adCids, nil
+}
+
+// listReencodeCandidates walks the advertisement chain from the latest advertisement and lists
+// the context IDs that are currently advertised, in the order they were first published.
+func (e *Engine) listReencodeCandidates(ctx context.Context) ([]reencodeCandidate, error) {
+	adCid, err := e.getLatestAdCid(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	lsys := e.vanillaLinkSystem()
+	seen := make(map[string]struct{})
+	var candidates []reencodeCandidate
+	for adCid != cid.Undef {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		n, err := lsys.Load(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: adCid}, schema.AdvertisementPrototype)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load advertisement %s: %w", adCid, err)
+		}
+		ad, err := schema.UnwrapAdvertisement(n)
+		if err != nil {
+			return nil, err
+		}
+
+		adCid = cid.Undef
+		if ad.PreviousID != nil {
+			adCid = ad.PreviousID.(cidlink.Link).Cid
+		}
+
+		key := ad.Provider + "/" + string(ad.ContextID)
+		if _, ok := seen[key]; ok {
+			continue
+		}
+		seen[key] = struct{}{}
+		if ad.IsRm || ad.Entries == schema.NoEntries {
+			continue
+		}
+
+		p, err := peer.Decode(ad.Provider)
+		if err != nil {
+			return nil, err
+		}
+		entriesCid, err := e.getKeyCidMap(ctx, p, ad.ContextID)
+		if err != nil {
+			if err == datastore.ErrNotFound {
+				// The advertisement was not published via NotifyPut; nothing to re-encode.
+				continue
+			}
+			return nil, err
+		}
+		candidates = append(candidates, reencodeCandidate{
+			provider:   p,
+			addrs:      ad.Addresses,
+			contextID:  ad.ContextID,
+			entriesCid: entriesCid,
+		})
+	}
+
+	// Reverse the order so that context IDs are re-encoded in the order they were published.
+	for i, j := 0, len(candidates)-1; i < j; i, j = i+1, j-1 {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	}
+	return candidates, nil
+}
@@ -2,6 +2,7 @@ package metadata
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
 
@@ -10,8 +11,9 @@ import (
 )
 
 var (
-	bitswapBytes          = varint.ToUvarint(uint64(multicodec.TransportBitswap))
-	_            Protocol = (*Bitswap)(nil)
+	bitswapBytes           = varint.ToUvarint(uint64(multicodec.TransportBitswap))
+	_            Protocol  = (*Bitswap)(nil)
+	_            Validator = (*Bitswap)(nil)
 )
 
 // Bitswap represents the indexing metadata that uses multicodec.TransportBitswap.
@@ -22,6 +24,12 @@ func (b Bitswap) ID() multicodec.Code {
 	return multicodec.TransportBitswap
 }
 
+// Validate always succeeds, since Bitswap carries no payload beyond its transport ID; retrieval
+// is by CID from the provider peer directly.
+func (b Bitswap) Validate() error {
+	return nil
+}
+
 func (b Bitswap) MarshalBinary() ([]byte, error) {
 	return bitswapBytes, nil
 }
@@ -50,3 +58,13 @@ func (b Bitswap) ReadFrom(r io.Reader) (n int64, err error) {
 	}
 	return bRead, nil
 }
+
+// MarshalJSON implements json.Marshaler.
+func (b Bitswap) MarshalJSON() ([]byte, error) {
+	return json.Marshal(protocolJSON{Protocol: protocolName(b.ID())})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (b Bitswap) UnmarshalJSON(data []byte) error {
+	return checkProtocolJSON(data, multicodec.TransportBitswap)
+}
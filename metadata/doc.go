@@ -4,6 +4,6 @@
 // multihashes advertised by a provider. It is represented as an array of bytes in the indexer
 // protocol, starting with a varint ProtocolID that defines how to decode the remaining bytes.
 //
-// Two metadata types are currently represented here: Bitswap and
-// GraphsyncFilecoinV1.
+// Three metadata types are currently represented here: Bitswap, GraphsyncFilecoinV1 and
+// HTTPRetrievalV1.
 package metadata
@@ -3,6 +3,7 @@ package metadata
 import (
 	"bytes"
 	_ "embed"
+	"encoding/json"
 	"fmt"
 	"io"
 
@@ -16,7 +17,8 @@ import (
 )
 
 var (
-	_ Protocol = (*GraphsyncFilecoinV1)(nil)
+	_ Protocol  = (*GraphsyncFilecoinV1)(nil)
+	_ Validator = (*GraphsyncFilecoinV1)(nil)
 
 	//go:embed graphsync_filecoinv1.ipldsch
 	schemaBytes                  []byte
@@ -46,6 +48,14 @@ func (dtm *GraphsyncFilecoinV1) ID() multicodec.Code {
 	return multicodec.TransportGraphsyncFilecoinv1
 }
 
+// Validate checks that the piece CID is defined, since retrieval requests are made for the piece.
+func (dtm *GraphsyncFilecoinV1) Validate() error {
+	if !dtm.PieceCID.Defined() {
+		return ErrInvalidMetadata{Message: "piece CID of graphsync filecoin v1 transport must be defined"}
+	}
+	return nil
+}
+
 // MarshalBinary implements encoding.BinaryMarshaler.
 func (dtm *GraphsyncFilecoinV1) MarshalBinary() ([]byte, error) {
 	buf := bytes.NewBuffer(varint.ToUvarint(uint64(dtm.ID())))
@@ -75,7 +85,7 @@ func (dtm *GraphsyncFilecoinV1) ReadFrom(r io.Reader) (n int64, err error) {
 	}
 
 	nb := graphSyncFilecoinV1Prototype.NewBuilder()
-	err = dagcbor.Decode(nb, cr)
+	err = decodeDagCbor(nb, cr)
 	if err != nil {
 		return cr.readCount, err
 	}
@@ -86,3 +96,45 @@ func (dtm *GraphsyncFilecoinV1) ReadFrom(r io.Reader) (n int64, err error) {
 	dtm.PieceCID = gm.PieceCID
 	return cr.readCount, nil
 }
+
+type graphsyncFilecoinV1JSON struct {
+	protocolJSON
+	PieceCID      string `json:"pieceCid"`
+	VerifiedDeal  bool   `json:"verifiedDeal"`
+	FastRetrieval bool   `json:"fastRetrieval"`
+}
+
+// MarshalJSON implements json.Marshaler.
+func (dtm *GraphsyncFilecoinV1) MarshalJSON() ([]byte, error) {
+	j := graphsyncFilecoinV1JSON{
+		protocolJSON:  protocolJSON{Protocol: protocolName(dtm.ID())},
+		VerifiedDeal:  dtm.VerifiedDeal,
+		FastRetrieval: dtm.FastRetrieval,
+	}
+	if dtm.PieceCID.Defined() {
+		j.PieceCID = dtm.PieceCID.String()
+	}
+	return json.Marshal(j)
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (dtm *GraphsyncFilecoinV1) UnmarshalJSON(data []byte) error {
+	if err := checkProtocolJSON(data, multicodec.TransportGraphsyncFilecoinv1); err != nil {
+		return err
+	}
+	var j graphsyncFilecoinV1JSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	pieceCid := cid.Undef
+	if j.PieceCID != "" {
+		var err error
+		if pieceCid, err = cid.Decode(j.PieceCID); err != nil {
+			return fmt.Errorf("invalid piece CID: %w", err)
+		}
+	}
+	dtm.PieceCID = pieceCid
+	dtm.VerifiedDeal = j.VerifiedDeal
+	dtm.FastRetrieval = j.FastRetrieval
+	return nil
+}
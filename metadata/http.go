@@ -1,9 +0,0 @@
-package metadata
-
-import "github.com/multiformats/go-multicodec"
-
-func HTTPV1() Protocol {
-	return &Unknown{
-		Code: multicodec.Http,
-	}
-}
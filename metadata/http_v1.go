@@ -0,0 +1,180 @@
+package metadata
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-varint"
+)
+
+var (
+	_ Protocol = (*HTTPRetrievalV1)(nil)
+
+	//go:embed http_v1.ipldsch
+	httpV1SchemaBytes []byte
+	httpV1Prototype   schema.TypedPrototype
+)
+
+// HTTPV1 returns the metadata protocol for retrieval of content over HTTP.
+//
+// Deprecated: Use HTTPRetrievalV1 instead, which also carries the details of how content is served.
+func HTTPV1() Protocol {
+	return &HTTPRetrievalV1{}
+}
+
+func init() {
+	typeSystem, err := ipld.LoadSchemaBytes(httpV1SchemaBytes)
+	if err != nil {
+		panic(fmt.Errorf("failed to load schema: %w", err))
+	}
+	t := typeSystem.TypeByName("HTTPV1")
+	httpV1Prototype = bindnode.Prototype((*httpV1Repr)(nil), t)
+}
+
+// HTTPRetrievalV1 represents the indexing metadata for multicodec.Http, i.e. retrieval of content
+// over HTTP.
+//
+// The metadata encoded in the legacy form, i.e. the protocol ID with no payload, decodes as the
+// zero value.
+type HTTPRetrievalV1 struct {
+	// URLTemplate is the optional base URL or path template at which the content is served, e.g.
+	// "https://example.com/ipfs/{cid}". When empty, the content is served at the conventional
+	// gateway path of the provider HTTP address.
+	URLTemplate string `json:"urlTemplate,omitempty"`
+	// TrustlessCAR indicates whether the responses are trustless CAR streams. Otherwise, the
+	// responses are raw blocks.
+	TrustlessCAR bool `json:"trustlessCar"`
+	// AuthHints are optional hints about the authentication schemes accepted by the server,
+	// e.g. "bearer".
+	AuthHints []string `json:"authHints,omitempty"`
+}
+
+// httpV1Repr is the representation of HTTPRetrievalV1 bound to its IPLD schema, where the optional
+// fields are nilable.
+type httpV1Repr struct {
+	URLTemplate  *string
+	TrustlessCAR bool
+	AuthHints    *[]string
+}
+
+func (h *HTTPRetrievalV1) ID() multicodec.Code {
+	return multicodec.Http
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (h *HTTPRetrievalV1) MarshalBinary() ([]byte, error) {
+	repr := httpV1Repr{
+		TrustlessCAR: h.TrustlessCAR,
+	}
+	if h.URLTemplate != "" {
+		repr.URLTemplate = &h.URLTemplate
+	}
+	if len(h.AuthHints) != 0 {
+		repr.AuthHints = &h.AuthHints
+	}
+
+	buf := bytes.NewBuffer(varint.ToUvarint(uint64(h.ID())))
+	// Encode the representation node so that absent optional fields are omitted.
+	nd := bindnode.Wrap(&repr, httpV1Prototype.Type()).Representation()
+	if err := dagcbor.Encode(nd, buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (h *HTTPRetrievalV1) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	_, err := h.ReadFrom(r)
+	return err
+}
+
+func (h *HTTPRetrievalV1) ReadFrom(r io.Reader) (n int64, err error) {
+	cr := &countingReader{r: r}
+	v, err := varint.ReadUvarint(cr)
+	if err != nil {
+		return cr.readCount, err
+	}
+	id := multicodec.Code(v)
+	if id != multicodec.Http {
+		return cr.readCount, fmt.Errorf("transport id does not match %s: %s", multicodec.Http, id)
+	}
+
+	*h = HTTPRetrievalV1{}
+	if legacy, err := hasNoPayload(r); err != nil {
+		return cr.readCount, err
+	} else if legacy {
+		return cr.readCount, nil
+	}
+	nb := httpV1Prototype.Representation().NewBuilder()
+	err = decodeDagCbor(nb, cr)
+	if err != nil {
+		return cr.readCount, err
+	}
+	nd := nb.Build()
+	repr := bindnode.Unwrap(nd.(schema.TypedNode)).(*httpV1Repr)
+	h.URLTemplate = ""
+	if repr.URLTemplate != nil {
+		h.URLTemplate = *repr.URLTemplate
+	}
+	h.TrustlessCAR = repr.TrustlessCAR
+	h.AuthHints = nil
+	if repr.AuthHints != nil {
+		h.AuthHints = *repr.AuthHints
+	}
+	return cr.readCount, nil
+}
+
+// httpV1JSON is the JSON representation of HTTPRetrievalV1 without the protocol field, used to
+// avoid recursive calls to HTTPRetrievalV1.MarshalJSON and HTTPRetrievalV1.UnmarshalJSON.
+type httpV1JSON HTTPRetrievalV1
+
+// MarshalJSON implements json.Marshaler.
+func (h *HTTPRetrievalV1) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		protocolJSON
+		*httpV1JSON
+	}{
+		protocolJSON: protocolJSON{Protocol: protocolName(h.ID())},
+		httpV1JSON:   (*httpV1JSON)(h),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (h *HTTPRetrievalV1) UnmarshalJSON(data []byte) error {
+	if err := checkProtocolJSON(data, multicodec.Http); err != nil {
+		return err
+	}
+	*h = HTTPRetrievalV1{}
+	return json.Unmarshal(data, (*httpV1JSON)(h))
+}
+
+// hasNoPayload checks whether the protocol ID just read from the given reader is in the legacy
+// form with no payload, i.e. it is either at the end of the reader or followed by something other
+// than a CBOR map. The reader is left unchanged.
+func hasNoPayload(r io.Reader) (bool, error) {
+	br, ok := r.(io.ByteScanner)
+	if !ok {
+		return false, nil
+	}
+	b, err := br.ReadByte()
+	if err == io.EOF {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := br.UnreadByte(); err != nil {
+		return false, err
+	}
+	// CBOR maps are of major type 5, i.e. the top three bits of the initial byte.
+	return b>>5 != 5, nil
+}
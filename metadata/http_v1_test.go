@@ -0,0 +1,92 @@
+package metadata_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/filecoin-project/index-provider/metadata"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-varint"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRoundTripHTTPV1(t *testing.T) {
+	httpV1Datas := []*metadata.HTTPRetrievalV1{
+		{},
+		{
+			TrustlessCAR: true,
+		},
+		{
+			URLTemplate: "https://example.com/ipfs/{cid}",
+		},
+		{
+			URLTemplate:  "/ipfs/{cid}",
+			TrustlessCAR: true,
+			AuthHints:    []string{"bearer", "basic"},
+		},
+	}
+	for _, src := range httpV1Datas {
+		require.Equal(t, multicodec.Http, src.ID())
+
+		asBytes, err := src.MarshalBinary()
+		require.NoError(t, err)
+
+		dst := &metadata.HTTPRetrievalV1{}
+		err = dst.UnmarshalBinary(asBytes)
+		require.NoError(t, err)
+		require.Equal(t, src, dst)
+
+		asJson, err := json.Marshal(src)
+		require.NoError(t, err)
+
+		dst = &metadata.HTTPRetrievalV1{}
+		err = json.Unmarshal(asJson, dst)
+		require.NoError(t, err)
+		require.Equal(t, src, dst)
+	}
+}
+
+func TestHTTPV1Metadata_InDefaultContext(t *testing.T) {
+	src := metadata.Default.New(&metadata.Bitswap{}, &metadata.HTTPRetrievalV1{
+		URLTemplate:  "https://example.com/ipfs/{cid}",
+		TrustlessCAR: true,
+	})
+	asBytes, err := src.MarshalBinary()
+	require.NoError(t, err)
+
+	dst := metadata.Default.New()
+	err = dst.UnmarshalBinary(asBytes)
+	require.NoError(t, err)
+	require.True(t, src.Equal(dst))
+	require.IsType(t, &metadata.HTTPRetrievalV1{}, dst.Get(multicodec.Http))
+}
+
+func TestHTTPV1Metadata_FromIndexerMetadataErr(t *testing.T) {
+	dst := &metadata.HTTPRetrievalV1{}
+	err := dst.UnmarshalBinary(varint.ToUvarint(uint64(multicodec.TransportBitswap)))
+	require.EqualError(t, err, "transport id does not match http: transport-bitswap")
+}
+
+func TestHTTPV1Metadata_DecodesLegacyForm(t *testing.T) {
+	// The legacy form of HTTP metadata is the protocol ID with no payload.
+	legacy := varint.ToUvarint(uint64(multicodec.Http))
+
+	got := &metadata.HTTPRetrievalV1{URLTemplate: "/ipfs/{cid}"}
+	require.NoError(t, got.UnmarshalBinary(legacy))
+	require.Equal(t, &metadata.HTTPRetrievalV1{}, got)
+
+	md := metadata.Default.New()
+	require.NoError(t, md.UnmarshalBinary(legacy))
+	require.Equal(t, 1, md.Len())
+	require.Equal(t, &metadata.HTTPRetrievalV1{}, md.Get(multicodec.Http))
+
+	// Protocols are sorted by ID, and so the legacy form may be followed by other protocols.
+	withBitswap := append(append([]byte{}, legacy...), varint.ToUvarint(uint64(multicodec.TransportBitswap))...)
+	md = metadata.Default.New()
+	require.NoError(t, md.UnmarshalBinary(withBitswap))
+	require.Equal(t, 2, md.Len())
+	require.Equal(t, &metadata.HTTPRetrievalV1{}, md.Get(multicodec.Http))
+
+	// The deprecated constructor must remain equivalent to the legacy form.
+	require.Equal(t, &metadata.HTTPRetrievalV1{}, metadata.HTTPV1())
+}
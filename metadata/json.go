@@ -0,0 +1,97 @@
+package metadata
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/multiformats/go-multicodec"
+)
+
+// protocolJSON captures the field common to the JSON representation of all protocols, which
+// identifies the protocol by its multicodec name.
+type protocolJSON struct {
+	Protocol string `json:"protocol"`
+}
+
+// protocolName returns the multicodec name of the given protocol ID, or its hexadecimal
+// representation if the ID is not a known multicodec.
+func protocolName(id multicodec.Code) string {
+	name := id.String()
+	if strings.HasPrefix(name, "Code(") {
+		return fmt.Sprintf("0x%x", uint64(id))
+	}
+	return name
+}
+
+// protocolFromJSON returns the multicodec of the protocol represented by the given JSON object.
+func protocolFromJSON(data []byte) (multicodec.Code, error) {
+	var p protocolJSON
+	if err := json.Unmarshal(data, &p); err != nil {
+		return 0, err
+	}
+	if p.Protocol == "" {
+		return 0, ErrInvalidMetadata{Message: "protocol must be specified"}
+	}
+	if n, err := strconv.ParseUint(p.Protocol, 0, 64); err == nil {
+		return multicodec.Code(n), nil
+	}
+	var id multicodec.Code
+	if err := id.Set(p.Protocol); err != nil {
+		return 0, ErrInvalidMetadata{Message: fmt.Sprintf("unknown protocol %q", p.Protocol)}
+	}
+	return id, nil
+}
+
+// checkProtocolJSON checks that the given JSON object represents the given protocol.
+func checkProtocolJSON(data []byte, want multicodec.Code) error {
+	id, err := protocolFromJSON(data)
+	if err != nil {
+		return err
+	}
+	if id != want {
+		return fmt.Errorf("transport id does not match %s: %s", want, id)
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler. Metadata is represented as an array of its protocols,
+// each of which is a JSON object with a "protocol" field set to the protocol multicodec name.
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	protocols := m.protocols
+	if protocols == nil {
+		protocols = []Protocol{}
+	}
+	return json.Marshal(protocols)
+}
+
+// UnmarshalJSON implements json.Unmarshaler. The protocols are instantiated using the context
+// from which the Metadata is created, or Default if the Metadata is a zero value.
+func (m *Metadata) UnmarshalJSON(data []byte) error {
+	if m.mc == nil {
+		m.mc = Default.(*metadataContext)
+	}
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return err
+	}
+	m.protocols = m.protocols[:0]
+	for _, raw := range raws {
+		id, err := protocolFromJSON(raw)
+		if err != nil {
+			return err
+		}
+		t, err := m.mc.newTransport(id)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(raw, t); err != nil {
+			return err
+		}
+		m.protocols = append(m.protocols, t)
+	}
+	sort.Sort(m)
+	return m.checkNotEmpty()
+}
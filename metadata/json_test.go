@@ -0,0 +1,122 @@
+package metadata_test
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/filecoin-project/index-provider/metadata"
+	"github.com/filecoin-project/index-provider/testutil"
+	"github.com/multiformats/go-multicodec"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadata_JSONRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1413))
+	cids := testutil.RandomCids(t, rng, 1)
+	subject := metadata.Default.New(
+		&metadata.GraphsyncFilecoinV1{
+			PieceCID:      cids[0],
+			VerifiedDeal:  true,
+			FastRetrieval: true,
+		},
+		&metadata.Bitswap{},
+		&metadata.HTTPRetrievalV1{
+			URLTemplate:  "https://example.com/ipfs/{cid}",
+			TrustlessCAR: true,
+		},
+	)
+
+	asJson, err := json.Marshal(subject)
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+  {"protocol":"http","urlTemplate":"https://example.com/ipfs/{cid}","trustlessCar":true},
+  {"protocol":"transport-bitswap"},
+  {"protocol":"transport-graphsync-filecoinv1","pieceCid":"`+cids[0].String()+`","verifiedDeal":true,"fastRetrieval":true}
+]`, string(asJson))
+
+	var fromJson metadata.Metadata
+	require.NoError(t, json.Unmarshal(asJson, &fromJson))
+	require.True(t, subject.Equal(fromJson))
+
+	// Assert binary encoding of metadata decoded from JSON is identical.
+	wantBytes, err := subject.MarshalBinary()
+	require.NoError(t, err)
+	gotBytes, err := fromJson.MarshalBinary()
+	require.NoError(t, err)
+	require.Equal(t, wantBytes, gotBytes)
+}
+
+func TestMetadata_UnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name          string
+		givenJson     string
+		wantProtocols []multicodec.Code
+		wantErr       string
+	}{
+		{
+			name:          "Unsorted protocols are sorted",
+			givenJson:     `[{"protocol":"transport-bitswap"},{"protocol":"http"}]`,
+			wantProtocols: []multicodec.Code{multicodec.Http, multicodec.TransportBitswap},
+		},
+		{
+			name:      "No protocols is invalid",
+			givenJson: `[]`,
+			wantErr:   "storetheindex: invalid metadata: at least one transport must be specified",
+		},
+		{
+			name:      "Missing protocol is invalid",
+			givenJson: `[{"urlTemplate":"/ipfs/{cid}"}]`,
+			wantErr:   "storetheindex: invalid metadata: protocol must be specified",
+		},
+		{
+			name:      "Unknown protocol name is invalid",
+			givenJson: `[{"protocol":"fish"}]`,
+			wantErr:   `storetheindex: invalid metadata: unknown protocol "fish"`,
+		},
+		{
+			name:      "Unregistered protocol is invalid",
+			givenJson: `[{"protocol":"0x3f0000"}]`,
+			wantErr:   "unknown transport id: Code(4128768)",
+		},
+		{
+			name:      "Malformed piece CID is invalid",
+			givenJson: `[{"protocol":"transport-graphsync-filecoinv1","pieceCid":"not-a-cid"}]`,
+			wantErr:   "invalid piece CID: selected encoding not supported",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var subject metadata.Metadata
+			err := json.Unmarshal([]byte(test.givenJson), &subject)
+			if test.wantErr != "" {
+				require.EqualError(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.wantProtocols, subject.Protocols())
+		})
+	}
+}
+
+func TestMetadata_JSONWithUnknownProtocol(t *testing.T) {
+	const customCode = multicodec.Code(0x3f0000)
+	mc := metadata.Default.WithProtocol(customCode, func() metadata.Protocol { return &metadata.Unknown{} })
+	subject := mc.New(&metadata.Unknown{Code: customCode, Payload: []byte("fish")})
+
+	asJson, err := json.Marshal(subject)
+	require.NoError(t, err)
+	require.JSONEq(t, `[{"protocol":"0x3f0000","payload":"ZmlzaA=="}]`, string(asJson))
+
+	fromJson := mc.New()
+	require.NoError(t, json.Unmarshal(asJson, &fromJson))
+	require.True(t, subject.Equal(fromJson))
+}
+
+func TestProtocol_UnmarshalJSONMismatchedProtocolErr(t *testing.T) {
+	protocols := []metadata.Protocol{&metadata.Bitswap{}, &metadata.GraphsyncFilecoinV1{}, &metadata.HTTPRetrievalV1{}}
+	for _, p := range protocols {
+		err := json.Unmarshal([]byte(`{"protocol":"dag-cbor"}`), p)
+		require.EqualError(t, err, "transport id does not match "+p.ID().String()+": dag-cbor")
+	}
+}
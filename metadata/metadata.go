@@ -3,15 +3,21 @@ package metadata
 import (
 	"bytes"
 	"encoding"
-	"errors"
 	"fmt"
 	"io"
 	"sort"
 
+	"github.com/filecoin-project/storetheindex/api/v0/ingest/schema"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/datamodel"
 	"github.com/multiformats/go-multicodec"
 	"github.com/multiformats/go-varint"
+	"github.com/polydawn/refmt/cbor"
 )
 
+// MaxMetadataLen is the maximum length of encoded metadata in bytes, as accepted by indexers.
+const MaxMetadataLen = schema.MaxMetadataLen
+
 type ErrInvalidMetadata struct {
 	Message string
 }
@@ -35,6 +41,8 @@ type (
 	}
 
 	// Protocol represents the retrieval transport protocol of an advertisement.
+	// A Protocol may optionally implement Validator, in which case it is validated by
+	// Metadata.Validate.
 	Protocol interface {
 		encoding.BinaryMarshaler
 		encoding.BinaryUnmarshaler
@@ -43,6 +51,14 @@ type (
 		// ID is the multicodec of the transport protocol represented by this Protocol.
 		ID() multicodec.Code
 	}
+
+	// Validator is implemented by the protocols that can check whether their content is valid
+	// beyond being decodable, e.g. whether required fields are set.
+	Validator interface {
+		// Validate returns an error describing why the protocol is invalid, or nil if it is
+		// valid.
+		Validate() error
+	}
 )
 
 // metadataContext holds context for metadata serialization and deserialization.
@@ -64,6 +80,7 @@ func init() {
 	}
 	d.protocols[multicodec.TransportBitswap] = func() Protocol { return &Bitswap{} }
 	d.protocols[multicodec.TransportGraphsyncFilecoinv1] = func() Protocol { return &GraphsyncFilecoinV1{} }
+	d.protocols[multicodec.Http] = func() Protocol { return &HTTPRetrievalV1{} }
 	Default = &d
 }
 
@@ -101,21 +118,53 @@ func (m *Metadata) Swap(one, other int) {
 	m.protocols[one], m.protocols[other] = m.protocols[other], m.protocols[one]
 }
 
-// Validate checks whether this Metadata is valid.
+// Validate checks whether this Metadata is valid. Metadata is valid if it has at least one
+// protocol, its protocols are sorted by ID and unique, each protocol that implements Validator is
+// valid, and its binary encoding does not exceed MaxMetadataLen bytes.
+//
+// All errors returned are of type ErrInvalidMetadata.
+//
+// Note that decoding metadata only checks that it has at least one protocol, so that metadata
+// published before these rules were in place remains decodable. Metadata is validated when
+// advertisements are published, and should be validated when it is accepted as input.
 func (m *Metadata) Validate() error {
-	if len(m.protocols) == 0 {
-		return errors.New("at least one transport must be specified")
+	if err := m.checkNotEmpty(); err != nil {
+		return err
 	}
 
 	var lastID multicodec.Code
-	for _, transport := range m.protocols {
-		if lastID > transport.ID() {
-			return errors.New("metadata transports must be sorted by ID")
+	for i, transport := range m.protocols {
+		id := transport.ID()
+		if i > 0 {
+			if lastID > id {
+				return ErrInvalidMetadata{Message: "metadata transports must be sorted by ID"}
+			}
+			if lastID == id {
+				return ErrInvalidMetadata{Message: fmt.Sprintf("transport %s must not be repeated", protocolName(id))}
+			}
+		}
+		lastID = id
+		if v, ok := transport.(Validator); ok {
+			if err := v.Validate(); err != nil {
+				if _, ok := err.(ErrInvalidMetadata); ok {
+					return err
+				}
+				return ErrInvalidMetadata{Message: fmt.Sprintf("invalid %s transport: %v", protocolName(id), err)}
+			}
 		}
 	}
 
-	//TODO: Assert all IDs are known and transports are unique once we discuss what's techincally valid?
-	//      For example, is it valid to have repeated graphsync metadata with different values?
+	var size int
+	for _, transport := range m.protocols {
+		b, err := transport.MarshalBinary()
+		if err != nil {
+			return ErrInvalidMetadata{Message: fmt.Sprintf("cannot encode %s transport: %v", protocolName(transport.ID()), err)}
+		}
+		size += len(b)
+	}
+	if size > MaxMetadataLen {
+		return ErrInvalidMetadata{Message: fmt.Sprintf("encoded size of %d bytes exceeds the maximum of %d bytes", size, MaxMetadataLen)}
+	}
 	return nil
 }
 
@@ -156,10 +205,10 @@ func (m *Metadata) MarshalBinary() ([]byte, error) {
 
 // UnmarshalBinary implements encoding.BinaryUnmarshaler.
 func (m *Metadata) UnmarshalBinary(data []byte) error {
-	var read int64
-	for read < int64(len(data)) {
-		data = data[read:]
-		v, _, err := varint.FromUvarint(data)
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		// Peek the ID of the next protocol; it is read again by the protocol itself.
+		v, _, err := varint.FromUvarint(data[len(data)-r.Len():])
 		if err != nil {
 			return err
 		}
@@ -168,16 +217,21 @@ func (m *Metadata) UnmarshalBinary(data []byte) error {
 		if err != nil {
 			return err
 		}
-
-		buf := bytes.NewBuffer(data)
-		tLen, err := t.ReadFrom(buf)
-		if err != nil {
+		if _, err := t.ReadFrom(r); err != nil {
 			return err
 		}
 		m.protocols = append(m.protocols, t)
-		read += tLen
 	}
-	return m.Validate()
+	return m.checkNotEmpty()
+}
+
+// checkNotEmpty checks that this Metadata has at least one protocol. Unlike Validate, it is the
+// only check applied when metadata is decoded.
+func (m *Metadata) checkNotEmpty() error {
+	if len(m.protocols) == 0 {
+		return ErrInvalidMetadata{Message: "at least one transport must be specified"}
+	}
+	return nil
 }
 
 // Equal checks whether this Metadata is equal with the other Metadata.
@@ -218,3 +272,11 @@ func (mc *metadataContext) newTransport(id multicodec.Code) (Protocol, error) {
 
 	return nil, fmt.Errorf("unknown transport id: %s", id.String())
 }
+
+// decodeDagCbor decodes exactly one DAG-CBOR object from the given reader, leaving any bytes that
+// follow it unread. This allows protocols to be decoded from metadata in which they are followed
+// by other protocols, since dagcbor.Decode rejects trailing bytes. Links are allowed, as they are
+// by dagcbor.Decode.
+func decodeDagCbor(na datamodel.NodeAssembler, r io.Reader) error {
+	return dagcbor.Unmarshal(na, cbor.NewDecoder(cbor.DecodeOptions{CoerceUndefToNull: true}, r), dagcbor.DecodeOptions{AllowLinks: true})
+}
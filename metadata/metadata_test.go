@@ -1,7 +1,9 @@
 package metadata_test
 
 import (
+	"encoding/json"
 	"math/rand"
+	"strings"
 	"testing"
 
 	"github.com/filecoin-project/index-provider/metadata"
@@ -30,9 +32,33 @@ func TestMetadata(t *testing.T) {
 				&metadata.Bitswap{},
 			},
 		},
+		{
+			name: "Three transports including HTTP",
+			givenTransports: []metadata.Protocol{
+				&metadata.HTTPRetrievalV1{
+					URLTemplate:  "https://example.com/ipfs/{cid}",
+					TrustlessCAR: true,
+					AuthHints:    []string{"bearer"},
+				},
+				&metadata.GraphsyncFilecoinV1{
+					PieceCID:      cids[1],
+					VerifiedDeal:  true,
+					FastRetrieval: true,
+				},
+				&metadata.Bitswap{},
+			},
+		},
+		{
+			name: "Three transports including legacy HTTP",
+			givenTransports: []metadata.Protocol{
+				&metadata.Bitswap{},
+				&metadata.HTTPRetrievalV1{},
+				&metadata.GraphsyncFilecoinV1{PieceCID: cids[2]},
+			},
+		},
 		{
 			name:            "No transports is invalid",
-			wantValidateErr: "at least one transport must be specified",
+			wantValidateErr: "storetheindex: invalid metadata: at least one transport must be specified",
 		},
 	}
 	for _, test := range tests {
@@ -82,7 +108,7 @@ func TestMetadata_UnmarshalBinary(t *testing.T) {
 	}{
 		{
 			name:    "Empty bytes is error",
-			wantErr: "at least one transport must be specified",
+			wantErr: "storetheindex: invalid metadata: at least one transport must be specified",
 		},
 		{
 			name:       "Unknown transport ID is error",
@@ -115,3 +141,79 @@ func TestMetadata_UnmarshalBinary(t *testing.T) {
 		})
 	}
 }
+
+func TestMetadata_ValidateProtocols(t *testing.T) {
+	rng := rand.New(rand.NewSource(1413))
+	cids := testutil.RandomCids(t, rng, 2)
+	tests := []struct {
+		name            string
+		givenTransports []metadata.Protocol
+		wantValidateErr string
+	}{
+		{
+			name: "Valid transports",
+			givenTransports: []metadata.Protocol{
+				&metadata.Bitswap{},
+				&metadata.GraphsyncFilecoinV1{PieceCID: cids[0]},
+				&metadata.HTTPRetrievalV1{TrustlessCAR: true},
+			},
+		},
+		{
+			name: "Repeated transport is invalid",
+			givenTransports: []metadata.Protocol{
+				&metadata.GraphsyncFilecoinV1{PieceCID: cids[0]},
+				&metadata.GraphsyncFilecoinV1{PieceCID: cids[1]},
+			},
+			wantValidateErr: "storetheindex: invalid metadata: transport transport-graphsync-filecoinv1 must not be repeated",
+		},
+		{
+			name: "Undefined piece CID is invalid",
+			givenTransports: []metadata.Protocol{
+				&metadata.Bitswap{},
+				&metadata.GraphsyncFilecoinV1{VerifiedDeal: true},
+			},
+			wantValidateErr: "storetheindex: invalid metadata: piece CID of graphsync filecoin v1 transport must be defined",
+		},
+		{
+			name: "Oversized metadata is invalid",
+			givenTransports: []metadata.Protocol{
+				&metadata.HTTPRetrievalV1{URLTemplate: strings.Repeat("a", metadata.MaxMetadataLen)},
+			},
+			wantValidateErr: "storetheindex: invalid metadata: encoded size of 1056 bytes exceeds the maximum of 1024 bytes",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			subject := metadata.Default.New(test.givenTransports...)
+			err := subject.Validate()
+			if test.wantValidateErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.EqualError(t, err, test.wantValidateErr)
+			require.ErrorAs(t, err, &metadata.ErrInvalidMetadata{})
+		})
+	}
+}
+
+func TestMetadata_DecodingDoesNotValidate(t *testing.T) {
+	for _, md := range []metadata.Metadata{
+		metadata.Default.New(&metadata.Bitswap{}, &metadata.Bitswap{}),
+		metadata.Default.New(&metadata.HTTPRetrievalV1{URLTemplate: strings.Repeat("a", metadata.MaxMetadataLen)}),
+	} {
+		require.Error(t, md.Validate())
+
+		// Metadata published before the validation rules must remain decodable.
+		mdBytes, err := md.MarshalBinary()
+		require.NoError(t, err)
+		decoded := metadata.Default.New()
+		require.NoError(t, decoded.UnmarshalBinary(mdBytes))
+		require.True(t, md.Equal(decoded))
+
+		mdJSON, err := json.Marshal(&md)
+		require.NoError(t, err)
+		decoded = metadata.Default.New()
+		require.NoError(t, json.Unmarshal(mdJSON, &decoded))
+		require.True(t, md.Equal(decoded))
+	}
+}
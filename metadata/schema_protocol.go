@@ -0,0 +1,174 @@
+package metadata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ipld/go-ipld-prime"
+	"github.com/ipld/go-ipld-prime/codec/dagcbor"
+	"github.com/ipld/go-ipld-prime/codec/dagjson"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/node/bindnode"
+	"github.com/ipld/go-ipld-prime/schema"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-varint"
+)
+
+var (
+	_ Protocol  = (*SchemaProtocol)(nil)
+	_ Validator = (*SchemaProtocol)(nil)
+)
+
+// SchemaProtocol is a Protocol for a custom transport, whose payload is a value of a type defined
+// by an IPLD schema, encoded as DAG-CBOR. The payload is validated against the schema type
+// whenever it is set or decoded, which allows metadata of custom transports to be validated
+// without implementing a dedicated Protocol.
+//
+// A SchemaProtocol is instantiated via the factory returned by NewSchemaProtocolFactory, which
+// can be registered on a MetadataContext via MetadataContext.WithProtocol.
+type SchemaProtocol struct {
+	code      multicodec.Code
+	prototype schema.TypedPrototype
+	node      schema.TypedNode
+}
+
+// NewSchemaProtocolFactory returns a factory of SchemaProtocol for the given transport code,
+// whose payload is of the type with the given name in the given IPLD schema DSL.
+func NewSchemaProtocolFactory(code multicodec.Code, schemaDSL, typeName string) (func() Protocol, error) {
+	typeSystem, err := ipld.LoadSchemaBytes([]byte(schemaDSL))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema for %s: %w", protocolName(code), err)
+	}
+	t := typeSystem.TypeByName(typeName)
+	if t == nil {
+		return nil, fmt.Errorf("type %q not found in schema for %s", typeName, protocolName(code))
+	}
+	prototype := bindnode.Prototype(nil, t)
+	return func() Protocol {
+		return &SchemaProtocol{
+			code:      code,
+			prototype: prototype,
+		}
+	}, nil
+}
+
+func (p *SchemaProtocol) ID() multicodec.Code {
+	return p.code
+}
+
+// Node returns the payload of this protocol, or nil if the payload is not set.
+func (p *SchemaProtocol) Node() datamodel.Node {
+	if p.node == nil {
+		return nil
+	}
+	return p.node
+}
+
+// SetNode sets the payload of this protocol to the given node. The node may be typed or untyped
+// as long as it matches the representation of the schema type; an error is returned otherwise.
+func (p *SchemaProtocol) SetNode(n datamodel.Node) error {
+	if tn, ok := n.(schema.TypedNode); ok {
+		n = tn.Representation()
+	}
+	nb := p.prototype.Representation().NewBuilder()
+	if err := datamodel.Copy(n, nb); err != nil {
+		return p.invalidPayload(err)
+	}
+	p.node = nb.Build().(schema.TypedNode)
+	return nil
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+func (p *SchemaProtocol) MarshalBinary() ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(varint.ToUvarint(uint64(p.code)))
+	if err := dagcbor.Encode(p.node.Representation(), buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler.
+func (p *SchemaProtocol) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	_, err := p.ReadFrom(r)
+	return err
+}
+
+func (p *SchemaProtocol) ReadFrom(r io.Reader) (n int64, err error) {
+	cr := &countingReader{r: r}
+	v, err := varint.ReadUvarint(cr)
+	if err != nil {
+		return cr.readCount, err
+	}
+	id := multicodec.Code(v)
+	if id != p.code {
+		return cr.readCount, fmt.Errorf("transport id does not match %s: %s", protocolName(p.code), id)
+	}
+
+	nb := p.prototype.Representation().NewBuilder()
+	if err := decodeDagCbor(nb, cr); err != nil {
+		return cr.readCount, p.invalidPayload(err)
+	}
+	p.node = nb.Build().(schema.TypedNode)
+	return cr.readCount, nil
+}
+
+type schemaProtocolJSON struct {
+	protocolJSON
+	Value json.RawMessage `json:"value"`
+}
+
+// MarshalJSON implements json.Marshaler. The payload is represented as the DAG-JSON encoding of
+// its schema representation.
+func (p *SchemaProtocol) MarshalJSON() ([]byte, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	var value bytes.Buffer
+	if err := dagjson.Encode(p.node.Representation(), &value); err != nil {
+		return nil, err
+	}
+	return json.Marshal(schemaProtocolJSON{
+		protocolJSON: protocolJSON{Protocol: protocolName(p.code)},
+		Value:        value.Bytes(),
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (p *SchemaProtocol) UnmarshalJSON(data []byte) error {
+	if err := checkProtocolJSON(data, p.code); err != nil {
+		return err
+	}
+	var j schemaProtocolJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	if len(j.Value) == 0 {
+		return p.invalidPayload(errors.New("value must be specified"))
+	}
+	nb := p.prototype.Representation().NewBuilder()
+	if err := dagjson.Decode(nb, bytes.NewReader(j.Value)); err != nil {
+		return p.invalidPayload(err)
+	}
+	p.node = nb.Build().(schema.TypedNode)
+	return nil
+}
+
+// Validate checks that the payload of this protocol is set. The payload itself is validated
+// against the schema whenever it is set.
+func (p *SchemaProtocol) Validate() error {
+	if p.node == nil {
+		return p.invalidPayload(errors.New("payload is not set"))
+	}
+	return nil
+}
+
+func (p *SchemaProtocol) invalidPayload(err error) error {
+	return ErrInvalidMetadata{Message: fmt.Sprintf("invalid %s payload: %v", protocolName(p.code), err)}
+}
@@ -0,0 +1,121 @@
+package metadata_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/filecoin-project/index-provider/metadata"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-ipld-prime/datamodel"
+	"github.com/ipld/go-ipld-prime/fluent/qp"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-varint"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testCustomCode   = multicodec.Code(0x3f0001)
+	testCustomSchema = `type CustomTransport struct {
+	Endpoint String
+	Priority Int
+}`
+)
+
+func newTestCustomProtocol(t *testing.T) (metadata.MetadataContext, *metadata.SchemaProtocol) {
+	factory, err := metadata.NewSchemaProtocolFactory(testCustomCode, testCustomSchema, "CustomTransport")
+	require.NoError(t, err)
+	mc := metadata.Default.WithProtocol(testCustomCode, factory)
+	return mc, factory().(*metadata.SchemaProtocol)
+}
+
+func TestSchemaProtocol_RoundTrip(t *testing.T) {
+	mc, subject := newTestCustomProtocol(t)
+	require.Equal(t, testCustomCode, subject.ID())
+
+	n, err := qp.BuildMap(basicnode.Prototype.Map, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "Endpoint", qp.String("https://example.com"))
+		qp.MapEntry(ma, "Priority", qp.Int(7))
+	})
+	require.NoError(t, err)
+	require.NoError(t, subject.SetNode(n))
+
+	src := mc.New(&metadata.Bitswap{}, subject)
+	asBytes, err := src.MarshalBinary()
+	require.NoError(t, err)
+
+	dst := mc.New()
+	require.NoError(t, dst.UnmarshalBinary(asBytes))
+	require.True(t, src.Equal(dst))
+
+	asJson, err := json.Marshal(src)
+	require.NoError(t, err)
+	require.JSONEq(t, `[
+  {"protocol":"transport-bitswap"},
+  {"protocol":"0x3f0001","value":{"Endpoint":"https://example.com","Priority":7}}
+]`, string(asJson))
+
+	dst = mc.New()
+	require.NoError(t, json.Unmarshal(asJson, &dst))
+	require.True(t, src.Equal(dst))
+	endpoint, err := dst.Get(testCustomCode).(*metadata.SchemaProtocol).Node().LookupByString("Endpoint")
+	require.NoError(t, err)
+	gotEndpoint, err := endpoint.AsString()
+	require.NoError(t, err)
+	require.Equal(t, "https://example.com", gotEndpoint)
+}
+
+func TestSchemaProtocol_RoundTripAfterGraphsync(t *testing.T) {
+	mc, subject := newTestCustomProtocol(t)
+	n, err := qp.BuildMap(basicnode.Prototype.Map, 2, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "Endpoint", qp.String("https://example.com"))
+		qp.MapEntry(ma, "Priority", qp.Int(7))
+	})
+	require.NoError(t, err)
+	require.NoError(t, subject.SetNode(n))
+	pieceCid, err := cid.Decode("baga6ea4seaqo7dnsh5bvx6lhwpqqo2pmbi4gsmwnbwdbg3w6oypw3r5rt5fnmhq")
+	require.NoError(t, err)
+
+	// Custom protocol codes sort after graphsync, the payload of which must then be followed by
+	// that of the custom protocol.
+	src := mc.New(subject, &metadata.GraphsyncFilecoinV1{PieceCID: pieceCid, VerifiedDeal: true}, &metadata.Bitswap{})
+	asBytes, err := src.MarshalBinary()
+	require.NoError(t, err)
+
+	dst := mc.New()
+	require.NoError(t, dst.UnmarshalBinary(asBytes))
+	require.True(t, src.Equal(dst))
+	require.Equal(t, pieceCid, dst.Get(multicodec.TransportGraphsyncFilecoinv1).(*metadata.GraphsyncFilecoinV1).PieceCID)
+}
+
+func TestSchemaProtocol_RejectsMalformedPayload(t *testing.T) {
+	mc, subject := newTestCustomProtocol(t)
+
+	n, err := qp.BuildMap(basicnode.Prototype.Map, 1, func(ma datamodel.MapAssembler) {
+		qp.MapEntry(ma, "Endpoint", qp.Int(42))
+	})
+	require.NoError(t, err)
+	require.Error(t, subject.SetNode(n))
+
+	// Payload that is valid DAG-CBOR but does not match the schema.
+	malformed := append(varint.ToUvarint(uint64(testCustomCode)), 0xa0)
+	md := mc.New()
+	err = md.UnmarshalBinary(malformed)
+	require.ErrorAs(t, err, &metadata.ErrInvalidMetadata{})
+
+	err = json.Unmarshal([]byte(`[{"protocol":"0x3f0001","value":{"Endpoint":42,"Priority":7}}]`), &md)
+	require.ErrorAs(t, err, &metadata.ErrInvalidMetadata{})
+
+	// Protocol with no payload is invalid.
+	_, unset := newTestCustomProtocol(t)
+	md = mc.New(unset)
+	require.ErrorAs(t, md.Validate(), &metadata.ErrInvalidMetadata{})
+}
+
+func TestNewSchemaProtocolFactory_InvalidSchemaIsError(t *testing.T) {
+	_, err := metadata.NewSchemaProtocolFactory(testCustomCode, "type Fish", "Fish")
+	require.Error(t, err)
+
+	_, err = metadata.NewSchemaProtocolFactory(testCustomCode, testCustomSchema, "Lobster")
+	require.EqualError(t, err, `type "Lobster" not found in schema for 0x3f0001`)
+}
@@ -1,6 +1,7 @@
 package metadata
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -60,6 +61,34 @@ func (u *Unknown) ReadFrom(r io.Reader) (n int64, err error) {
 	return preSize + bRead, nil
 }
 
+type unknownJSON struct {
+	protocolJSON
+	Payload []byte `json:"payload"`
+}
+
+// MarshalJSON implements json.Marshaler. The payload is represented as base64 encoded bytes.
+func (u *Unknown) MarshalJSON() ([]byte, error) {
+	return json.Marshal(unknownJSON{
+		protocolJSON: protocolJSON{Protocol: protocolName(u.Code)},
+		Payload:      u.Payload,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (u *Unknown) UnmarshalJSON(data []byte) error {
+	id, err := protocolFromJSON(data)
+	if err != nil {
+		return err
+	}
+	var j unknownJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	u.Code = id
+	u.Payload = j.Payload
+	return nil
+}
+
 type rbr struct {
 	io.Reader
 	b [1]byte // avoid alloc in ReadByte
@@ -3,11 +3,13 @@ package metrics
 import "go.opentelemetry.io/otel/attribute"
 
 var Attributes struct {
-	StatusFailure attribute.KeyValue
-	StatusSuccess attribute.KeyValue
+	StatusFailure  attribute.KeyValue
+	StatusSuccess  attribute.KeyValue
+	StatusRejected attribute.KeyValue
 }
 
 func init() {
 	Attributes.StatusFailure = attribute.String("status", "failure")
 	Attributes.StatusSuccess = attribute.String("status", "success")
+	Attributes.StatusRejected = attribute.String("status", "rejected")
 }
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"go.opentelemetry.io/otel/metric/instrument"
+	"go.opentelemetry.io/otel/metric/instrument/syncint64"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+var Retrieval struct {
+	Transfers        syncint64.Counter
+	ActiveTransfers  syncint64.UpDownCounter
+	BytesSent        syncint64.Counter
+	TransferDuration syncint64.Histogram
+}
+
+func init() {
+	var err error
+	if Retrieval.Transfers, err = meter.SyncInt64().Counter(
+		"index-provider/retrieval/transfers",
+		instrument.WithDescription("The number of retrieval transfers by status, i.e. success, failure or rejected"),
+	); err != nil {
+		panic(err)
+	}
+	if Retrieval.ActiveTransfers, err = meter.SyncInt64().UpDownCounter(
+		"index-provider/retrieval/active_transfers",
+		instrument.WithDescription("The number of retrieval transfers in progress"),
+	); err != nil {
+		panic(err)
+	}
+	if Retrieval.BytesSent, err = meter.SyncInt64().Counter(
+		"index-provider/retrieval/bytes_sent",
+		instrument.WithUnit(unit.Bytes),
+		instrument.WithDescription("The number of bytes sent by retrieval transfers"),
+	); err != nil {
+		panic(err)
+	}
+	if Retrieval.TransferDuration, err = meter.SyncInt64().Histogram(
+		"index-provider/retrieval/transfer_duration",
+		instrument.WithUnit(unit.Milliseconds),
+		instrument.WithDescription("The time taken by retrieval transfers from acceptance to termination in milliseconds"),
+	); err != nil {
+		panic(err)
+	}
+}
@@ -8,9 +8,12 @@
 // be re-signed as the original signature will no longer be valid.
 //
 // A Mirror will also act as a CDN for the original advertisement chain by exposing a dagsync.Publisher
-// over GraphSync. The endpoint enables an indexer node to fetch the content associated with the
-// original chain of advertisement as well as the mirrored advertisement chain which may be
-// different.
+// over GraphSync, HTTP or both; see WithPublisherKinds. The endpoints enable an indexer node to fetch
+// the content associated with the original chain of advertisement as well as the mirrored
+// advertisement chain which may be different.
+//
+// The original advertisement chain is synced over GraphSync, unless the source address info has an
+// address with an "/http" component, in which case it is synced over HTTP from that address.
 //
 // Upon starting a Mirror, when no prior mirrored advertisements exist, the initial mirroring
 // recursion depth is set to unlimited. When the initial limit is set to a value smaller than the
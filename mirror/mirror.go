@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
 	"time"
 
@@ -11,11 +12,14 @@ import (
 	datatransfer "github.com/filecoin-project/go-data-transfer/impl"
 	dtnetwork "github.com/filecoin-project/go-data-transfer/network"
 	gstransport "github.com/filecoin-project/go-data-transfer/transport/graphsync"
+	"github.com/filecoin-project/index-provider/engine"
 	"github.com/filecoin-project/index-provider/engine/chunker"
 	"github.com/filecoin-project/index-provider/metrics"
 	"github.com/filecoin-project/storetheindex/api/v0/ingest/schema"
 	"github.com/filecoin-project/storetheindex/dagsync"
 	"github.com/filecoin-project/storetheindex/dagsync/dtsync"
+	"github.com/filecoin-project/storetheindex/dagsync/httpsync"
+	"github.com/hashicorp/go-multierror"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/namespace"
@@ -30,6 +34,7 @@ import (
 	"github.com/ipld/go-ipld-prime/traversal/selector"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multiaddr"
 )
 
 var log = logging.Logger("provider/mirror")
@@ -38,12 +43,13 @@ var log = logging.Logger("provider/mirror")
 // options to restructure entries as EntryChunk chain or HAMT.
 //
 // Additionally, a mirror can also serve as a CDN for the original advertisement chain and its
-// entries. It exposes a GraphSync publisher endpoint from which ad chain can be synced.
+// entries. It exposes publisher endpoints over GraphSync, HTTP or both, from which ad chain can be
+// synced.
 type Mirror struct {
 	*options
 	source  peer.AddrInfo
 	sub     *dagsync.Subscriber
-	pub     dagsync.Publisher
+	pubs    []dagsync.Publisher
 	ls      ipld.LinkSystem
 	chunker *chunker.CachedEntriesChunker
 	cancel  context.CancelFunc
@@ -82,18 +88,67 @@ func New(ctx context.Context, source peer.AddrInfo, o ...Option) (*Mirror, error
 		return nil, err
 	}
 
-	// TODO: make the publisher kind configurable just like we do for Engine.
-	m.pub, err = dtsync.NewPublisherFromExisting(dm, m.h, m.topic, m.ls)
-	if err != nil {
+	if err := m.startPublishers(ctx, dm); err != nil {
+		m.closePublishers()
 		return nil, err
 	}
 	m.sub, err = dagsync.NewSubscriber(m.h, nil, m.ls, m.topic, nil, dagsync.DtManager(dm, gx))
 	if err != nil {
+		m.closePublishers()
 		return nil, err
 	}
 	return m, nil
 }
 
+// startPublishers instantiates a publisher for each of the configured publisher kinds, and
+// initialises them with the latest mirrored advertisement CID if there is one.
+func (m *Mirror) startPublishers(ctx context.Context, dm dt.Manager) error {
+	for _, kind := range m.pubKinds {
+		var pub dagsync.Publisher
+		var err error
+		switch kind {
+		case engine.NoPublisher:
+			continue
+		case engine.DataTransferPublisher:
+			pub, err = dtsync.NewPublisherFromExisting(dm, m.h, m.topic, m.ls)
+		case engine.HttpPublisher:
+			pub, err = httpsync.NewPublisher(m.pubHttpListenAddr, m.ls, m.h.ID(), m.h.Peerstore().PrivKey(m.h.ID()))
+		default:
+			err = fmt.Errorf("unknown publisher kind: %s", kind)
+		}
+		if err != nil {
+			log.Errorw("Failed to instantiate dagsync publisher", "err", err, "kind", kind)
+			return err
+		}
+		m.pubs = append(m.pubs, pub)
+	}
+
+	latest, err := m.getLatestMirroredAdCid(ctx)
+	if err != nil {
+		return err
+	}
+	if cid.Undef.Equals(latest) {
+		return nil
+	}
+	for _, pub := range m.pubs {
+		if err := pub.SetRoot(ctx, latest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Mirror) closePublishers() error {
+	var errs error
+	for _, pub := range m.pubs {
+		if err := pub.Close(); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("error closing publisher: %w", err))
+		}
+	}
+	m.pubs = nil
+	return errs
+}
+
 // TODO: add option to override this
 func newDataTransfer(ctx context.Context, host host.Host, ds datastore.Batching, ls ipld.LinkSystem) (dt.Manager, graphsync.GraphExchange, error) {
 	gn := gsnet.NewFromLibp2pHost(host)
@@ -182,7 +237,11 @@ func (m *Mirror) Shutdown() error {
 	if m.cancel != nil {
 		m.cancel()
 	}
-	return nil
+	errs := m.closePublishers()
+	if err := m.sub.Close(); err != nil {
+		errs = multierror.Append(errs, fmt.Errorf("error closing subscriber: %w", err))
+	}
+	return errs
 }
 
 func (m *Mirror) mirror(ctx context.Context, adCid cid.Cid) error {
@@ -230,12 +289,11 @@ func (m *Mirror) mirror(ctx context.Context, adCid cid.Cid) error {
 		case schema.NoEntries.Cid:
 			// Nothing to do.
 		default:
-			if len(m.source.Addrs) == 0 {
-				return errors.New("no address for source")
+			sourceAddr, err := m.sourceAddr()
+			if err != nil {
+				return err
 			}
-			// TODO: it is unfortunate that dagsync takes a single address here... this needs to be
-			//       fixed in storetheindex/dagsync.
-			_, err = m.sub.Sync(ctx, m.source.ID, entriesCid, selectors.entriesWithLimit(m.entriesRecurLimit), m.source.Addrs[0])
+			_, err = m.sub.Sync(ctx, m.source.ID, entriesCid, selectors.entriesWithLimit(m.entriesRecurLimit), sourceAddr)
 			if err != nil {
 				log.Errorw("Failed to sync entries", "cid", entriesCid, "err", err)
 				return err
@@ -279,8 +337,16 @@ func (m *Mirror) mirror(ctx context.Context, adCid cid.Cid) error {
 		return err
 	}
 
-	if err := m.pub.UpdateRoot(ctx, mirroredAdCid); err != nil {
-		return err
+	// Update every publisher, so that a failing one does not hold back the others.
+	var errs error
+	for _, pub := range m.pubs {
+		if err := pub.UpdateRoot(ctx, mirroredAdCid); err != nil {
+			log.Errorw("Failed to publish mirrored advertisement", "err", err, "mirroredAdCid", mirroredAdCid)
+			errs = multierror.Append(errs, fmt.Errorf("error updating publisher root: %w", err))
+		}
+	}
+	if errs != nil {
+		return errs
 	}
 	log.Infow("Mirrored successfully", "originalAdCid", adCid, "mirroredAdCid", mirroredAdCid)
 	return nil
@@ -392,12 +458,13 @@ func (m *Mirror) remapEntries(ctx context.Context, original ipld.Link) (ipld.Lin
 }
 
 func (m *Mirror) syncAds(ctx context.Context, sel ipld.Node) ([]cid.Cid, error) {
-	if len(m.source.Addrs) == 0 {
-		return nil, errors.New("no address for source")
+	sourceAddr, err := m.sourceAddr()
+	if err != nil {
+		return nil, err
 	}
 	startSync := time.Now()
 	var syncedAdCids []cid.Cid
-	_, err := m.sub.Sync(ctx, m.source.ID, cid.Undef, sel, m.source.Addrs[0],
+	_, err = m.sub.Sync(ctx, m.source.ID, cid.Undef, sel, sourceAddr,
 		dagsync.ScopedBlockHook(func(id peer.ID, c cid.Cid, actions dagsync.SegmentSyncActions) {
 			// TODO: set actions next segment link to ad previous id if it is present. For
 			//      now segmentation is disabled.
@@ -419,3 +486,20 @@ func (m *Mirror) syncAds(ctx context.Context, sel ipld.Node) ([]cid.Cid, error)
 	metrics.Mirror.SyncDuration.Record(ctx, elapsedSync.Milliseconds(), attr)
 	return syncedAdCids, err
 }
+
+// sourceAddr returns the address at which to sync from the source provider. An address with an
+// "/http" component is preferred if present, in which case the source is synced over HTTP instead
+// of data transfer.
+func (m *Mirror) sourceAddr() (multiaddr.Multiaddr, error) {
+	if len(m.source.Addrs) == 0 {
+		return nil, errors.New("no address for source")
+	}
+	for _, addr := range m.source.Addrs {
+		for _, p := range addr.Protocols() {
+			if p.Code == multiaddr.P_HTTP || p.Code == multiaddr.P_HTTPS {
+				return addr, nil
+			}
+		}
+	}
+	return m.source.Addrs[0], nil
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"testing"
 
 	provider "github.com/filecoin-project/index-provider"
@@ -13,7 +14,9 @@ import (
 	"github.com/filecoin-project/index-provider/mirror"
 	"github.com/filecoin-project/index-provider/testutil"
 	"github.com/filecoin-project/storetheindex/api/v0/ingest/schema"
+	"github.com/filecoin-project/storetheindex/dagsync"
 	"github.com/filecoin-project/storetheindex/dagsync/dtsync"
+	"github.com/filecoin-project/storetheindex/dagsync/httpsync"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
@@ -27,21 +30,24 @@ import (
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/libp2p/go-libp2p/core/peerstore"
+	"github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
 	"github.com/multiformats/go-multihash"
 	"github.com/stretchr/testify/require"
 )
 
 type testEnv struct {
-	sourceHost host.Host
-	source     *engine.Engine
-	sourceMhs  map[string][]multihash.Multihash
+	sourceHost     host.Host
+	sourceHttpAddr multiaddr.Multiaddr
+	source         *engine.Engine
+	sourceMhs      map[string][]multihash.Multihash
 
 	mirror            *mirror.Mirror
 	mirrorHost        host.Host
 	mirrorSync        *dtsync.Sync
 	mirrorSyncHost    host.Host
 	mirrorSyncLs      ipld.LinkSystem
-	mirrorSyncer      *dtsync.Syncer
+	mirrorSyncer      dagsync.Syncer
 	mirrorSyncLsStore *memstore.Store
 }
 
@@ -71,9 +77,40 @@ func (te *testEnv) startMirror(t *testing.T, ctx context.Context, opts ...mirror
 	te.mirrorSyncer = te.mirrorSync.NewSyncer(te.mirrorHost.ID(), te.mirror.GetTopicName(), nil)
 }
 
+// syncFromMirrorOverHttp switches syncing from the mirror to its HTTP publisher, listening on the
+// given address.
+func (te *testEnv) syncFromMirrorOverHttp(t *testing.T, listenAddr string) {
+	require.NotNil(t, te.mirror, "start mirror first")
+	tcpAddr, err := net.ResolveTCPAddr("tcp", listenAddr)
+	require.NoError(t, err)
+	addr, err := manet.FromNetAddr(tcpAddr)
+	require.NoError(t, err)
+	httpSync := httpsync.NewSync(te.mirrorSyncLs, nil, nil)
+	t.Cleanup(httpSync.Close)
+	te.mirrorSyncer, err = httpSync.NewSyncer(te.mirrorHost.ID(), multiaddr.Join(addr, multiaddr.StringCast("/http")), nil)
+	require.NoError(t, err)
+}
+
 func (te *testEnv) sourceAddrInfo(t *testing.T) peer.AddrInfo {
 	require.NotNil(t, te.sourceHost, "start source first")
-	return testutil.WaitForAddrs(te.sourceHost)
+	addrInfo := testutil.WaitForAddrs(te.sourceHost)
+	if te.sourceHttpAddr != nil {
+		addrInfo.Addrs = append(addrInfo.Addrs, te.sourceHttpAddr)
+	}
+	return addrInfo
+}
+
+// startHttpSource starts a source that publishes its advertisements over HTTP only.
+func (te *testEnv) startHttpSource(t *testing.T, ctx context.Context, opts ...engine.Option) {
+	listenAddr := findOpenAddr(t)
+	var err error
+	te.sourceHttpAddr, err = manet.FromNetAddr(listenAddr)
+	require.NoError(t, err)
+	te.sourceHttpAddr = multiaddr.Join(te.sourceHttpAddr, multiaddr.StringCast("/http"))
+	opts = append(opts,
+		engine.WithPublisherKind(engine.HttpPublisher),
+		engine.WithHttpPublisherListenAddr(listenAddr.String()))
+	te.startSource(t, ctx, opts...)
 }
 
 func (te *testEnv) startSource(t *testing.T, ctx context.Context, opts ...engine.Option) {
@@ -227,3 +264,10 @@ func (te *testEnv) syncMirrorAd(ctx context.Context, adCid cid.Cid) (*schema.Adv
 	}
 	return schema.UnwrapAdvertisement(n)
 }
+
+func findOpenAddr(t *testing.T) net.Addr {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+	return l.Addr()
+}
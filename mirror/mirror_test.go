@@ -323,3 +323,83 @@ func TestMirror_MirrorsAdsIdenticallyWhenConfiguredTo(t *testing.T) {
 	// verified against the content.
 	te.requireAdChainMirroredRecursively(t, ctx, originalHeadCid, gotMirroredHeadAdCid)
 }
+
+func TestMirror_MirrorsFromHttpSource(t *testing.T) {
+	ctx := newTestContext(t)
+	rng := rand.New(rand.NewSource(testRandomSeed))
+	md := metadata.Default.New(metadata.Bitswap{})
+
+	te := &testEnv{}
+	// Start a source that only publishes over HTTP and publish 3 ads.
+	te.startHttpSource(t, ctx)
+	_ = te.putAdOnSource(t, ctx, []byte("ad1"), testutil.RandomMultihashes(t, rng, 1), md)
+	_ = te.putAdOnSource(t, ctx, []byte("ad2"), testutil.RandomMultihashes(t, rng, 2), md)
+	originalHeadCid := te.putAdOnSource(t, ctx, []byte("ad3"), testutil.RandomMultihashes(t, rng, 3), md)
+
+	te.startMirror(t, ctx, mirror.WithSyncInterval(time.Second), mirror.WithEntryChunkRemapper(1))
+
+	var gotMirroredHeadAdCid cid.Cid
+	var err error
+	require.Eventually(t, func() bool {
+		gotMirroredHeadAdCid, err = te.mirrorSyncer.GetHead(ctx)
+		if err != nil || cid.Undef.Equals(gotMirroredHeadAdCid) {
+			return false
+		}
+		// Wait until the mirror has caught up with the original head.
+		ad, err := te.syncMirrorAd(ctx, gotMirroredHeadAdCid)
+		return err == nil && string(ad.ContextID) == "ad3"
+	}, testEventualTimeout, testCheckInterval, "err: %v", err)
+
+	te.requireAdChainMirroredRecursively(t, ctx, originalHeadCid, gotMirroredHeadAdCid)
+}
+
+func TestMirror_PublishesOverHttp(t *testing.T) {
+	ctx := newTestContext(t)
+	rng := rand.New(rand.NewSource(testRandomSeed))
+	md := metadata.Default.New(metadata.Bitswap{})
+
+	te := &testEnv{}
+	te.startSource(t, ctx, engine.WithPublisherKind(engine.DataTransferPublisher))
+	_ = te.putAdOnSource(t, ctx, []byte("ad1"), testutil.RandomMultihashes(t, rng, 1), md)
+	originalHeadCid := te.putAdOnSource(t, ctx, []byte("ad2"), testutil.RandomMultihashes(t, rng, 2), md)
+
+	// Start a mirror that publishes over both data transfer and HTTP.
+	httpListenAddr := findOpenAddr(t).String()
+	te.startMirror(t, ctx,
+		mirror.WithSyncInterval(time.Second),
+		mirror.WithEntryChunkRemapper(1),
+		mirror.WithPublisherKinds(engine.DataTransferPublisher, engine.HttpPublisher),
+		mirror.WithHttpPublisherListenAddr(httpListenAddr))
+
+	var dtHeadCid cid.Cid
+	var err error
+	require.Eventually(t, func() bool {
+		dtHeadCid, err = te.mirrorSyncer.GetHead(ctx)
+		if err != nil || cid.Undef.Equals(dtHeadCid) {
+			return false
+		}
+		ad, err := te.syncMirrorAd(ctx, dtHeadCid)
+		return err == nil && string(ad.ContextID) == "ad2"
+	}, testEventualTimeout, testCheckInterval, "err: %v", err)
+
+	// Assert that the same head is published over HTTP, and that the mirrored ad chain is
+	// syncable over HTTP.
+	te.syncFromMirrorOverHttp(t, httpListenAddr)
+	httpHeadCid, err := te.mirrorSyncer.GetHead(ctx)
+	require.NoError(t, err)
+	require.Equal(t, dtHeadCid, httpHeadCid)
+	te.requireAdChainMirroredRecursively(t, ctx, originalHeadCid, httpHeadCid)
+}
+
+func TestMirror_RejectsInvalidPublisherKinds(t *testing.T) {
+	ctx := newTestContext(t)
+	te := &testEnv{}
+	te.startSource(t, ctx, engine.WithPublisherKind(engine.DataTransferPublisher))
+
+	_, err := mirror.New(ctx, te.sourceAddrInfo(t), mirror.WithPublisherKinds("fish"))
+	require.EqualError(t, err, "unknown publisher kind: fish")
+	_, err = mirror.New(ctx, te.sourceAddrInfo(t), mirror.WithPublisherKinds(engine.HttpPublisher, engine.HttpPublisher))
+	require.EqualError(t, err, "duplicate publisher kind: http")
+	_, err = mirror.New(ctx, te.sourceAddrInfo(t), mirror.WithPublisherKinds(engine.NoPublisher, engine.HttpPublisher))
+	require.EqualError(t, err, `publisher kind "" disables publishing and cannot be combined with other kinds`)
+}
@@ -1,8 +1,10 @@
 package mirror
 
 import (
+	"fmt"
 	"time"
 
+	"github.com/filecoin-project/index-provider/engine"
 	"github.com/filecoin-project/index-provider/engine/chunker"
 	stischema "github.com/filecoin-project/storetheindex/api/v0/ingest/schema"
 	"github.com/ipfs/go-datastore"
@@ -30,6 +32,8 @@ type (
 		skipRemapOnEntriesTypeMatch bool
 		entriesRemapPrototype       schema.TypedPrototype
 		alwaysReSignAds             bool
+		pubKinds                    []engine.PublisherKind
+		pubHttpListenAddr           string
 	}
 )
 
@@ -45,6 +49,8 @@ func newOptions(o ...Option) (*options, error) {
 		chunkCacheCap:     1024,
 		chunkCachePurge:   false,
 		topic:             "/indexer/ingest/mainnet",
+		pubKinds:          []engine.PublisherKind{engine.DataTransferPublisher},
+		pubHttpListenAddr: "0.0.0.0:3104",
 	}
 	for _, apply := range o {
 		if err := apply(&opts); err != nil {
@@ -199,3 +205,44 @@ func WithAlwaysReSignAds(r bool) Option {
 		return nil
 	}
 }
+
+// WithPublisherKinds specifies the kinds of publisher over which the mirrored advertisements are
+// published. Multiple kinds may be specified in order to publish over both data transfer and
+// HTTP. Specifying engine.NoPublisher alone or no kinds at all disables publishing;
+// engine.NoPublisher cannot be combined with other kinds.
+// If unset, only engine.DataTransferPublisher is used.
+//
+// See: WithHttpPublisherListenAddr.
+func WithPublisherKinds(kinds ...engine.PublisherKind) Option {
+	return func(o *options) error {
+		seen := make(map[engine.PublisherKind]struct{}, len(kinds))
+		for _, k := range kinds {
+			switch k {
+			case engine.NoPublisher, engine.DataTransferPublisher, engine.HttpPublisher:
+			default:
+				return fmt.Errorf("unknown publisher kind: %s", k)
+			}
+			if _, ok := seen[k]; ok {
+				return fmt.Errorf("duplicate publisher kind: %s", k)
+			}
+			seen[k] = struct{}{}
+		}
+		if _, ok := seen[engine.NoPublisher]; ok && len(kinds) > 1 {
+			return fmt.Errorf("publisher kind %q disables publishing and cannot be combined with other kinds", engine.NoPublisher)
+		}
+		o.pubKinds = kinds
+		return nil
+	}
+}
+
+// WithHttpPublisherListenAddr specifies the net listen address of the HTTP publisher.
+// This option has no effect unless engine.HttpPublisher is one of the publisher kinds.
+// If unset, the default net listen address of '0.0.0.0:3104' is used.
+//
+// See: WithPublisherKinds.
+func WithHttpPublisherListenAddr(addr string) Option {
+	return func(o *options) error {
+		o.pubHttpListenAddr = addr
+		return nil
+	}
+}
@@ -3,17 +3,22 @@ package adminserver
 import (
 	"context"
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 
 	provider "github.com/filecoin-project/index-provider"
+	"github.com/filecoin-project/index-provider/cardatatransfer"
 	"github.com/filecoin-project/index-provider/metadata"
 	"github.com/filecoin-project/index-provider/supplier"
 	"github.com/ipfs/go-cid"
 )
 
 type carHandler struct {
-	cs *supplier.CarSupplier
+	cs     *supplier.CarSupplier
+	mc     metadata.MetadataContext
+	httpMd *metadata.HTTPRetrievalV1
 }
 
 func (h *carHandler) handleImport(w http.ResponseWriter, r *http.Request) {
@@ -33,38 +38,174 @@ func (h *carHandler) handleImport(w http.ResponseWriter, r *http.Request) {
 	var err error
 	ctx := context.Background()
 
-	md := metadata.Default.New()
-	if err := md.UnmarshalBinary(req.Metadata); err != nil {
-		msg := fmt.Sprintf("failed to unmarshal metadata: %v", err)
-		log.Errorw(msg, "err", err)
+	md := h.mc.New()
+	var metadataFromKey bool
+	switch {
+	case len(req.MetadataJSON) != 0 && len(req.Metadata) != 0:
+		msg := "only one of metadata or metadata_json must be specified"
+		log.Error(msg)
 		http.Error(w, msg, http.StatusBadRequest)
 		return
+	case len(req.MetadataJSON) != 0:
+		if err := json.Unmarshal(req.MetadataJSON, &md); err != nil {
+			msg := fmt.Sprintf("failed to unmarshal metadata: %v", err)
+			log.Errorw(msg, "err", err)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	case len(req.Metadata) == 0 && req.KeyDerivation != "":
+		// The key is not known to the client, which therefore cannot generate the default
+		// metadata from it; generate it once the key is derived instead.
+		metadataFromKey = true
+	default:
+		if err := md.UnmarshalBinary(req.Metadata); err != nil {
+			msg := fmt.Sprintf("failed to unmarshal metadata: %v", err)
+			log.Errorw(msg, "err", err)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !metadataFromKey {
+		if err := md.Validate(); err != nil {
+			log.Errorw("Invalid metadata", "err", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	paths := append([]string{req.Path}, req.Shards...)
+	key := req.Key
+	var putOpts []supplier.PutOption
+	if req.KeyDerivation != "" {
+		derivation := supplier.ContextIDDerivation(req.KeyDerivation)
+		switch {
+		case len(req.Key) != 0:
+			msg := "only one of key or key_derivation must be specified"
+			log.Error(msg)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		case derivation != supplier.ContextIDFromRoots && derivation != supplier.ContextIDFromContent:
+			msg := fmt.Sprintf("unknown key derivation %q; must be one of %q or %q", req.KeyDerivation, supplier.ContextIDFromRoots, supplier.ContextIDFromContent)
+			log.Error(msg)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		if key, err = h.cs.DeriveContextID(ctx, derivation, paths); err != nil {
+			msg := fmt.Sprintf("failed to derive key: %v", err)
+			status := http.StatusInternalServerError
+			if errors.Is(err, supplier.ErrInvalidCar) {
+				status = http.StatusBadRequest
+			}
+			log.Errorw(msg, "err", err, "path", req.Path)
+			http.Error(w, msg, status)
+			return
+		}
+		putOpts = append(putOpts, supplier.WithDerivedContextID(derivation))
+	}
+	var piece supplier.PieceInfo
+	if req.ComputePieceCID {
+		if len(req.Shards) != 0 {
+			msg := "piece CID can only be computed for a single CAR"
+			log.Error(msg)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		if piece, err = h.cs.ComputePiece(ctx, req.Path); err != nil {
+			msg := fmt.Sprintf("failed to compute piece CID: %v", err)
+			status := http.StatusInternalServerError
+			if errors.Is(err, supplier.ErrInvalidCar) {
+				status = http.StatusBadRequest
+			}
+			log.Errorw(msg, "err", err, "path", req.Path)
+			http.Error(w, msg, status)
+			return
+		}
+		if md, err = h.withPieceCID(md, piece.PieceCID); err != nil {
+			msg := fmt.Sprintf("failed to generate metadata from piece CID: %v", err)
+			log.Errorw(msg, "err", err)
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+		// The metadata that would be generated from the key is superseded by the piece CID.
+		metadataFromKey = false
+	}
+	if metadataFromKey {
+		tp, err := cardatatransfer.TransportFromContextID(key)
+		if err != nil {
+			msg := fmt.Sprintf("failed to generate metadata from key: %v", err)
+			log.Errorw(msg, "err", err)
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+		md = h.mc.New(tp)
 	}
+	md = withHTTPRetrieval(h.mc, md, h.httpMd)
 
 	log.Info("importing CAR")
-	advID, err = h.cs.Put(ctx, req.Key, req.Path, md)
+	advID, err = h.cs.PutShards(ctx, key, paths, md, putOpts...)
 
 	// Respond with cause of failure.
 	if err != nil {
+		var dupErr *supplier.DuplicateCarError
+		if errors.As(err, &dupErr) {
+			log.Infow("identical CAR content already imported", "path", req.Path, "contextID", dupErr.ContextID)
+			respond(w, http.StatusOK, &ImportCarRes{Key: dupErr.ContextID, AdvId: dupErr.AdCid, Duplicate: true})
+			return
+		}
 		if err == provider.ErrAlreadyAdvertised {
 			msg := "CAR already advertised"
 			log.Infow(msg, "path", req.Path)
 			http.Error(w, msg, http.StatusConflict)
 			return
 		}
+		if errors.Is(err, supplier.ErrContextIDConflict) {
+			msg := fmt.Sprintf("failed to import CAR: %v", err)
+			log.Infow(msg, "path", req.Path)
+			http.Error(w, msg, http.StatusConflict)
+			return
+		}
+		if errors.As(err, &metadata.ErrInvalidMetadata{}) || errors.Is(err, supplier.ErrInvalidCar) {
+			msg := fmt.Sprintf("failed to import CAR: %v", err)
+			log.Infow(msg, "path", req.Path)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
 		msg := fmt.Sprintf("failed to import CAR: %v", err)
 		log.Errorw(msg, "err", err, "path", req.Path)
 		http.Error(w, msg, http.StatusInternalServerError)
 		return
 	}
 
-	log.Infow("imported CAR successfully", "path", req.Path, "contextID", req.Key)
+	log.Infow("imported CAR successfully", "path", req.Path, "contextID", key)
 
 	// Respond with successful import results.
-	resp := &ImportCarRes{req.Key, advID}
+	resp := &ImportCarRes{Key: key, AdvId: advID, PieceCID: piece.PieceCID, PieceSize: piece.Size}
 	respond(w, http.StatusOK, resp)
 }
 
+// withPieceCID returns the given metadata with its graphsync retrieval protocol referencing the
+// given piece CID. The protocol is added if the metadata has none.
+func (h *carHandler) withPieceCID(md metadata.Metadata, pieceCid cid.Cid) (metadata.Metadata, error) {
+	tp, err := cardatatransfer.TransportFromPieceCID(pieceCid)
+	if err != nil {
+		return metadata.Metadata{}, err
+	}
+	gs := tp.(*metadata.GraphsyncFilecoinV1)
+	protocols := []metadata.Protocol{gs}
+	for _, id := range md.Protocols() {
+		p := md.Get(id)
+		if specified, ok := p.(*metadata.GraphsyncFilecoinV1); ok {
+			// Preserve the deal properties specified by the user.
+			gs.VerifiedDeal = specified.VerifiedDeal
+			gs.FastRetrieval = specified.FastRetrieval
+			continue
+		}
+		protocols = append(protocols, p)
+	}
+	return h.mc.New(protocols...), nil
+}
+
 func (h *carHandler) handleRemove(w http.ResponseWriter, r *http.Request) {
 	log.Info("Received remove CAR request")
 
@@ -109,7 +250,7 @@ func (h *carHandler) handleRemove(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *carHandler) handleList(w http.ResponseWriter, _ *http.Request) {
-	paths, err := h.cs.List(context.Background())
+	entries, err := h.cs.ListEntries(context.Background())
 	if err != nil {
 		err = fmt.Errorf("failed to list CARs %w", err)
 		log.Error(err)
@@ -117,7 +258,18 @@ func (h *carHandler) handleList(w http.ResponseWriter, _ *http.Request) {
 		return
 	}
 	resp := &ListCarRes{
-		Paths: paths,
+		Paths: make([]string, 0, len(entries)),
+		Cars:  make([]CarEntry, 0, len(entries)),
+	}
+	for _, entry := range entries {
+		resp.Paths = append(resp.Paths, entry.Paths...)
+		resp.Cars = append(resp.Cars, CarEntry{
+			Key:       entry.ContextID,
+			Paths:     entry.Paths,
+			Status:    string(entry.Status),
+			Detail:    entry.Detail,
+			CheckedAt: entry.CheckedAt,
+		})
 	}
 	respond(w, http.StatusOK, resp)
 }
@@ -9,10 +9,14 @@ import (
 	"math/rand"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	provider "github.com/filecoin-project/index-provider"
 	"github.com/filecoin-project/index-provider/cardatatransfer"
+	"github.com/filecoin-project/index-provider/engine"
 	"github.com/filecoin-project/index-provider/metadata"
 	mock_provider "github.com/filecoin-project/index-provider/mock"
 	"github.com/filecoin-project/index-provider/supplier"
@@ -21,10 +25,13 @@ import (
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/stretchr/testify/require"
 )
 
+const testCarPath = "../../../testdata/sample-v1.car"
+
 func Test_importCarHandler(t *testing.T) {
 	rng := rand.New(rand.NewSource(1413))
 	wantKey := []byte("lobster")
@@ -38,7 +45,7 @@ func Test_importCarHandler(t *testing.T) {
 	require.NoError(t, err)
 
 	icReq := &ImportCarReq{
-		Path:     "fish",
+		Path:     testCarPath,
 		Key:      wantKey,
 		Metadata: mdBytes,
 	}
@@ -56,7 +63,7 @@ func Test_importCarHandler(t *testing.T) {
 
 	cs := supplier.NewCarSupplier(mockEng, ds)
 
-	subject := carHandler{cs}
+	subject := carHandler{cs: cs, mc: metadata.Default}
 
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(subject.handleImport)
@@ -83,6 +90,328 @@ func Test_importCarHandler(t *testing.T) {
 	require.Equal(t, wantCid, resp.AdvId)
 }
 
+func Test_importCarHandlerWithShards(t *testing.T) {
+	wantKey := []byte("lobster")
+	wantMetadata := metadata.Default.New(&metadata.Bitswap{})
+	mdBytes, err := wantMetadata.MarshalBinary()
+	require.NoError(t, err)
+	wantShard := "../../../testdata/sample-v1-2.car"
+
+	jsonReq, err := json.Marshal(&ImportCarReq{
+		Path:     testCarPath,
+		Shards:   []string{wantShard},
+		Key:      wantKey,
+		Metadata: mdBytes,
+	})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, "/admin/import/car", bytes.NewReader(jsonReq))
+	require.NoError(t, err)
+
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	cs := supplier.NewCarSupplier(mockEng, dssync.MutexWrap(datastore.NewMapDatastore()))
+	subject := carHandler{cs: cs, mc: metadata.Default}
+
+	mockEng.
+		EXPECT().
+		NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(wantKey), gomock.Eq(wantMetadata))
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(subject.handleImport).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	paths, err := cs.List(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{testCarPath, wantShard}, paths)
+}
+
+func Test_importCarHandlerWithKeyDerivation(t *testing.T) {
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	cs := supplier.NewCarSupplier(mockEng, dssync.MutexWrap(datastore.NewMapDatastore()))
+	subject := carHandler{cs: cs, mc: metadata.Default}
+
+	wantKey, err := cs.DeriveContextID(context.Background(), supplier.ContextIDFromContent, []string{testCarPath})
+	require.NoError(t, err)
+	wantTp, err := cardatatransfer.TransportFromContextID(wantKey)
+	require.NoError(t, err)
+	wantCid := testutil.RandomCids(t, rand.New(rand.NewSource(1413)), 1)[0]
+	mockEng.
+		EXPECT().
+		NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(wantKey), gomock.Eq(metadata.Default.New(wantTp))).
+		Return(wantCid, nil)
+
+	importCar := func(req *ImportCarReq) (int, ImportCarRes) {
+		jsonReq, err := json.Marshal(req)
+		require.NoError(t, err)
+		httpReq, err := http.NewRequest(http.MethodPost, "/admin/import/car", bytes.NewReader(jsonReq))
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		http.HandlerFunc(subject.handleImport).ServeHTTP(rr, httpReq)
+		var resp ImportCarRes
+		if rr.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		}
+		return rr.Code, resp
+	}
+
+	// Assert that the key is derived, and that metadata is generated from it when unspecified.
+	code, resp := importCar(&ImportCarReq{Path: testCarPath, KeyDerivation: "content"})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, wantKey, resp.Key)
+	require.Equal(t, wantCid, resp.AdvId)
+	require.False(t, resp.Duplicate)
+
+	// Assert that importing identical content under another derived key returns the existing
+	// import.
+	md := metadata.Default.New(&metadata.Bitswap{})
+	mdBytes, err := md.MarshalBinary()
+	require.NoError(t, err)
+	code, resp = importCar(&ImportCarReq{Path: "../../../testdata/sample-wrapped-v2.car", KeyDerivation: "roots", Metadata: mdBytes})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, wantKey, resp.Key)
+	require.Equal(t, wantCid, resp.AdvId)
+	require.True(t, resp.Duplicate)
+
+	// Assert that importing identical content under a specified key does not detect duplicates.
+	mockEng.
+		EXPECT().
+		NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq([]byte("lobster")), gomock.Eq(md))
+	code, resp = importCar(&ImportCarReq{Path: "../../../testdata/sample-wrapped-v2.car", Key: []byte("lobster"), Metadata: mdBytes})
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, []byte("lobster"), resp.Key)
+	require.False(t, resp.Duplicate)
+
+	code, _ = importCar(&ImportCarReq{Path: testCarPath, KeyDerivation: "fish"})
+	require.Equal(t, http.StatusBadRequest, code)
+	code, _ = importCar(&ImportCarReq{Path: testCarPath, Key: []byte("lobster"), KeyDerivation: "roots"})
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
+func Test_importCarHandlerWithPieceCID(t *testing.T) {
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	cs := supplier.NewCarSupplier(mockEng, dssync.MutexWrap(datastore.NewMapDatastore()))
+	subject := carHandler{cs: cs, mc: metadata.Default}
+
+	piece, err := cs.ComputePiece(context.Background(), testCarPath)
+	require.NoError(t, err)
+	key := []byte("lobster")
+	tp, err := cardatatransfer.TransportFromContextID(key)
+	require.NoError(t, err)
+	tp.(*metadata.GraphsyncFilecoinV1).FastRetrieval = false
+	specified := metadata.Default.New(&metadata.Bitswap{}, tp)
+	mdBytes, err := specified.MarshalBinary()
+	require.NoError(t, err)
+
+	// Assert that the piece CID replaces the one of the specified graphsync metadata, preserving
+	// the other protocols and properties.
+	wantMd := metadata.Default.New(&metadata.Bitswap{}, &metadata.GraphsyncFilecoinV1{PieceCID: piece.PieceCID, VerifiedDeal: true})
+	wantCid := testutil.RandomCids(t, rand.New(rand.NewSource(1413)), 1)[0]
+	mockEng.
+		EXPECT().
+		NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(key), gomock.Eq(wantMd)).
+		Return(wantCid, nil)
+
+	jsonReq, err := json.Marshal(&ImportCarReq{Path: testCarPath, Key: key, Metadata: mdBytes, ComputePieceCID: true})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, "/admin/import/car", bytes.NewReader(jsonReq))
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(subject.handleImport).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp ImportCarRes
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	require.Equal(t, wantCid, resp.AdvId)
+	require.Equal(t, piece.PieceCID, resp.PieceCID)
+	require.Equal(t, piece.Size, resp.PieceSize)
+
+	// Assert that the piece CID is resolvable to the key for retrieval.
+	gotKey, err := cs.ContextIDForPiece(piece.PieceCID)
+	require.NoError(t, err)
+	require.Equal(t, key, gotKey)
+
+	// Assert that piece CIDs are not computed for sharded CARs.
+	jsonReq, err = json.Marshal(&ImportCarReq{Path: testCarPath, Shards: []string{"../../../testdata/sample-v1-2.car"}, Key: key, ComputePieceCID: true})
+	require.NoError(t, err)
+	req, err = http.NewRequest(http.MethodPost, "/admin/import/car", bytes.NewReader(jsonReq))
+	require.NoError(t, err)
+	rr = httptest.NewRecorder()
+	http.HandlerFunc(subject.handleImport).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func Test_importCarHandlerWithMetadataJSON(t *testing.T) {
+	rng := rand.New(rand.NewSource(1413))
+	wantKey := []byte("lobster")
+	wantMetadata := metadata.Default.New(&metadata.Bitswap{}, &metadata.HTTPRetrievalV1{TrustlessCAR: true})
+
+	jsonReq := []byte(`{"path":"../../../testdata/sample-v1.car","key":"bG9ic3Rlcg==","metadata_json":[{"protocol":"transport-bitswap"},{"protocol":"http","trustlessCar":true}]}`)
+	req, err := http.NewRequest(http.MethodPost, "/admin/import/car", bytes.NewReader(jsonReq))
+	require.NoError(t, err)
+
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	cs := supplier.NewCarSupplier(mockEng, ds)
+
+	subject := carHandler{cs: cs, mc: metadata.Default}
+
+	rr := httptest.NewRecorder()
+	handler := http.HandlerFunc(subject.handleImport)
+	wantCid := testutil.RandomCids(t, rng, 1)[0]
+
+	mockEng.
+		EXPECT().
+		NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(wantKey), gomock.Eq(wantMetadata)).
+		Return(wantCid, nil)
+
+	handler.ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp ImportCarRes
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	require.Equal(t, wantCid, resp.AdvId)
+}
+
+func Test_importCarHandlerAddsHTTPRetrievalMetadata(t *testing.T) {
+	gateway := &metadata.HTTPRetrievalV1{URLTemplate: "http://example.com/ipfs/{cid}", TrustlessCAR: true}
+	specified := &metadata.HTTPRetrievalV1{URLTemplate: "https://fish.com/ipfs/{cid}"}
+	tests := []struct {
+		name   string
+		given  metadata.Metadata
+		wantMd metadata.Metadata
+	}{
+		{
+			name:   "Added",
+			given:  metadata.Default.New(&metadata.Bitswap{}),
+			wantMd: metadata.Default.New(&metadata.Bitswap{}, gateway),
+		},
+		{
+			name:   "SpecifiedIsKept",
+			given:  metadata.Default.New(&metadata.Bitswap{}, specified),
+			wantMd: metadata.Default.New(&metadata.Bitswap{}, specified),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wantKey := []byte("lobster")
+			mdBytes, err := tt.given.MarshalBinary()
+			require.NoError(t, err)
+			jsonReq, err := json.Marshal(&ImportCarReq{Path: testCarPath, Key: wantKey, Metadata: mdBytes})
+			require.NoError(t, err)
+			req, err := http.NewRequest(http.MethodPost, "/admin/import/car", bytes.NewReader(jsonReq))
+			require.NoError(t, err)
+
+			mc := gomock.NewController(t)
+			mockEng := mock_provider.NewMockInterface(mc)
+			mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+			cs := supplier.NewCarSupplier(mockEng, dssync.MutexWrap(datastore.NewMapDatastore()))
+			subject := carHandler{cs: cs, mc: metadata.Default, httpMd: gateway}
+
+			mockEng.
+				EXPECT().
+				NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(wantKey), gomock.Eq(tt.wantMd)).
+				Return(testutil.RandomCids(t, rand.New(rand.NewSource(1413)), 1)[0], nil)
+
+			rr := httptest.NewRecorder()
+			http.HandlerFunc(subject.handleImport).ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+		})
+	}
+}
+
+func Test_importCarHandlerWithBothMetadataIsBadRequest(t *testing.T) {
+	jsonReq := []byte(`{"path":"../../../testdata/sample-v1.car","key":"bG9ic3Rlcg==","metadata":"gBI=","metadata_json":[{"protocol":"transport-bitswap"}]}`)
+	req, err := http.NewRequest(http.MethodPost, "/admin/import/car", bytes.NewReader(jsonReq))
+	require.NoError(t, err)
+
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	cs := supplier.NewCarSupplier(mockEng, dssync.MutexWrap(datastore.NewMapDatastore()))
+
+	subject := carHandler{cs: cs, mc: metadata.Default}
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(subject.handleImport).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, "only one of metadata or metadata_json must be specified\n", rr.Body.String())
+}
+
+func Test_importCarHandlerInvalidMetadataIsBadRequest(t *testing.T) {
+	wantKey := []byte("lobster")
+	wantMetadata := metadata.Default.New(&metadata.Bitswap{})
+	mdBytes, err := wantMetadata.MarshalBinary()
+	require.NoError(t, err)
+	jsonReq, err := json.Marshal(&ImportCarReq{Path: testCarPath, Key: wantKey, Metadata: mdBytes})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, "/admin/import/car", bytes.NewReader(jsonReq))
+	require.NoError(t, err)
+
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	cs := supplier.NewCarSupplier(mockEng, dssync.MutexWrap(datastore.NewMapDatastore()))
+	mockEng.
+		EXPECT().
+		NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(wantKey), gomock.Eq(wantMetadata)).
+		Return(cid.Undef, metadata.ErrInvalidMetadata{Message: "fish"})
+
+	subject := carHandler{cs: cs, mc: metadata.Default}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(subject.handleImport).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, "failed to import CAR: storetheindex: invalid metadata: fish\n", rr.Body.String())
+}
+
+func Test_importCarHandlerMetadataIsValidated(t *testing.T) {
+	// The metadata decodes, but is too large to be published.
+	md := metadata.Default.New(&metadata.HTTPRetrievalV1{URLTemplate: strings.Repeat("a", metadata.MaxMetadataLen)})
+	mdBytes, err := md.MarshalBinary()
+	require.NoError(t, err)
+	jsonReq, err := json.Marshal(&ImportCarReq{Path: testCarPath, Key: []byte("lobster"), Metadata: mdBytes})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, "/admin/import/car", bytes.NewReader(jsonReq))
+	require.NoError(t, err)
+
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	cs := supplier.NewCarSupplier(mockEng, dssync.MutexWrap(datastore.NewMapDatastore()))
+
+	subject := carHandler{cs: cs, mc: metadata.Default}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(subject.handleImport).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Equal(t, "storetheindex: invalid metadata: encoded size of 1056 bytes exceeds the maximum of 1024 bytes\n", rr.Body.String())
+}
+
+func Test_importCarHandlerInvalidCarIsBadRequest(t *testing.T) {
+	md := metadata.Default.New(&metadata.Bitswap{})
+	mdBytes, err := md.MarshalBinary()
+	require.NoError(t, err)
+	jsonReq, err := json.Marshal(&ImportCarReq{Path: "car_handler_test.go", Key: []byte("lobster"), Metadata: mdBytes})
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, "/admin/import/car", bytes.NewReader(jsonReq))
+	require.NoError(t, err)
+
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	cs := supplier.NewCarSupplier(mockEng, dssync.MutexWrap(datastore.NewMapDatastore()))
+
+	subject := carHandler{cs: cs, mc: metadata.Default}
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(subject.handleImport).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Contains(t, rr.Body.String(), "failed to import CAR: invalid CAR car_handler_test.go")
+}
+
 func Test_importCarHandlerFail(t *testing.T) {
 	wantKey := []byte("lobster")
 	wantTp, err := cardatatransfer.TransportFromContextID(wantKey)
@@ -91,7 +420,7 @@ func Test_importCarHandlerFail(t *testing.T) {
 	mdBytes, err := wantMetadata.MarshalBinary()
 	require.NoError(t, err)
 	icReq := &ImportCarReq{
-		Path:     "fish",
+		Path:     testCarPath,
 		Key:      wantKey,
 		Metadata: mdBytes,
 	}
@@ -108,7 +437,7 @@ func Test_importCarHandlerFail(t *testing.T) {
 	ds := dssync.MutexWrap(datastore.NewMapDatastore())
 	cs := supplier.NewCarSupplier(mockEng, ds)
 
-	subject := carHandler{cs}
+	subject := carHandler{cs: cs, mc: metadata.Default}
 
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(subject.handleImport)
@@ -135,7 +464,7 @@ func Test_importCarAlreadyAdvertised(t *testing.T) {
 	mdBytes, err := wantMetadata.MarshalBinary()
 	require.NoError(t, err)
 	icReq := &ImportCarReq{
-		Path:     "fish",
+		Path:     testCarPath,
 		Key:      wantKey,
 		Metadata: mdBytes,
 	}
@@ -152,7 +481,7 @@ func Test_importCarAlreadyAdvertised(t *testing.T) {
 	ds := dssync.MutexWrap(datastore.NewMapDatastore())
 	cs := supplier.NewCarSupplier(mockEng, ds)
 
-	subject := carHandler{cs}
+	subject := carHandler{cs: cs, mc: metadata.Default}
 
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(subject.handleImport)
@@ -182,7 +511,7 @@ func Test_removeCarHandler(t *testing.T) {
 	ds := dssync.MutexWrap(datastore.NewMapDatastore())
 	cs := supplier.NewCarSupplier(mockEng, ds)
 
-	subject := carHandler{cs}
+	subject := carHandler{cs: cs, mc: metadata.Default}
 
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(subject.handleRemove)
@@ -218,7 +547,7 @@ func Test_removeCarHandlerFail(t *testing.T) {
 	ds := dssync.MutexWrap(datastore.NewMapDatastore())
 	cs := supplier.NewCarSupplier(mockEng, ds)
 
-	subject := carHandler{cs}
+	subject := carHandler{cs: cs, mc: metadata.Default}
 
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(subject.handleRemove)
@@ -248,7 +577,7 @@ func Test_removeCarHandler_NonExistingCarIsNotFound(t *testing.T) {
 	ds := dssync.MutexWrap(datastore.NewMapDatastore())
 	cs := supplier.NewCarSupplier(mockEng, ds)
 
-	subject := carHandler{cs}
+	subject := carHandler{cs: cs, mc: metadata.Default}
 
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(subject.handleRemove)
@@ -266,7 +595,7 @@ func Test_removeCarHandler_UnspecifiedKeyIsBadRequest(t *testing.T) {
 	ds := dssync.MutexWrap(datastore.NewMapDatastore())
 	cs := supplier.NewCarSupplier(mockEng, ds)
 
-	subject := carHandler{cs}
+	subject := carHandler{cs: cs, mc: metadata.Default}
 
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(subject.handleRemove)
@@ -284,7 +613,7 @@ func Test_removeCarHandler_InvalidJsonIsBadRequest(t *testing.T) {
 	ds := dssync.MutexWrap(datastore.NewMapDatastore())
 	cs := supplier.NewCarSupplier(mockEng, ds)
 
-	subject := carHandler{cs}
+	subject := carHandler{cs: cs, mc: metadata.Default}
 
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(subject.handleRemove)
@@ -317,13 +646,13 @@ func requireMockPut(t *testing.T, mockEng *mock_provider.MockInterface, provider
 		EXPECT().
 		NotifyPut(gomock.Any(), gomock.Eq(provider), gomock.Eq(key), wantMetadata).
 		Return(wantCid, nil)
-	_, err = cs.Put(context.Background(), key, "/fish/in/da/sea", wantMetadata)
+	_, err = cs.Put(context.Background(), key, testCarPath, wantMetadata)
 	require.NoError(t, err)
 }
 
 func Test_ListCarHandler(t *testing.T) {
 	rng := rand.New(rand.NewSource(1413))
-	wantPath := "fish"
+	wantPath := testCarPath
 	wantKey := []byte("lobster")
 	wantTp, err := cardatatransfer.TransportFromContextID(wantKey)
 	require.NoError(t, err)
@@ -337,7 +666,7 @@ func Test_ListCarHandler(t *testing.T) {
 	ds := dssync.MutexWrap(datastore.NewMapDatastore())
 	cs := supplier.NewCarSupplier(mockEng, ds)
 
-	subject := carHandler{cs}
+	subject := carHandler{cs: cs, mc: metadata.Default}
 
 	req, err := http.NewRequest(http.MethodGet, "/admin/list/car", nil)
 	require.NoError(t, err)
@@ -380,4 +709,96 @@ func Test_ListCarHandler(t *testing.T) {
 	require.NoError(t, err)
 	require.Len(t, respAfterPut.Paths, 1)
 	require.Equal(t, wantPath, respAfterPut.Paths[0])
+	require.Len(t, respAfterPut.Cars, 1)
+	require.Equal(t, wantKey, respAfterPut.Cars[0].Key)
+	require.Equal(t, []string{wantPath}, respAfterPut.Cars[0].Paths)
+	require.Equal(t, "ok", respAfterPut.Cars[0].Status)
+}
+
+func Test_ListCarHandlerReportsBrokenCars(t *testing.T) {
+	wantKey := []byte("lobster")
+	wantMetadata := metadata.Default.New(&metadata.Bitswap{})
+	wantPath := filepath.Join(t.TempDir(), "sample-v1.car")
+	testutil.CopyFile(t, testCarPath, wantPath)
+
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	cs := supplier.NewCarSupplier(mockEng, dssync.MutexWrap(datastore.NewMapDatastore()))
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(wantKey), gomock.Eq(wantMetadata))
+	_, err := cs.Put(context.Background(), wantKey, wantPath, wantMetadata)
+	require.NoError(t, err)
+
+	require.NoError(t, os.Remove(wantPath))
+	_, err = cs.Check(context.Background(), wantKey)
+	require.NoError(t, err)
+
+	subject := carHandler{cs: cs, mc: metadata.Default}
+	req, err := http.NewRequest(http.MethodGet, "/admin/list/car", nil)
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(subject.handleList).ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+
+	var resp ListCarRes
+	require.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	require.Len(t, resp.Cars, 1)
+	require.Equal(t, []string{wantPath}, resp.Cars[0].Paths)
+	require.Equal(t, "missing", resp.Cars[0].Status)
+	require.Equal(t, wantPath+" does not exist", resp.Cars[0].Detail)
+	require.False(t, resp.Cars[0].CheckedAt.IsZero())
+}
+
+func TestServer_ImportCarWithHTTPGatewayIsReimportableAndFoundLocally(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	h, err := libp2p.New()
+	require.NoError(t, err)
+	defer h.Close()
+	eng, err := engine.New(engine.WithHost(h), engine.WithLocalIndex(true))
+	require.NoError(t, err)
+	require.NoError(t, eng.Start(ctx))
+	defer eng.Shutdown()
+
+	reg := supplier.NewRegistry(eng)
+	cs := supplier.NewCarSupplier(reg.Engine(), dssync.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, reg.Register(supplier.CarSupplierName, cs))
+	gateway := &metadata.HTTPRetrievalV1{URLTemplate: "http://example.com/ipfs/{cid}", TrustlessCAR: true}
+	subject, err := New(h, h.Peerstore().PrivKey(h.ID()), eng, reg,
+		WithListenAddr("127.0.0.1:0"),
+		WithHTTPRetrievalMetadata(gateway))
+	require.NoError(t, err)
+	go subject.Start()
+	defer subject.Shutdown(ctx)
+
+	// Import with Bitswap and Graphsync metadata, to which the gateway adds HTTP metadata.
+	key := []byte("lobster")
+	gsMd, err := cardatatransfer.TransportFromContextID(key)
+	require.NoError(t, err)
+	wantMd := metadata.Default.New(&metadata.Bitswap{}, gsMd, gateway)
+	givenMd := metadata.Default.New(&metadata.Bitswap{}, gsMd)
+	mdBytes, err := givenMd.MarshalBinary()
+	require.NoError(t, err)
+	jsonReq, err := json.Marshal(&ImportCarReq{Path: testCarPath, Key: key, Metadata: mdBytes})
+	require.NoError(t, err)
+	importCar := func() int {
+		resp, err := http.Post("http://"+subject.l.Addr().String()+"/admin/import/car", "application/json", bytes.NewReader(jsonReq))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+	require.Equal(t, http.StatusOK, importCar())
+
+	// Re-importing decodes the advertised metadata, and is rejected as already advertised.
+	require.Equal(t, http.StatusConflict, importCar())
+
+	// Assert that the content is found locally along with its advertised metadata.
+	carBs := testutil.OpenSampleCar(t, "sample-v1.car")
+	cids, err := carBs.AllKeysChan(ctx)
+	require.NoError(t, err)
+	c := <-cids
+	records, err := eng.FindLocal(ctx, c.Hash())
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, key, records[0].ContextID)
+	require.True(t, wantMd.Equal(records[0].Metadata))
 }
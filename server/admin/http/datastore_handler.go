@@ -0,0 +1,29 @@
+package adminserver
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func (s *Server) gcDatastoreHandler(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received datastore garbage collection request")
+
+	stats, err := s.e.GC(r.Context())
+	if err != nil {
+		msg := fmt.Sprintf("failed to collect garbage: %v", err)
+		log.Errorw(msg, "err", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	log.Infow("Collected garbage successfully", "deletedKeys", stats.DeletedKeys, "reclaimedBytes", stats.ReclaimedBytes())
+
+	resp := &GCDatastoreRes{
+		DeletedKeys:     stats.DeletedKeys,
+		DeletedBytes:    stats.DeletedBytes,
+		DiskUsageBefore: stats.DiskUsageBefore,
+		DiskUsageAfter:  stats.DiskUsageAfter,
+		ReclaimedBytes:  stats.ReclaimedBytes(),
+	}
+	respond(w, http.StatusOK, resp)
+}
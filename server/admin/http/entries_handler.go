@@ -0,0 +1,24 @@
+package adminserver
+
+import (
+	"fmt"
+	"net/http"
+)
+
+func (s *Server) reencodeEntriesHandler(w http.ResponseWriter, r *http.Request) {
+	log.Info("Received re-encode entries request")
+
+	adCids, err := s.e.ReencodeEntries(r.Context())
+	if err != nil {
+		msg := fmt.Sprintf("failed to re-encode entries: %v", err)
+		log.Errorw(msg, "err", err, "published", len(adCids))
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	log.Infow("Re-encoded entries successfully", "published", len(adCids))
+
+	// Respond with successful re-encode result.
+	resp := &ReencodeEntriesRes{AdvIds: adCids}
+	respond(w, http.StatusOK, resp)
+}
@@ -0,0 +1,53 @@
+package adminserver
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/filecoin-project/index-provider/engine"
+	"github.com/gorilla/mux"
+	"github.com/multiformats/go-multihash"
+)
+
+func (s *Server) findLocalHandler(w http.ResponseWriter, r *http.Request) {
+	mhVar := mux.Vars(r)["multihash"]
+	mh, err := multihash.FromB58String(mhVar)
+	if err != nil {
+		msg := fmt.Sprintf("invalid multihash: %v", err)
+		log.Errorw(msg, "err", err, "multihash", mhVar)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+
+	records, err := s.e.FindLocal(r.Context(), mh)
+	if err != nil {
+		if err == engine.ErrLocalIndexDisabled {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		msg := fmt.Sprintf("failed to find multihash locally: %v", err)
+		log.Errorw(msg, "err", err, "multihash", mhVar)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	resp := &FindLocalRes{
+		Multihash: mh,
+		Results:   make([]FindLocalResult, 0, len(records)),
+	}
+	for _, record := range records {
+		mdBytes, err := record.Metadata.MarshalBinary()
+		if err != nil {
+			msg := fmt.Sprintf("failed to marshal metadata: %v", err)
+			log.Errorw(msg, "err", err, "multihash", mhVar)
+			http.Error(w, msg, http.StatusInternalServerError)
+			return
+		}
+		resp.Results = append(resp.Results, FindLocalResult{
+			Provider:  record.Provider,
+			ContextID: record.ContextID,
+			Metadata:  mdBytes,
+		})
+	}
+	respond(w, http.StatusOK, resp)
+}
@@ -11,6 +11,12 @@ var (
 	_ io.ReaderFrom = (*ImportCarRes)(nil)
 	_ io.ReaderFrom = (*RemoveCarReq)(nil)
 	_ io.ReaderFrom = (*RemoveCarRes)(nil)
+	_ io.ReaderFrom = (*ImportReq)(nil)
+	_ io.ReaderFrom = (*ImportRes)(nil)
+	_ io.ReaderFrom = (*RemoveReq)(nil)
+	_ io.ReaderFrom = (*RemoveRes)(nil)
+	_ io.ReaderFrom = (*ListRes)(nil)
+	_ io.ReaderFrom = (*ListSuppliersRes)(nil)
 	_ io.ReaderFrom = (*ConnectReq)(nil)
 	_ io.ReaderFrom = (*ConnectRes)(nil)
 
@@ -18,6 +24,12 @@ var (
 	_ io.WriterTo = (*ImportCarRes)(nil)
 	_ io.WriterTo = (*RemoveCarReq)(nil)
 	_ io.WriterTo = (*RemoveCarRes)(nil)
+	_ io.WriterTo = (*ImportReq)(nil)
+	_ io.WriterTo = (*ImportRes)(nil)
+	_ io.WriterTo = (*RemoveReq)(nil)
+	_ io.WriterTo = (*RemoveRes)(nil)
+	_ io.WriterTo = (*ListRes)(nil)
+	_ io.WriterTo = (*ListSuppliersRes)(nil)
 	_ io.WriterTo = (*ConnectReq)(nil)
 	_ io.WriterTo = (*ConnectRes)(nil)
 )
@@ -62,6 +74,54 @@ func (er *ListCarRes) ReadFrom(r io.Reader) (int64, error) {
 	return unmarshalAsJson(r, er)
 }
 
+func (er *ImportReq) WriteTo(w io.Writer) (int64, error) {
+	return marshalToJson(w, er)
+}
+
+func (er *ImportReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, er)
+}
+
+func (er *ImportRes) WriteTo(w io.Writer) (int64, error) {
+	return marshalToJson(w, er)
+}
+
+func (er *ImportRes) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, er)
+}
+
+func (er *RemoveReq) WriteTo(w io.Writer) (int64, error) {
+	return marshalToJson(w, er)
+}
+
+func (er *RemoveReq) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, er)
+}
+
+func (er *RemoveRes) WriteTo(w io.Writer) (int64, error) {
+	return marshalToJson(w, er)
+}
+
+func (er *RemoveRes) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, er)
+}
+
+func (er *ListRes) WriteTo(w io.Writer) (int64, error) {
+	return marshalToJson(w, er)
+}
+
+func (er *ListRes) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, er)
+}
+
+func (er *ListSuppliersRes) WriteTo(w io.Writer) (int64, error) {
+	return marshalToJson(w, er)
+}
+
+func (er *ListSuppliersRes) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, er)
+}
+
 func (er *ConnectReq) WriteTo(w io.Writer) (int64, error) {
 	return marshalToJson(w, er)
 }
@@ -78,6 +138,30 @@ func (er *ConnectRes) ReadFrom(r io.Reader) (int64, error) {
 	return unmarshalAsJson(r, er)
 }
 
+func (er *ReencodeEntriesRes) WriteTo(w io.Writer) (int64, error) {
+	return marshalToJson(w, er)
+}
+
+func (er *ReencodeEntriesRes) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, er)
+}
+
+func (er *GCDatastoreRes) WriteTo(w io.Writer) (int64, error) {
+	return marshalToJson(w, er)
+}
+
+func (er *GCDatastoreRes) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, er)
+}
+
+func (er *FindLocalRes) WriteTo(w io.Writer) (int64, error) {
+	return marshalToJson(w, er)
+}
+
+func (er *FindLocalRes) ReadFrom(r io.Reader) (int64, error) {
+	return unmarshalAsJson(r, er)
+}
+
 func (er *AnnounceRes) WriteTo(w io.Writer) (int64, error) {
 	return marshalToJson(w, er)
 }
@@ -1,7 +1,12 @@
 package adminserver
 
 import (
+	"encoding/json"
+	"time"
+
 	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
 )
 
 type (
@@ -17,12 +22,26 @@ type (
 type (
 	// ImportCarReq represents a request for importing a CAR file.
 	ImportCarReq struct {
-		// The path to the CAR file
+		// The path to the CAR file, or its http(s):// URL if it is served remotely.
 		Path string `json:"path"`
+		// The optional paths to additional CAR files, i.e. shards, whose content is advertised
+		// along with the CAR file at Path under the same key.
+		Shards []string `json:"shards,omitempty"`
 		// The optional key associated to the CAR. If not provided, one will be generated.
 		Key []byte `json:"key"`
-		// The optional metadata.
+		// The optional way in which the key is derived from the content of the CAR instead, as an
+		// alternative to Key; one of "roots" or "content".
+		// See: supplier.ContextIDDerivation.
+		KeyDerivation string `json:"key_derivation,omitempty"`
+		// The optional metadata in binary form.
 		Metadata []byte `json:"metadata"`
+		// The optional metadata in human-readable JSON form, as an alternative to Metadata.
+		// See: metadata.Metadata.MarshalJSON.
+		MetadataJSON json.RawMessage `json:"metadata_json,omitempty"`
+		// Whether to compute the piece commitment of the CAR, i.e. its CommP once padded to a
+		// power-of-two piece size, and advertise it as the piece CID of the graphsync retrieval
+		// metadata. Only supported for a CAR without shards.
+		ComputePieceCID bool `json:"compute_piece_cid,omitempty"`
 	}
 	// ImportCarRes represents the response to an ImportCarReq.
 	ImportCarRes struct {
@@ -30,6 +49,13 @@ type (
 		Key []byte `json:"key"`
 		// The CID of the advertisement generated as a result of import.
 		AdvId cid.Cid `json:"adv_id"`
+		// Whether identical CAR content was already imported, in which case no advertisement is
+		// generated, and Key and AdvId are those of the existing import.
+		Duplicate bool `json:"duplicate,omitempty"`
+		// The piece CID of the CAR, if computed as requested by ImportCarReq.ComputePieceCID.
+		PieceCID cid.Cid `json:"piece_cid"`
+		// The padded size of the piece identified by PieceCID.
+		PieceSize uint64 `json:"piece_size,omitempty"`
 	}
 )
 
@@ -51,6 +77,112 @@ type (
 	ListCarRes struct {
 		// The path of CARs imported.
 		Paths []string `json:"paths"`
+		// The CARs imported along with their integrity status.
+		Cars []CarEntry `json:"cars"`
+	}
+	// CarEntry describes an imported CAR along with its integrity status.
+	CarEntry struct {
+		// The key associated to the CAR.
+		Key []byte `json:"key"`
+		// The paths to the CAR files; more than one if the key spans multiple CAR shards.
+		Paths []string `json:"paths"`
+		// The integrity status of the CAR as of its last check; one of "unchecked", "ok",
+		// "missing" or "modified".
+		Status string `json:"status"`
+		// The reason for which the CAR is broken, if it is.
+		Detail string `json:"detail,omitempty"`
+		// The time at which the CAR was last checked, or zero if it never was.
+		CheckedAt time.Time `json:"checked_at"`
+	}
+)
+
+type (
+	// ImportReq represents a request for importing content via the supplier named in the request
+	// path, e.g. "unixfs".
+	ImportReq struct {
+		// The path to the content, as interpreted by the supplier.
+		Path string `json:"path"`
+		// The key associated to the content.
+		Key []byte `json:"key"`
+		// The optional metadata in binary form.
+		Metadata []byte `json:"metadata"`
+		// The optional metadata in human-readable JSON form, as an alternative to Metadata.
+		// See: metadata.Metadata.MarshalJSON.
+		MetadataJSON json.RawMessage `json:"metadata_json,omitempty"`
+	}
+	// ImportRes represents the response to an ImportReq.
+	ImportRes struct {
+		// The key associated to the imported content.
+		Key []byte `json:"key"`
+		// The CID of the advertisement generated as a result of import.
+		AdvId cid.Cid `json:"adv_id"`
+	}
+	// RemoveReq represents a request for removing content via the supplier named in the request
+	// path.
+	RemoveReq struct {
+		// The key associated to the content.
+		Key []byte `json:"key"`
+	}
+	// RemoveRes represents the response to a RemoveReq.
+	RemoveRes struct {
+		// The CID of the advertisement generated as a result of removal.
+		AdvId cid.Cid `json:"adv_id"`
+	}
+	// ListRes represents the response to listing the content of the supplier named in the request
+	// path.
+	ListRes struct {
+		// The paths of the content imported.
+		Paths []string `json:"paths"`
+	}
+	// ListSuppliersRes represents the response to listing the registered suppliers.
+	ListSuppliersRes struct {
+		// The names of the registered suppliers.
+		Names []string `json:"names"`
+	}
+)
+
+type (
+	// ReencodeEntriesRes represents the response to a request for re-encoding advertisement
+	// entries in the format configured on the provider.
+	ReencodeEntriesRes struct {
+		// The CIDs of advertisements published as a result of re-encoding, in order of publication.
+		AdvIds []cid.Cid `json:"adv_ids"`
+	}
+)
+
+type (
+	// GCDatastoreRes represents the response to a request for collecting garbage in the provider
+	// datastore.
+	GCDatastoreRes struct {
+		// The number of datastore keys deleted.
+		DeletedKeys int `json:"deleted_keys"`
+		// The total size of the deleted datastore keys and values.
+		DeletedBytes uint64 `json:"deleted_bytes"`
+		// The disk usage of the datastore before garbage collection, if reported by the datastore.
+		DiskUsageBefore uint64 `json:"disk_usage_before"`
+		// The disk usage of the datastore after garbage collection, if reported by the datastore.
+		DiskUsageAfter uint64 `json:"disk_usage_after"`
+		// The number of bytes reclaimed by garbage collection.
+		ReclaimedBytes uint64 `json:"reclaimed_bytes"`
+	}
+)
+
+type (
+	// FindLocalRes represents the response to a local lookup of a multihash.
+	FindLocalRes struct {
+		// The multihash looked up.
+		Multihash multihash.Multihash `json:"multihash"`
+		// The provider and context IDs under which the multihash is advertised.
+		Results []FindLocalResult `json:"results"`
+	}
+	// FindLocalResult represents a provider and context ID under which a multihash is advertised.
+	FindLocalResult struct {
+		// The ID of the provider that advertises the multihash.
+		Provider peer.ID `json:"provider"`
+		// The context ID under which the multihash is advertised.
+		ContextID []byte `json:"context_id"`
+		// The metadata advertised for the provider and context ID.
+		Metadata []byte `json:"metadata"`
 	}
 )
 
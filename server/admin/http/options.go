@@ -1,6 +1,10 @@
 package adminserver
 
-import "time"
+import (
+	"time"
+
+	"github.com/filecoin-project/index-provider/metadata"
+)
 
 type (
 	// Option captures a configurable parameter in admin HTTP server.
@@ -10,6 +14,8 @@ type (
 		listenAddr   string
 		readTimeout  time.Duration
 		writeTimeout time.Duration
+		mdContext    metadata.MetadataContext
+		httpMd       *metadata.HTTPRetrievalV1
 	}
 )
 
@@ -18,6 +24,7 @@ func newOptions(o ...Option) (*options, error) {
 		listenAddr:   "0.0.0.0:3102",
 		readTimeout:  30 * time.Second,
 		writeTimeout: 30 * time.Second,
+		mdContext:    metadata.Default,
 	}
 
 	for _, apply := range o {
@@ -54,3 +61,24 @@ func WithWriteTimeout(t time.Duration) Option {
 		return nil
 	}
 }
+
+// WithMetadataContext sets the context used to decode the metadata of import requests, which must
+// include any custom protocols accepted by the server.
+// If unset, metadata.Default is used.
+func WithMetadataContext(mc metadata.MetadataContext) Option {
+	return func(o *options) error {
+		o.mdContext = mc
+		return nil
+	}
+}
+
+// WithHTTPRetrievalMetadata sets the HTTP retrieval protocol added to the metadata of all imported
+// content, unless the metadata of an import request already specifies one, e.g. so that content is
+// advertised as retrievable from the gateway of the provider.
+// If unset, the metadata of import requests is used as is.
+func WithHTTPRetrievalMetadata(md *metadata.HTTPRetrievalV1) Option {
+	return func(o *options) error {
+		o.httpMd = md
+		return nil
+	}
+}
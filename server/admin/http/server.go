@@ -2,19 +2,20 @@ package adminserver
 
 import (
 	"context"
-	"errors"
 	"net"
 	"net/http"
 	"sync"
 
 	provider "github.com/filecoin-project/index-provider"
 	"github.com/filecoin-project/index-provider/engine"
+	"github.com/filecoin-project/index-provider/metadata"
 	"github.com/filecoin-project/index-provider/supplier"
 	"github.com/gorilla/mux"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/libp2p/go-libp2p/core/crypto"
 	"github.com/libp2p/go-libp2p/core/host"
 	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multicodec"
 	"github.com/multiformats/go-multihash"
 )
 
@@ -29,7 +30,10 @@ type Server struct {
 	e      *engine.Engine
 }
 
-func New(h host.Host, priv crypto.PrivKey, e *engine.Engine, cs *supplier.CarSupplier, o ...Option) (*Server, error) {
+// New instantiates a new admin server that imports, removes and lists content via the suppliers
+// in the given registry. The CAR specific endpoints are only served if a supplier.CarSupplier is
+// registered as supplier.CarSupplierName.
+func New(h host.Host, priv crypto.PrivKey, e *engine.Engine, reg *supplier.Registry, o ...Option) (*Server, error) {
 	mhsByCtxId = sync.Map{}
 
 	opts, err := newOptions(o...)
@@ -50,10 +54,12 @@ func New(h host.Host, priv crypto.PrivKey, e *engine.Engine, cs *supplier.CarSup
 	}
 	s := &Server{server, priv, l, h, e}
 
+	// List the multihashes of random advertisements, and those of any other context ID via the
+	// registered suppliers.
 	s.e.RegisterMultihashLister(func(ctx context.Context, providerID peer.ID, contextID []byte) (provider.MultihashIterator, error) {
 		mhs, ok := mhsByCtxId.Load(string(contextID))
 		if !ok {
-			return nil, errors.New("unknown context id")
+			return reg.ListMultihashes(ctx, providerID, contextID)
 		}
 		return provider.SliceMultihashIterator(mhs.([]multihash.Multihash)), nil
 	})
@@ -68,24 +74,67 @@ func New(h host.Host, priv crypto.PrivKey, e *engine.Engine, cs *supplier.CarSup
 		Methods(http.MethodPost).
 		Headers("Content-Type", "application/json")
 
-	cHandler := &carHandler{cs}
-	r.HandleFunc("/admin/import/car", cHandler.handleImport).
+	// The CAR specific endpoints take precedence over the generic ones, since they are registered
+	// first.
+	if s, err := reg.Get(supplier.CarSupplierName); err == nil {
+		if cs, ok := s.(*supplier.CarSupplier); ok {
+			cHandler := &carHandler{cs, opts.mdContext, opts.httpMd}
+			r.HandleFunc("/admin/import/car", cHandler.handleImport).
+				Methods(http.MethodPost).
+				Headers("Content-Type", "application/json")
+
+			r.HandleFunc("/admin/remove/car", cHandler.handleRemove).
+				Methods(http.MethodPost).
+				Headers("Content-Type", "application/json")
+
+			r.HandleFunc("/admin/list/car", cHandler.handleList).
+				Methods(http.MethodGet)
+		}
+	}
+
+	sHandler := &supplierHandler{reg, opts.mdContext, opts.httpMd}
+	r.HandleFunc("/admin/suppliers", sHandler.handleListSuppliers).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/import/{supplier}", sHandler.handleImport).
 		Methods(http.MethodPost).
 		Headers("Content-Type", "application/json")
 
-	r.HandleFunc("/admin/remove/car", cHandler.handleRemove).
+	r.HandleFunc("/admin/remove/{supplier}", sHandler.handleRemove).
 		Methods(http.MethodPost).
 		Headers("Content-Type", "application/json")
 
-	r.HandleFunc("/admin/list/car", cHandler.handleList).
+	r.HandleFunc("/admin/list/{supplier}", sHandler.handleList).
 		Methods(http.MethodGet)
 
+	r.HandleFunc("/admin/datastore/gc", s.gcDatastoreHandler).
+		Methods(http.MethodPost)
+
+	r.HandleFunc("/admin/find/{multihash}", s.findLocalHandler).
+		Methods(http.MethodGet)
+
+	r.HandleFunc("/admin/entries/reencode", s.reencodeEntriesHandler).
+		Methods(http.MethodPost)
+
 	r.HandleFunc("/admin/randomAd", s.randomAdHandler).
 		Methods(http.MethodPost)
 
 	return s, nil
 }
 
+// withHTTPRetrieval returns the given metadata with the given HTTP retrieval protocol added, unless
+// it is nil or the metadata already includes one.
+func withHTTPRetrieval(mc metadata.MetadataContext, md metadata.Metadata, httpMd *metadata.HTTPRetrievalV1) metadata.Metadata {
+	if httpMd == nil || md.Get(multicodec.Http) != nil {
+		return md
+	}
+	protocols := []metadata.Protocol{httpMd}
+	for _, id := range md.Protocols() {
+		protocols = append(protocols, md.Get(id))
+	}
+	return mc.New(protocols...)
+}
+
 func (s *Server) Start() error {
 	log.Infow("admin http server listening", "addr", s.l.Addr())
 	return s.server.Serve(s.l)
@@ -0,0 +1,172 @@
+package adminserver
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	provider "github.com/filecoin-project/index-provider"
+	"github.com/filecoin-project/index-provider/metadata"
+	"github.com/filecoin-project/index-provider/supplier"
+	"github.com/gorilla/mux"
+)
+
+// supplierHandler handles the import, removal and listing of content via any supplier in the
+// registry, named by the "supplier" variable of the request path.
+type supplierHandler struct {
+	reg    *supplier.Registry
+	mc     metadata.MetadataContext
+	httpMd *metadata.HTTPRetrievalV1
+}
+
+// supplier returns the supplier named in the request path, or responds with 404 if there is none.
+func (h *supplierHandler) supplier(w http.ResponseWriter, r *http.Request) (supplier.Supplier, bool) {
+	name := mux.Vars(r)["supplier"]
+	s, err := h.reg.Get(name)
+	if err != nil {
+		log.Errorw("Unknown supplier", "name", name)
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	return s, true
+}
+
+func (h *supplierHandler) handleListSuppliers(w http.ResponseWriter, _ *http.Request) {
+	respond(w, http.StatusOK, &ListSuppliersRes{Names: h.reg.Names()})
+}
+
+func (h *supplierHandler) handleImport(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.supplier(w, r)
+	if !ok {
+		return
+	}
+	log := log.With("supplier", mux.Vars(r)["supplier"])
+	log.Info("Received import request")
+
+	var req ImportReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		log.Errorw(msg, "err", err)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if len(req.Key) == 0 {
+		http.Error(w, "key must be specified", http.StatusBadRequest)
+		return
+	}
+	if req.Path == "" {
+		http.Error(w, "path must be specified", http.StatusBadRequest)
+		return
+	}
+
+	md := h.mc.New()
+	switch {
+	case len(req.MetadataJSON) != 0 && len(req.Metadata) != 0:
+		msg := "only one of metadata or metadata_json must be specified"
+		log.Error(msg)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	case len(req.MetadataJSON) != 0:
+		if err := json.Unmarshal(req.MetadataJSON, &md); err != nil {
+			msg := fmt.Sprintf("failed to unmarshal metadata: %v", err)
+			log.Errorw(msg, "err", err)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	default:
+		if err := md.UnmarshalBinary(req.Metadata); err != nil {
+			msg := fmt.Sprintf("failed to unmarshal metadata: %v", err)
+			log.Errorw(msg, "err", err)
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := md.Validate(); err != nil {
+		log.Errorw("Invalid metadata", "err", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	md = withHTTPRetrieval(h.mc, md, h.httpMd)
+
+	advID, err := s.Put(context.Background(), req.Key, req.Path, md)
+	if err != nil {
+		if err == provider.ErrAlreadyAdvertised {
+			msg := "content already advertised"
+			log.Infow(msg, "path", req.Path)
+			http.Error(w, msg, http.StatusConflict)
+			return
+		}
+		msg := fmt.Sprintf("failed to import content: %v", err)
+		status := http.StatusInternalServerError
+		if errors.As(err, &metadata.ErrInvalidMetadata{}) || errors.Is(err, supplier.ErrInvalidCar) {
+			status = http.StatusBadRequest
+		}
+		log.Errorw(msg, "err", err, "path", req.Path)
+		http.Error(w, msg, status)
+		return
+	}
+
+	log.Infow("Imported content successfully", "path", req.Path, "contextID", req.Key)
+	respond(w, http.StatusOK, &ImportRes{Key: req.Key, AdvId: advID})
+}
+
+func (h *supplierHandler) handleRemove(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.supplier(w, r)
+	if !ok {
+		return
+	}
+	log := log.With("supplier", mux.Vars(r)["supplier"])
+	log.Info("Received remove request")
+
+	var req RemoveReq
+	if _, err := req.ReadFrom(r.Body); err != nil {
+		msg := fmt.Sprintf("failed to unmarshal request: %v", err)
+		log.Errorw(msg, "err", err)
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if len(req.Key) == 0 {
+		http.Error(w, "key must be specified", http.StatusBadRequest)
+		return
+	}
+
+	b64Key := base64.StdEncoding.EncodeToString(req.Key)
+	advID, err := s.Remove(context.Background(), req.Key)
+	if err != nil {
+		if err == supplier.ErrNotFound {
+			msg := fmt.Sprintf("supplier has no content for key %s", b64Key)
+			log.Error(msg)
+			http.Error(w, msg, http.StatusNotFound)
+			return
+		}
+		msg := fmt.Sprintf("failed to remove content: %v", err)
+		log.Errorw(msg, "err", err, "key", b64Key)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	log.Infow("Removed content successfully", "key", b64Key)
+	respond(w, http.StatusOK, &RemoveRes{AdvId: advID})
+}
+
+func (h *supplierHandler) handleList(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.supplier(w, r)
+	if !ok {
+		return
+	}
+	paths, err := s.List(context.Background())
+	if err != nil {
+		msg := fmt.Sprintf("failed to list content: %v", err)
+		log.Errorw(msg, "err", err)
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+	if paths == nil {
+		paths = []string{}
+	}
+	respond(w, http.StatusOK, &ListRes{Paths: paths})
+}
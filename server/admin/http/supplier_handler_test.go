@@ -0,0 +1,97 @@
+package adminserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/index-provider/metadata"
+	mock_provider "github.com/filecoin-project/index-provider/mock"
+	"github.com/filecoin-project/index-provider/supplier"
+	"github.com/filecoin-project/index-provider/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/gorilla/mux"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_supplierHandler(t *testing.T) {
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	reg := supplier.NewRegistry(mockEng)
+	us, err := supplier.NewUnixFSSupplier(reg.Engine(), dssync.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, err)
+	require.NoError(t, reg.Register(supplier.UnixFSSupplierName, us))
+
+	r := mux.NewRouter()
+	subject := &supplierHandler{reg: reg, mc: metadata.Default}
+	r.HandleFunc("/admin/suppliers", subject.handleListSuppliers).Methods(http.MethodGet)
+	r.HandleFunc("/admin/import/{supplier}", subject.handleImport).Methods(http.MethodPost)
+	r.HandleFunc("/admin/remove/{supplier}", subject.handleRemove).Methods(http.MethodPost)
+	r.HandleFunc("/admin/list/{supplier}", subject.handleList).Methods(http.MethodGet)
+	serve := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		var b []byte
+		if body != nil {
+			b, err = json.Marshal(body)
+			require.NoError(t, err)
+		}
+		req, err := http.NewRequest(method, path, bytes.NewReader(b))
+		require.NoError(t, err)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := serve(http.MethodGet, "/admin/suppliers", nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var suppliers ListSuppliersRes
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &suppliers))
+	require.Equal(t, []string{"unixfs"}, suppliers.Names)
+
+	file := filepath.Join(t.TempDir(), "fish.txt")
+	require.NoError(t, os.WriteFile(file, []byte("lobster"), 0666))
+	key := []byte("fish")
+	md := metadata.Default.New(&metadata.Bitswap{})
+	mdBytes, err := md.MarshalBinary()
+	require.NoError(t, err)
+	wantCid := testutil.RandomCids(t, rand.New(rand.NewSource(1413)), 1)[0]
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(key), gomock.Eq(md)).Return(wantCid, nil)
+
+	rr = serve(http.MethodPost, "/admin/import/unixfs", &ImportReq{Path: file, Key: key, Metadata: mdBytes})
+	require.Equal(t, http.StatusOK, rr.Code)
+	var importRes ImportRes
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &importRes))
+	require.Equal(t, key, importRes.Key)
+	require.Equal(t, wantCid, importRes.AdvId)
+
+	rr = serve(http.MethodPost, "/admin/import/unixfs", &ImportReq{Path: file, Key: key, Metadata: mdBytes})
+	require.Equal(t, http.StatusConflict, rr.Code)
+	rr = serve(http.MethodPost, "/admin/import/unixfs", &ImportReq{Path: file, Metadata: mdBytes})
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = serve(http.MethodPost, "/admin/import/fish", &ImportReq{Path: file, Key: key, Metadata: mdBytes})
+	require.Equal(t, http.StatusNotFound, rr.Code)
+
+	rr = serve(http.MethodGet, "/admin/list/unixfs", nil)
+	require.Equal(t, http.StatusOK, rr.Code)
+	var listRes ListRes
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &listRes))
+	require.Equal(t, []string{file}, listRes.Paths)
+
+	mockEng.EXPECT().NotifyRemove(gomock.Any(), peer.ID(""), gomock.Eq(key)).Return(wantCid, nil)
+	rr = serve(http.MethodPost, "/admin/remove/unixfs", &RemoveReq{Key: key})
+	require.Equal(t, http.StatusOK, rr.Code)
+	var removeRes RemoveRes
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &removeRes))
+	require.Equal(t, wantCid, removeRes.AdvId)
+
+	rr = serve(http.MethodPost, "/admin/remove/unixfs", &RemoveReq{Key: key})
+	require.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,85 @@
+package bitswapserver
+
+import (
+	"fmt"
+)
+
+type (
+	// Option captures a configurable parameter in the Bitswap server.
+	Option func(*options) error
+
+	options struct {
+		maxBlocksPerSecondPerPeer  float64
+		burstPerPeer               int
+		taskWorkerCount            int
+		maxOutstandingBytesPerPeer int
+	}
+)
+
+func newOptions(o ...Option) (*options, error) {
+	opts := &options{
+		maxBlocksPerSecondPerPeer:  1000,
+		burstPerPeer:               2000,
+		taskWorkerCount:            8,
+		maxOutstandingBytesPerPeer: 1 << 20,
+	}
+
+	for _, apply := range o {
+		if err := apply(opts); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// WithMaxBlocksPerSecondPerPeer sets the maximum rate at which the wants of each peer are accepted,
+// in blocks per second, counting both want-have and want-block entries. Wants beyond the rate are
+// answered with DONT_HAVE, if the peer asked for it, or ignored. Zero disables rate limiting.
+// If unset, the default of 1000 blocks per second is used.
+func WithMaxBlocksPerSecondPerPeer(rate float64) Option {
+	return func(o *options) error {
+		if rate < 0 {
+			return fmt.Errorf("max blocks per second per peer must not be negative, got %v", rate)
+		}
+		o.maxBlocksPerSecondPerPeer = rate
+		return nil
+	}
+}
+
+// WithBurstPerPeer sets the maximum number of wants of each peer that are accepted at once, beyond
+// the maximum rate set by WithMaxBlocksPerSecondPerPeer.
+// If unset, the default of 2000 blocks is used.
+func WithBurstPerPeer(burst int) Option {
+	return func(o *options) error {
+		if burst < 1 {
+			return fmt.Errorf("burst per peer must be at least 1, got %d", burst)
+		}
+		o.burstPerPeer = burst
+		return nil
+	}
+}
+
+// WithTaskWorkerCount sets the number of workers that send blocks to peers.
+// If unset, the default of 8 workers is used.
+func WithTaskWorkerCount(count int) Option {
+	return func(o *options) error {
+		if count < 1 {
+			return fmt.Errorf("task worker count must be at least 1, got %d", count)
+		}
+		o.taskWorkerCount = count
+		return nil
+	}
+}
+
+// WithMaxOutstandingBytesPerPeer sets the maximum number of bytes of blocks queued to be sent to
+// each peer at a time, so that no single peer can monopolise the task workers.
+// If unset, the default of 1 MiB is used.
+func WithMaxOutstandingBytesPerPeer(count int) Option {
+	return func(o *options) error {
+		if count < 1 {
+			return fmt.Errorf("max outstanding bytes per peer must be at least 1, got %d", count)
+		}
+		o.maxOutstandingBytesPerPeer = count
+		return nil
+	}
+}
@@ -0,0 +1,130 @@
+package bitswapserver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	bsnet "github.com/ipfs/go-bitswap/network"
+	bsserver "github.com/ipfs/go-bitswap/server"
+	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	logging "github.com/ipfs/go-log/v2"
+	"github.com/libp2p/go-libp2p/core/host"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/protocol"
+	"golang.org/x/time/rate"
+)
+
+var log = logging.Logger("bitswapserver")
+
+// idleLimiterTimeout is the duration after which the rate limiter of a peer that sent no wants is
+// discarded.
+const idleLimiterTimeout = 5 * time.Minute
+
+// Server serves the blocks of a blockstore over Bitswap on a libp2p host. It only answers the
+// wants of peers, and never fetches or provides blocks itself.
+type Server struct {
+	h      host.Host
+	net    bsnet.BitSwapNetwork
+	server *bsserver.Server
+	limits *peerLimits
+}
+
+// New instantiates a new Bitswap server that serves the blocks of the given blockstore on the given
+// host, and starts handling Bitswap streams. The wants of each peer are accepted at a limited rate,
+// configured via the given options.
+//
+// The blockstore is typically supplier.Registry.Blockstore, which serves the blocks of all the
+// supplied context IDs.
+func New(ctx context.Context, h host.Host, bs bstore.Blockstore, o ...Option) (*Server, error) {
+	opts, err := newOptions(o...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{h: h}
+	serverOpts := []bsserver.Option{
+		bsserver.ProvideEnabled(false),
+		bsserver.TaskWorkerCount(opts.taskWorkerCount),
+		bsserver.MaxOutstandingBytesPerPeer(opts.maxOutstandingBytesPerPeer),
+	}
+	if opts.maxBlocksPerSecondPerPeer > 0 {
+		s.limits = newPeerLimits(rate.Limit(opts.maxBlocksPerSecondPerPeer), opts.burstPerPeer)
+		serverOpts = append(serverOpts, bsserver.WithPeerBlockRequestFilter(s.limits.allow))
+	}
+
+	// No content routing is needed, since providing is disabled.
+	s.net = bsnet.NewFromIpfsHost(h, nil)
+	s.server = bsserver.New(ctx, s.net, bs, serverOpts...)
+	s.net.Start(s.server)
+	log.Infow("Bitswap server started", "peerID", h.ID())
+	return s, nil
+}
+
+// Close stops handling Bitswap streams, and shuts down the server.
+func (s *Server) Close() error {
+	for _, p := range []protocol.ID{
+		bsnet.ProtocolBitswap,
+		bsnet.ProtocolBitswapOneOne,
+		bsnet.ProtocolBitswapOneZero,
+		bsnet.ProtocolBitswapNoVers,
+	} {
+		s.h.RemoveStreamHandler(p)
+	}
+	s.net.Stop()
+	return s.server.Close()
+}
+
+// peerLimits limits the rate at which the wants of each peer are accepted.
+type peerLimits struct {
+	limit rate.Limit
+	burst int
+
+	lock      sync.Mutex
+	limiters  map[peer.ID]*peerLimiter
+	lastPrune time.Time
+}
+
+type peerLimiter struct {
+	*rate.Limiter
+	lastSeen time.Time
+}
+
+func newPeerLimits(limit rate.Limit, burst int) *peerLimits {
+	return &peerLimits{
+		limit:     limit,
+		burst:     burst,
+		limiters:  make(map[peer.ID]*peerLimiter),
+		lastPrune: time.Now(),
+	}
+}
+
+// allow reports whether a want of the given peer is accepted. It is a
+// bsserver.PeerBlockRequestFilter.
+func (l *peerLimits) allow(p peer.ID, c cid.Cid) bool {
+	now := time.Now()
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if now.Sub(l.lastPrune) > idleLimiterTimeout {
+		for id, pl := range l.limiters {
+			if now.Sub(pl.lastSeen) > idleLimiterTimeout {
+				delete(l.limiters, id)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	pl, ok := l.limiters[p]
+	if !ok {
+		pl = &peerLimiter{Limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.limiters[p] = pl
+	}
+	pl.lastSeen = now
+	if !pl.AllowN(now, 1) {
+		log.Debugw("Rate limited want", "peer", p, "cid", c)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+package bitswapserver
+
+import (
+	"context"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/index-provider/metadata"
+	mock_provider "github.com/filecoin-project/index-provider/mock"
+	"github.com/filecoin-project/index-provider/supplier"
+	"github.com/filecoin-project/index-provider/testutil"
+	"github.com/golang/mock/gomock"
+	bsclient "github.com/ipfs/go-bitswap/client"
+	bsnet "github.com/ipfs/go-bitswap/network"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/libp2p/go-libp2p/core/routing"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
+)
+
+func TestServerServesSuppliedBlocks(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	reg := supplier.NewRegistry(mockEng)
+	cs := supplier.NewCarSupplier(reg.Engine(), ds)
+	require.NoError(t, reg.Register(supplier.CarSupplierName, cs))
+
+	md := metadata.Default.New(metadata.Bitswap{})
+	contextID := []byte("fish")
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), contextID, md)
+	_, err := cs.Put(ctx, contextID, "../../testdata/sample-wrapped-v2.car", md)
+	require.NoError(t, err)
+
+	serverHost, err := libp2p.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { serverHost.Close() })
+	// Disable rate limiting, since all blocks of the CAR are wanted at once.
+	subject, err := New(ctx, serverHost, reg.Blockstore(), WithMaxBlocksPerSecondPerPeer(0))
+	require.NoError(t, err)
+	t.Cleanup(func() { subject.Close() })
+
+	clientHost, err := libp2p.New()
+	require.NoError(t, err)
+	t.Cleanup(func() { clientHost.Close() })
+	clientNet := bsnet.NewFromIpfsHost(clientHost, noProviders{})
+	client := bsclient.New(ctx, clientNet, bstore.NewBlockstore(dssync.MutexWrap(datastore.NewMapDatastore())))
+	clientNet.Start(client)
+	t.Cleanup(func() {
+		clientNet.Stop()
+		client.Close()
+	})
+	require.NoError(t, clientHost.Connect(ctx, peer.AddrInfo{ID: serverHost.ID(), Addrs: serverHost.Addrs()}))
+
+	carBs := testutil.OpenSampleCar(t, "sample-wrapped-v2.car")
+	keys, err := carBs.AllKeysChan(ctx)
+	require.NoError(t, err)
+	var wantCids []cid.Cid
+	for c := range keys {
+		wantCids = append(wantCids, c)
+	}
+	require.NotEmpty(t, wantCids)
+
+	blks, err := client.GetBlocks(ctx, wantCids)
+	require.NoError(t, err)
+	var got int
+	for blk := range blks {
+		want, err := carBs.Get(ctx, blk.Cid())
+		require.NoError(t, err)
+		require.Equal(t, want.RawData(), blk.RawData())
+		got++
+	}
+	require.Equal(t, len(wantCids), got)
+}
+
+func TestPeerLimitsLimitEachPeerSeparately(t *testing.T) {
+	subject := newPeerLimits(rate.Every(time.Hour), 2)
+	c := testutil.RandomCids(t, rand.New(rand.NewSource(1413)), 1)[0]
+	alice := testutil.NewID(t)
+	bob := testutil.NewID(t)
+
+	require.True(t, subject.allow(alice, c))
+	require.True(t, subject.allow(alice, c))
+	require.False(t, subject.allow(alice, c))
+	require.True(t, subject.allow(bob, c))
+
+	// Assert that limiters of idle peers are discarded.
+	subject.lastPrune = time.Now().Add(-2 * idleLimiterTimeout)
+	subject.limiters[alice].lastSeen = subject.lastPrune
+	require.True(t, subject.allow(bob, c))
+	require.NotContains(t, subject.limiters, alice)
+	require.Contains(t, subject.limiters, bob)
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	h, err := libp2p.New()
+	require.NoError(t, err)
+	defer h.Close()
+	_, err = New(context.Background(), h, nil, WithBurstPerPeer(0))
+	require.Error(t, err)
+}
+
+var _ routing.ContentRouting = noProviders{}
+
+// noProviders is a content routing that finds no providers, so that the Bitswap client only fetches
+// from connected peers.
+type noProviders struct{}
+
+func (noProviders) Provide(context.Context, cid.Cid, bool) error { return nil }
+
+func (noProviders) FindProvidersAsync(context.Context, cid.Cid, int) <-chan peer.AddrInfo {
+	ch := make(chan peer.AddrInfo)
+	close(ch)
+	return ch
+}
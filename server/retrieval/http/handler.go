@@ -0,0 +1,220 @@
+package retrievalserver
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-graphsync/storeutil"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/ipfs/go-unixfsnode"
+	"github.com/ipld/go-car/v2"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime"
+	_ "github.com/ipld/go-ipld-prime/codec/raw"
+	"github.com/ipld/go-ipld-prime/linking"
+	"github.com/ipld/go-ipld-prime/node/basicnode"
+	"github.com/ipld/go-ipld-prime/traversal/selector"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
+)
+
+const (
+	// rawContentType is the media type of raw block responses.
+	rawContentType = "application/vnd.ipld.raw"
+	// carContentType is the media type of CAR responses.
+	carContentType = "application/vnd.ipld.car"
+
+	formatRaw = "raw"
+	formatCar = "car"
+
+	// The values of the dag-scope query parameter, which selects the blocks included in CAR
+	// responses.
+	dagScopeAll    = "all"
+	dagScopeEntity = "entity"
+	dagScopeBlock  = "block"
+)
+
+// handler serves the trustless gateway responses of the blocks in a blockstore.
+type handler struct {
+	bs   bstore.Blockstore
+	lsys ipld.LinkSystem
+}
+
+func newHandler(bs bstore.Blockstore) http.Handler {
+	lsys := storeutil.LinkSystemForBlockstore(bs)
+	unixfsnode.AddUnixFSReificationToLinkSystem(&lsys)
+	h := &handler{bs: bs, lsys: lsys}
+
+	r := mux.NewRouter()
+	r.HandleFunc("/ipfs/{cid}", h.handleGet).Methods(http.MethodGet, http.MethodHead)
+	r.HandleFunc("/ipfs/{cid}/{path:.*}", h.handlePath).Methods(http.MethodGet, http.MethodHead)
+	return r
+}
+
+func (h *handler) handlePath(w http.ResponseWriter, _ *http.Request) {
+	http.Error(w, "content paths are not supported", http.StatusBadRequest)
+}
+
+func (h *handler) handleGet(w http.ResponseWriter, r *http.Request) {
+	root, err := cid.Decode(mux.Vars(r)["cid"])
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid CID: %v", err), http.StatusBadRequest)
+		return
+	}
+	respFormat, err := responseFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotAcceptable)
+		return
+	}
+
+	switch respFormat {
+	case formatRaw:
+		h.serveRaw(w, r, root)
+	case formatCar:
+		h.serveCar(w, r, root)
+	}
+}
+
+func (h *handler) serveRaw(w http.ResponseWriter, r *http.Request, root cid.Cid) {
+	blk, err := h.bs.Get(r.Context(), root)
+	if err != nil {
+		h.handleBlockstoreError(w, root, err)
+		return
+	}
+
+	setImmutableHeaders(w, root)
+	w.Header().Set("Content-Type", rawContentType)
+	w.Header().Set("Content-Length", fmt.Sprint(len(blk.RawData())))
+	w.Header().Set("Etag", fmt.Sprintf(`"%s.raw"`, root))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+	if _, err := w.Write(blk.RawData()); err != nil {
+		log.Debugw("Failed to write raw block response", "cid", root, "err", err)
+	}
+}
+
+func (h *handler) serveCar(w http.ResponseWriter, r *http.Request, root cid.Cid) {
+	query := r.URL.Query()
+	if query.Has("entity-bytes") {
+		http.Error(w, "entity-bytes is not supported", http.StatusBadRequest)
+		return
+	}
+	scope := query.Get("dag-scope")
+	if scope == "" {
+		scope = dagScopeAll
+	}
+	sel, err := dagScopeSelector(scope)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Check the presence of the root block before responding, since errors cannot be signalled
+	// via the status code once the CAR stream has started.
+	has, err := h.bs.Has(r.Context(), root)
+	if err != nil {
+		h.handleBlockstoreError(w, root, err)
+		return
+	}
+	if !has {
+		h.handleBlockstoreError(w, root, format.ErrNotFound{Cid: root})
+		return
+	}
+
+	setImmutableHeaders(w, root)
+	w.Header().Set("Content-Type", carContentType+"; version=1; order=dfs; dups=n")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.car"`, root))
+	w.Header().Set("Etag", fmt.Sprintf(`"%s.car.%s"`, root, scope))
+	w.WriteHeader(http.StatusOK)
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	lsys := h.lsys
+	_, err = car.TraverseV1(r.Context(), &lsys, root, sel, w,
+		car.WithTraversalPrototypeChooser(dagpb.AddSupportToChooser(func(ipld.Link, linking.LinkContext) (ipld.NodePrototype, error) {
+			return basicnode.Prototype.Any, nil
+		})))
+	if err != nil {
+		// The response is truncated, which clients detect since the CAR stream is incomplete.
+		log.Errorw("Failed to stream CAR response", "cid", root, "scope", scope, "err", err)
+	}
+}
+
+func (h *handler) handleBlockstoreError(w http.ResponseWriter, root cid.Cid, err error) {
+	if format.IsNotFound(err) {
+		http.Error(w, fmt.Sprintf("block not found: %s", root), http.StatusNotFound)
+		return
+	}
+	log.Errorw("Failed to read block", "cid", root, "err", err)
+	http.Error(w, fmt.Sprintf("failed to read block: %v", err), http.StatusInternalServerError)
+}
+
+func setImmutableHeaders(w http.ResponseWriter, root cid.Cid) {
+	w.Header().Set("Cache-Control", "public, max-age=29030400, immutable")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Ipfs-Path", "/ipfs/"+root.String())
+}
+
+// responseFormat returns the format of the response requested via the format query parameter, or
+// otherwise via the Accept header. An error is returned if neither requests a supported format,
+// since trustless gateways never respond with deserialized content.
+func responseFormat(r *http.Request) (string, error) {
+	switch f := r.URL.Query().Get("format"); f {
+	case formatRaw, formatCar:
+		return f, nil
+	case "":
+	default:
+		return "", fmt.Errorf("unsupported format: %s", f)
+	}
+
+	for _, accept := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accept))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case rawContentType:
+			return formatRaw, nil
+		case carContentType:
+			// Only CARv1 responses with blocks in depth-first order are supported.
+			if v, ok := params["version"]; ok && v != "1" {
+				continue
+			}
+			if o, ok := params["order"]; ok && o != "dfs" && o != "unk" {
+				continue
+			}
+			return formatCar, nil
+		}
+	}
+	return "", fmt.Errorf("either format query parameter or Accept header must request %s or %s", rawContentType, carContentType)
+}
+
+// dagScopeSelector returns the selector of the blocks included in a CAR response for the given
+// dag-scope:
+//   - block: the root block only.
+//   - entity: the blocks needed to read the root entity, i.e. all blocks of a UnixFS file, or the
+//     root block of a UnixFS directory or any other DAG.
+//   - all: all blocks of the DAG.
+func dagScopeSelector(scope string) (ipld.Node, error) {
+	ssb := builder.NewSelectorSpecBuilder(basicnode.Prototype.Any)
+	var spec builder.SelectorSpec
+	switch scope {
+	case dagScopeBlock:
+		spec = ssb.Matcher()
+	case dagScopeEntity:
+		// Matching UnixFS files reads all of their bytes, which loads all of their blocks.
+		spec = ssb.ExploreInterpretAs("unixfs", ssb.Matcher())
+	case dagScopeAll:
+		spec = ssb.ExploreRecursive(selector.RecursionLimitNone(), ssb.ExploreAll(ssb.ExploreRecursiveEdge()))
+	default:
+		return nil, fmt.Errorf("unsupported dag-scope: %s", scope)
+	}
+	return spec.Node(), nil
+}
@@ -0,0 +1,183 @@
+package retrievalserver
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/filecoin-project/index-provider/metadata"
+	mock_provider "github.com/filecoin-project/index-provider/mock"
+	"github.com/filecoin-project/index-provider/supplier"
+	"github.com/filecoin-project/index-provider/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipld/go-car/v2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandlerServesTrustlessResponses(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	bs := testutil.OpenSampleCar(t, "sample-wrapped-v2.car")
+	roots, err := bs.Roots()
+	require.NoError(t, err)
+	root := roots[0]
+	rootBlk, err := bs.Get(ctx, root)
+	require.NoError(t, err)
+	wantCids := allKeys(t, ctx, bs.AllKeysChan)
+
+	server := httptest.NewServer(newHandler(bs))
+	defer server.Close()
+
+	get := func(method, path, accept string) *http.Response {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		require.NoError(t, err)
+		if accept != "" {
+			req.Header.Set("Accept", accept)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	t.Run("raw", func(t *testing.T) {
+		for _, resp := range []*http.Response{
+			get(http.MethodGet, "/ipfs/"+root.String()+"?format=raw", ""),
+			get(http.MethodGet, "/ipfs/"+root.String(), "application/vnd.ipld.raw"),
+		} {
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, "application/vnd.ipld.raw", resp.Header.Get("Content-Type"))
+			body, err := io.ReadAll(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, rootBlk.RawData(), body)
+			gotCid, err := root.Prefix().Sum(body)
+			require.NoError(t, err)
+			require.Equal(t, root, gotCid)
+		}
+	})
+
+	t.Run("head", func(t *testing.T) {
+		resp := get(http.MethodHead, "/ipfs/"+root.String()+"?format=car", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Contains(t, resp.Header.Get("Content-Type"), "application/vnd.ipld.car")
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.Empty(t, body)
+	})
+
+	for _, tt := range []struct {
+		name       string
+		path       string
+		accept     string
+		wantBlocks int
+	}{
+		{name: "car all", path: "?format=car", wantBlocks: len(wantCids)},
+		{name: "car all via accept", accept: "application/vnd.ipld.car; version=1", wantBlocks: len(wantCids)},
+		{name: "car block", path: "?format=car&dag-scope=block", wantBlocks: 1},
+		{name: "car entity of directory", path: "?format=car&dag-scope=entity", wantBlocks: 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := get(http.MethodGet, "/ipfs/"+root.String()+tt.path, tt.accept)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, "application/vnd.ipld.car; version=1; order=dfs; dups=n", resp.Header.Get("Content-Type"))
+
+			br, err := car.NewBlockReader(resp.Body)
+			require.NoError(t, err)
+			require.Equal(t, []cid.Cid{root}, br.Roots)
+			var got int
+			for {
+				blk, err := br.Next()
+				if err == io.EOF {
+					break
+				}
+				require.NoError(t, err)
+				// Assert that each block is verifiable against its CID.
+				gotCid, err := blk.Cid().Prefix().Sum(blk.RawData())
+				require.NoError(t, err)
+				require.Equal(t, blk.Cid(), gotCid)
+				require.Contains(t, wantCids, blk.Cid())
+				got++
+			}
+			require.Equal(t, tt.wantBlocks, got)
+		})
+	}
+
+	absent := testutil.RandomCids(t, rand.New(rand.NewSource(1413)), 1)[0]
+	for _, tt := range []struct {
+		name       string
+		path       string
+		accept     string
+		wantStatus int
+	}{
+		{name: "absent raw", path: "/ipfs/" + absent.String() + "?format=raw", wantStatus: http.StatusNotFound},
+		{name: "absent car", path: "/ipfs/" + absent.String() + "?format=car", wantStatus: http.StatusNotFound},
+		{name: "invalid cid", path: "/ipfs/fish?format=raw", wantStatus: http.StatusBadRequest},
+		{name: "no format", path: "/ipfs/" + root.String(), accept: "text/html", wantStatus: http.StatusNotAcceptable},
+		{name: "unsupported format", path: "/ipfs/" + root.String() + "?format=tar", wantStatus: http.StatusNotAcceptable},
+		{name: "unsupported car version", path: "/ipfs/" + root.String(), accept: "application/vnd.ipld.car; version=2", wantStatus: http.StatusNotAcceptable},
+		{name: "unsupported dag-scope", path: "/ipfs/" + root.String() + "?format=car&dag-scope=fish", wantStatus: http.StatusBadRequest},
+		{name: "path", path: "/ipfs/" + root.String() + "/fish?format=car", wantStatus: http.StatusBadRequest},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := get(http.MethodGet, tt.path, tt.accept)
+			require.Equal(t, tt.wantStatus, resp.StatusCode)
+		})
+	}
+}
+
+func TestHandlerServesSuppliedCars(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	reg := supplier.NewRegistry(mockEng)
+	cs := supplier.NewCarSupplier(reg.Engine(), dssync.MutexWrap(datastore.NewMapDatastore()))
+	require.NoError(t, reg.Register(supplier.CarSupplierName, cs))
+	md := metadata.Default.New(&metadata.HTTPRetrievalV1{TrustlessCAR: true})
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), []byte("fish"), md)
+	_, err := cs.Put(ctx, []byte("fish"), "../../../testdata/sample-v1.car", md)
+	require.NoError(t, err)
+
+	carBs := testutil.OpenSampleCar(t, "sample-v1.car")
+	roots, err := carBs.Roots()
+	require.NoError(t, err)
+	wantCids := allKeys(t, ctx, carBs.AllKeysChan)
+
+	server := httptest.NewServer(newHandler(reg.Blockstore()))
+	defer server.Close()
+	resp, err := http.Get(server.URL + "/ipfs/" + roots[0].String() + "?format=car")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	br, err := car.NewBlockReader(resp.Body)
+	require.NoError(t, err)
+	var gotCids []cid.Cid
+	for {
+		blk, err := br.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		want, err := carBs.Get(ctx, blk.Cid())
+		require.NoError(t, err)
+		require.Equal(t, want.RawData(), blk.RawData())
+		gotCids = append(gotCids, blk.Cid())
+	}
+	require.ElementsMatch(t, wantCids, gotCids)
+}
+
+func allKeys(t *testing.T, ctx context.Context, allKeysChan func(context.Context) (<-chan cid.Cid, error)) []cid.Cid {
+	keys, err := allKeysChan(ctx)
+	require.NoError(t, err)
+	var cids []cid.Cid
+	for c := range keys {
+		cids = append(cids, c)
+	}
+	return cids
+}
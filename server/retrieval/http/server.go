@@ -0,0 +1,58 @@
+package retrievalserver
+
+import (
+	"context"
+	"net"
+	"net/http"
+
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	logging "github.com/ipfs/go-log/v2"
+)
+
+var log = logging.Logger("retrievalserver")
+
+// Server serves the blocks of a blockstore over HTTP as a trustless gateway, i.e. as verifiable raw
+// blocks or CAR streams at `GET /ipfs/{cid}`.
+//
+// See: https://specs.ipfs.tech/http-gateways/trustless-gateway/
+type Server struct {
+	server *http.Server
+	l      net.Listener
+}
+
+// New instantiates a new retrieval HTTP server that serves the blocks of the given blockstore,
+// typically supplier.Registry.Blockstore.
+func New(bs bstore.Blockstore, o ...Option) (*Server, error) {
+	opts, err := newOptions(o...)
+	if err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp", opts.listenAddr)
+	if err != nil {
+		return nil, err
+	}
+
+	server := &http.Server{
+		Handler:      newHandler(bs),
+		ReadTimeout:  opts.readTimeout,
+		WriteTimeout: opts.writeTimeout,
+	}
+	return &Server{server, l}, nil
+}
+
+// Addr returns the net address on which the server listens, which is useful when it is
+// configured to listen on a random port.
+func (s *Server) Addr() net.Addr {
+	return s.l.Addr()
+}
+
+func (s *Server) Start() error {
+	log.Infow("retrieval http server listening", "addr", s.l.Addr())
+	return s.server.Serve(s.l)
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	log.Info("retrieval http server shutdown")
+	return s.server.Shutdown(ctx)
+}
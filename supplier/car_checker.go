@@ -0,0 +1,117 @@
+package supplier
+
+import (
+	"context"
+	"encoding/base64"
+	"time"
+
+	provider "github.com/filecoin-project/index-provider"
+)
+
+// CarChecker periodically checks the integrity of the CAR files supplied by a CarSupplier, so that
+// CAR files that are moved, deleted or modified after they are put are detected long before their
+// content fails to be retrieved. Broken CAR files are marked as such, and are optionally removed.
+//
+// See: CarSupplier.Check, CarSupplier.ListEntries, WithRemoveBroken.
+type CarChecker struct {
+	*carCheckerOptions
+	cs *CarSupplier
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewCarChecker instantiates a new CarChecker that checks the CAR files supplied by the given
+// CarSupplier. The checker must be started via CarChecker.Start.
+func NewCarChecker(cs *CarSupplier, o ...CarCheckerOption) (*CarChecker, error) {
+	opts, err := newCarCheckerOptions(o...)
+	if err != nil {
+		return nil, err
+	}
+	return &CarChecker{
+		carCheckerOptions: opts,
+		cs:                cs,
+	}, nil
+}
+
+// Start starts checking the CAR files in the background at the configured interval, until
+// CarChecker.Close is called. The first check runs immediately.
+func (c *CarChecker) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+	c.done = make(chan struct{})
+	go c.run(ctx)
+}
+
+func (c *CarChecker) run(ctx context.Context) {
+	defer close(c.done)
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+	for {
+		if err := c.CheckAll(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Errorw("Failed to check CAR files", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll checks all the CAR files supplied by the CarSupplier once, and removes the broken ones
+// if configured to do so. Failing to check or remove an individual CAR file does not stop the
+// remaining ones from being checked.
+func (c *CarChecker) CheckAll(ctx context.Context) error {
+	entries, err := c.cs.ListEntries(ctx)
+	if err != nil {
+		return err
+	}
+	for _, previous := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log := log.With("contextID", base64.StdEncoding.EncodeToString(previous.ContextID), "paths", previous.Paths)
+		entry, err := c.cs.Check(ctx, previous.ContextID)
+		if err != nil {
+			if err != ErrNotFound {
+				log.Errorw("Failed to check CAR file", "err", err)
+			}
+			continue
+		}
+		switch {
+		case !entry.Status.IsBroken():
+			if previous.Status.IsBroken() {
+				log.Infow("CAR file is no longer broken")
+			}
+			continue
+		case entry.Status != previous.Status:
+			log.Warnw("CAR file is broken", "status", entry.Status, "detail", entry.Detail)
+		}
+		if !c.removeBroken {
+			continue
+		}
+		adCid, err := c.cs.Remove(ctx, entry.ContextID)
+		switch err {
+		case nil:
+			log.Infow("Removed broken CAR file", "status", entry.Status, "adCid", adCid)
+		case ErrNotFound, provider.ErrContextIDNotFound:
+			log.Infow("Broken CAR file is already removed", "status", entry.Status)
+		default:
+			log.Errorw("Failed to remove broken CAR file", "status", entry.Status, "err", err)
+		}
+	}
+	return nil
+}
+
+// Close stops checking the CAR files.
+func (c *CarChecker) Close() error {
+	if c.cancel != nil {
+		c.cancel()
+		<-c.done
+	}
+	return nil
+}
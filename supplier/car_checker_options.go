@@ -0,0 +1,50 @@
+package supplier
+
+import (
+	"fmt"
+	"time"
+)
+
+type (
+	// CarCheckerOption captures a configurable parameter of CarChecker.
+	CarCheckerOption func(*carCheckerOptions) error
+
+	carCheckerOptions struct {
+		interval     time.Duration
+		removeBroken bool
+	}
+)
+
+func newCarCheckerOptions(o ...CarCheckerOption) (*carCheckerOptions, error) {
+	opts := &carCheckerOptions{
+		interval: 10 * time.Minute,
+	}
+	for _, apply := range o {
+		if err := apply(opts); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// WithCheckInterval sets the interval at which the CAR files are checked.
+// If unset, the default of ten minutes is used.
+func WithCheckInterval(d time.Duration) CarCheckerOption {
+	return func(o *carCheckerOptions) error {
+		if d <= 0 {
+			return fmt.Errorf("check interval must be greater than zero; got %s", d)
+		}
+		o.interval = d
+		return nil
+	}
+}
+
+// WithRemoveBroken sets whether to remove the CAR files found to be broken, which publishes the
+// removal of their advertisements. Otherwise, broken CAR files are only marked as such.
+// If unset, broken CAR files are not removed.
+func WithRemoveBroken(remove bool) CarCheckerOption {
+	return func(o *carCheckerOptions) error {
+		o.removeBroken = remove
+		return nil
+	}
+}
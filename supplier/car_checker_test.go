@@ -0,0 +1,148 @@
+package supplier
+
+import (
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/index-provider/metadata"
+	mock_provider "github.com/filecoin-project/index-provider/mock"
+	"github.com/filecoin-project/index-provider/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPutRejectsInvalidCar(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	subject := NewCarSupplier(mockEng, datastore.NewMapDatastore())
+
+	dir := t.TempDir()
+	notCar := filepath.Join(dir, "fish.car")
+	require.NoError(t, os.WriteFile(notCar, []byte("lobster"), 0666))
+	truncated := filepath.Join(dir, "truncated.car")
+	b, err := os.ReadFile("../testdata/sample-v1.car")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(truncated, b[:20], 0666))
+
+	md := metadata.Default.New(metadata.Bitswap{})
+	for _, path := range []string{filepath.Join(dir, "missing.car"), notCar, truncated} {
+		_, err := subject.Put(ctx, []byte("applesauce"), path, md)
+		require.ErrorIs(t, err, ErrInvalidCar, path)
+	}
+	paths, err := subject.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, paths)
+}
+
+func TestCarChecker_MarksBrokenCars(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	ds := datastore.NewMapDatastore()
+	cs := NewCarSupplier(mockEng, ds)
+	subject, err := NewCarChecker(cs)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	movedPath := filepath.Join(dir, "moved.car")
+	modifiedPath := filepath.Join(dir, "modified.car")
+	intactPath := filepath.Join(dir, "intact.car")
+	md := metadata.Default.New(metadata.Bitswap{})
+	rng := rand.New(rand.NewSource(1413))
+	for _, path := range []string{movedPath, modifiedPath, intactPath} {
+		writeRandomCar(t, rng, path)
+		mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), []byte(path), md)
+		_, err := cs.Put(ctx, []byte(path), path, md)
+		require.NoError(t, err)
+	}
+
+	// Put a CAR the way it was put before integrity checks were introduced, i.e. with no record.
+	legacyPath := filepath.Join(dir, "legacy.car")
+	testutil.CopyFile(t, "../testdata/sample-v1.car", legacyPath)
+	require.NoError(t, ds.Put(ctx, toCarIdKey([]byte("legacy")), []byte(legacyPath)))
+
+	require.NoError(t, os.Rename(movedPath, movedPath+".bak"))
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(modifiedPath, later, later))
+
+	require.NoError(t, subject.CheckAll(ctx))
+	wantStatuses := map[string]CarStatus{
+		movedPath:    CarStatusMissing,
+		modifiedPath: CarStatusModified,
+		intactPath:   CarStatusOK,
+		legacyPath:   CarStatusOK,
+	}
+	requireStatuses(t, cs, wantStatuses)
+
+	// Assert that the CAR is no longer broken once moved back.
+	require.NoError(t, os.Rename(movedPath+".bak", movedPath))
+	require.NoError(t, subject.CheckAll(ctx))
+	wantStatuses[movedPath] = CarStatusOK
+	requireStatuses(t, cs, wantStatuses)
+
+	// Assert that re-importing a modified CAR accepts its modifications.
+	mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), []byte(modifiedPath), md).Return(cid.Undef, nil)
+	_, err = cs.Put(ctx, []byte(modifiedPath), modifiedPath, md)
+	require.NoError(t, err)
+	require.NoError(t, subject.CheckAll(ctx))
+	wantStatuses[modifiedPath] = CarStatusOK
+	requireStatuses(t, cs, wantStatuses)
+}
+
+func TestCarChecker_RemovesBrokenCars(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	cs := NewCarSupplier(mockEng, dssync.MutexWrap(datastore.NewMapDatastore()))
+	subject, err := NewCarChecker(cs, WithRemoveBroken(true), WithCheckInterval(10*time.Millisecond))
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	brokenPath := filepath.Join(dir, "broken.car")
+	intactPath := filepath.Join(dir, "intact.car")
+	md := metadata.Default.New(metadata.Bitswap{})
+	rng := rand.New(rand.NewSource(1413))
+	for _, path := range []string{brokenPath, intactPath} {
+		writeRandomCar(t, rng, path)
+		mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), []byte(path), md)
+		_, err := cs.Put(ctx, []byte(path), path, md)
+		require.NoError(t, err)
+	}
+	require.NoError(t, os.Remove(brokenPath))
+
+	removed := make(chan struct{})
+	mockEng.EXPECT().NotifyRemove(gomock.Any(), peer.ID(""), []byte(brokenPath)).
+		Do(func(context.Context, peer.ID, []byte) { close(removed) })
+	subject.Start()
+	defer subject.Close()
+	waitFor(t, ctx, removed)
+	require.NoError(t, subject.Close())
+
+	paths, err := cs.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{intactPath}, paths)
+}
+
+func requireStatuses(t *testing.T, cs *CarSupplier, want map[string]CarStatus) {
+	entries, err := cs.ListEntries(testutil.ContextWithTimeout(t))
+	require.NoError(t, err)
+	got := make(map[string]CarStatus)
+	for _, entry := range entries {
+		require.Len(t, entry.Paths, 1)
+		got[entry.Paths[0]] = entry.Status
+		require.False(t, entry.CheckedAt.IsZero())
+	}
+	require.Equal(t, want, got)
+}
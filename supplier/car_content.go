@@ -0,0 +1,197 @@
+package supplier
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-car/v2/index"
+	"github.com/multiformats/go-multihash"
+)
+
+const carContentKeyPrefix = carSupplierDatastorePrefix + "content/"
+
+// ContextIDDerivation specifies how a context ID is derived from the content of CAR files.
+//
+// See: CarSupplier.DeriveContextID.
+type ContextIDDerivation string
+
+const (
+	// ContextIDFromRoots derives the context ID from the roots of the CAR files, i.e. the SHA-256
+	// hash of their sorted root CIDs. CAR files with the same roots get the same context ID, even
+	// if their blocks differ.
+	ContextIDFromRoots ContextIDDerivation = "roots"
+	// ContextIDFromContent derives the context ID from the content of the CAR files, i.e. the
+	// SHA-256 hash of the sorted multihashes of their blocks. CAR files with the same blocks get
+	// the same context ID, regardless of their version, block order or index.
+	ContextIDFromContent ContextIDDerivation = "content"
+)
+
+// ErrContextIDConflict signals that CARs with different content are put under a derived context ID
+// that is already supplied.
+//
+// See: WithDerivedContextID.
+var ErrContextIDConflict = errors.New("derived context ID is already supplied with different content")
+
+// DuplicateCarError signals that the content of the CAR files being put is identical to the
+// content of CAR files already supplied under another context ID. Instead of publishing another
+// advertisement, the existing one is returned.
+type DuplicateCarError struct {
+	// ContextID is the context ID under which the identical content is supplied.
+	ContextID []byte
+	// AdCid is the CID of the latest advertisement published for ContextID.
+	AdCid cid.Cid
+}
+
+func (e *DuplicateCarError) Error() string {
+	return fmt.Sprintf("identical CAR content is already supplied with context ID %s",
+		base64.StdEncoding.EncodeToString(e.ContextID))
+}
+
+// DeriveContextID deterministically derives a context ID from the CAR files at the given
+// locations, using the given derivation. The order of the locations does not matter.
+// An error wrapping ErrInvalidCar is returned if any of the files is not a valid CAR.
+//
+// See: ContextIDFromRoots, ContextIDFromContent.
+func (cs *CarSupplier) DeriveContextID(ctx context.Context, derivation ContextIDDerivation, paths []string) ([]byte, error) {
+	if len(paths) == 0 {
+		return nil, errors.New("at least one CAR path must be specified")
+	}
+	for _, path := range paths {
+		if err := cs.validateCar(ctx, cleanCarPath(path)); err != nil {
+			return nil, err
+		}
+	}
+	switch derivation {
+	case ContextIDFromRoots:
+		return cs.rootsDigest(ctx, paths)
+	case ContextIDFromContent:
+		return cs.contentDigest(ctx, paths, func(path string) (index.IterableIndex, error) {
+			return cs.readOrGenerateIterableIndex(ctx, path)
+		})
+	default:
+		return nil, fmt.Errorf("unknown context ID derivation: %q", derivation)
+	}
+}
+
+// rootsDigest returns the SHA-256 hash of the sorted distinct roots of the given CAR files.
+func (cs *CarSupplier) rootsDigest(ctx context.Context, paths []string) ([]byte, error) {
+	var roots [][]byte
+	seen := make(map[string]struct{})
+	for _, path := range paths {
+		cr, err := cs.openCar(ctx, cleanCarPath(path))
+		if err != nil {
+			return nil, err
+		}
+		rs, err := cr.Roots()
+		cr.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, root := range rs {
+			if _, ok := seen[root.KeyString()]; ok {
+				continue
+			}
+			seen[root.KeyString()] = struct{}{}
+			roots = append(roots, root.Bytes())
+		}
+	}
+	return digestSorted(roots), nil
+}
+
+// contentDigest returns the SHA-256 hash of the sorted distinct multihashes of the given CAR files,
+// listed via the indexes returned by the given function.
+func (cs *CarSupplier) contentDigest(ctx context.Context, paths []string, lookupIndex func(path string) (index.IterableIndex, error)) ([]byte, error) {
+	var mhs [][]byte
+	seen := make(map[string]struct{})
+	for _, path := range paths {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		idx, err := lookupIndex(path)
+		if err != nil {
+			return nil, err
+		}
+		err = idx.ForEach(func(mh multihash.Multihash, _ uint64) error {
+			if _, ok := seen[string(mh)]; ok {
+				return nil
+			}
+			seen[string(mh)] = struct{}{}
+			mhs = append(mhs, mh)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return digestSorted(mhs), nil
+}
+
+func digestSorted(values [][]byte) []byte {
+	sort.Slice(values, func(i, j int) bool { return bytes.Compare(values[i], values[j]) < 0 })
+	h := sha256.New()
+	for _, v := range values {
+		// Values are length-prefixed so that their concatenation is unambiguous.
+		_, _ = fmt.Fprintf(h, "%d:", len(v))
+		_, _ = h.Write(v)
+	}
+	return h.Sum(nil)
+}
+
+// readOrGenerateIterableIndex reads the iterable index embedded in the CAR at the given location,
+// or generates one if there is none. Unlike CarSupplier.lookupIterableIndex, the index is not
+// persisted since it is not associated to any context ID.
+func (cs *CarSupplier) readOrGenerateIterableIndex(ctx context.Context, path string) (index.IterableIndex, error) {
+	cr, err := cs.openCar(ctx, cleanCarPath(path))
+	if err != nil {
+		return nil, err
+	}
+	defer cr.Close()
+	idx, err := readIterableIndex(cr)
+	if err != nil || idx != nil {
+		return idx, err
+	}
+	return cs.generateIterableIndex(cr)
+}
+
+// getContentOwner returns the context ID under which content with the given digest is supplied,
+// or nil if there is none.
+func (cs *CarSupplier) getContentOwner(ctx context.Context, digest []byte) ([]byte, error) {
+	b, err := cs.ds.Get(ctx, toCarContentKey(digest))
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return b, nil
+}
+
+// deleteContentOwner deletes the mapping of the given digest to the given context ID, unless the
+// digest is mapped to another context ID.
+func (cs *CarSupplier) deleteContentOwner(ctx context.Context, digest, contextID []byte) error {
+	if len(digest) == 0 {
+		return nil
+	}
+	owner, err := cs.getContentOwner(ctx, digest)
+	if err != nil || !bytes.Equal(owner, contextID) {
+		return err
+	}
+	return cs.ds.Delete(ctx, toCarContentKey(digest))
+}
+
+// supplies returns true if CARs are supplied under the given context ID.
+func (cs *CarSupplier) supplies(ctx context.Context, contextID []byte) (bool, error) {
+	return cs.ds.Has(ctx, toCarIdKey(contextID))
+}
+
+func toCarContentKey(digest []byte) datastore.Key {
+	return datastore.NewKey(carContentKeyPrefix + hex.EncodeToString(digest))
+}
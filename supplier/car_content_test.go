@@ -0,0 +1,159 @@
+package supplier
+
+import (
+	"errors"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	provider "github.com/filecoin-project/index-provider"
+	"github.com/filecoin-project/index-provider/metadata"
+	mock_provider "github.com/filecoin-project/index-provider/mock"
+	"github.com/filecoin-project/index-provider/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeriveContextID(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	subject := NewCarSupplier(mockEng, datastore.NewMapDatastore())
+
+	v1 := "../testdata/sample-v1.car"
+	// Has the same roots and blocks as v1, wrapped in a CARv2 with an index.
+	wrappedV1 := "../testdata/sample-wrapped-v2.car"
+	other := "../testdata/sample-v1-2.car"
+
+	for _, derivation := range []ContextIDDerivation{ContextIDFromRoots, ContextIDFromContent} {
+		t.Run(string(derivation), func(t *testing.T) {
+			got, err := subject.DeriveContextID(ctx, derivation, []string{v1})
+			require.NoError(t, err)
+			require.Len(t, got, 32)
+
+			again, err := subject.DeriveContextID(ctx, derivation, []string{wrappedV1})
+			require.NoError(t, err)
+			require.Equal(t, got, again)
+
+			different, err := subject.DeriveContextID(ctx, derivation, []string{other})
+			require.NoError(t, err)
+			require.NotEqual(t, got, different)
+
+			// Assert that the order of shards does not matter.
+			shards, err := subject.DeriveContextID(ctx, derivation, []string{v1, other})
+			require.NoError(t, err)
+			reordered, err := subject.DeriveContextID(ctx, derivation, []string{other, v1})
+			require.NoError(t, err)
+			require.Equal(t, shards, reordered)
+			require.NotEqual(t, got, shards)
+		})
+	}
+
+	_, err := subject.DeriveContextID(ctx, "fish", []string{v1})
+	require.ErrorContains(t, err, "unknown context ID derivation")
+	_, err = subject.DeriveContextID(ctx, ContextIDFromRoots, []string{"../testdata/missing.car"})
+	require.ErrorIs(t, err, ErrInvalidCar)
+}
+
+func TestPutIdenticalContentReturnsExistingAd(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	ds := datastore.NewMapDatastore()
+	subject := NewCarSupplier(mockEng, ds)
+	md := metadata.Default.New(metadata.Bitswap{})
+	wantAdCid := generateCidV1(t, rand.New(rand.NewSource(1413)))
+	detect := WithDuplicateDetection(true)
+
+	// Assert that content is not mapped to a context ID that failed to be advertised.
+	contextID := []byte("applesauce")
+	mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), contextID, md).Return(cid.Undef, errors.New("fish"))
+	_, err := subject.PutShards(ctx, contextID, []string{"../testdata/sample-v1.car"}, md, detect)
+	require.EqualError(t, err, "fish")
+	results, err := ds.Query(ctx, query.Query{Prefix: carContentKeyPrefix, KeysOnly: true})
+	require.NoError(t, err)
+	contentKeys, err := results.Rest()
+	require.NoError(t, err)
+	require.Empty(t, contentKeys)
+
+	mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), contextID, md).Return(wantAdCid, nil)
+	_, err = subject.PutShards(ctx, contextID, []string{"../testdata/sample-v1.car"}, md, detect)
+	require.NoError(t, err)
+
+	// Assert that the same content put under another context ID is not advertised again,
+	// regardless of the CAR version it is wrapped in.
+	for _, path := range []string{"../testdata/sample-v1.car", "../testdata/sample-wrapped-v2.car"} {
+		gotAdCid, err := subject.PutShards(ctx, []byte("lobster"), []string{path}, md, detect)
+		var dupErr *DuplicateCarError
+		require.ErrorAs(t, err, &dupErr)
+		require.Equal(t, contextID, dupErr.ContextID)
+		require.Equal(t, wantAdCid, dupErr.AdCid)
+		require.Equal(t, wantAdCid, gotAdCid)
+	}
+	paths, err := subject.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Clean("../testdata/sample-v1.car")}, paths)
+
+	// Assert that putting the same content again under the same context ID returns the
+	// existing ad.
+	mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), contextID, md).Return(wantAdCid, provider.ErrAlreadyAdvertised)
+	gotAdCid, err := subject.PutShards(ctx, contextID, []string{"../testdata/sample-v1.car"}, md, detect)
+	require.Equal(t, provider.ErrAlreadyAdvertised, err)
+	require.Equal(t, wantAdCid, gotAdCid)
+
+	// Assert that duplicates are not detected unless enabled.
+	mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), []byte("lobster"), md)
+	_, err = subject.Put(ctx, []byte("lobster"), "../testdata/sample-wrapped-v2.car", md)
+	require.NoError(t, err)
+	mockEng.EXPECT().NotifyRemove(ctx, peer.ID(""), []byte("lobster"))
+	_, err = subject.Remove(ctx, []byte("lobster"))
+	require.NoError(t, err)
+
+	// Assert that the content can be put under another context ID once removed.
+	mockEng.EXPECT().NotifyRemove(ctx, peer.ID(""), contextID)
+	_, err = subject.Remove(ctx, contextID)
+	require.NoError(t, err)
+	results, err = ds.Query(ctx, query.Query{KeysOnly: true})
+	require.NoError(t, err)
+	remaining, err := results.Rest()
+	require.NoError(t, err)
+	require.Empty(t, remaining)
+
+	mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), []byte("lobster"), md)
+	_, err = subject.PutShards(ctx, []byte("lobster"), []string{"../testdata/sample-wrapped-v2.car"}, md, detect)
+	require.NoError(t, err)
+}
+
+func TestPutDerivedContextIDRejectsDifferentContent(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	subject := NewCarSupplier(mockEng, datastore.NewMapDatastore())
+	md := metadata.Default.New(metadata.Bitswap{})
+
+	v1 := "../testdata/sample-v1.car"
+	contextID, err := subject.DeriveContextID(ctx, ContextIDFromRoots, []string{v1})
+	require.NoError(t, err)
+	derived := WithDerivedContextID(ContextIDFromRoots)
+	mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), contextID, md)
+	_, err = subject.PutShards(ctx, contextID, []string{v1}, md, derived)
+	require.NoError(t, err)
+
+	// Assert that the shards of a derived context ID are not replaced by other CARs, e.g. CARs with
+	// the same roots but different blocks.
+	_, err = subject.PutShards(ctx, contextID, []string{"../testdata/sample-v1-2.car"}, md, derived)
+	require.ErrorIs(t, err, ErrContextIDConflict)
+	paths, err := subject.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Clean(v1)}, paths)
+
+	_, err = subject.PutShards(ctx, contextID, []string{v1}, md, WithDerivedContextID("fish"))
+	require.ErrorContains(t, err, "unknown context ID derivation")
+}
@@ -0,0 +1,306 @@
+package supplier
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+const carRecordKeyPrefix = carSupplierDatastorePrefix + "record/"
+
+// ErrInvalidCar signals that a file is not a valid CAR file.
+var ErrInvalidCar = errors.New("invalid CAR")
+
+// CarStatus is the integrity status of a CAR file supplied by CarSupplier.
+type CarStatus string
+
+const (
+	// CarStatusUnchecked signals that the CAR file has not been checked yet. This is only the case
+	// for CAR files put before integrity checks were introduced.
+	CarStatusUnchecked CarStatus = "unchecked"
+	// CarStatusOK signals that the CAR file is unchanged since it was put.
+	CarStatusOK CarStatus = "ok"
+	// CarStatusMissing signals that the CAR file no longer exists at its path.
+	CarStatusMissing CarStatus = "missing"
+	// CarStatusModified signals that the CAR file has changed since it was put, and may no longer
+	// contain the advertised content.
+	CarStatusModified CarStatus = "modified"
+)
+
+// IsBroken returns true if the status signals that the CAR file cannot be relied upon to supply
+// the advertised content.
+func (s CarStatus) IsBroken() bool {
+	return s == CarStatusMissing || s == CarStatusModified
+}
+
+// CarEntry describes a CAR file supplied by CarSupplier along with its integrity status.
+// For a context ID that spans multiple CAR files, the status is that of all its shards: the entry
+// is broken if any of its shards is.
+type CarEntry struct {
+	// ContextID is the context ID under which the CAR file is advertised.
+	ContextID []byte
+	// Paths are the paths of the CAR files, i.e. the shards of the context ID. There is more than
+	// one path only if the context ID spans multiple CAR files.
+	Paths []string
+	// Status is the integrity status of the CAR file as of its last check.
+	Status CarStatus
+	// Detail describes the reason for which the CAR file is broken, if it is.
+	Detail string
+	// CheckedAt is the time at which the CAR file was last checked, or zero if it never was.
+	CheckedAt time.Time
+}
+
+// carRecord is the persisted state of a CAR file supplied by CarSupplier, which captures the
+// fingerprints of its shards at the time it was put along with its integrity status.
+type carRecord struct {
+	ContextID    []byte           `json:"context_id"`
+	Fingerprints []carFingerprint `json:"fingerprints,omitempty"`
+	Status       CarStatus        `json:"status"`
+	Detail       string           `json:"detail,omitempty"`
+	CheckedAt    time.Time        `json:"checked_at"`
+	// ContentDigest is the digest of the multihashes of all shards, used to detect identical
+	// content put under different context IDs.
+	ContentDigest []byte `json:"content_digest,omitempty"`
+	// PieceCID is the CID of the piece commitment advertised for the context ID, if any.
+	PieceCID cid.Cid `json:"piece_cid"`
+	// AdCid is the CID of the latest advertisement published for the context ID.
+	AdCid cid.Cid `json:"ad_cid"`
+
+	// Fingerprint is the fingerprint of the single CAR file recorded before context IDs could span
+	// multiple CAR files. It is only read, and migrated to Fingerprints.
+	Fingerprint *carFingerprint `json:"fingerprint,omitempty"`
+}
+
+func decodeCarRecord(b []byte) (carRecord, error) {
+	var record carRecord
+	if err := json.Unmarshal(b, &record); err != nil {
+		return carRecord{}, err
+	}
+	if record.Fingerprint != nil {
+		if record.Fingerprint.Path != "" && len(record.Fingerprints) == 0 {
+			record.Fingerprints = []carFingerprint{*record.Fingerprint}
+		}
+		record.Fingerprint = nil
+	}
+	return record, nil
+}
+
+// validateCar checks that the file at the given location is a CAR file with a valid header that
+// specifies at least one root.
+func (cs *CarSupplier) validateCar(ctx context.Context, path string) error {
+	cr, err := cs.openCar(ctx, path)
+	if err != nil {
+		return invalidCar(path, err)
+	}
+	defer cr.Close()
+	roots, err := cr.Roots()
+	if err != nil {
+		return invalidCar(path, err)
+	}
+	if len(roots) == 0 {
+		return invalidCar(path, errors.New("header has no roots"))
+	}
+	for _, root := range roots {
+		if !root.Defined() {
+			return invalidCar(path, errors.New("header has undefined root"))
+		}
+	}
+	return nil
+}
+
+func invalidCar(path string, err error) error {
+	return fmt.Errorf("%w %s: %v", ErrInvalidCar, path, err)
+}
+
+func fingerprintCar(ctx context.Context, path string) (carFingerprint, error) {
+	if IsRemoteCar(path) {
+		return fingerprintRemoteCar(ctx, path)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return carFingerprint{}, err
+	}
+	return carFingerprint{
+		Path:    path,
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}, nil
+}
+
+// ListEntries lists the CAR files that are supplied by this supplier along with their integrity
+// status as of their last check.
+//
+// See: CarSupplier.Check, CarChecker.
+func (cs *CarSupplier) ListEntries(ctx context.Context) ([]CarEntry, error) {
+	records, err := cs.listRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	shards, err := cs.listShards(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := cs.ds.Query(ctx, query.Query{Prefix: carIdDatastoreKeyPrefix})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	keyPrefix := datastore.NewKey(carIdDatastoreKeyPrefix).String() + "/"
+	var entries []CarEntry
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		record, ok := records[r.Key]
+		if !ok {
+			// The CAR was put before integrity checks were introduced; its context ID can only be
+			// inferred from its key.
+			record = carRecord{
+				ContextID: []byte(strings.TrimPrefix(r.Key, keyPrefix)),
+				Status:    CarStatusUnchecked,
+			}
+		}
+		paths, ok := shards[r.Key]
+		if !ok {
+			paths = []string{string(r.Value)}
+		}
+		entries = append(entries, record.entry(paths))
+	}
+	return entries, nil
+}
+
+// listRecords lists the persisted records of CAR files, keyed by the string form of the datastore
+// key that maps their context ID to their path.
+func (cs *CarSupplier) listRecords(ctx context.Context) (map[string]carRecord, error) {
+	results, err := cs.ds.Query(ctx, query.Query{Prefix: carRecordKeyPrefix})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	records := make(map[string]carRecord)
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		record, err := decodeCarRecord(r.Value)
+		if err != nil {
+			return nil, err
+		}
+		records[toCarIdKey(record.ContextID).String()] = record
+	}
+	return records, nil
+}
+
+// Check checks that the CAR files put under the given context ID still exist and are unchanged
+// since they were put, and records their resulting integrity status. A CAR file put before
+// integrity checks were introduced is assumed to be unchanged upon its first check.
+//
+// ErrNotFound is returned if no CAR file is put under the context ID.
+func (cs *CarSupplier) Check(ctx context.Context, contextID []byte) (CarEntry, error) {
+	paths, err := cs.getPaths(ctx, contextID)
+	if err != nil {
+		return CarEntry{}, err
+	}
+	record, err := cs.getRecord(ctx, contextID)
+	if err != nil {
+		return CarEntry{}, err
+	}
+
+	recorded := make(map[string]carFingerprint, len(record.Fingerprints))
+	for _, fp := range record.Fingerprints {
+		recorded[fp.Path] = fp
+	}
+	// No fingerprints were recorded when the CARs were put; adopt the current ones.
+	adopt := len(recorded) == 0
+
+	var missing, modified []string
+	current := make([]carFingerprint, 0, len(paths))
+	for _, path := range paths {
+		fp, err := fingerprintCar(ctx, path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			missing = append(missing, path+" does not exist")
+		case err != nil:
+			missing = append(missing, err.Error())
+		case adopt:
+			current = append(current, fp)
+		default:
+			current = append(current, fp)
+			previous, ok := recorded[path]
+			if !ok {
+				modified = append(modified, path+" was not fingerprinted when put")
+			} else if !previous.matches(fp) {
+				modified = append(modified, fmt.Sprintf("%s size or modification time changed from %d bytes at %s to %d bytes at %s",
+					path, previous.Size, previous.ModTime.Format(time.RFC3339), fp.Size, fp.ModTime.Format(time.RFC3339)))
+			}
+		}
+	}
+
+	switch {
+	case len(missing) != 0:
+		record.Status = CarStatusMissing
+		record.Detail = strings.Join(missing, "; ")
+		// Stop serving blocks from the CARs kept open in memory.
+		cs.evictCachedIndexes(contextID)
+	case len(modified) != 0:
+		record.Status = CarStatusModified
+		record.Detail = strings.Join(modified, "; ")
+		cs.evictCachedIndexes(contextID)
+	default:
+		if adopt {
+			record.Fingerprints = current
+		}
+		record.Status = CarStatusOK
+		record.Detail = ""
+	}
+	record.CheckedAt = time.Now()
+	if err := cs.putRecord(ctx, record); err != nil {
+		return CarEntry{}, err
+	}
+	return record.entry(paths), nil
+}
+
+func (r carRecord) entry(paths []string) CarEntry {
+	return CarEntry{
+		ContextID: r.ContextID,
+		Paths:     paths,
+		Status:    r.Status,
+		Detail:    r.Detail,
+		CheckedAt: r.CheckedAt,
+	}
+}
+
+func (cs *CarSupplier) getRecord(ctx context.Context, contextID []byte) (carRecord, error) {
+	b, err := cs.ds.Get(ctx, toCarRecordKey(contextID))
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return carRecord{ContextID: contextID, Status: CarStatusUnchecked}, nil
+		}
+		return carRecord{}, err
+	}
+	return decodeCarRecord(b)
+}
+
+func (cs *CarSupplier) putRecord(ctx context.Context, record carRecord) error {
+	b, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return cs.ds.Put(ctx, toCarRecordKey(record.ContextID), b)
+}
+
+func toCarRecordKey(contextID []byte) datastore.Key {
+	return datastore.NewKey(carRecordKeyPrefix + hex.EncodeToString(contextID))
+}
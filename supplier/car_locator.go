@@ -0,0 +1,197 @@
+package supplier
+
+import (
+	"context"
+	"encoding/hex"
+	"os"
+	"strings"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/ipfs/go-cid"
+	"github.com/ipld/go-car/v2/blockstore"
+	"github.com/ipld/go-car/v2/index"
+	"github.com/multiformats/go-multihash"
+)
+
+// carIndexCacheSize is the maximum number of CAR indexes kept in memory to locate blocks and open
+// blockstores without reading or generating indexes again. It is also the maximum number of CAR
+// blockstores kept open, so that serving blocks does not require opening the CARs every time.
+const carIndexCacheSize = 64
+
+// Locate returns the context IDs of the CAR files that hold the block with the given multihash,
+// looked up via the indexes of all supplied CAR files. The most recently used indexes are kept in
+// memory, so that locating blocks does not require reading indexes again every time.
+//
+// CAR files that cannot be read, e.g. because they are missing, are skipped.
+func (cs *CarSupplier) Locate(ctx context.Context, mh multihash.Multihash) ([][]byte, error) {
+	entries, err := cs.ListEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// The index is keyed by multihash, regardless of the CID codec.
+	key := cid.NewCidV1(cid.Raw, mh)
+	var contextIDs [][]byte
+	for _, entry := range entries {
+		for _, path := range entry.Paths {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			idx, err := cs.cachedIterableIndex(ctx, entry.ContextID, path)
+			if err != nil {
+				log.Debugw("Skipping unreadable CAR index while locating block", "contextID", entry.ContextID, "path", path, "err", err)
+				continue
+			}
+			var found bool
+			err = idx.GetAll(key, func(uint64) bool {
+				found = true
+				return false
+			})
+			if err != nil && err != index.ErrNotFound {
+				return nil, err
+			}
+			if found {
+				contextIDs = append(contextIDs, entry.ContextID)
+				break
+			}
+		}
+	}
+	return contextIDs, nil
+}
+
+// cachedIterableIndex returns the index of the CAR shard of the given context ID at the given
+// location from memory if present, or looks it up and keeps it in memory otherwise.
+func (cs *CarSupplier) cachedIterableIndex(ctx context.Context, contextID []byte, path string) (index.IterableIndex, error) {
+	key := toCarIndexCacheKey(contextID, path)
+	if idx, ok := cs.indexCache.Get(key); ok {
+		return idx.(index.IterableIndex), nil
+	}
+	idx, err := cs.lookupIterableIndex(ctx, contextID, path)
+	if err != nil {
+		return nil, err
+	}
+	cs.indexCache.Add(key, idx)
+	return idx, nil
+}
+
+// cachedReadOnlyBlockstore returns the blockstore of the CAR shard of the given context ID at the
+// given location, which is kept open in memory and shared by its users. The returned blockstore
+// must be closed once no longer used, but the shared blockstore is only closed once it is evicted
+// from memory and closed by all its users.
+func (cs *CarSupplier) cachedReadOnlyBlockstore(ctx context.Context, contextID []byte, path string) (ClosableBlockstore, error) {
+	key := toCarIndexCacheKey(contextID, path)
+	if v, ok := cs.blockstoreCache.Get(key); ok {
+		if shared := v.(*sharedBlockstore); shared.acquire() {
+			return &sharedBlockstoreRef{sharedBlockstore: shared}, nil
+		}
+	}
+	bs, err := cs.openReadOnlyBlockstore(ctx, contextID, path)
+	if err != nil {
+		return nil, err
+	}
+	// Referenced by both the cache and the caller, unless another user cached it concurrently.
+	shared := &sharedBlockstore{ClosableBlockstore: bs, refs: 2}
+	if cached, _ := cs.blockstoreCache.ContainsOrAdd(key, shared); cached {
+		shared.refs = 1
+	}
+	return &sharedBlockstoreRef{sharedBlockstore: shared}, nil
+}
+
+// evictCachedIndexes evicts the indexes and blockstores of all shards of the given context ID from
+// memory.
+func (cs *CarSupplier) evictCachedIndexes(contextID []byte) {
+	prefix := hex.EncodeToString(contextID) + "/"
+	for _, cache := range []*lru.Cache{cs.indexCache, cs.blockstoreCache} {
+		for _, key := range cache.Keys() {
+			if strings.HasPrefix(key.(string), prefix) {
+				cache.Remove(key)
+			}
+		}
+	}
+}
+
+// releaseEvictedBlockstore releases the reference of the blockstore cache to an evicted blockstore.
+func releaseEvictedBlockstore(key, value interface{}) {
+	if err := value.(*sharedBlockstore).release(); err != nil {
+		log.Warnw("Failed to close evicted CAR blockstore", "key", key, "err", err)
+	}
+}
+
+// sharedBlockstore is a blockstore that is shared by multiple users, and closed once all of them
+// have released it.
+type sharedBlockstore struct {
+	ClosableBlockstore
+	lock sync.Mutex
+	refs int
+}
+
+// acquire adds a reference to the blockstore, and returns false if it is already closed.
+func (s *sharedBlockstore) acquire() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.refs == 0 {
+		return false
+	}
+	s.refs++
+	return true
+}
+
+// release removes a reference to the blockstore, and closes it if there are none left.
+func (s *sharedBlockstore) release() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.refs--
+	if s.refs == 0 {
+		return s.ClosableBlockstore.Close()
+	}
+	return nil
+}
+
+// sharedBlockstoreRef is a reference to a shared blockstore, which is released when closed.
+type sharedBlockstoreRef struct {
+	*sharedBlockstore
+	once sync.Once
+}
+
+func (r *sharedBlockstoreRef) Close() error {
+	var err error
+	r.once.Do(func() { err = r.release() })
+	return err
+}
+
+func toCarIndexCacheKey(contextID []byte, path string) string {
+	return hex.EncodeToString(contextID) + "/" + path
+}
+
+// openLocalReadOnlyBlockstore opens a read-only blockstore over the local CAR shard of the given
+// context ID at the given path, using its cached index.
+func (cs *CarSupplier) openLocalReadOnlyBlockstore(ctx context.Context, contextID []byte, path string) (ClosableBlockstore, error) {
+	idx, err := cs.cachedIterableIndex(ctx, contextID, path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	bs, err := blockstore.NewReadOnly(f, idx, cs.opts...)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return &fileBlockstore{ReadOnly: bs, f: f}, nil
+}
+
+// fileBlockstore is a read-only CAR blockstore that closes its backing file when closed.
+type fileBlockstore struct {
+	*blockstore.ReadOnly
+	f *os.File
+}
+
+func (b *fileBlockstore) Close() error {
+	if err := b.ReadOnly.Close(); err != nil {
+		_ = b.f.Close()
+		return err
+	}
+	return b.f.Close()
+}
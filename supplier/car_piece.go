@@ -0,0 +1,118 @@
+package supplier
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/filecoin-project/index-provider/commp"
+	"github.com/filecoin-project/index-provider/metadata"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/multiformats/go-multicodec"
+)
+
+const carPieceKeyPrefix = carSupplierDatastorePrefix + "piece/"
+
+// PieceInfo describes the Filecoin piece that holds a CAR file.
+type PieceInfo struct {
+	// PieceCID is the CID of the piece commitment, i.e. CommP, of the CAR file.
+	PieceCID cid.Cid
+	// Size is the padded size of the piece, i.e. a power of two.
+	Size uint64
+}
+
+// ComputePiece computes the piece commitment of the CAR file at the given location, as if it were
+// stored as is in a Filecoin piece padded to a power-of-two size. The entire CAR file is read,
+// including its CARv2 header and index if any. An error wrapping ErrInvalidCar is returned if the
+// file is not a valid CAR.
+//
+// The resulting piece CID may be advertised via metadata.GraphsyncFilecoinV1 when the CAR is put,
+// in which case it is stored along with the context ID.
+//
+// See: CarSupplier.ContextIDForPiece.
+func (cs *CarSupplier) ComputePiece(ctx context.Context, path string) (PieceInfo, error) {
+	path = cleanCarPath(path)
+	if err := cs.validateCar(ctx, path); err != nil {
+		return PieceInfo{}, err
+	}
+
+	var r io.Reader
+	if IsRemoteCar(path) {
+		rcr, err := newRemoteCarReader(ctx, path)
+		if err != nil {
+			return PieceInfo{}, err
+		}
+		r = io.NewSectionReader(rcr, 0, rcr.size)
+	} else {
+		f, err := os.Open(path)
+		if err != nil {
+			return PieceInfo{}, err
+		}
+		defer f.Close()
+		r = f
+	}
+	pieceCid, size, err := commp.FromReader(r)
+	if err != nil {
+		return PieceInfo{}, err
+	}
+	log.Debugw("Computed piece commitment of CAR", "path", path, "pieceCid", pieceCid, "size", size)
+	return PieceInfo{PieceCID: pieceCid, Size: size}, nil
+}
+
+// ContextIDForPiece returns the context ID of the CAR files whose piece CID is advertised via
+// metadata.GraphsyncFilecoinV1. ErrNotFound is returned if there is none.
+func (cs *CarSupplier) ContextIDForPiece(pieceCid cid.Cid) ([]byte, error) {
+	contextID, err := cs.ds.Get(context.Background(), toCarPieceKey(pieceCid))
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return contextID, nil
+}
+
+// pieceCIDFromMetadata returns the piece CID advertised via metadata.GraphsyncFilecoinV1 in the
+// given metadata, or cid.Undef if there is none or it is not the CID of a piece commitment.
+func pieceCIDFromMetadata(md metadata.Metadata) cid.Cid {
+	gs, ok := md.Get(multicodec.TransportGraphsyncFilecoinv1).(*metadata.GraphsyncFilecoinV1)
+	if !ok || !commp.IsPieceCID(gs.PieceCID) {
+		return cid.Undef
+	}
+	return gs.PieceCID
+}
+
+// putPieceOwner maps the given piece CID to the given context ID, replacing the mapping of the
+// previous piece CID of the context ID, if any.
+func (cs *CarSupplier) putPieceOwner(ctx context.Context, pieceCid, previous cid.Cid, contextID []byte) error {
+	if previous.Defined() && previous != pieceCid {
+		if err := cs.deletePieceOwner(ctx, previous, contextID); err != nil {
+			return err
+		}
+	}
+	if !pieceCid.Defined() {
+		return nil
+	}
+	return cs.ds.Put(ctx, toCarPieceKey(pieceCid), contextID)
+}
+
+// deletePieceOwner deletes the mapping of the given piece CID to the given context ID, unless the
+// piece CID is mapped to another context ID.
+func (cs *CarSupplier) deletePieceOwner(ctx context.Context, pieceCid cid.Cid, contextID []byte) error {
+	if !pieceCid.Defined() {
+		return nil
+	}
+	owner, err := cs.ContextIDForPiece(pieceCid)
+	if err == ErrNotFound || (err == nil && string(owner) != string(contextID)) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return cs.ds.Delete(ctx, toCarPieceKey(pieceCid))
+}
+
+func toCarPieceKey(pieceCid cid.Cid) datastore.Key {
+	return datastore.NewKey(carPieceKeyPrefix + pieceCid.String())
+}
@@ -0,0 +1,55 @@
+package supplier
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/filecoin-project/index-provider/commp"
+	"github.com/filecoin-project/index-provider/metadata"
+	mock_provider "github.com/filecoin-project/index-provider/mock"
+	"github.com/filecoin-project/index-provider/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/ipfs/go-datastore"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPieceCIDIsStoredWithContextID(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	subject := NewCarSupplier(mockEng, datastore.NewMapDatastore())
+
+	path := "../testdata/sample-wrapped-v2.car"
+	piece, err := subject.ComputePiece(ctx, path)
+	require.NoError(t, err)
+	require.True(t, commp.IsPieceCID(piece.PieceCID))
+	require.Equal(t, uint64(1<<20), piece.Size)
+
+	// Assert that the piece CID is the same for a remote copy of the CAR.
+	server := newCarServer(t)
+	testutil.CopyFile(t, path, filepath.Join(server.dir, "sample.car"))
+	remotePiece, err := subject.ComputePiece(ctx, server.URL+"/sample.car")
+	require.NoError(t, err)
+	require.Equal(t, piece, remotePiece)
+
+	_, err = subject.ComputePiece(ctx, "../testdata/missing.car")
+	require.ErrorIs(t, err, ErrInvalidCar)
+
+	contextID := []byte("applesauce")
+	md := metadata.Default.New(&metadata.GraphsyncFilecoinV1{PieceCID: piece.PieceCID, VerifiedDeal: true, FastRetrieval: true})
+	mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), contextID, md)
+	_, err = subject.Put(ctx, contextID, path, md)
+	require.NoError(t, err)
+
+	got, err := subject.ContextIDForPiece(piece.PieceCID)
+	require.NoError(t, err)
+	require.Equal(t, contextID, got)
+
+	mockEng.EXPECT().NotifyRemove(ctx, peer.ID(""), contextID)
+	_, err = subject.Remove(ctx, contextID)
+	require.NoError(t, err)
+	_, err = subject.ContextIDForPiece(piece.PieceCID)
+	require.Equal(t, ErrNotFound, err)
+}
@@ -0,0 +1,50 @@
+package supplier
+
+import "fmt"
+
+type (
+	// PutOption captures a configurable parameter of CarSupplier.PutShards.
+	PutOption func(*putOptions) error
+
+	putOptions struct {
+		derivation      ContextIDDerivation
+		detectDuplicate bool
+	}
+)
+
+func newPutOptions(o ...PutOption) (*putOptions, error) {
+	opts := &putOptions{}
+	for _, apply := range o {
+		if err := apply(opts); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// WithDerivedContextID specifies that the context ID was derived from the CARs being put via
+// CarSupplier.DeriveContextID, using the given derivation. This implies WithDuplicateDetection,
+// and rejects putting CARs with different content under a context ID that is already supplied,
+// e.g. a CAR with the same roots but different blocks.
+func WithDerivedContextID(derivation ContextIDDerivation) PutOption {
+	return func(o *putOptions) error {
+		if derivation != ContextIDFromRoots && derivation != ContextIDFromContent {
+			return fmt.Errorf("unknown context ID derivation: %q", derivation)
+		}
+		o.derivation = derivation
+		o.detectDuplicate = true
+		return nil
+	}
+}
+
+// WithDuplicateDetection sets whether to detect CARs with content identical to that of CARs
+// already supplied under another context ID, in which case no advertisement is published and a
+// DuplicateCarError is returned instead. Detecting duplicates requires reading the multihashes of
+// all CARs being put.
+// If unset, duplicates are not detected unless WithDerivedContextID is specified.
+func WithDuplicateDetection(detect bool) PutOption {
+	return func(o *putOptions) error {
+		o.detectDuplicate = detect
+		return nil
+	}
+}
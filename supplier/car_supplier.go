@@ -1,28 +1,36 @@
 package supplier
 
 import (
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
-	"path/filepath"
+	"time"
 
 	provider "github.com/filecoin-project/index-provider"
 	"github.com/filecoin-project/index-provider/metadata"
+	lru "github.com/hashicorp/golang-lru"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
 	"github.com/ipfs/go-datastore/query"
 	bstore "github.com/ipfs/go-ipfs-blockstore"
 	logging "github.com/ipfs/go-log/v2"
 	"github.com/ipld/go-car/v2"
-	"github.com/ipld/go-car/v2/blockstore"
 	"github.com/ipld/go-car/v2/index"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-multihash"
 )
 
 const (
 	carSupplierDatastorePrefix = "car_supplier://"
 	carIdDatastoreKeyPrefix    = carSupplierDatastorePrefix + "car_id/"
+	carIndexKeyPrefix          = carSupplierDatastorePrefix + "index/"
+	carShardsKeyPrefix         = carSupplierDatastorePrefix + "shards/"
 )
 
 // ErrNotFound signals that CidIteratorSupplier has no iterator corresponding to the given key.
@@ -35,21 +43,36 @@ var log = logging.Logger("provider/carsupplier")
 //
 // CarSupplier accepts both CARv1 and CARv2, and will automatically generate an index if one is not
 // present or the index codec and characteristics are not sufficient for provider.Interface purposes.
+// Generated indexes are persisted in the datastore, and reused for as long as the size and
+// modification time of the CAR file remain unchanged.
+//
+// CAR files may also be located by http:// or https:// URL, in which case they are read via HTTP
+// range requests. The indexes of such remote CAR files are always persisted, so that they are not
+// fetched again unless the CAR changes.
 //
 // See: engine.New, CarSupplier.Put, CarSupplier.Remove.
 type CarSupplier struct {
-	eng  provider.Interface
-	ds   datastore.Datastore
-	opts []car.ReadOption
+	eng        provider.Interface
+	ds         datastore.Datastore
+	opts       []car.ReadOption
+	indexCache *lru.Cache
+	// blockstoreCache holds the open blockstores of CAR shards, as *sharedBlockstore.
+	blockstoreCache *lru.Cache
 }
 
 // NewCarSupplier instantiates a new CarSupplier and registers it as the provider.MultihashLister of the
-// given provider.Interface.
+// given provider.Interface. To supply content alongside other suppliers, instantiate it with
+// Registry.Engine instead.
 func NewCarSupplier(eng provider.Interface, ds datastore.Datastore, opts ...car.ReadOption) *CarSupplier {
+	// The cache size is a positive constant, for which instantiation never fails.
+	indexCache, _ := lru.New(carIndexCacheSize)
+	blockstoreCache, _ := lru.NewWithEvict(carIndexCacheSize, releaseEvictedBlockstore)
 	cs := &CarSupplier{
-		eng:  eng,
-		ds:   ds,
-		opts: opts,
+		eng:             eng,
+		ds:              ds,
+		opts:            opts,
+		indexCache:      indexCache,
+		blockstoreCache: blockstoreCache,
 	}
 	eng.RegisterMultihashLister(cs.ListMultihashes)
 	return cs
@@ -59,25 +82,206 @@ func NewCarSupplier(eng provider.Interface, ds datastore.Datastore, opts ...car.
 // suppliable by this supplier. The return CID can then be used via Supply to
 // get an iterator over CIDs that belong to the CAR.
 //
-// This function accepts both CARv1 and CARv2 formats.
+// This function accepts both CARv1 and CARv2 formats. An error wrapping ErrInvalidCar is returned
+// if the file at the given path is not a CAR with a valid header that specifies at least one root.
+//
+// See: CarSupplier.PutShards.
 func (cs *CarSupplier) Put(ctx context.Context, contextID []byte, path string, metadata metadata.Metadata) (cid.Cid, error) {
-	// Clean path to CAR.
-	path = filepath.Clean(path)
+	return cs.PutShards(ctx, contextID, []string{path}, metadata)
+}
 
-	// Store mapping of CAR ID to path, used to instantiate CID iterator.
-	carIdKey := toCarIdKey(contextID)
-	err := cs.ds.Put(ctx, carIdKey, []byte(path))
+// PutShards makes the content of the CARs at the given paths, collectively identified by the given
+// ID, suppliable by this supplier. This allows the content advertised under a single context ID,
+// e.g. a deal, to be split across multiple CAR shards. The multihashes of all shards are listed
+// together, and the blocks of all shards are served by CarSupplier.ReadOnlyBlockstore.
+//
+// Calling PutShards on a context ID that is already put with a different set of shards replaces
+// the shards and re-advertises the context ID, so that the advertised multihashes reflect the
+// shards that were added or removed.
+//
+// If duplicate detection is enabled via WithDuplicateDetection or WithDerivedContextID, and the
+// content of the CARs is identical to the content of CARs already supplied under another context
+// ID, no advertisement is published; instead, the CID of the existing advertisement is returned
+// along with a DuplicateCarError that identifies the existing context ID. A context ID derived
+// via WithDerivedContextID is never re-advertised with different content; an error wrapping
+// ErrContextIDConflict is returned instead.
+//
+// If the metadata advertises the CID of a piece commitment via metadata.GraphsyncFilecoinV1, e.g.
+// as computed by CarSupplier.ComputePiece, the piece CID is stored along with the context ID so
+// that retrievals of the piece can be resolved to it.
+//
+// This function accepts both CARv1 and CARv2 formats. An error wrapping ErrInvalidCar is returned
+// if any of the files is not a CAR with a valid header that specifies at least one root.
+func (cs *CarSupplier) PutShards(ctx context.Context, contextID []byte, paths []string, metadata metadata.Metadata, o ...PutOption) (cid.Cid, error) {
+	opts, err := newPutOptions(o...)
 	if err != nil {
 		return cid.Undef, err
 	}
+	if len(paths) == 0 {
+		return cid.Undef, errors.New("at least one CAR path must be specified")
+	}
+
+	// Clean paths to CARs, ignoring duplicates.
+	shards := make([]string, 0, len(paths))
+	seen := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		path = cleanCarPath(path)
+		if _, ok := seen[path]; ok {
+			continue
+		}
+		seen[path] = struct{}{}
+		shards = append(shards, path)
+	}
 
-	return cs.eng.NotifyPut(ctx, nil, contextID, metadata)
+	// Validate the CARs up front, so that a CAR that cannot supply multihashes is never advertised.
+	fingerprints := make([]carFingerprint, 0, len(shards))
+	for _, path := range shards {
+		if err := cs.validateCar(ctx, path); err != nil {
+			return cid.Undef, err
+		}
+		fingerprint, err := fingerprintCar(ctx, path)
+		if err != nil {
+			return cid.Undef, err
+		}
+		fingerprints = append(fingerprints, fingerprint)
+	}
+
+	previous, err := cs.getPaths(ctx, contextID)
+	if err != nil && err != ErrNotFound {
+		return cid.Undef, err
+	}
+	reAdvertise := previous != nil && !sameShards(previous, shards)
+	previousRecord, err := cs.getRecord(ctx, contextID)
+	if err != nil {
+		return cid.Undef, err
+	}
+
+	// Detect identical content supplied under another context ID, so that it is not advertised
+	// twice. The indexes looked up to digest the content are those used to list its multihashes
+	// once advertised.
+	var digest []byte
+	if opts.detectDuplicate {
+		digest, err = cs.contentDigest(ctx, shards, func(path string) (index.IterableIndex, error) {
+			return cs.lookupIterableIndex(ctx, contextID, path)
+		})
+		if err != nil {
+			return cid.Undef, err
+		}
+		changed := reAdvertise || (previousRecord.ContentDigest != nil && !bytes.Equal(previousRecord.ContentDigest, digest))
+		if opts.derivation != "" && changed {
+			// The context ID of the different content is the same as the one already supplied,
+			// e.g. because it has the same roots. Replacing the content would silently change
+			// what the derived context ID stands for.
+			return cid.Undef, fmt.Errorf("%w: context ID derived from %s is already supplied with shards %v", ErrContextIDConflict, opts.derivation, previous)
+		}
+		owner, err := cs.getContentOwner(ctx, digest)
+		if err != nil {
+			return cid.Undef, err
+		}
+		if owner != nil && !bytes.Equal(owner, contextID) {
+			if previous == nil {
+				// Discard the indexes persisted while digesting the content, since nothing is put.
+				if err := cs.deleteIndexes(ctx, contextID); err != nil {
+					return cid.Undef, err
+				}
+			}
+			ownerRecord, err := cs.getRecord(ctx, owner)
+			if err != nil {
+				return cid.Undef, err
+			}
+			log.Infow("Identical CAR content is already supplied", "contextID", contextID, "existingContextID", owner)
+			return ownerRecord.AdCid, &DuplicateCarError{ContextID: owner, AdCid: ownerRecord.AdCid}
+		}
+	}
+
+	// Store mapping of CAR ID to paths, used to instantiate CID iterator.
+	if err := cs.putPaths(ctx, contextID, shards); err != nil {
+		return cid.Undef, err
+	}
+	cs.evictCachedIndexes(contextID)
+	if err := cs.deleteDroppedIndexes(ctx, contextID, previous, shards); err != nil {
+		return cid.Undef, err
+	}
+
+	// Store the fingerprints of the CARs, used to detect whether they are moved or modified later on,
+	// along with the digest of their content.
+	record := carRecord{
+		ContextID:     contextID,
+		Fingerprints:  fingerprints,
+		ContentDigest: digest,
+		PieceCID:      pieceCIDFromMetadata(metadata),
+		AdCid:         previousRecord.AdCid,
+		Status:        CarStatusOK,
+		CheckedAt:     time.Now(),
+	}
+	if err := cs.putRecord(ctx, record); err != nil {
+		return cid.Undef, err
+	}
+	if !bytes.Equal(previousRecord.ContentDigest, digest) {
+		if err := cs.deleteContentOwner(ctx, previousRecord.ContentDigest, contextID); err != nil {
+			return cid.Undef, err
+		}
+	}
+	if err := cs.putPieceOwner(ctx, record.PieceCID, previousRecord.PieceCID, contextID); err != nil {
+		return cid.Undef, err
+	}
+
+	if reAdvertise {
+		// The engine reuses the multihashes previously advertised under a context ID when it is
+		// re-advertised. Remove the context ID first, so that the multihashes of the new set of
+		// shards are advertised instead.
+		log.Infow("Shards of context ID changed; re-advertising", "contextID", contextID, "previous", previous, "current", shards)
+		if _, err := cs.eng.NotifyRemove(ctx, "", contextID); err != nil && err != provider.ErrContextIDNotFound {
+			return cid.Undef, err
+		}
+	}
+	adCid, err := cs.eng.NotifyPut(ctx, nil, contextID, metadata)
+	if err != nil && err != provider.ErrAlreadyAdvertised {
+		return adCid, err
+	}
+	// Map the content to the context ID only once it is advertised, so that a failure to advertise
+	// does not make later puts of identical content resolve to a context ID that is not advertised.
+	if digest != nil {
+		if err := cs.ds.Put(ctx, toCarContentKey(digest), contextID); err != nil {
+			return cid.Undef, err
+		}
+	}
+	if err == provider.ErrAlreadyAdvertised {
+		return record.AdCid, err
+	}
+
+	// Remember the advertisement, so that it can be returned when identical content is put.
+	record.AdCid = adCid
+	if err := cs.putRecord(ctx, record); err != nil {
+		return cid.Undef, err
+	}
+	return adCid, nil
+}
+
+func sameShards(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	set := make(map[string]struct{}, len(a))
+	for _, path := range a {
+		set[path] = struct{}{}
+	}
+	for _, path := range b {
+		if _, ok := set[path]; !ok {
+			return false
+		}
+	}
+	return true
 }
 
 func toCarIdKey(contextID []byte) datastore.Key {
 	return datastore.NewKey(carIdDatastoreKeyPrefix + string(contextID))
 }
 
+func toCarShardsKey(contextID []byte) datastore.Key {
+	return datastore.NewKey(carShardsKeyPrefix + hex.EncodeToString(contextID))
+}
+
 // Remove removes the CAR at the given path from the list of suppliable CID
 // iterators. If the CAR at given path is not known, this function will return
 // an error.  This function accepts both CARv1 and CARv2 formats.
@@ -98,13 +302,34 @@ func (cs *CarSupplier) Remove(ctx context.Context, contextID []byte) (cid.Cid, e
 		// See what we can do to opportunistically heal the datastore.
 		return cid.Undef, err
 	}
+	if err := cs.ds.Delete(ctx, toCarShardsKey(contextID)); err != nil {
+		return cid.Undef, err
+	}
+	record, err := cs.getRecord(ctx, contextID)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if err := cs.deleteContentOwner(ctx, record.ContentDigest, contextID); err != nil {
+		return cid.Undef, err
+	}
+	if err := cs.deletePieceOwner(ctx, record.PieceCID, contextID); err != nil {
+		return cid.Undef, err
+	}
+	if err := cs.ds.Delete(ctx, toCarRecordKey(contextID)); err != nil {
+		return cid.Undef, err
+	}
+	if err := cs.deleteIndexes(ctx, contextID); err != nil {
+		return cid.Undef, err
+	}
+	cs.evictCachedIndexes(contextID)
 
 	return cs.eng.NotifyRemove(ctx, "", contextID)
 }
 
-// List lists the CAR paths that are supplied by this supplier.
+// List lists the CAR paths that are supplied by this supplier, including every shard of the
+// context IDs that span multiple CARs.
 //
-// See: CarSupplier.Put
+// See: CarSupplier.Put, CarSupplier.PutShards
 func (cs *CarSupplier) List(ctx context.Context) ([]string, error) {
 	q := query.Query{
 		Prefix: carIdDatastoreKeyPrefix,
@@ -115,24 +340,140 @@ func (cs *CarSupplier) List(ctx context.Context) ([]string, error) {
 	}
 	defer results.Close()
 
+	shards, err := cs.listShards(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	var paths []string
 	for r := range results.Next() {
 		if r.Error != nil {
 			return nil, r.Error
 		}
+		if s, ok := shards[r.Key]; ok {
+			paths = append(paths, s...)
+			continue
+		}
 		paths = append(paths, string(r.Value))
 	}
 	return paths, nil
 }
 
+// listShards lists the paths of context IDs that span multiple CARs, keyed by the string form of
+// the datastore key that maps their context ID to their first path.
+func (cs *CarSupplier) listShards(ctx context.Context) (map[string][]string, error) {
+	results, err := cs.ds.Query(ctx, query.Query{Prefix: carShardsKeyPrefix})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	shards := make(map[string][]string)
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		contextID, err := hex.DecodeString(datastore.RawKey(r.Key).BaseNamespace())
+		if err != nil {
+			return nil, err
+		}
+		var paths []string
+		if err := json.Unmarshal(r.Value, &paths); err != nil {
+			return nil, err
+		}
+		shards[toCarIdKey(contextID).String()] = paths
+	}
+	return shards, nil
+}
+
 // ListMultihashes supplies an iterator over CIDs of the CAR file that corresponds to
 // the given key.  An error is returned if no CAR file is found for the key.
+//
+// The multihashes of context IDs that span multiple CARs are merged across all shards, and
+// listed only once even if they are present in more than one shard.
 func (cs *CarSupplier) ListMultihashes(ctx context.Context, p peer.ID, contextID []byte) (provider.MultihashIterator, error) {
-	idx, err := cs.lookupIterableIndex(ctx, contextID)
+	paths, err := cs.getPaths(ctx, contextID)
 	if err != nil {
 		return nil, err
 	}
-	return provider.CarMultihashIterator(idx)
+	if len(paths) == 1 {
+		idx, err := cs.lookupIterableIndex(ctx, contextID, paths[0])
+		if err != nil {
+			return nil, err
+		}
+		return provider.CarMultihashIterator(idx)
+	}
+
+	idxs := make([]index.IterableIndex, 0, len(paths))
+	for _, path := range paths {
+		idx, err := cs.lookupIterableIndex(ctx, contextID, path)
+		if err != nil {
+			return nil, err
+		}
+		idxs = append(idxs, idx)
+	}
+	return &shardsMultihashIterator{idxs: idxs}, nil
+}
+
+// shardsMultihashIterator iterates over the multihashes of CAR shards one shard at a time, in the
+// order of their offsets within each shard. A multihash is skipped if it is present in an earlier
+// shard, which is looked up via the index of that shard. This avoids holding the multihashes of
+// all shards in memory at once.
+type shardsMultihashIterator struct {
+	idxs    []index.IterableIndex
+	current provider.MultihashIterator
+	// next is the position of the shard after the one currently iterated over.
+	next int
+}
+
+func (it *shardsMultihashIterator) Next() (multihash.Multihash, error) {
+	for {
+		if it.current == nil {
+			if it.next >= len(it.idxs) {
+				return nil, io.EOF
+			}
+			current, err := provider.CarMultihashIterator(it.idxs[it.next])
+			if err != nil {
+				return nil, err
+			}
+			it.current = current
+			it.next++
+		}
+		mh, err := it.current.Next()
+		if err == io.EOF {
+			it.current = nil
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		seen, err := it.seenInEarlierShard(mh)
+		if err != nil {
+			return nil, err
+		}
+		if !seen {
+			return mh, nil
+		}
+	}
+}
+
+func (it *shardsMultihashIterator) seenInEarlierShard(mh multihash.Multihash) (bool, error) {
+	// The index is keyed by multihash, regardless of the CID codec.
+	key := cid.NewCidV1(cid.Raw, mh)
+	for _, idx := range it.idxs[:it.next-1] {
+		var found bool
+		err := idx.GetAll(key, func(uint64) bool {
+			found = true
+			return false
+		})
+		if err != nil && err != index.ErrNotFound {
+			return false, err
+		}
+		if found {
+			return true, nil
+		}
+	}
+	return false, nil
 }
 
 // ClosableBlockstore is a blockstore that can be closed
@@ -141,38 +482,83 @@ type ClosableBlockstore interface {
 	io.Closer
 }
 
-// ReadOnlyBlockstore returns a CAR blockstore interface for the given blockstore key
+// ReadOnlyBlockstore returns a CAR blockstore interface for the given blockstore key.
+// For context IDs that span multiple CARs, the returned blockstore is the union of the
+// blockstores of all shards.
 func (cs *CarSupplier) ReadOnlyBlockstore(contextID []byte) (ClosableBlockstore, error) {
-	path, err := cs.getPath(context.TODO(), contextID)
+	paths, err := cs.getPaths(context.TODO(), contextID)
 	if err != nil {
 		return nil, err
 	}
-	return blockstore.OpenReadOnly(path, cs.opts...)
+	if len(paths) == 1 {
+		return cs.cachedReadOnlyBlockstore(context.TODO(), contextID, paths[0])
+	}
+	union := make(unionBlockstore, 0, len(paths))
+	for _, path := range paths {
+		bs, err := cs.cachedReadOnlyBlockstore(context.TODO(), contextID, path)
+		if err != nil {
+			_ = union.Close()
+			return nil, err
+		}
+		union = append(union, bs)
+	}
+	return union, nil
 }
 
-func (cs *CarSupplier) getPath(ctx context.Context, contextID []byte) (path string, err error) {
+// getPaths returns the paths of the CARs put under the given context ID, in the order in which
+// they were put.
+func (cs *CarSupplier) getPaths(ctx context.Context, contextID []byte) ([]string, error) {
 	b, err := cs.ds.Get(ctx, toCarIdKey(contextID))
 	if err != nil {
 		if err == datastore.ErrNotFound {
 			err = ErrNotFound
 		}
-		return "", err
+		return nil, err
+	}
+	b2, err := cs.ds.Get(ctx, toCarShardsKey(contextID))
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return []string{string(b)}, nil
+		}
+		return nil, err
 	}
-	return string(b), nil
+	var paths []string
+	if err := json.Unmarshal(b2, &paths); err != nil {
+		return nil, err
+	}
+	return paths, nil
 }
 
-func (cs *CarSupplier) lookupIterableIndex(ctx context.Context, contextID []byte) (index.IterableIndex, error) {
-	log := log.With("contextID", contextID)
-
-	path, err := cs.getPath(ctx, contextID)
+// putPaths stores the paths of the CARs put under the given context ID. The first path is mapped
+// to the context ID as it always has been, and the complete list of paths is stored separately
+// only if there is more than one.
+func (cs *CarSupplier) putPaths(ctx context.Context, contextID []byte, paths []string) error {
+	if err := cs.ds.Put(ctx, toCarIdKey(contextID), []byte(paths[0])); err != nil {
+		return err
+	}
+	shardsKey := toCarShardsKey(contextID)
+	if len(paths) == 1 {
+		return cs.ds.Delete(ctx, shardsKey)
+	}
+	b, err := json.Marshal(paths)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	return cs.ds.Put(ctx, shardsKey, b)
+}
+
+func (cs *CarSupplier) lookupIterableIndex(ctx context.Context, contextID []byte, path string) (index.IterableIndex, error) {
+	log := log.With("contextID", contextID, "path", path)
+
+	if IsRemoteCar(path) {
+		return cs.lookupRemoteIterableIndex(ctx, contextID, path)
 	}
 
 	cr, err := car.OpenReader(path, cs.opts...)
 	if err != nil {
 		return nil, err
 	}
+	defer cr.Close()
 	idxReader, err := cr.IndexReader()
 	if err != nil {
 		return nil, err
@@ -180,7 +566,7 @@ func (cs *CarSupplier) lookupIterableIndex(ctx context.Context, contextID []byte
 	if idxReader == nil {
 		// Missing index; generate it.
 		log.Debugw("CAR has no index; generating.")
-		return cs.generateIterableIndex(cr)
+		return cs.loadOrGenerateIterableIndex(ctx, contextID, path, cr)
 	}
 	idx, err := index.ReadFrom(idxReader)
 	if err != nil {
@@ -190,7 +576,7 @@ func (cs *CarSupplier) lookupIterableIndex(ctx context.Context, contextID []byte
 	log = log.With("codec", codec)
 	if codec != multicodec.CarMultihashIndexSorted {
 		log.Debugw("CAR index not iterable; regenerating index.")
-		return cs.generateIterableIndex(cr)
+		return cs.loadOrGenerateIterableIndex(ctx, contextID, path, cr)
 	}
 	itIdx, ok := idx.(index.IterableIndex)
 	if !ok {
@@ -199,11 +585,162 @@ func (cs *CarSupplier) lookupIterableIndex(ctx context.Context, contextID []byte
 		// Regardless, defensively check this and re-generate as needed in case go-car library
 		// changes this expectation.
 		log.Warnw("expected CAR index to implement index.IterableIndex interface; regenerating index.")
-		return cs.generateIterableIndex(cr)
+		return cs.loadOrGenerateIterableIndex(ctx, contextID, path, cr)
 	}
 	return itIdx, nil
 }
 
+// carFingerprint identifies the version of a CAR file from which an index was generated.
+type carFingerprint struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// ETag is the entity tag of a remote CAR, if its server reports one.
+	ETag string `json:"etag,omitempty"`
+}
+
+func (f carFingerprint) matches(other carFingerprint) bool {
+	return f.Path == other.Path && f.Size == other.Size && f.ModTime.Equal(other.ModTime) && f.ETag == other.ETag
+}
+
+// loadOrGenerateIterableIndex returns the index previously generated for the CAR at the given path
+// if the CAR has not changed since, or generates and persists a new one otherwise.
+func (cs *CarSupplier) loadOrGenerateIterableIndex(ctx context.Context, contextID []byte, path string, cr *car.Reader) (index.IterableIndex, error) {
+	log := log.With("contextID", contextID, "path", path)
+
+	fingerprint, err := fingerprintCar(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := cs.loadIndex(ctx, contextID, fingerprint)
+	switch {
+	case err != nil:
+		// Regenerate the index instead of failing, since the persisted index is only a cache.
+		log.Warnw("Failed to load persisted CAR index; regenerating index.", "err", err)
+	case idx != nil:
+		log.Debugw("Using persisted CAR index.")
+		return idx, nil
+	default:
+		log.Debugw("No up-to-date persisted CAR index; generating index.")
+	}
+
+	idx, err = cs.generateIterableIndex(cr)
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.storeIndex(ctx, contextID, fingerprint, idx); err != nil {
+		log.Warnw("Failed to persist generated CAR index.", "err", err)
+	}
+	return idx, nil
+}
+
+// loadIndex loads the index persisted for the given context ID, or returns nil if there is none
+// or it was generated from a CAR that does not match the given fingerprint.
+func (cs *CarSupplier) loadIndex(ctx context.Context, contextID []byte, fingerprint carFingerprint) (index.IterableIndex, error) {
+	fpKey, dataKey := toCarIndexKeys(contextID, fingerprint.Path)
+	b, err := cs.ds.Get(ctx, fpKey)
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var stored carFingerprint
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, err
+	}
+	if !stored.matches(fingerprint) {
+		return nil, nil
+	}
+	b, err = cs.ds.Get(ctx, dataKey)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := index.ReadFrom(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	itIdx, ok := idx.(index.IterableIndex)
+	if !ok {
+		return nil, fmt.Errorf("persisted index with codec %s is not iterable", idx.Codec())
+	}
+	return itIdx, nil
+}
+
+func (cs *CarSupplier) storeIndex(ctx context.Context, contextID []byte, fingerprint carFingerprint, idx index.IterableIndex) error {
+	var buf bytes.Buffer
+	if _, err := index.WriteTo(idx, &buf); err != nil {
+		return err
+	}
+	fp, err := json.Marshal(fingerprint)
+	if err != nil {
+		return err
+	}
+	// Delete the fingerprint first so that a partially stored index is never mistaken for a valid
+	// one, and store it last once the index is fully written.
+	fpKey, dataKey := toCarIndexKeys(contextID, fingerprint.Path)
+	if err := cs.ds.Delete(ctx, fpKey); err != nil {
+		return err
+	}
+	if err := cs.ds.Put(ctx, dataKey, buf.Bytes()); err != nil {
+		return err
+	}
+	return cs.ds.Put(ctx, fpKey, fp)
+}
+
+// deleteIndexes deletes the indexes persisted for all shards of the given context ID.
+func (cs *CarSupplier) deleteIndexes(ctx context.Context, contextID []byte) error {
+	results, err := cs.ds.Query(ctx, query.Query{
+		Prefix:   carIndexKeyPrefix + hex.EncodeToString(contextID) + "/",
+		KeysOnly: true,
+	})
+	if err != nil {
+		return err
+	}
+	entries, err := results.Rest()
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if err := cs.ds.Delete(ctx, datastore.NewKey(e.Key)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteDroppedIndexes deletes the indexes persisted for the previous shards of the given context
+// ID that are not among its current shards.
+func (cs *CarSupplier) deleteDroppedIndexes(ctx context.Context, contextID []byte, previous, current []string) error {
+	kept := make(map[string]struct{}, len(current))
+	for _, path := range current {
+		kept[path] = struct{}{}
+	}
+	for _, path := range previous {
+		if _, ok := kept[path]; ok {
+			continue
+		}
+		fpKey, dataKey := toCarIndexKeys(contextID, path)
+		if err := cs.ds.Delete(ctx, fpKey); err != nil {
+			return err
+		}
+		if err := cs.ds.Delete(ctx, dataKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toCarIndexKeys returns the keys under which the index of the CAR shard at the given path is
+// persisted. The keys are namespaced by context ID, so that the indexes of all shards of a context
+// ID can be deleted together.
+func toCarIndexKeys(contextID []byte, path string) (fingerprint datastore.Key, data datastore.Key) {
+	pathHash := sha256.Sum256([]byte(path))
+	prefix := carIndexKeyPrefix + hex.EncodeToString(contextID) + "/" + hex.EncodeToString(pathHash[:])
+	return datastore.NewKey(prefix + "/fingerprint"), datastore.NewKey(prefix + "/data")
+}
+
 func (cs *CarSupplier) generateIterableIndex(cr *car.Reader) (index.IterableIndex, error) {
 	idx := index.NewMultihashSorted()
 	dr, err := cr.DataReader()
@@ -219,5 +756,6 @@ func (cs *CarSupplier) generateIterableIndex(cr *car.Reader) (index.IterableInde
 // Close permanently closes this supplier.
 // After calling Close this supplier is no longer usable.
 func (cs *CarSupplier) Close() error {
+	cs.blockstoreCache.Purge()
 	return cs.ds.Close()
 }
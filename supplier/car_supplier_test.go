@@ -1,6 +1,7 @@
 package supplier
 
 import (
+	"bytes"
 	"context"
 	"crypto/sha256"
 	"fmt"
@@ -9,13 +10,21 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	provider "github.com/filecoin-project/index-provider"
 	"github.com/filecoin-project/index-provider/metadata"
 	mock_provider "github.com/filecoin-project/index-provider/mock"
+	"github.com/filecoin-project/index-provider/testutil"
 	"github.com/golang/mock/gomock"
+	blocks "github.com/ipfs/go-block-format"
 	"github.com/ipfs/go-cid"
 	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+	format "github.com/ipfs/go-ipld-format"
 	"github.com/ipld/go-car/v2"
+	"github.com/ipld/go-car/v2/blockstore"
+	"github.com/ipld/go-car/v2/index"
 	"github.com/libp2p/go-libp2p/core/peer"
 	"github.com/multiformats/go-multihash"
 	"github.com/stretchr/testify/require"
@@ -196,3 +205,221 @@ func generateCidV1(t *testing.T, rng *rand.Rand) cid.Cid {
 	require.NoError(t, err)
 	return cid.NewCidV1(cid.Raw, mh)
 }
+
+func TestGeneratedIndexIsPersistedAndReused(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	ds := datastore.NewMapDatastore()
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	subject := NewCarSupplier(mockEng, ds)
+
+	// Use a CARv1, which has no index.
+	path := filepath.Join(t.TempDir(), "sample-v1.car")
+	testutil.CopyFile(t, "../testdata/sample-v1.car", path)
+	contextID := []byte("applesauce")
+	md := metadata.Default.New(metadata.Bitswap{})
+	mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), contextID, md)
+	_, err := subject.Put(ctx, contextID, path, md)
+	require.NoError(t, err)
+
+	wantMhs := listAllMultihashes(t, ctx, subject, contextID)
+	require.NotEmpty(t, wantMhs)
+
+	// Assert that the generated index is persisted.
+	fpKey, dataKey := toCarIndexKeys(contextID, path)
+	has, err := ds.Has(ctx, fpKey)
+	require.NoError(t, err)
+	require.True(t, has)
+
+	// Replace the persisted index with one that only contains the first multihash, and assert
+	// that it is used for listing instead of regenerating the index from the CAR.
+	partial := index.NewMultihashSorted()
+	require.NoError(t, partial.Load([]index.Record{{Cid: cid.NewCidV1(cid.Raw, wantMhs[0]), Offset: 1}}))
+	var buf bytes.Buffer
+	_, err = index.WriteTo(partial, &buf)
+	require.NoError(t, err)
+	require.NoError(t, ds.Put(ctx, dataKey, buf.Bytes()))
+	require.Equal(t, wantMhs[:1], listAllMultihashes(t, ctx, subject, contextID))
+
+	// Assert that the persisted index is invalidated once the CAR is modified.
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(path, later, later))
+	require.ElementsMatch(t, wantMhs, listAllMultihashes(t, ctx, subject, contextID))
+
+	// Assert that the persisted index is removed along with the CAR.
+	mockEng.EXPECT().NotifyRemove(ctx, peer.ID(""), contextID)
+	_, err = subject.Remove(ctx, contextID)
+	require.NoError(t, err)
+	for _, key := range []datastore.Key{fpKey, dataKey} {
+		has, err = ds.Has(ctx, key)
+		require.NoError(t, err)
+		require.False(t, has)
+	}
+}
+
+func listAllMultihashes(t *testing.T, ctx context.Context, cs *CarSupplier, contextID []byte) []multihash.Multihash {
+	it, err := cs.ListMultihashes(ctx, "", contextID)
+	require.NoError(t, err)
+	var mhs []multihash.Multihash
+	for {
+		mh, err := it.Next()
+		if err == io.EOF {
+			return mhs
+		}
+		require.NoError(t, err)
+		mhs = append(mhs, mh)
+	}
+}
+
+func TestPutShardsMergesAndReAdvertises(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	ds := datastore.NewMapDatastore()
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	subject := NewCarSupplier(mockEng, ds)
+
+	dir := t.TempDir()
+	shard1 := filepath.Join(dir, "sample-v1.car")
+	shard2 := filepath.Join(dir, "sample-v1-2.car")
+	// Has the same content as shard1, wrapped in a CARv2.
+	shard3 := filepath.Join(dir, "sample-wrapped-v2.car")
+	testutil.CopyFile(t, "../testdata/sample-v1.car", shard1)
+	testutil.CopyFile(t, "../testdata/sample-v1-2.car", shard2)
+	testutil.CopyFile(t, "../testdata/sample-wrapped-v2.car", shard3)
+	mhs1 := readCarMultihashes(t, shard1)
+	mhs2 := readCarMultihashes(t, shard2)
+
+	contextID := []byte("applesauce")
+	md := metadata.Default.New(metadata.Bitswap{})
+	mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), contextID, md)
+	_, err := subject.Put(ctx, contextID, shard1, md)
+	require.NoError(t, err)
+	require.ElementsMatch(t, mhs1, listAllMultihashes(t, ctx, subject, contextID))
+
+	// Assert that adding shards re-advertises the context ID with the multihashes of all shards,
+	// each listed once.
+	gomock.InOrder(
+		mockEng.EXPECT().NotifyRemove(ctx, peer.ID(""), contextID),
+		mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), contextID, md),
+	)
+	_, err = subject.PutShards(ctx, contextID, []string{shard1, shard2, shard3}, md)
+	require.NoError(t, err)
+	require.ElementsMatch(t, append(mhs1, mhs2...), listAllMultihashes(t, ctx, subject, contextID))
+
+	paths, err := subject.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{shard1, shard2, shard3}, paths)
+	entries, err := subject.ListEntries(ctx)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, []string{shard1, shard2, shard3}, entries[0].Paths)
+	require.Equal(t, CarStatusOK, entries[0].Status)
+
+	// Assert that the blocks of all shards are served, and that modifying one shard breaks the
+	// context ID.
+	bs, err := subject.ReadOnlyBlockstore(contextID)
+	require.NoError(t, err)
+	for _, mh := range []multihash.Multihash{mhs1[0], mhs2[0]} {
+		blk, err := bs.Get(ctx, cid.NewCidV1(cid.Raw, mh))
+		require.NoError(t, err)
+		require.Equal(t, mh, blk.Cid().Hash())
+	}
+	_, err = bs.Get(ctx, generateCidV1(t, rand.New(rand.NewSource(1413))))
+	require.True(t, format.IsNotFound(err))
+	keys, err := bs.AllKeysChan(ctx)
+	require.NoError(t, err)
+	gotKeys := make(map[string]struct{})
+	for c := range keys {
+		require.NotContains(t, gotKeys, string(c.Hash()))
+		gotKeys[string(c.Hash())] = struct{}{}
+	}
+	for _, mh := range append(mhs1, mhs2...) {
+		require.Contains(t, gotKeys, string(mh))
+	}
+	require.Equal(t, errReadOnlyBlockstore, bs.DeleteBlock(ctx, cid.NewCidV1(cid.Raw, mhs1[0])))
+	require.NoError(t, bs.Close())
+
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(shard2, later, later))
+	entry, err := subject.Check(ctx, contextID)
+	require.NoError(t, err)
+	require.Equal(t, CarStatusModified, entry.Status)
+	require.Contains(t, entry.Detail, shard2)
+
+	// Assert that putting the same set of shards does not re-advertise the context ID.
+	mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), contextID, md).Return(cid.Undef, provider.ErrAlreadyAdvertised)
+	_, err = subject.PutShards(ctx, contextID, []string{shard3, shard2, shard1}, md)
+	require.Equal(t, provider.ErrAlreadyAdvertised, err)
+
+	// Assert that removing shards re-advertises the context ID with the multihashes of the
+	// remaining shard only.
+	gomock.InOrder(
+		mockEng.EXPECT().NotifyRemove(ctx, peer.ID(""), contextID),
+		mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), contextID, md),
+	)
+	_, err = subject.PutShards(ctx, contextID, []string{shard2}, md)
+	require.NoError(t, err)
+	require.ElementsMatch(t, mhs2, listAllMultihashes(t, ctx, subject, contextID))
+	paths, err = subject.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{shard2}, paths)
+
+	// Assert that the persisted indexes of the removed shards are deleted.
+	for _, shard := range []string{shard1, shard3} {
+		fpKey, dataKey := toCarIndexKeys(contextID, shard)
+		for _, key := range []datastore.Key{fpKey, dataKey} {
+			has, err := ds.Has(ctx, key)
+			require.NoError(t, err)
+			require.False(t, has)
+		}
+	}
+
+	mockEng.EXPECT().NotifyRemove(ctx, peer.ID(""), contextID)
+	_, err = subject.Remove(ctx, contextID)
+	require.NoError(t, err)
+	results, err := ds.Query(ctx, query.Query{KeysOnly: true})
+	require.NoError(t, err)
+	remaining, err := results.Rest()
+	require.NoError(t, err)
+	require.Empty(t, remaining)
+}
+
+func readCarMultihashes(t *testing.T, path string) []multihash.Multihash {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+	br, err := car.NewBlockReader(f)
+	require.NoError(t, err)
+	var mhs []multihash.Multihash
+	for {
+		blk, err := br.Next()
+		if err == io.EOF {
+			return mhs
+		}
+		require.NoError(t, err)
+		// Identity multihashes are not indexed by default.
+		if blk.Cid().Prefix().MhType != multihash.IDENTITY {
+			mhs = append(mhs, blk.Cid().Hash())
+		}
+	}
+}
+
+// writeRandomCar writes a CAR file with distinct random content at the given path.
+func writeRandomCar(t *testing.T, rng *rand.Rand, path string) {
+	var blks []blocks.Block
+	for i := 0; i < 10; i++ {
+		data := make([]byte, 256)
+		rng.Read(data)
+		c, err := cid.Prefix{Version: 1, Codec: cid.Raw, MhType: multihash.SHA2_256, MhLength: -1}.Sum(data)
+		require.NoError(t, err)
+		blk, err := blocks.NewBlockWithCid(data, c)
+		require.NoError(t, err)
+		blks = append(blks, blk)
+	}
+	bs, err := blockstore.OpenReadWrite(path, []cid.Cid{blks[0].Cid()})
+	require.NoError(t, err)
+	require.NoError(t, bs.PutMany(context.Background(), blks))
+	require.NoError(t, bs.Finalize())
+}
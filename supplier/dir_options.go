@@ -0,0 +1,83 @@
+package supplier
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/filecoin-project/index-provider/metadata"
+)
+
+type (
+	// MetadataFunc returns the metadata to advertise for the CAR at the given path, identified by
+	// the given context ID.
+	MetadataFunc func(ctx context.Context, contextID []byte, path string) (metadata.Metadata, error)
+
+	// DirOption captures a configurable parameter of DirSupplier.
+	DirOption func(*dirOptions) error
+
+	dirOptions struct {
+		mdFunc       MetadataFunc
+		pollInterval time.Duration
+		settleDelay  time.Duration
+		disableWatch bool
+	}
+)
+
+func newDirOptions(o ...DirOption) (*dirOptions, error) {
+	opts := &dirOptions{
+		mdFunc: func(context.Context, []byte, string) (metadata.Metadata, error) {
+			return metadata.Default.New(metadata.Bitswap{}), nil
+		},
+		pollInterval: time.Minute,
+		settleDelay:  time.Second,
+	}
+	for _, apply := range o {
+		if err := apply(opts); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// WithMetadataFunc sets the function that returns the metadata advertised for each CAR file.
+// If unset, the CAR files are advertised as retrievable over Bitswap.
+func WithMetadataFunc(f MetadataFunc) DirOption {
+	return func(o *dirOptions) error {
+		o.mdFunc = f
+		return nil
+	}
+}
+
+// WithPollInterval sets the interval at which the watched directories are scanned for changes
+// when they cannot be watched for file system events, e.g. on platforms other than Linux.
+// If unset, the default of one minute is used.
+func WithPollInterval(d time.Duration) DirOption {
+	return func(o *dirOptions) error {
+		if d <= 0 {
+			return fmt.Errorf("poll interval must be greater than zero; got %s", d)
+		}
+		o.pollInterval = d
+		return nil
+	}
+}
+
+// WithSettleDelay sets the duration for which a CAR file must remain unmodified before it is
+// advertised, so that files that are being written are not advertised prematurely.
+// If unset, the default of one second is used.
+func WithSettleDelay(d time.Duration) DirOption {
+	return func(o *dirOptions) error {
+		o.settleDelay = d
+		return nil
+	}
+}
+
+// WithPolling sets whether to always scan the watched directories at the poll interval instead of
+// watching them for file system events.
+// If unset, file system events are used where supported.
+func WithPolling(enabled bool) DirOption {
+	return func(o *dirOptions) error {
+		o.disableWatch = enabled
+		return nil
+	}
+}
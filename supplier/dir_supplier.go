@@ -0,0 +1,361 @@
+package supplier
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	provider "github.com/filecoin-project/index-provider"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/query"
+)
+
+const dirSupplierCarKeyPrefix = "dir_supplier://car/"
+
+// DirSupplier advertises the CAR files in a set of directories via a CarSupplier, keeping the
+// advertised content in sync with the files present in the directories: a CAR file is advertised
+// once it appears in a directory, re-advertised when it is modified and its advertisement is
+// removed when the file disappears.
+//
+// Only the files with ".car" extension at the top level of each directory are considered.
+// The directories are watched for changes via inotify on Linux; elsewhere, or if watching fails,
+// the directories are scanned periodically instead. See: WithPollInterval.
+//
+// The context ID of each CAR file is the SHA-256 hash of its absolute path, which is stable across
+// restarts and matches the context ID generated by the provider CLI when importing a CAR file
+// without an explicit key. The files advertised are persisted in the datastore, so that changes
+// made while the supplier is not running are reconciled by DirSupplier.Start, including the removal
+// of directories from the set.
+type DirSupplier struct {
+	*dirOptions
+	cs   *CarSupplier
+	ds   datastore.Datastore
+	dirs []string
+
+	// reconcileLock serialises reconciliations.
+	reconcileLock sync.Mutex
+	cancel        context.CancelFunc
+	done          chan struct{}
+}
+
+// dirCarState is the persisted state of a CAR file advertised by DirSupplier.
+type dirCarState struct {
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// DuplicateOf is the context ID under which content identical to that of the file is supplied,
+	// in which case the file itself is not advertised.
+	DuplicateOf []byte `json:"duplicate_of,omitempty"`
+}
+
+func (s dirCarState) sameFile(other dirCarState) bool {
+	return s.Path == other.Path && s.Size == other.Size && s.ModTime.Equal(other.ModTime)
+}
+
+// NewDirSupplier instantiates a new DirSupplier that advertises the CAR files in the given
+// directories via the given CarSupplier, and persists its state in the given datastore.
+// The supplier must be started via DirSupplier.Start. With no directories, the supplier only
+// removes the advertisements of the CAR files in previously given directories upon reconciliation.
+func NewDirSupplier(cs *CarSupplier, ds datastore.Datastore, dirs []string, o ...DirOption) (*DirSupplier, error) {
+	opts, err := newDirOptions(o...)
+	if err != nil {
+		return nil, err
+	}
+	absDirs := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		absDir, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		absDirs = append(absDirs, absDir)
+	}
+	return &DirSupplier{
+		dirOptions: opts,
+		cs:         cs,
+		ds:         ds,
+		dirs:       absDirs,
+	}, nil
+}
+
+// Start reconciles the advertised CAR files with the files present in the directories, then
+// starts watching the directories for changes in the background until DirSupplier.Close is
+// called.
+func (d *DirSupplier) Start(ctx context.Context) error {
+	if _, err := d.Reconcile(ctx); err != nil {
+		return err
+	}
+
+	var events <-chan struct{}
+	var w *dirWatcher
+	if !d.disableWatch {
+		var err error
+		w, err = newDirWatcher(d.dirs)
+		if err != nil {
+			log.Warnw("Cannot watch directories for changes; falling back on polling", "err", err, "pollInterval", d.pollInterval)
+		} else {
+			events = w.events
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	d.done = make(chan struct{})
+	go d.run(runCtx, w, events)
+	return nil
+}
+
+func (d *DirSupplier) run(ctx context.Context, w *dirWatcher, events <-chan struct{}) {
+	defer close(d.done)
+	if w != nil {
+		defer w.close()
+	}
+
+	// Poll only if the directories are not watched.
+	var poll <-chan time.Time
+	if events == nil {
+		ticker := time.NewTicker(d.pollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	// Debounce file system events, since writing a single file produces many.
+	settle := time.NewTimer(d.settleDelay)
+	settle.Stop()
+	defer settle.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-events:
+			settle.Reset(d.settleDelay)
+			continue
+		case <-settle.C:
+		case <-poll:
+		}
+
+		pending, err := d.Reconcile(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Errorw("Failed to reconcile CAR files in watched directories", "err", err)
+		}
+		if pending {
+			// Some files were still being written; check again once they have settled.
+			settle.Reset(d.settleDelay)
+		}
+	}
+}
+
+// Reconcile advertises the CAR files that are new or modified in the directories and removes the
+// advertisements of the files that no longer exist, or that are in directories no longer given to
+// the supplier. It returns true if some files were skipped
+// because they were modified too recently, in which case Reconcile should be called again once
+// they have settled. See: WithSettleDelay.
+//
+// Reconcile is called automatically by the supplier once started, and need not be called
+// explicitly.
+func (d *DirSupplier) Reconcile(ctx context.Context) (bool, error) {
+	d.reconcileLock.Lock()
+	defer d.reconcileLock.Unlock()
+
+	advertised, err := d.loadStates(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var pending bool
+	present := make(map[string]dirCarState)
+	scanned := make(map[string]struct{})
+	for _, dir := range d.dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			// Leave the advertisements of the files in this directory as they are, so that
+			// the directory being temporarily unavailable does not remove them all.
+			log.Errorw("Cannot read watched directory", "dir", dir, "err", err)
+			continue
+		}
+		scanned[dir] = struct{}{}
+		for _, entry := range entries {
+			if entry.IsDir() || !strings.EqualFold(filepath.Ext(entry.Name()), ".car") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					continue
+				}
+				return false, err
+			}
+			if !info.Mode().IsRegular() {
+				continue
+			}
+			if time.Since(info.ModTime()) < d.settleDelay {
+				pending = true
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			present[string(DirCarContextID(path))] = dirCarState{
+				Path:    path,
+				Size:    info.Size(),
+				ModTime: info.ModTime(),
+			}
+		}
+	}
+
+	configured := make(map[string]struct{}, len(d.dirs))
+	for _, dir := range d.dirs {
+		configured[dir] = struct{}{}
+	}
+	for contextID, state := range advertised {
+		dir := filepath.Dir(state.Path)
+		if _, ok := configured[dir]; !ok {
+			// The directory is no longer watched; stop advertising its files.
+			if err := d.remove(ctx, []byte(contextID), state); err != nil {
+				return pending, err
+			}
+			continue
+		}
+		if _, ok := scanned[dir]; !ok {
+			continue
+		}
+		current, ok := present[contextID]
+		if ok && current.sameFile(state) {
+			continue
+		}
+		if !ok {
+			if _, err := os.Stat(state.Path); err == nil {
+				// The file is still being modified; handle it once it settles.
+				continue
+			}
+		}
+		if err := d.remove(ctx, []byte(contextID), state); err != nil {
+			return pending, err
+		}
+	}
+
+	for contextID, state := range present {
+		if previous, ok := advertised[contextID]; ok && previous.sameFile(state) {
+			if previous.DuplicateOf == nil {
+				continue
+			}
+			// Advertise a duplicate file only once its identical content is no longer supplied,
+			// without digesting the file again until then.
+			supplied, err := d.cs.supplies(ctx, previous.DuplicateOf)
+			if err != nil {
+				return pending, err
+			}
+			if supplied {
+				continue
+			}
+		}
+		if err := d.put(ctx, []byte(contextID), state); err != nil {
+			if ctx.Err() != nil {
+				return pending, ctx.Err()
+			}
+			// Retry on the next reconciliation, e.g. once a partially written file is complete.
+			log.Errorw("Failed to advertise CAR file", "path", state.Path, "err", err)
+		}
+	}
+	return pending, nil
+}
+
+func (d *DirSupplier) put(ctx context.Context, contextID []byte, state dirCarState) error {
+	md, err := d.mdFunc(ctx, contextID, state.Path)
+	if err != nil {
+		return err
+	}
+	adCid, err := d.cs.PutShards(ctx, contextID, []string{state.Path}, md, WithDuplicateDetection(true))
+	var dupErr *DuplicateCarError
+	switch {
+	case err == nil:
+		log.Infow("Advertised CAR file", "path", state.Path, "adCid", adCid)
+	case err == provider.ErrAlreadyAdvertised:
+		log.Infow("CAR file is already advertised", "path", state.Path)
+	case errors.As(err, &dupErr):
+		// Record the file as a duplicate, so that it is advertised on a later reconciliation once
+		// the identical content is no longer supplied.
+		log.Infow("Identical content is already advertised; skipping CAR file", "path", state.Path, "adCid", dupErr.AdCid)
+		state.DuplicateOf = dupErr.ContextID
+	default:
+		return err
+	}
+	return d.putState(ctx, contextID, state)
+}
+
+func (d *DirSupplier) remove(ctx context.Context, contextID []byte, state dirCarState) error {
+	adCid, err := d.cs.Remove(ctx, contextID)
+	switch err {
+	case nil:
+		log.Infow("Removed advertisement of CAR file", "path", state.Path, "adCid", adCid)
+	case ErrNotFound, provider.ErrContextIDNotFound:
+		log.Infow("CAR file is not advertised", "path", state.Path)
+	default:
+		return err
+	}
+	return d.ds.Delete(ctx, dirCarStateKey(contextID))
+}
+
+func (d *DirSupplier) loadStates(ctx context.Context) (map[string]dirCarState, error) {
+	results, err := d.ds.Query(ctx, query.Query{Prefix: dirSupplierCarKeyPrefix})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	states := make(map[string]dirCarState)
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		contextID, err := hex.DecodeString(datastore.RawKey(r.Key).BaseNamespace())
+		if err != nil {
+			return nil, err
+		}
+		var state dirCarState
+		if err := json.Unmarshal(r.Value, &state); err != nil {
+			return nil, err
+		}
+		states[string(contextID)] = state
+	}
+	return states, nil
+}
+
+func (d *DirSupplier) putState(ctx context.Context, contextID []byte, state dirCarState) error {
+	value, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return d.ds.Put(ctx, dirCarStateKey(contextID), value)
+}
+
+func dirCarStateKey(contextID []byte) datastore.Key {
+	return datastore.NewKey(dirSupplierCarKeyPrefix + hex.EncodeToString(contextID))
+}
+
+// DirCarContextID returns the context ID under which DirSupplier advertises the CAR file at the
+// given path, i.e. the SHA-256 hash of its absolute path.
+func DirCarContextID(path string) []byte {
+	if absPath, err := filepath.Abs(path); err == nil {
+		path = absPath
+	}
+	h := sha256.Sum256([]byte(path))
+	return h[:]
+}
+
+// Close stops watching the directories. The advertised CAR files are left as they are.
+func (d *DirSupplier) Close() error {
+	if d.cancel != nil {
+		d.cancel()
+		<-d.done
+	}
+	return nil
+}
@@ -0,0 +1,248 @@
+package supplier
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/index-provider/metadata"
+	mock_provider "github.com/filecoin-project/index-provider/mock"
+	"github.com/filecoin-project/index-provider/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirSupplier_AdvertisesAndRemovesCars(t *testing.T) {
+	tests := []struct {
+		name    string
+		polling bool
+	}{
+		{name: "Watching"},
+		{name: "Polling", polling: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testutil.ContextWithTimeout(t)
+			mc := gomock.NewController(t)
+			mockEng := mock_provider.NewMockInterface(mc)
+			mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+			ds := dssync.MutexWrap(datastore.NewMapDatastore())
+			cs := NewCarSupplier(mockEng, ds)
+
+			dir := t.TempDir()
+			subject, err := NewDirSupplier(cs, ds, []string{dir},
+				WithPolling(tt.polling),
+				WithPollInterval(10*time.Millisecond),
+				WithSettleDelay(10*time.Millisecond))
+			require.NoError(t, err)
+			require.NoError(t, subject.Start(ctx))
+			defer subject.Close()
+
+			carPath := filepath.Join(dir, "sample.car")
+			wantContextID := DirCarContextID(carPath)
+			wantMd := metadata.Default.New(metadata.Bitswap{})
+
+			put := make(chan struct{})
+			mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(wantContextID), gomock.Eq(wantMd)).
+				DoAndReturn(func(context.Context, interface{}, []byte, metadata.Metadata) (cid.Cid, error) {
+					close(put)
+					return cid.Undef, nil
+				})
+			// Files that are not CARs are ignored.
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "fish.txt"), []byte("lobster"), 0666))
+			testutil.CopyFile(t, "../testdata/sample-v1.car", carPath)
+			waitFor(t, ctx, put)
+
+			gotPaths, err := cs.List(ctx)
+			require.NoError(t, err)
+			require.Equal(t, []string{carPath}, gotPaths)
+
+			removed := make(chan struct{})
+			mockEng.EXPECT().NotifyRemove(gomock.Any(), gomock.Any(), gomock.Eq(wantContextID)).
+				DoAndReturn(func(context.Context, interface{}, []byte) (cid.Cid, error) {
+					close(removed)
+					return cid.Undef, nil
+				})
+			require.NoError(t, os.Remove(carPath))
+			waitFor(t, ctx, removed)
+
+			require.NoError(t, subject.Close())
+			gotPaths, err = cs.List(ctx)
+			require.NoError(t, err)
+			require.Empty(t, gotPaths)
+		})
+	}
+}
+
+func TestDirSupplier_ReconcilesOnStart(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	cs := NewCarSupplier(mockEng, ds)
+	dir := t.TempDir()
+	wantMd := metadata.Default.New(metadata.Bitswap{})
+
+	removedPath := filepath.Join(dir, "removed.car")
+	unchangedPath := filepath.Join(dir, "unchanged.car")
+	addedPath := filepath.Join(dir, "added.car")
+	testutil.CopyFile(t, "../testdata/sample-v1.car", removedPath)
+	testutil.CopyFile(t, "../testdata/sample-v1-2.car", unchangedPath)
+	backdate(t, removedPath, unchangedPath)
+
+	// Advertise the files present before the supplier is stopped.
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(DirCarContextID(removedPath)), gomock.Eq(wantMd))
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(DirCarContextID(unchangedPath)), gomock.Eq(wantMd))
+	subject, err := NewDirSupplier(cs, ds, []string{dir}, WithPolling(true), WithSettleDelay(0))
+	require.NoError(t, err)
+	require.NoError(t, subject.Start(ctx))
+	require.NoError(t, subject.Close())
+
+	// Change the directory while the supplier is stopped.
+	require.NoError(t, os.Remove(removedPath))
+	writeRandomCar(t, rand.New(rand.NewSource(1413)), addedPath)
+	backdate(t, addedPath)
+
+	// Assert that changes are reconciled upon start, leaving the unchanged file as is.
+	mockEng.EXPECT().NotifyRemove(gomock.Any(), gomock.Any(), gomock.Eq(DirCarContextID(removedPath)))
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(DirCarContextID(addedPath)), gomock.Eq(wantMd))
+	subject, err = NewDirSupplier(cs, ds, []string{dir}, WithPolling(true), WithSettleDelay(0))
+	require.NoError(t, err)
+	require.NoError(t, subject.Start(ctx))
+	defer subject.Close()
+
+	gotPaths, err := cs.List(ctx)
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{unchangedPath, addedPath}, gotPaths)
+}
+
+func TestDirSupplier_RemovesCarsOfUnconfiguredDirsOnStart(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	cs := NewCarSupplier(mockEng, ds)
+	keptDir := t.TempDir()
+	droppedDir := t.TempDir()
+	wantMd := metadata.Default.New(metadata.Bitswap{})
+
+	keptPath := filepath.Join(keptDir, "kept.car")
+	droppedPath := filepath.Join(droppedDir, "dropped.car")
+	testutil.CopyFile(t, "../testdata/sample-v1.car", keptPath)
+	testutil.CopyFile(t, "../testdata/sample-v1-2.car", droppedPath)
+	backdate(t, keptPath, droppedPath)
+
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(DirCarContextID(keptPath)), gomock.Eq(wantMd))
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(DirCarContextID(droppedPath)), gomock.Eq(wantMd))
+	subject, err := NewDirSupplier(cs, ds, []string{keptDir, droppedDir}, WithPolling(true), WithSettleDelay(0))
+	require.NoError(t, err)
+	require.NoError(t, subject.Start(ctx))
+	require.NoError(t, subject.Close())
+
+	// Assert that the files of the directory no longer given are removed upon start, even though
+	// they still exist.
+	mockEng.EXPECT().NotifyRemove(gomock.Any(), gomock.Any(), gomock.Eq(DirCarContextID(droppedPath)))
+	subject, err = NewDirSupplier(cs, ds, []string{keptDir}, WithPolling(true), WithSettleDelay(0))
+	require.NoError(t, err)
+	require.NoError(t, subject.Start(ctx))
+	defer subject.Close()
+
+	gotPaths, err := cs.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{keptPath}, gotPaths)
+	states, err := subject.loadStates(ctx)
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	require.NoError(t, subject.Close())
+
+	// Assert that reconciling with no directories removes the files of all directories.
+	mockEng.EXPECT().NotifyRemove(gomock.Any(), gomock.Any(), gomock.Eq(DirCarContextID(keptPath)))
+	subject, err = NewDirSupplier(cs, ds, nil)
+	require.NoError(t, err)
+	_, err = subject.Reconcile(ctx)
+	require.NoError(t, err)
+	gotPaths, err = cs.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, gotPaths)
+	states, err = subject.loadStates(ctx)
+	require.NoError(t, err)
+	require.Empty(t, states)
+}
+
+func TestDirSupplier_RecordsDuplicates(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	cs := NewCarSupplier(mockEng, ds)
+	dir := t.TempDir()
+	wantMd := metadata.Default.New(metadata.Bitswap{})
+
+	// Write two files with identical content, only one of which is advertised.
+	paths := []string{filepath.Join(dir, "a.car"), filepath.Join(dir, "b.car")}
+	for _, path := range paths {
+		testutil.CopyFile(t, "../testdata/sample-v1.car", path)
+	}
+	backdate(t, paths...)
+	var advertised []byte
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), gomock.Any(), gomock.Eq(wantMd)).
+		DoAndReturn(func(_ context.Context, _ interface{}, contextID []byte, _ metadata.Metadata) (cid.Cid, error) {
+			advertised = contextID
+			return cid.Undef, nil
+		})
+	subject, err := NewDirSupplier(cs, ds, []string{dir}, WithPolling(true), WithSettleDelay(0))
+	require.NoError(t, err)
+	_, err = subject.Reconcile(ctx)
+	require.NoError(t, err)
+
+	advertisedPath, duplicatePath := paths[0], paths[1]
+	if bytes.Equal(advertised, DirCarContextID(duplicatePath)) {
+		advertisedPath, duplicatePath = duplicatePath, advertisedPath
+	}
+	require.Equal(t, DirCarContextID(advertisedPath), advertised)
+
+	// Assert that the duplicate is recorded, and is not put again while its identical content is
+	// supplied.
+	states, err := subject.loadStates(ctx)
+	require.NoError(t, err)
+	require.Len(t, states, 2)
+	require.Equal(t, advertised, states[string(DirCarContextID(duplicatePath))].DuplicateOf)
+	_, err = subject.Reconcile(ctx)
+	require.NoError(t, err)
+
+	// Assert that the duplicate is advertised once its identical content is no longer supplied.
+	mockEng.EXPECT().NotifyRemove(gomock.Any(), gomock.Any(), gomock.Eq(DirCarContextID(advertisedPath)))
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(DirCarContextID(duplicatePath)), gomock.Eq(wantMd))
+	require.NoError(t, os.Remove(advertisedPath))
+	_, err = subject.Reconcile(ctx)
+	require.NoError(t, err)
+	states, err = subject.loadStates(ctx)
+	require.NoError(t, err)
+	require.Len(t, states, 1)
+	require.Nil(t, states[string(DirCarContextID(duplicatePath))].DuplicateOf)
+}
+
+func backdate(t *testing.T, paths ...string) {
+	past := time.Now().Add(-time.Hour)
+	for _, path := range paths {
+		require.NoError(t, os.Chtimes(path, past, past))
+	}
+}
+
+func waitFor(t *testing.T, ctx context.Context, c <-chan struct{}) {
+	select {
+	case <-c:
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for notification")
+	}
+}
@@ -0,0 +1,59 @@
+package supplier
+
+import (
+	"github.com/fsnotify/fsnotify"
+)
+
+// dirWatcher signals changes to the files in a set of directories, using inotify.
+type dirWatcher struct {
+	w      *fsnotify.Watcher
+	events chan struct{}
+	done   chan struct{}
+}
+
+func newDirWatcher(dirs []string) (*dirWatcher, error) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if err := w.Add(dir); err != nil {
+			_ = w.Close()
+			return nil, err
+		}
+	}
+	dw := &dirWatcher{
+		w:      w,
+		events: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	go dw.forward()
+	return dw, nil
+}
+
+// forward coalesces the file system events into signals on the events channel.
+func (dw *dirWatcher) forward() {
+	defer close(dw.done)
+	for {
+		select {
+		case _, ok := <-dw.w.Events:
+			if !ok {
+				return
+			}
+			select {
+			case dw.events <- struct{}{}:
+			default:
+			}
+		case err, ok := <-dw.w.Errors:
+			if !ok {
+				return
+			}
+			log.Errorw("Error watching directories", "err", err)
+		}
+	}
+}
+
+func (dw *dirWatcher) close() {
+	_ = dw.w.Close()
+	<-dw.done
+}
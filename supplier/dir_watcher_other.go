@@ -0,0 +1,17 @@
+//go:build !linux
+
+package supplier
+
+import "errors"
+
+// dirWatcher signals changes to the files in a set of directories. Watching is only supported on
+// Linux; elsewhere the directories are polled instead.
+type dirWatcher struct {
+	events chan struct{}
+}
+
+func newDirWatcher([]string) (*dirWatcher, error) {
+	return nil, errors.New("watching directories is not supported on this platform")
+}
+
+func (dw *dirWatcher) close() {}
@@ -1,5 +1,11 @@
 // Package supplier provides mechanisms to supply mulithashes to an index-provider engine via
 // provider.MultihashLister
-// The only implemented mechanism is CarSupplier, that in conjunction with an engine allows a user
-// to advertise multihashes by simply providing CAR files.
+// The main mechanism is CarSupplier, that in conjunction with an engine allows a user
+// to advertise multihashes by simply providing CAR files. DirSupplier builds on CarSupplier to
+// automatically advertise the CAR files placed in a set of directories. UnixFSSupplier allows
+// a user to advertise plain files and directories by importing them as UnixFS DAGs.
+//
+// Suppliers implement the Supplier interface, and can be registered together in a Registry that
+// lists multihashes and serves blocks across all of them, provided they are instantiated with
+// Registry.Engine.
 package supplier
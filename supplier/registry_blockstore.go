@@ -0,0 +1,164 @@
+package supplier
+
+import (
+	"context"
+	"errors"
+
+	"github.com/filecoin-project/index-provider/engine"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/multiformats/go-multihash"
+)
+
+var _ bstore.Blockstore = (*registryBlockstore)(nil)
+
+// Blockstore returns a read-only blockstore over the union of the blocks supplied under all context
+// IDs of the registered suppliers. Each block is located via the local index of the engine if it
+// is enabled, i.e. engine.WithLocalIndex, which is persisted and kept up to date as content is
+// advertised. Otherwise, or if the local index has no records of the block, e.g. because it was
+// advertised before the index was enabled, blocks are located via the registered suppliers that
+// implement BlockLocator, which may need to look through all their content. Each block is read from the
+// blockstore of the first context ID that holds it.
+//
+// Blocks of CIDs with identity multihashes are served from the CIDs themselves, since suppliers do
+// not index them. Listing all keys is not supported, since the union of all supplied blocks may be
+// very large.
+func (r *Registry) Blockstore() bstore.Blockstore {
+	return bstore.NewIdStore(&registryBlockstore{r})
+}
+
+// registryBlockstore is a read-only blockstore that serves the blocks of all context IDs supplied
+// via a Registry.
+type registryBlockstore struct {
+	r *Registry
+}
+
+// localIndex is implemented by engines that maintain a local index of the multihashes they
+// advertise, i.e. engine.Engine.
+type localIndex interface {
+	FindLocal(ctx context.Context, mh multihash.Multihash) ([]engine.LocalIndexRecord, error)
+}
+
+// locate returns the context IDs under which the block with the given multihash is supplied.
+func (b *registryBlockstore) locate(ctx context.Context, mh multihash.Multihash) ([][]byte, error) {
+	if li, ok := b.r.eng.(localIndex); ok {
+		records, err := li.FindLocal(ctx, mh)
+		switch err {
+		case nil:
+			if len(records) != 0 {
+				contextIDs := make([][]byte, 0, len(records))
+				for _, record := range records {
+					contextIDs = append(contextIDs, record.ContextID)
+				}
+				return contextIDs, nil
+			}
+			// The multihash may have been advertised before the local index was enabled, in
+			// which case it is not indexed.
+		case engine.ErrLocalIndexDisabled:
+		default:
+			return nil, err
+		}
+	}
+
+	var contextIDs [][]byte
+	for _, s := range b.r.ordered() {
+		locator, ok := s.(BlockLocator)
+		if !ok {
+			continue
+		}
+		located, err := locator.Locate(ctx, mh)
+		if err != nil {
+			return nil, err
+		}
+		contextIDs = append(contextIDs, located...)
+	}
+	return contextIDs, nil
+}
+
+// withBlock calls f with the blockstore of the first context ID that holds the given block, and
+// returns format.ErrNotFound if there is none.
+func (b *registryBlockstore) withBlock(ctx context.Context, c cid.Cid, f func(ClosableBlockstore) error) error {
+	contextIDs, err := b.locate(ctx, c.Hash())
+	if err != nil {
+		return err
+	}
+	for _, contextID := range contextIDs {
+		bs, err := b.r.ReadOnlyBlockstore(contextID)
+		if err == ErrNotFound {
+			// The context ID was removed since it was located.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		err = f(bs)
+		if cerr := bs.Close(); cerr != nil {
+			log.Warnw("Failed to close blockstore", "contextID", contextID, "err", cerr)
+		}
+		if format.IsNotFound(err) {
+			continue
+		}
+		return err
+	}
+	return format.ErrNotFound{Cid: c}
+}
+
+func (b *registryBlockstore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	err := b.withBlock(ctx, c, func(bs ClosableBlockstore) error {
+		has, err := bs.Has(ctx, c)
+		if err == nil && !has {
+			err = format.ErrNotFound{Cid: c}
+		}
+		return err
+	})
+	if format.IsNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b *registryBlockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	var blk blocks.Block
+	err := b.withBlock(ctx, c, func(bs ClosableBlockstore) error {
+		var err error
+		blk, err = bs.Get(ctx, c)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return blk, nil
+}
+
+func (b *registryBlockstore) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	size := -1
+	err := b.withBlock(ctx, c, func(bs ClosableBlockstore) error {
+		var err error
+		size, err = bs.GetSize(ctx, c)
+		return err
+	})
+	if err != nil {
+		return -1, err
+	}
+	return size, nil
+}
+
+func (*registryBlockstore) AllKeysChan(context.Context) (<-chan cid.Cid, error) {
+	return nil, errors.New("listing all keys of supplied blocks is not supported")
+}
+
+func (*registryBlockstore) HashOnRead(bool) {}
+
+func (*registryBlockstore) Put(context.Context, blocks.Block) error {
+	return errReadOnlyBlockstore
+}
+
+func (*registryBlockstore) PutMany(context.Context, []blocks.Block) error {
+	return errReadOnlyBlockstore
+}
+
+func (*registryBlockstore) DeleteBlock(context.Context, cid.Cid) error {
+	return errReadOnlyBlockstore
+}
@@ -0,0 +1,308 @@
+package supplier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ipld/go-car/v2"
+	"github.com/ipld/go-car/v2/blockstore"
+	"github.com/ipld/go-car/v2/index"
+	"github.com/multiformats/go-multicodec"
+)
+
+const (
+	// remoteCarChunkSize is the size of the byte ranges in which remote CARs are fetched.
+	remoteCarChunkSize = 256 << 10
+	// remoteCarMaxChunks is the maximum number of fetched chunks cached per remote CAR reader.
+	remoteCarMaxChunks = 16
+	// remoteCarRequestTimeout is the maximum duration of a single request to a remote CAR.
+	remoteCarRequestTimeout = time.Minute
+)
+
+// IsRemoteCar returns true if the given CAR location is an HTTP(S) URL rather than a local path.
+func IsRemoteCar(path string) bool {
+	return strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://")
+}
+
+// cleanCarPath cleans the given CAR location. URLs are left as they are, since cleaning them as
+// file paths would alter their scheme.
+func cleanCarPath(path string) string {
+	if IsRemoteCar(path) {
+		return path
+	}
+	return filepath.Clean(path)
+}
+
+// openCar opens a reader over the CAR at the given location, which is either a local path or
+// an HTTP(S) URL.
+func (cs *CarSupplier) openCar(ctx context.Context, path string) (*car.Reader, error) {
+	if !IsRemoteCar(path) {
+		return car.OpenReader(path, cs.opts...)
+	}
+	r, err := newRemoteCarReader(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return car.NewReader(r, cs.opts...)
+}
+
+// openReadOnlyBlockstore opens a read-only blockstore over the CAR shard of the given context ID
+// at the given location. The blocks of a remote CAR are fetched on demand, and located via its
+// persisted index.
+func (cs *CarSupplier) openReadOnlyBlockstore(ctx context.Context, contextID []byte, path string) (ClosableBlockstore, error) {
+	if !IsRemoteCar(path) {
+		return cs.openLocalReadOnlyBlockstore(ctx, contextID, path)
+	}
+	idx, err := cs.cachedIterableIndex(ctx, contextID, path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := newRemoteCarReader(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return blockstore.NewReadOnly(r, idx, cs.opts...)
+}
+
+// lookupRemoteIterableIndex returns the index of the remote CAR at the given URL. Since reading
+// the index of a remote CAR requires fetching it, or the entire CAR if it has no index, the index
+// is always persisted and reused for as long as the remote CAR remains unchanged.
+func (cs *CarSupplier) lookupRemoteIterableIndex(ctx context.Context, contextID []byte, path string) (index.IterableIndex, error) {
+	log := log.With("contextID", contextID, "path", path)
+
+	fingerprint, err := fingerprintRemoteCar(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	idx, err := cs.loadIndex(ctx, contextID, fingerprint)
+	switch {
+	case err != nil:
+		log.Warnw("Failed to load persisted CAR index; fetching index.", "err", err)
+	case idx != nil:
+		log.Debugw("Using persisted CAR index.")
+		return idx, nil
+	default:
+		log.Debugw("No up-to-date persisted CAR index; fetching index.")
+	}
+
+	cr, err := car.NewReader(newRemoteCarReaderAt(path, fingerprint), cs.opts...)
+	if err != nil {
+		return nil, err
+	}
+	idx, err = readIterableIndex(cr)
+	if err != nil {
+		return nil, err
+	}
+	if idx == nil {
+		log.Debugw("Remote CAR has no iterable index; generating index.")
+		if idx, err = cs.generateIterableIndex(cr); err != nil {
+			return nil, err
+		}
+	}
+	if err := cs.storeIndex(ctx, contextID, fingerprint, idx); err != nil {
+		log.Warnw("Failed to persist remote CAR index.", "err", err)
+	}
+	return idx, nil
+}
+
+// readIterableIndex reads the index embedded in the given CAR, or returns nil if there is none or
+// it is not iterable.
+func readIterableIndex(cr *car.Reader) (index.IterableIndex, error) {
+	idxReader, err := cr.IndexReader()
+	if err != nil || idxReader == nil {
+		return nil, err
+	}
+	idx, err := index.ReadFrom(idxReader)
+	if err != nil {
+		return nil, err
+	}
+	if idx.Codec() != multicodec.CarMultihashIndexSorted {
+		return nil, nil
+	}
+	itIdx, _ := idx.(index.IterableIndex)
+	return itIdx, nil
+}
+
+// fingerprintRemoteCar fingerprints the remote CAR at the given URL via a HEAD request. An error
+// wrapping os.ErrNotExist is returned if the server reports that the CAR does not exist.
+func fingerprintRemoteCar(ctx context.Context, url string) (carFingerprint, error) {
+	ctx, cancel := context.WithTimeout(ctx, remoteCarRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return carFingerprint{}, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return carFingerprint{}, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusGone:
+		return carFingerprint{}, fmt.Errorf("%s: %w", url, os.ErrNotExist)
+	default:
+		return carFingerprint{}, fmt.Errorf("unexpected response status for remote CAR %s: %s", url, resp.Status)
+	}
+	if resp.ContentLength < 0 {
+		return carFingerprint{}, fmt.Errorf("remote CAR %s has unknown size", url)
+	}
+	fingerprint := carFingerprint{
+		Path: url,
+		Size: resp.ContentLength,
+		ETag: resp.Header.Get("ETag"),
+	}
+	if lm := resp.Header.Get("Last-Modified"); lm != "" {
+		if fingerprint.ModTime, err = http.ParseTime(lm); err != nil {
+			return carFingerprint{}, fmt.Errorf("invalid Last-Modified header for remote CAR %s: %w", url, err)
+		}
+	}
+	return fingerprint, nil
+}
+
+// remoteCarReader reads a remote CAR via HTTP range requests. Bytes are fetched in chunks of
+// remoteCarChunkSize, and the most recently fetched chunks are cached so that the many small reads
+// made when decoding a CAR do not each result in a request.
+type remoteCarReader struct {
+	url  string
+	size int64
+	etag string
+
+	lock   sync.Mutex
+	chunks map[int64][]byte
+	// order lists the offsets of cached chunks from least to most recently fetched.
+	order []int64
+	// fetching holds the chunks that are being fetched, keyed by offset.
+	fetching map[int64]*chunkFetch
+}
+
+// chunkFetch is the result of fetching a chunk, which is available once done is closed.
+type chunkFetch struct {
+	done  chan struct{}
+	chunk []byte
+	err   error
+}
+
+var _ io.ReaderAt = (*remoteCarReader)(nil)
+
+func newRemoteCarReader(ctx context.Context, url string) (*remoteCarReader, error) {
+	fingerprint, err := fingerprintRemoteCar(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	return newRemoteCarReaderAt(url, fingerprint), nil
+}
+
+// newRemoteCarReaderAt instantiates a reader over the version of the remote CAR at the given URL
+// that is identified by the given fingerprint. Reads fail if the server reports that the CAR has
+// changed since, provided that it identifies versions via ETag.
+func newRemoteCarReaderAt(url string, fingerprint carFingerprint) *remoteCarReader {
+	return &remoteCarReader{
+		url:      url,
+		size:     fingerprint.Size,
+		etag:     fingerprint.ETag,
+		chunks:   make(map[int64][]byte),
+		fetching: make(map[int64]*chunkFetch),
+	}
+}
+
+func (r *remoteCarReader) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	var n int
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos >= r.size {
+			return n, io.EOF
+		}
+		chunkOff := pos - pos%remoteCarChunkSize
+		chunk, err := r.chunk(chunkOff)
+		if err != nil {
+			return n, err
+		}
+		n += copy(p[n:], chunk[pos-chunkOff:])
+	}
+	return n, nil
+}
+
+// chunk returns the chunk at the given offset, fetching it unless it is cached. The lock is not
+// held while fetching, so that reads of other chunks are not blocked by it; concurrent reads of
+// the same chunk wait for a single fetch instead.
+func (r *remoteCarReader) chunk(off int64) ([]byte, error) {
+	r.lock.Lock()
+	if chunk, ok := r.chunks[off]; ok {
+		r.lock.Unlock()
+		return chunk, nil
+	}
+	if f, ok := r.fetching[off]; ok {
+		r.lock.Unlock()
+		<-f.done
+		return f.chunk, f.err
+	}
+	f := &chunkFetch{done: make(chan struct{})}
+	r.fetching[off] = f
+	r.lock.Unlock()
+
+	f.chunk, f.err = r.fetch(off)
+
+	r.lock.Lock()
+	delete(r.fetching, off)
+	if f.err == nil {
+		if len(r.order) == remoteCarMaxChunks {
+			delete(r.chunks, r.order[0])
+			r.order = r.order[1:]
+		}
+		r.chunks[off] = f.chunk
+		r.order = append(r.order, off)
+	}
+	r.lock.Unlock()
+	close(f.done)
+	return f.chunk, f.err
+}
+
+func (r *remoteCarReader) fetch(off int64) ([]byte, error) {
+	end := off + remoteCarChunkSize
+	if end > r.size {
+		end = r.size
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), remoteCarRequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", off, end-1))
+	if r.etag != "" {
+		req.Header.Set("If-Match", r.etag)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		return nil, fmt.Errorf("server of remote CAR %s does not support range requests", r.url)
+	case http.StatusPreconditionFailed:
+		return nil, fmt.Errorf("remote CAR %s changed while being read", r.url)
+	default:
+		return nil, fmt.Errorf("unexpected response status for remote CAR %s: %s", r.url, resp.Status)
+	}
+	chunk := make([]byte, end-off)
+	if _, err := io.ReadFull(resp.Body, chunk); err != nil {
+		return nil, fmt.Errorf("failed to read range of remote CAR %s: %w", r.url, err)
+	}
+	return chunk, nil
+}
@@ -0,0 +1,219 @@
+package supplier
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/filecoin-project/index-provider/metadata"
+	mock_provider "github.com/filecoin-project/index-provider/mock"
+	"github.com/filecoin-project/index-provider/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipld/go-car/v2/blockstore"
+	"github.com/stretchr/testify/require"
+)
+
+// carServer serves the CAR files in a directory over HTTP, and records the requests made to it.
+type carServer struct {
+	*httptest.Server
+	dir string
+
+	lock sync.Mutex
+	gets []string
+}
+
+func newCarServer(t *testing.T) *carServer {
+	s := &carServer{dir: t.TempDir()}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, err := os.Open(filepath.Join(s.dir, filepath.Base(r.URL.Path)))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		require.NoError(t, err)
+		if r.Method == http.MethodGet {
+			s.lock.Lock()
+			s.gets = append(s.gets, r.Header.Get("Range"))
+			s.lock.Unlock()
+		}
+		http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// takeGets returns the Range headers of the GET requests made since the last call.
+func (s *carServer) takeGets() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	gets := s.gets
+	s.gets = nil
+	return gets
+}
+
+func TestRemoteCarIsReadViaRangeRequests(t *testing.T) {
+	tests := []struct {
+		name    string
+		carPath string
+	}{
+		{
+			name:    "CARv1",
+			carPath: "../testdata/sample-v1.car",
+		},
+		{
+			name:    "CARv2WithIndex",
+			carPath: "../testdata/sample-wrapped-v2.car",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := testutil.ContextWithTimeout(t)
+			server := newCarServer(t)
+			name := filepath.Base(tt.carPath)
+			testutil.CopyFile(t, tt.carPath, filepath.Join(server.dir, name))
+			url := server.URL + "/" + name
+
+			mc := gomock.NewController(t)
+			mockEng := mock_provider.NewMockInterface(mc)
+			mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+			subject := NewCarSupplier(mockEng, datastore.NewMapDatastore())
+
+			contextID := []byte("applesauce")
+			md := metadata.Default.New(metadata.Bitswap{})
+			mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), contextID, md)
+			_, err := subject.Put(ctx, contextID, url, md)
+			require.NoError(t, err)
+			paths, err := subject.List(ctx)
+			require.NoError(t, err)
+			require.Equal(t, []string{url}, paths)
+
+			wantMhs := readCarMultihashes(t, tt.carPath)
+			require.ElementsMatch(t, wantMhs, listAllMultihashes(t, ctx, subject, contextID))
+			gets := server.takeGets()
+			require.NotEmpty(t, gets)
+			for _, rng := range gets {
+				require.NotEmpty(t, rng, "remote CAR must only be read via range requests")
+			}
+
+			// Assert that the index is cached locally, and is not fetched again while the remote
+			// CAR is unchanged.
+			require.ElementsMatch(t, wantMhs, listAllMultihashes(t, ctx, subject, contextID))
+			require.Empty(t, server.takeGets())
+
+			// Assert that blocks are served from the remote CAR.
+			local, err := blockstore.OpenReadOnly(tt.carPath)
+			require.NoError(t, err)
+			defer local.Close()
+			bs, err := subject.ReadOnlyBlockstore(contextID)
+			require.NoError(t, err)
+			defer bs.Close()
+			for _, mh := range []int{0, len(wantMhs) / 2, len(wantMhs) - 1} {
+				c := cid.NewCidV1(cid.Raw, wantMhs[mh])
+				want, err := local.Get(ctx, c)
+				require.NoError(t, err)
+				got, err := bs.Get(ctx, c)
+				require.NoError(t, err)
+				require.Equal(t, want.RawData(), got.RawData())
+			}
+			for _, rng := range server.takeGets() {
+				require.NotEmpty(t, rng, "remote CAR must only be read via range requests")
+			}
+
+			entry, err := subject.Check(ctx, contextID)
+			require.NoError(t, err)
+			require.Equal(t, CarStatusOK, entry.Status)
+		})
+	}
+}
+
+func TestRemoteCarIsCheckedAndValidated(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	server := newCarServer(t)
+	path := filepath.Join(server.dir, "sample-v1.car")
+	testutil.CopyFile(t, "../testdata/sample-v1.car", path)
+	require.NoError(t, os.WriteFile(filepath.Join(server.dir, "fish.car"), []byte("lobster"), 0666))
+
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	subject := NewCarSupplier(mockEng, datastore.NewMapDatastore())
+	md := metadata.Default.New(metadata.Bitswap{})
+
+	_, err := subject.Put(ctx, []byte("fish"), server.URL+"/fish.car", md)
+	require.ErrorIs(t, err, ErrInvalidCar)
+	_, err = subject.Put(ctx, []byte("fish"), server.URL+"/missing.car", md)
+	require.ErrorIs(t, err, ErrInvalidCar)
+
+	contextID := []byte("applesauce")
+	mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), contextID, md)
+	_, err = subject.Put(ctx, contextID, server.URL+"/sample-v1.car", md)
+	require.NoError(t, err)
+
+	require.NoError(t, os.Remove(path))
+	entry, err := subject.Check(ctx, contextID)
+	require.NoError(t, err)
+	require.Equal(t, CarStatusMissing, entry.Status)
+}
+
+func TestRemoteCarReaderFetchesChunksConcurrently(t *testing.T) {
+	content := make([]byte, 2*remoteCarChunkSize)
+	for i := range content {
+		content[i] = byte(i)
+	}
+	firstChunkRange := fmt.Sprintf("bytes=0-%d", remoteCarChunkSize-1)
+	release := make(chan struct{})
+	var lock sync.Mutex
+	var gets []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rng := r.Header.Get("Range")
+		if r.Method == http.MethodGet {
+			lock.Lock()
+			gets = append(gets, rng)
+			lock.Unlock()
+			if rng == firstChunkRange {
+				<-release
+			}
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	subject := newRemoteCarReaderAt(server.URL, carFingerprint{Path: server.URL, Size: int64(len(content))})
+
+	// Read the first chunk concurrently, while its fetch is blocked.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			p := make([]byte, 8)
+			_, err := subject.ReadAt(p, int64(i))
+			require.NoError(t, err)
+			require.Equal(t, content[i:i+8], p)
+		}(i)
+	}
+
+	// Assert that the second chunk can be read while the first one is being fetched.
+	p := make([]byte, 8)
+	_, err := subject.ReadAt(p, remoteCarChunkSize)
+	require.NoError(t, err)
+	require.Equal(t, content[remoteCarChunkSize:remoteCarChunkSize+8], p)
+
+	close(release)
+	wg.Wait()
+
+	// Assert that the first chunk was fetched once, despite being read concurrently.
+	lock.Lock()
+	defer lock.Unlock()
+	require.ElementsMatch(t, []string{firstChunkRange, fmt.Sprintf("bytes=%d-%d", remoteCarChunkSize, len(content)-1)}, gets)
+}
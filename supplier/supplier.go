@@ -0,0 +1,200 @@
+package supplier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	provider "github.com/filecoin-project/index-provider"
+	"github.com/filecoin-project/index-provider/metadata"
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+)
+
+// Supplier supplies the content advertised under context IDs from a source of blocks, e.g. CAR
+// files or UnixFS files and directories. It lists the multihashes advertised under each context ID
+// for the engine, and serves the corresponding blocks for retrieval.
+//
+// Implementations return ErrNotFound for context IDs they do not supply, so that a Registry can
+// dispatch requests to the supplier of each context ID.
+type Supplier interface {
+	// Put makes the content at the given path suppliable under the given context ID, and
+	// advertises it with the given metadata. The path is interpreted by the supplier.
+	Put(ctx context.Context, contextID []byte, path string, md metadata.Metadata) (cid.Cid, error)
+	// Remove stops supplying the content of the given context ID, and advertises its removal.
+	Remove(ctx context.Context, contextID []byte) (cid.Cid, error)
+	// List lists the paths of the content that is supplied.
+	List(ctx context.Context) ([]string, error)
+	// ListMultihashes lists the multihashes of the content supplied under the given context ID.
+	// It is a provider.MultihashLister.
+	ListMultihashes(ctx context.Context, p peer.ID, contextID []byte) (provider.MultihashIterator, error)
+	// ReadOnlyBlockstore returns a blockstore of the blocks supplied under the given context ID.
+	ReadOnlyBlockstore(contextID []byte) (ClosableBlockstore, error)
+}
+
+// BlockLocator is implemented by suppliers that can locate the context IDs under which a block is
+// supplied, without knowing the context ID in advance. This allows the blocks of all context IDs of
+// a supplier to be served by multihash, e.g. over Bitswap.
+//
+// Locating a block may require looking through all the content of a supplier, and so suppliers are
+// only asked to locate blocks if the engine maintains no local index. See: Registry.Blockstore.
+type BlockLocator interface {
+	// Locate returns the context IDs under which the block with the given multihash is supplied,
+	// or no context IDs if there are none.
+	Locate(ctx context.Context, mh multihash.Multihash) ([][]byte, error)
+}
+
+var (
+	_ Supplier     = (*CarSupplier)(nil)
+	_ Supplier     = (*UnixFSSupplier)(nil)
+	_ BlockLocator = (*CarSupplier)(nil)
+	_ BlockLocator = (*UnixFSSupplier)(nil)
+)
+
+// The names under which the suppliers of this package are registered by the provider daemon.
+const (
+	CarSupplierName    = "car"
+	UnixFSSupplierName = "unixfs"
+)
+
+// ErrUnknownSupplier signals that no supplier is registered under a given name.
+var ErrUnknownSupplier = errors.New("unknown supplier")
+
+// Registry holds the suppliers of a provider by name, e.g. "car" or "unixfs". It is the single
+// provider.MultihashLister of the engine, and the single source of blocks for retrieval, both of
+// which it dispatches to the registered suppliers in order of registration until one supplies the
+// context ID.
+//
+// This allows multiple sources of blocks to advertise through the same engine, despite the engine
+// supporting a single multihash lister only. To that end, the suppliers must be instantiated with
+// Registry.Engine rather than the engine itself, so that they do not replace the registry as the
+// multihash lister of the engine.
+type Registry struct {
+	eng provider.Interface
+
+	lock      sync.RWMutex
+	suppliers map[string]Supplier
+	names     []string
+}
+
+// NewRegistry instantiates a new empty Registry of the suppliers that advertise via the given
+// provider.Interface, and registers it as the provider.MultihashLister of the given
+// provider.Interface.
+func NewRegistry(eng provider.Interface) *Registry {
+	r := &Registry{
+		eng:       eng,
+		suppliers: make(map[string]Supplier),
+	}
+	eng.RegisterMultihashLister(r.ListMultihashes)
+	return r
+}
+
+// Engine returns the provider.Interface with which to instantiate the suppliers registered with
+// this registry. It advertises via the engine of the registry, except that registering a
+// multihash lister on it has no effect, so that the registry remains the multihash lister of the
+// engine regardless of the order in which suppliers are instantiated and registered.
+func (r *Registry) Engine() provider.Interface {
+	return registryEngine{r.eng}
+}
+
+// registryEngine is a provider.Interface that ignores the registration of multihash listers.
+type registryEngine struct {
+	provider.Interface
+}
+
+func (registryEngine) RegisterMultihashLister(provider.MultihashLister) {}
+
+// Register registers the given supplier under the given name. The supplier must be instantiated
+// with Registry.Engine, so that its multihashes are listed via the registry.
+//
+// An error is returned if another supplier is already registered under the name.
+func (r *Registry) Register(name string, s Supplier) error {
+	if name == "" {
+		return errors.New("supplier name must not be empty")
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if _, ok := r.suppliers[name]; ok {
+		return fmt.Errorf("supplier %q is already registered", name)
+	}
+	r.suppliers[name] = s
+	r.names = append(r.names, name)
+	return nil
+}
+
+// Get returns the supplier registered under the given name. ErrUnknownSupplier is returned if
+// there is none.
+func (r *Registry) Get(name string) (Supplier, error) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	s, ok := r.suppliers[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownSupplier, name)
+	}
+	return s, nil
+}
+
+// Names returns the sorted names of the registered suppliers.
+func (r *Registry) Names() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	names := append([]string(nil), r.names...)
+	sort.Strings(names)
+	return names
+}
+
+// ordered returns the registered suppliers in order of registration.
+func (r *Registry) ordered() []Supplier {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	suppliers := make([]Supplier, 0, len(r.names))
+	for _, name := range r.names {
+		suppliers = append(suppliers, r.suppliers[name])
+	}
+	return suppliers
+}
+
+// ListMultihashes lists the multihashes of the given context ID via the first registered
+// supplier that supplies it. ErrNotFound is returned if none does.
+func (r *Registry) ListMultihashes(ctx context.Context, p peer.ID, contextID []byte) (provider.MultihashIterator, error) {
+	for _, s := range r.ordered() {
+		mhi, err := s.ListMultihashes(ctx, p, contextID)
+		if err != ErrNotFound {
+			return mhi, err
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ReadOnlyBlockstore returns the blockstore of the given context ID from the first registered
+// supplier that supplies it. ErrNotFound is returned if none does.
+func (r *Registry) ReadOnlyBlockstore(contextID []byte) (ClosableBlockstore, error) {
+	for _, s := range r.ordered() {
+		bs, err := s.ReadOnlyBlockstore(contextID)
+		if err != ErrNotFound {
+			return bs, err
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// ContextIDForPiece resolves the given piece CID to a context ID via the registered suppliers
+// that store piece CIDs, e.g. CarSupplier. ErrNotFound is returned if none resolves it.
+func (r *Registry) ContextIDForPiece(pieceCid cid.Cid) ([]byte, error) {
+	for _, s := range r.ordered() {
+		resolver, ok := s.(interface {
+			ContextIDForPiece(cid.Cid) ([]byte, error)
+		})
+		if !ok {
+			continue
+		}
+		contextID, err := resolver.ContextIDForPiece(pieceCid)
+		if err != ErrNotFound {
+			return contextID, err
+		}
+	}
+	return nil, ErrNotFound
+}
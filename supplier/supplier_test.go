@@ -0,0 +1,270 @@
+package supplier
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	provider "github.com/filecoin-project/index-provider"
+	"github.com/filecoin-project/index-provider/engine"
+	"github.com/filecoin-project/index-provider/metadata"
+	mock_provider "github.com/filecoin-project/index-provider/mock"
+	"github.com/filecoin-project/index-provider/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	format "github.com/ipfs/go-ipld-format"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegistryDispatchesToSuppliers(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	// Only the registry is registered as the lister, regardless of when suppliers are instantiated.
+	var lister provider.MultihashLister
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any()).Do(func(l provider.MultihashLister) { lister = l })
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	subject := NewRegistry(mockEng)
+	cs := NewCarSupplier(subject.Engine(), ds)
+	require.NoError(t, subject.Register(CarSupplierName, cs))
+	us, err := NewUnixFSSupplier(subject.Engine(), ds)
+	require.NoError(t, err)
+	require.NoError(t, subject.Register(UnixFSSupplierName, us))
+
+	require.ErrorContains(t, subject.Register(CarSupplierName, cs), "already registered")
+	require.Equal(t, []string{"car", "unixfs"}, subject.Names())
+	got, err := subject.Get(UnixFSSupplierName)
+	require.NoError(t, err)
+	require.Equal(t, us, got)
+	_, err = subject.Get("fish")
+	require.ErrorIs(t, err, ErrUnknownSupplier)
+
+	md := metadata.Default.New(metadata.Bitswap{})
+	carContextID := []byte("applesauce")
+	mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), carContextID, md)
+	_, err = cs.Put(ctx, carContextID, "../testdata/sample-v1.car", md)
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "fish.txt")
+	require.NoError(t, os.WriteFile(file, []byte("lobster"), 0666))
+	unixFSContextID := []byte("lobster")
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), unixFSContextID, md)
+	_, err = us.Put(ctx, unixFSContextID, file, md)
+	require.NoError(t, err)
+
+	// Assert that each context ID is listed and served by its supplier.
+	for _, tt := range []struct {
+		contextID []byte
+		supplier  Supplier
+	}{
+		{contextID: carContextID, supplier: cs},
+		{contextID: unixFSContextID, supplier: us},
+	} {
+		want, err := tt.supplier.ListMultihashes(ctx, "", tt.contextID)
+		require.NoError(t, err)
+		wantMhs := drainMultihashes(t, want)
+		gotMhs, err := subject.ListMultihashes(ctx, "", tt.contextID)
+		require.NoError(t, err)
+		require.Equal(t, wantMhs, drainMultihashes(t, gotMhs))
+		gotMhs, err = lister(ctx, "", tt.contextID)
+		require.NoError(t, err)
+		require.Equal(t, wantMhs, drainMultihashes(t, gotMhs))
+
+		bs, err := subject.ReadOnlyBlockstore(tt.contextID)
+		require.NoError(t, err)
+		require.NoError(t, bs.Close())
+	}
+
+	_, err = subject.ListMultihashes(ctx, "", []byte("fish"))
+	require.Equal(t, ErrNotFound, err)
+	_, err = subject.ReadOnlyBlockstore([]byte("fish"))
+	require.Equal(t, ErrNotFound, err)
+}
+
+func TestRegistryBlockstoreServesBlocksOfAllContextIDs(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	reg := NewRegistry(mockEng)
+	cs := NewCarSupplier(reg.Engine(), ds)
+	require.NoError(t, reg.Register(CarSupplierName, cs))
+	us, err := NewUnixFSSupplier(reg.Engine(), ds)
+	require.NoError(t, err)
+	require.NoError(t, reg.Register(UnixFSSupplierName, us))
+	subject := reg.Blockstore()
+
+	md := metadata.Default.New(metadata.Bitswap{})
+	carContextID := []byte("applesauce")
+	mockEng.EXPECT().NotifyPut(ctx, gomock.Nil(), carContextID, md)
+	_, err = cs.Put(ctx, carContextID, "../testdata/sample-v1.car", md)
+	require.NoError(t, err)
+
+	file := filepath.Join(t.TempDir(), "fish.txt")
+	require.NoError(t, os.WriteFile(file, []byte("lobster"), 0666))
+	unixFSContextID := []byte("lobster")
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), unixFSContextID, md)
+	_, err = us.Put(ctx, unixFSContextID, file, md)
+	require.NoError(t, err)
+	unixFSRoot, err := us.Root(ctx, unixFSContextID)
+	require.NoError(t, err)
+
+	carBs := testutil.OpenSampleCar(t, "sample-v1.car")
+	carCids, err := carBs.AllKeysChan(ctx)
+	require.NoError(t, err)
+	var wantCids []cid.Cid
+	for c := range carCids {
+		wantCids = append(wantCids, c)
+	}
+	require.NotEmpty(t, wantCids)
+	wantCids = append(wantCids, unixFSRoot)
+
+	for _, c := range wantCids {
+		contextIDs, err := cs.Locate(ctx, c.Hash())
+		require.NoError(t, err)
+		switch {
+		case c.Prefix().MhType == multihash.IDENTITY, c.Equals(unixFSRoot):
+			// Identity CIDs are not indexed, and the UnixFS content is not in any CAR.
+			require.Empty(t, contextIDs)
+		default:
+			require.Equal(t, [][]byte{carContextID}, contextIDs)
+		}
+
+		has, err := subject.Has(ctx, c)
+		require.NoError(t, err)
+		require.True(t, has)
+		blk, err := subject.Get(ctx, c)
+		require.NoError(t, err)
+		require.Equal(t, c, blk.Cid())
+		size, err := subject.GetSize(ctx, c)
+		require.NoError(t, err)
+		require.Equal(t, len(blk.RawData()), size)
+	}
+
+	absent := testutil.RandomCids(t, rand.New(rand.NewSource(1413)), 1)[0]
+	has, err := subject.Has(ctx, absent)
+	require.NoError(t, err)
+	require.False(t, has)
+	_, err = subject.Get(ctx, absent)
+	require.True(t, format.IsNotFound(err))
+	require.Equal(t, errReadOnlyBlockstore, subject.DeleteBlock(ctx, wantCids[0]))
+
+	// Assert that blocks of removed context IDs are no longer served.
+	mockEng.EXPECT().NotifyRemove(ctx, peer.ID(""), carContextID)
+	_, err = cs.Remove(ctx, carContextID)
+	require.NoError(t, err)
+	has, err = subject.Has(ctx, wantCids[0])
+	require.NoError(t, err)
+	require.False(t, has)
+}
+
+// locateCountingCarSupplier is a CarSupplier that counts the number of times it is asked to locate
+// blocks.
+type locateCountingCarSupplier struct {
+	*CarSupplier
+	locates int
+}
+
+func (s *locateCountingCarSupplier) Locate(ctx context.Context, mh multihash.Multihash) ([][]byte, error) {
+	s.locates++
+	return s.CarSupplier.Locate(ctx, mh)
+}
+
+func TestRegistryBlockstoreLocatesViaLocalIndex(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	eng, err := engine.New(engine.WithLocalIndex(true))
+	require.NoError(t, err)
+	require.NoError(t, eng.Start(ctx))
+	defer eng.Shutdown()
+
+	reg := NewRegistry(eng)
+	cs := &locateCountingCarSupplier{CarSupplier: NewCarSupplier(reg.Engine(), dssync.MutexWrap(datastore.NewMapDatastore()))}
+	require.NoError(t, reg.Register(CarSupplierName, cs))
+	subject := reg.Blockstore()
+
+	contextID := []byte("applesauce")
+	_, err = cs.Put(ctx, contextID, "../testdata/sample-v1.car", metadata.Default.New(metadata.Bitswap{}))
+	require.NoError(t, err)
+
+	mhs := readCarMultihashes(t, "../testdata/sample-v1.car")
+	require.NotEmpty(t, mhs)
+	for _, mh := range mhs {
+		blk, err := subject.Get(ctx, cid.NewCidV1(cid.Raw, mh))
+		require.NoError(t, err)
+		require.Equal(t, mh, blk.Cid().Hash())
+	}
+	// Assert that blocks are located via the local index, and the blockstore of the CAR is kept
+	// open across requests.
+	require.Zero(t, cs.locates)
+	require.Equal(t, 1, cs.blockstoreCache.Len())
+
+	// Assert that blocks of removed context IDs are no longer served, and their blockstores are
+	// closed.
+	_, err = cs.Remove(ctx, contextID)
+	require.NoError(t, err)
+	has, err := subject.Has(ctx, cid.NewCidV1(cid.Raw, mhs[0]))
+	require.NoError(t, err)
+	require.False(t, has)
+	require.Zero(t, cs.blockstoreCache.Len())
+}
+
+func TestRegistryBlockstoreLocatesContentAdvertisedBeforeLocalIndex(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	engDs := dssync.MutexWrap(datastore.NewMapDatastore())
+	csDs := dssync.MutexWrap(datastore.NewMapDatastore())
+
+	// Advertise content with the local index disabled.
+	eng, err := engine.New(engine.WithDatastore(engDs))
+	require.NoError(t, err)
+	require.NoError(t, eng.Start(ctx))
+	reg := NewRegistry(eng)
+	cs := NewCarSupplier(reg.Engine(), csDs)
+	require.NoError(t, reg.Register(CarSupplierName, cs))
+	_, err = cs.Put(ctx, []byte("applesauce"), "../testdata/sample-v1.car", metadata.Default.New(metadata.Bitswap{}))
+	require.NoError(t, err)
+	require.NoError(t, eng.Shutdown())
+
+	// Restart with the local index enabled, which has no records of the content advertised so far.
+	eng, err = engine.New(engine.WithDatastore(engDs), engine.WithLocalIndex(true))
+	require.NoError(t, err)
+	require.NoError(t, eng.Start(ctx))
+	defer eng.Shutdown()
+	reg = NewRegistry(eng)
+	cs2 := &locateCountingCarSupplier{CarSupplier: NewCarSupplier(reg.Engine(), csDs)}
+	require.NoError(t, reg.Register(CarSupplierName, cs2))
+	subject := reg.Blockstore()
+
+	mhs := readCarMultihashes(t, "../testdata/sample-v1.car")
+	require.NotEmpty(t, mhs)
+	records, err := eng.FindLocal(ctx, mhs[0])
+	require.NoError(t, err)
+	require.Empty(t, records)
+	for _, mh := range mhs {
+		blk, err := subject.Get(ctx, cid.NewCidV1(cid.Raw, mh))
+		require.NoError(t, err)
+		require.Equal(t, mh, blk.Cid().Hash())
+	}
+	require.Equal(t, len(mhs), cs2.locates)
+}
+
+func drainMultihashes(t *testing.T, mhi provider.MultihashIterator) []multihash.Multihash {
+	var mhs []multihash.Multihash
+	for {
+		mh, err := mhi.Next()
+		if err == io.EOF {
+			return mhs
+		}
+		require.NoError(t, err)
+		mhs = append(mhs, mh)
+	}
+}
@@ -0,0 +1,114 @@
+package supplier
+
+import (
+	"context"
+
+	"github.com/hashicorp/go-multierror"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	format "github.com/ipfs/go-ipld-format"
+)
+
+var _ ClosableBlockstore = (unionBlockstore)(nil)
+
+// unionBlockstore is a read-only blockstore that serves the blocks of a set of blockstores, e.g.
+// the shards of a context ID that spans multiple CARs. Blocks are looked up in each blockstore in
+// order, and the first one found is returned.
+type unionBlockstore []ClosableBlockstore
+
+func (u unionBlockstore) Has(ctx context.Context, c cid.Cid) (bool, error) {
+	for _, bs := range u {
+		has, err := bs.Has(ctx, c)
+		if err != nil {
+			return false, err
+		}
+		if has {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (u unionBlockstore) Get(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	for _, bs := range u {
+		blk, err := bs.Get(ctx, c)
+		if format.IsNotFound(err) {
+			continue
+		}
+		return blk, err
+	}
+	return nil, format.ErrNotFound{Cid: c}
+}
+
+func (u unionBlockstore) GetSize(ctx context.Context, c cid.Cid) (int, error) {
+	for _, bs := range u {
+		size, err := bs.GetSize(ctx, c)
+		if format.IsNotFound(err) {
+			continue
+		}
+		return size, err
+	}
+	return -1, format.ErrNotFound{Cid: c}
+}
+
+// AllKeysChan returns the keys of all blockstores, listing each key only once even if it is
+// present in more than one blockstore.
+func (u unionBlockstore) AllKeysChan(ctx context.Context) (<-chan cid.Cid, error) {
+	chans := make([]<-chan cid.Cid, 0, len(u))
+	for _, bs := range u {
+		ch, err := bs.AllKeysChan(ctx)
+		if err != nil {
+			return nil, err
+		}
+		chans = append(chans, ch)
+	}
+
+	out := make(chan cid.Cid)
+	go func() {
+		defer close(out)
+		seen := make(map[string]struct{})
+		for _, ch := range chans {
+			for c := range ch {
+				if _, ok := seen[c.KeyString()]; ok {
+					continue
+				}
+				seen[c.KeyString()] = struct{}{}
+				select {
+				case out <- c:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (u unionBlockstore) HashOnRead(enabled bool) {
+	for _, bs := range u {
+		bs.HashOnRead(enabled)
+	}
+}
+
+func (unionBlockstore) Put(context.Context, blocks.Block) error {
+	return errReadOnlyBlockstore
+}
+
+func (unionBlockstore) PutMany(context.Context, []blocks.Block) error {
+	return errReadOnlyBlockstore
+}
+
+func (unionBlockstore) DeleteBlock(context.Context, cid.Cid) error {
+	return errReadOnlyBlockstore
+}
+
+// Close closes all blockstores.
+func (u unionBlockstore) Close() error {
+	var errs error
+	for _, bs := range u {
+		if err := bs.Close(); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	return errs
+}
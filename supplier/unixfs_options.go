@@ -0,0 +1,44 @@
+package supplier
+
+import (
+	"bytes"
+	"fmt"
+
+	chunk "github.com/ipfs/go-ipfs-chunker"
+)
+
+const defaultUnixFSChunker = "size-262144"
+
+type (
+	// UnixFSOption captures a configurable parameter of UnixFSSupplier.
+	UnixFSOption func(*unixFSOptions) error
+
+	unixFSOptions struct {
+		chunker string
+	}
+)
+
+func newUnixFSOptions(o ...UnixFSOption) (*unixFSOptions, error) {
+	opts := &unixFSOptions{
+		chunker: defaultUnixFSChunker,
+	}
+	for _, apply := range o {
+		if err := apply(opts); err != nil {
+			return nil, err
+		}
+	}
+	return opts, nil
+}
+
+// WithChunker sets the chunker used to split the content of files into blocks, in the format
+// accepted by go-ipfs-chunker, e.g. "size-1048576" or "rabin-262144-524288-1048576".
+// If unset, files are split into blocks of 256 KiB.
+func WithChunker(chunker string) UnixFSOption {
+	return func(o *unixFSOptions) error {
+		if _, err := chunk.FromString(bytes.NewReader(nil), chunker); err != nil {
+			return fmt.Errorf("invalid chunker %q: %w", chunker, err)
+		}
+		o.chunker = chunker
+		return nil
+	}
+}
@@ -0,0 +1,413 @@
+package supplier
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	provider "github.com/filecoin-project/index-provider"
+	"github.com/filecoin-project/index-provider/metadata"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	"github.com/ipfs/go-datastore/namespace"
+	"github.com/ipfs/go-datastore/query"
+	"github.com/ipfs/go-graphsync/storeutil"
+	bstore "github.com/ipfs/go-ipfs-blockstore"
+	dshelp "github.com/ipfs/go-ipfs-ds-help"
+	"github.com/ipfs/go-unixfsnode/data/builder"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multihash"
+)
+
+const (
+	unixFSSupplierDatastorePrefix = "unixfs_supplier://"
+	unixFSRootKeyPrefix           = unixFSSupplierDatastorePrefix + "root/"
+	unixFSBlocksKeyPrefix         = unixFSSupplierDatastorePrefix + "blocks/"
+)
+
+var errReadOnlyBlockstore = errors.New("blockstore is read-only")
+
+// UnixFSSupplier supplies multihashes to an implementation of Provider.Interface via
+// provider.MultihashLister. It allows the users to advertise plain files and directories by simply
+// calling UnixFSSupplier.Put and UnixFSSupplier.Remove, without having to convert them to CAR
+// files first.
+//
+// Upon UnixFSSupplier.Put, the file or directory is imported as a UnixFS DAG of dag-pb nodes and
+// raw leaves, and its blocks are stored in a blockstore managed by the supplier. The blocks of each
+// context ID are stored separately, so that removing one context ID never affects the content of
+// another. The blocks can be served to retrieval clients via UnixFSSupplier.ReadOnlyBlockstore,
+// e.g. as the cardatatransfer.BlockStoreSupplier.
+//
+// See: engine.New, UnixFSSupplier.Put, UnixFSSupplier.Remove.
+type UnixFSSupplier struct {
+	*unixFSOptions
+	eng provider.Interface
+	ds  datastore.Batching
+}
+
+// unixFSEntry is the persisted state of a file or directory imported by UnixFSSupplier.
+type unixFSEntry struct {
+	Path string  `json:"path"`
+	Root cid.Cid `json:"root"`
+}
+
+// NewUnixFSSupplier instantiates a new UnixFSSupplier that stores the imported blocks in the
+// given datastore, and registers it as the provider.MultihashLister of the given
+// provider.Interface. To supply content alongside other suppliers, instantiate it with
+// Registry.Engine instead.
+func NewUnixFSSupplier(eng provider.Interface, ds datastore.Batching, o ...UnixFSOption) (*UnixFSSupplier, error) {
+	opts, err := newUnixFSOptions(o...)
+	if err != nil {
+		return nil, err
+	}
+	us := &UnixFSSupplier{
+		unixFSOptions: opts,
+		eng:           eng,
+		ds:            ds,
+	}
+	eng.RegisterMultihashLister(us.ListMultihashes)
+	return us, nil
+}
+
+// Put imports the file or directory at the given path as a UnixFS DAG, and advertises the
+// multihashes of its blocks under the given context ID with the given metadata. Directories are
+// imported recursively, and symbolic links are imported as such rather than followed.
+//
+// If the given context ID is already imported, provider.ErrAlreadyAdvertised is returned; the
+// context ID must be removed first in order to import different content under it.
+func (us *UnixFSSupplier) Put(ctx context.Context, contextID []byte, path string, md metadata.Metadata) (cid.Cid, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return cid.Undef, err
+	}
+	rootKey := toUnixFSRootKey(contextID)
+	has, err := us.ds.Has(ctx, rootKey)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if has {
+		return cid.Undef, provider.ErrAlreadyAdvertised
+	}
+
+	root, err := us.importPath(ctx, contextID, path)
+	if err != nil {
+		return cid.Undef, us.abortPut(ctx, contextID, fmt.Errorf("failed to import %s: %w", path, err))
+	}
+	log.Infow("Imported UnixFS DAG", "path", path, "root", root)
+
+	entry, err := json.Marshal(unixFSEntry{Path: path, Root: root})
+	if err != nil {
+		return cid.Undef, us.abortPut(ctx, contextID, err)
+	}
+	if err := us.ds.Put(ctx, rootKey, entry); err != nil {
+		return cid.Undef, us.abortPut(ctx, contextID, err)
+	}
+
+	adCid, err := us.eng.NotifyPut(ctx, nil, contextID, md)
+	if err != nil {
+		return cid.Undef, us.abortPut(ctx, contextID, err)
+	}
+	return adCid, nil
+}
+
+// abortPut discards the state of a failed put for the given context ID, and returns the given
+// error that caused the failure.
+func (us *UnixFSSupplier) abortPut(ctx context.Context, contextID []byte, cause error) error {
+	if err := us.ds.Delete(ctx, toUnixFSRootKey(contextID)); err != nil {
+		log.Errorw("Failed to delete UnixFS root after failed import", "err", err)
+	}
+	if err := us.deleteBlocks(ctx, contextID); err != nil {
+		log.Errorw("Failed to delete UnixFS blocks after failed import", "err", err)
+	}
+	return cause
+}
+
+func (us *UnixFSSupplier) importPath(ctx context.Context, contextID []byte, path string) (cid.Cid, error) {
+	lsys := storeutil.LinkSystemForBlockstore(us.blockstore(contextID))
+	lnk, _, err := us.buildUnixFS(ctx, path, &lsys)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return lnk.(cidlink.Link).Cid, nil
+}
+
+// buildUnixFS recursively builds the UnixFS DAG of the file or directory at the given path, and
+// returns the link to its root along with its cumulative size.
+//
+// Unlike builder.BuildUnixFSRecursive, it chunks files with the configured chunker and stops as
+// soon as the given context is done.
+func (us *UnixFSSupplier) buildUnixFS(ctx context.Context, path string, lsys *ipld.LinkSystem) (ipld.Link, uint64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	mode := info.Mode()
+	switch {
+	case mode.IsDir():
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		links := make([]dagpb.PBLink, 0, len(entries))
+		for _, e := range entries {
+			lnk, size, err := us.buildUnixFS(ctx, filepath.Join(path, e.Name()), lsys)
+			if err != nil {
+				return nil, 0, err
+			}
+			entry, err := builder.BuildUnixFSDirectoryEntry(e.Name(), int64(size), lnk)
+			if err != nil {
+				return nil, 0, err
+			}
+			links = append(links, entry)
+		}
+		return builder.BuildUnixFSDirectory(links, lsys)
+	case mode.Type() == fs.ModeSymlink:
+		target, err := os.Readlink(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		return builder.BuildUnixFSSymlink(target, lsys)
+	case mode.IsRegular():
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer f.Close()
+		return builder.BuildUnixFSFile(f, us.chunker, lsys)
+	default:
+		return nil, 0, fmt.Errorf("unsupported file type %s: %s", mode.Type(), path)
+	}
+}
+
+// Remove removes the content imported under the given context ID, and advertises its removal.
+// ErrNotFound is returned if no content is imported under the context ID.
+func (us *UnixFSSupplier) Remove(ctx context.Context, contextID []byte) (cid.Cid, error) {
+	rootKey := toUnixFSRootKey(contextID)
+	has, err := us.ds.Has(ctx, rootKey)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if !has {
+		return cid.Undef, ErrNotFound
+	}
+	if err := us.ds.Delete(ctx, rootKey); err != nil {
+		return cid.Undef, err
+	}
+	if err := us.deleteBlocks(ctx, contextID); err != nil {
+		return cid.Undef, err
+	}
+	return us.eng.NotifyRemove(ctx, "", contextID)
+}
+
+// List lists the paths of the files and directories that are supplied by this supplier.
+//
+// See: UnixFSSupplier.Put
+func (us *UnixFSSupplier) List(ctx context.Context) ([]string, error) {
+	results, err := us.ds.Query(ctx, query.Query{Prefix: unixFSRootKeyPrefix})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	var paths []string
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		var entry unixFSEntry
+		if err := json.Unmarshal(r.Value, &entry); err != nil {
+			return nil, err
+		}
+		paths = append(paths, entry.Path)
+	}
+	return paths, nil
+}
+
+// Root returns the CID of the root of the UnixFS DAG imported under the given context ID.
+// ErrNotFound is returned if no content is imported under the context ID.
+func (us *UnixFSSupplier) Root(ctx context.Context, contextID []byte) (cid.Cid, error) {
+	entry, err := us.getEntry(ctx, contextID)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return entry.Root, nil
+}
+
+func (us *UnixFSSupplier) getEntry(ctx context.Context, contextID []byte) (unixFSEntry, error) {
+	var entry unixFSEntry
+	b, err := us.ds.Get(ctx, toUnixFSRootKey(contextID))
+	if err != nil {
+		if err == datastore.ErrNotFound {
+			err = ErrNotFound
+		}
+		return entry, err
+	}
+	err = json.Unmarshal(b, &entry)
+	return entry, err
+}
+
+// ListMultihashes supplies an iterator over the multihashes of the blocks imported under the
+// given context ID. An error is returned if no content is imported under the context ID.
+func (us *UnixFSSupplier) ListMultihashes(ctx context.Context, p peer.ID, contextID []byte) (provider.MultihashIterator, error) {
+	if _, err := us.getEntry(ctx, contextID); err != nil {
+		return nil, err
+	}
+	results, err := us.blocksDatastore(contextID).Query(ctx, query.Query{
+		Prefix:   bstore.BlockPrefix.String(),
+		KeysOnly: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &blocksMultihashIterator{results: results}, nil
+}
+
+// blocksMultihashIterator iterates over the multihashes of the blocks returned by a keys-only
+// query of a blockstore datastore, reading the query results as it goes so that the multihashes
+// are never held in memory at once. The results are closed once exhausted or failed, or when the
+// iterator is closed.
+type blocksMultihashIterator struct {
+	results query.Results
+	done    bool
+}
+
+func (it *blocksMultihashIterator) Next() (multihash.Multihash, error) {
+	if it.done {
+		return nil, io.EOF
+	}
+	r, ok := it.results.NextSync()
+	if !ok {
+		return nil, it.finish(io.EOF)
+	}
+	if r.Error != nil {
+		return nil, it.finish(r.Error)
+	}
+	mh, err := dshelp.DsKeyToMultihash(datastore.NewKey(datastore.RawKey(r.Key).BaseNamespace()))
+	if err != nil {
+		return nil, it.finish(err)
+	}
+	return mh, nil
+}
+
+// finish closes the query results, and returns the given error or any error that occurs when
+// closing the results.
+func (it *blocksMultihashIterator) finish(err error) error {
+	it.done = true
+	if cerr := it.results.Close(); cerr != nil && err == io.EOF {
+		return cerr
+	}
+	return err
+}
+
+// Close closes the query results, which is only necessary if the iterator is not exhausted.
+func (it *blocksMultihashIterator) Close() error {
+	if it.done {
+		return nil
+	}
+	it.done = true
+	return it.results.Close()
+}
+
+// ReadOnlyBlockstore returns a read-only blockstore of the blocks imported under the given
+// context ID.
+func (us *UnixFSSupplier) ReadOnlyBlockstore(contextID []byte) (ClosableBlockstore, error) {
+	if _, err := us.getEntry(context.TODO(), contextID); err != nil {
+		return nil, err
+	}
+	return readOnlyBlockstore{us.blockstore(contextID)}, nil
+}
+
+// Locate returns the context IDs under which the block with the given multihash is imported.
+func (us *UnixFSSupplier) Locate(ctx context.Context, mh multihash.Multihash) ([][]byte, error) {
+	results, err := us.ds.Query(ctx, query.Query{Prefix: unixFSRootKeyPrefix, KeysOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer results.Close()
+
+	key := cid.NewCidV1(cid.Raw, mh)
+	var contextIDs [][]byte
+	for r := range results.Next() {
+		if r.Error != nil {
+			return nil, r.Error
+		}
+		contextID, err := hex.DecodeString(datastore.RawKey(r.Key).BaseNamespace())
+		if err != nil {
+			return nil, err
+		}
+		has, err := us.blockstore(contextID).Has(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if has {
+			contextIDs = append(contextIDs, contextID)
+		}
+	}
+	return contextIDs, nil
+}
+
+func (us *UnixFSSupplier) blocksDatastore(contextID []byte) datastore.Batching {
+	return namespace.Wrap(us.ds, datastore.NewKey(unixFSBlocksKeyPrefix+hex.EncodeToString(contextID)))
+}
+
+func (us *UnixFSSupplier) blockstore(contextID []byte) bstore.Blockstore {
+	return bstore.NewBlockstore(us.blocksDatastore(contextID))
+}
+
+func (us *UnixFSSupplier) deleteBlocks(ctx context.Context, contextID []byte) error {
+	bds := us.blocksDatastore(contextID)
+	results, err := bds.Query(ctx, query.Query{KeysOnly: true})
+	if err != nil {
+		return err
+	}
+	defer results.Close()
+
+	batch, err := bds.Batch(ctx)
+	if err != nil {
+		return err
+	}
+	for r := range results.Next() {
+		if r.Error != nil {
+			return r.Error
+		}
+		if err := batch.Delete(ctx, datastore.RawKey(r.Key)); err != nil {
+			return err
+		}
+	}
+	return batch.Commit(ctx)
+}
+
+func toUnixFSRootKey(contextID []byte) datastore.Key {
+	return datastore.NewKey(unixFSRootKeyPrefix + hex.EncodeToString(contextID))
+}
+
+// Close permanently closes this supplier.
+// After calling Close this supplier is no longer usable.
+func (us *UnixFSSupplier) Close() error {
+	return us.ds.Close()
+}
+
+// readOnlyBlockstore wraps a blockstore, rejecting any modification to it.
+type readOnlyBlockstore struct {
+	bstore.Blockstore
+}
+
+func (readOnlyBlockstore) DeleteBlock(context.Context, cid.Cid) error { return errReadOnlyBlockstore }
+func (readOnlyBlockstore) Put(context.Context, blocks.Block) error    { return errReadOnlyBlockstore }
+func (readOnlyBlockstore) PutMany(context.Context, []blocks.Block) error {
+	return errReadOnlyBlockstore
+}
+func (readOnlyBlockstore) Close() error { return nil }
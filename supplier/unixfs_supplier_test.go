@@ -0,0 +1,200 @@
+package supplier
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	provider "github.com/filecoin-project/index-provider"
+	"github.com/filecoin-project/index-provider/metadata"
+	mock_provider "github.com/filecoin-project/index-provider/mock"
+	"github.com/filecoin-project/index-provider/testutil"
+	"github.com/golang/mock/gomock"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-datastore"
+	dssync "github.com/ipfs/go-datastore/sync"
+	"github.com/ipfs/go-graphsync/storeutil"
+	"github.com/ipfs/go-unixfsnode/file"
+	dagpb "github.com/ipld/go-codec-dagpb"
+	"github.com/ipld/go-ipld-prime"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	"github.com/libp2p/go-libp2p/core/peer"
+	"github.com/multiformats/go-multicodec"
+	"github.com/multiformats/go-multihash"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnixFSSupplier_PutListsAndServesBlocks(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	rng := rand.New(rand.NewSource(1413))
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	subject, err := NewUnixFSSupplier(mockEng, ds, WithChunker("size-1024"))
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	fish := []byte("lobster")
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "fish.txt"), fish, 0666))
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "sub"), 0777))
+	data := make([]byte, 10*1024+1)
+	rng.Read(data)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "sub", "data.bin"), data, 0666))
+
+	contextID := []byte("applesauce")
+	md := metadata.Default.New(metadata.Bitswap{})
+	wantAdCid, err := cid.Decode("bafkqaaa")
+	require.NoError(t, err)
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(contextID), gomock.Eq(md)).Return(wantAdCid, nil)
+	gotAdCid, err := subject.Put(ctx, contextID, dir, md)
+	require.NoError(t, err)
+	require.Equal(t, wantAdCid, gotAdCid)
+
+	// Reimporting under the same context ID is rejected.
+	_, err = subject.Put(ctx, contextID, dir, md)
+	require.Equal(t, provider.ErrAlreadyAdvertised, err)
+
+	gotPaths, err := subject.List(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{dir}, gotPaths)
+
+	root, err := subject.Root(ctx, contextID)
+	require.NoError(t, err)
+	require.Equal(t, uint64(multicodec.DagPb), root.Prefix().Codec)
+
+	bs, err := subject.ReadOnlyBlockstore(contextID)
+	require.NoError(t, err)
+	defer bs.Close()
+	require.Error(t, bs.DeleteBlock(ctx, root))
+
+	// Assert that every listed multihash is served by the blockstore, and that the listed
+	// multihashes are exactly those of the blocks.
+	mhIter, err := subject.ListMultihashes(ctx, "", contextID)
+	require.NoError(t, err)
+	var gotMhs []multihash.Multihash
+	for {
+		mh, err := mhIter.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		has, err := bs.Has(ctx, cid.NewCidV1(cid.Raw, mh))
+		require.NoError(t, err)
+		require.True(t, has)
+		gotMhs = append(gotMhs, mh)
+	}
+	_, err = mhIter.Next()
+	require.Equal(t, io.EOF, err)
+
+	// Assert that an iterator that is not exhausted can be closed.
+	mhIter, err = subject.ListMultihashes(ctx, "", contextID)
+	require.NoError(t, err)
+	_, err = mhIter.Next()
+	require.NoError(t, err)
+	require.Implements(t, (*io.Closer)(nil), mhIter)
+	require.NoError(t, mhIter.(io.Closer).Close())
+	_, err = mhIter.Next()
+	require.Equal(t, io.EOF, err)
+	// One directory node per directory, one node for fish.txt and a root node with 11 leaves
+	// for data.bin.
+	require.Len(t, gotMhs, 2+1+1+11)
+	require.Equal(t, len(gotMhs), testutil.GetBstoreLen(ctx, t, bs))
+
+	// Assert that the imported files can be read back from the served blocks.
+	lsys := storeutil.LinkSystemForBlockstore(bs)
+	dirNode := loadPBNode(t, lsys, root)
+	require.Equal(t, fish, readUnixFSFile(t, ctx, lsys, findPBLink(t, dirNode, "fish.txt")))
+	subNode := loadPBNode(t, lsys, findPBLink(t, dirNode, "sub"))
+	require.Equal(t, data, readUnixFSFile(t, ctx, lsys, findPBLink(t, subNode, "data.bin")))
+
+	mockEng.EXPECT().NotifyRemove(gomock.Any(), gomock.Eq(peer.ID("")), gomock.Eq(contextID))
+	_, err = subject.Remove(ctx, contextID)
+	require.NoError(t, err)
+
+	// Assert that the removed content is no longer supplied.
+	_, err = subject.Remove(ctx, contextID)
+	require.Equal(t, ErrNotFound, err)
+	_, err = subject.ListMultihashes(ctx, "", contextID)
+	require.Equal(t, ErrNotFound, err)
+	_, err = subject.ReadOnlyBlockstore(contextID)
+	require.Equal(t, ErrNotFound, err)
+	gotPaths, err = subject.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, gotPaths)
+	require.Zero(t, testutil.GetBstoreLen(ctx, t, subject.blockstore(contextID)))
+}
+
+func TestUnixFSSupplier_FailedPutIsDiscarded(t *testing.T) {
+	ctx := testutil.ContextWithTimeout(t)
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	mockEng.EXPECT().RegisterMultihashLister(gomock.Any())
+	ds := dssync.MutexWrap(datastore.NewMapDatastore())
+	subject, err := NewUnixFSSupplier(mockEng, ds)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "fish.txt")
+	require.NoError(t, os.WriteFile(path, []byte("lobster"), 0666))
+	contextID := []byte("applesauce")
+	md := metadata.Default.New(metadata.Bitswap{})
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(contextID), gomock.Eq(md)).Return(cid.Undef, context.Canceled)
+	_, err = subject.Put(ctx, contextID, path, md)
+	require.Equal(t, context.Canceled, err)
+
+	gotPaths, err := subject.List(ctx)
+	require.NoError(t, err)
+	require.Empty(t, gotPaths)
+	require.Zero(t, testutil.GetBstoreLen(ctx, t, subject.blockstore(contextID)))
+
+	// Assert that the failed import can be retried.
+	mockEng.EXPECT().NotifyPut(gomock.Any(), gomock.Nil(), gomock.Eq(contextID), gomock.Eq(md))
+	_, err = subject.Put(ctx, contextID, path, md)
+	require.NoError(t, err)
+}
+
+func TestUnixFSSupplier_InvalidChunker(t *testing.T) {
+	mc := gomock.NewController(t)
+	mockEng := mock_provider.NewMockInterface(mc)
+	_, err := NewUnixFSSupplier(mockEng, datastore.NewMapDatastore(), WithChunker("fish"))
+	require.ErrorContains(t, err, "invalid chunker")
+}
+
+func loadPBNode(t *testing.T, lsys ipld.LinkSystem, c cid.Cid) dagpb.PBNode {
+	n, err := lsys.Load(ipld.LinkContext{}, cidlink.Link{Cid: c}, dagpb.Type.PBNode)
+	require.NoError(t, err)
+	return n.(dagpb.PBNode)
+}
+
+func findPBLink(t *testing.T, n dagpb.PBNode, name string) cid.Cid {
+	links := n.FieldLinks().Iterator()
+	for !links.Done() {
+		_, l := links.Next()
+		if l.FieldName().Exists() && l.FieldName().Must().String() == name {
+			return l.FieldHash().Link().(cidlink.Link).Cid
+		}
+	}
+	require.FailNow(t, "link not found", name)
+	return cid.Undef
+}
+
+func readUnixFSFile(t *testing.T, ctx context.Context, lsys ipld.LinkSystem, c cid.Cid) []byte {
+	if c.Prefix().Codec == cid.Raw {
+		var buf bytes.Buffer
+		r, err := lsys.StorageReadOpener(ipld.LinkContext{Ctx: ctx}, cidlink.Link{Cid: c})
+		require.NoError(t, err)
+		_, err = buf.ReadFrom(r)
+		require.NoError(t, err)
+		return buf.Bytes()
+	}
+	n := loadPBNode(t, lsys, c)
+	f, err := file.NewUnixFSFile(ctx, n, &lsys)
+	require.NoError(t, err)
+	b, err := f.AsBytes()
+	require.NoError(t, err)
+	return b
+}